@@ -0,0 +1,86 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// Future is the pending result of an asynchronous lookup.
+type Future struct {
+	done chan struct{}
+	ips  []net.IPAddr
+	err  error
+}
+
+// Done is closed once the result is there.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result waits for the lookup and returns its outcome, it may be called any
+// number of times from any goroutine.
+func (f *Future) Result() ([]net.IPAddr, error) {
+	<-f.done
+
+	return append([]net.IPAddr(nil), f.ips...), f.err
+}
+
+// flights are the asynchronous lookups under way, by name.
+type flights struct {
+	calls map[string]*Future
+	mu    sync.Mutex
+}
+
+// LookupIPAddrAsync starts looking up host and returns at once. Lookups of
+// the same host started while one is under way wait for that one instead of
+// sending queries of their own. Once ctx is done the future fails with
+// ctx.Err(), the shared lookup goes on for the other callers.
+func (r *Resolver) LookupIPAddrAsync(ctx context.Context, host string) *Future {
+	call := r.flight(nameKey(host))
+	if ctx.Done() == nil {
+		return call
+	}
+
+	f := &Future{done: make(chan struct{})}
+	go func() {
+		select {
+		case <-call.done:
+			f.ips, f.err = call.ips, call.err
+		case <-ctx.Done():
+			f.err = ctx.Err()
+		}
+		close(f.done)
+	}()
+
+	return f
+}
+
+// flight returns the lookup of host under way, starting one when there is
+// none.
+func (r *Resolver) flight(host string) *Future {
+	fl := r.flights
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	if call, ok := fl.calls[host]; ok {
+		return call
+	}
+
+	call := &Future{done: make(chan struct{})}
+	if fl.calls == nil {
+		fl.calls = make(map[string]*Future)
+	}
+	fl.calls[host] = call
+
+	go func() {
+		call.ips, call.err = r.LookupIPAddr(host)
+
+		fl.mu.Lock()
+		delete(fl.calls, host)
+		fl.mu.Unlock()
+		close(call.done)
+	}()
+
+	return call
+}
@@ -0,0 +1,73 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLookupIPAddrAsync(t *testing.T) {
+	zone := answerA(map[string]string{`hot.example.com`: `192.0.2.1`})
+	server := newTestServer(t, func(q Question, resp *Message) {
+		time.Sleep(time.Millisecond * 20)
+		zone(q, resp)
+	})
+
+	r := New()
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	futures := make([]*Future, 1000)
+	for i := range futures {
+		futures[i] = r.LookupIPAddrAsync(context.Background(), `hot.example.com`)
+	}
+
+	var wg sync.WaitGroup
+	for _, f := range futures {
+		wg.Add(1)
+		go func(f *Future) {
+			defer wg.Done()
+
+			<-f.Done()
+			ips, err := f.Result()
+			if err != nil || len(ips) != 1 || !ips[0].IP.Equal(net.ParseIP(`192.0.2.1`)) {
+				t.Errorf(`unexpected result %v %v`, ips, err)
+			}
+		}(f)
+	}
+	wg.Wait()
+
+	if st := r.Stats(); st.Lookups != 1 {
+		t.Errorf(`expected the futures to share one lookup, got %d`, st.Lookups)
+	}
+}
+
+func TestLookupIPAddrAsyncCancel(t *testing.T) {
+	server := newTestServer(t, func(q Question, resp *Message) {
+		time.Sleep(time.Millisecond * 50)
+		resp.Rcode = RcodeNameError
+	})
+
+	r := New()
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := r.LookupIPAddrAsync(ctx, `slow.example.com`)
+	other := r.LookupIPAddrAsync(context.Background(), `slow.example.com`)
+	cancel()
+
+	select {
+	case <-canceled.Done():
+	case <-time.After(time.Second):
+		t.Fatal(`canceled future never done`)
+	}
+	if _, err := canceled.Result(); !errors.Is(err, context.Canceled) {
+		t.Errorf(`expected context.Canceled, got %v`, err)
+	}
+	if _, err := other.Result(); !errors.Is(err, ErrNoSuchHost) {
+		t.Errorf(`expected the shared lookup to go on, got %v`, err)
+	}
+}
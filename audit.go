@@ -0,0 +1,194 @@
+package resolver
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// AuditAnswer is what one server answered for an audited name.
+type AuditAnswer struct {
+	Server string
+	Rcode  int
+	Addrs  []net.IP
+	CNAMEs []string
+}
+
+// AnswerComparator decides whether two servers agree on a name.
+type AnswerComparator interface {
+	Agree(a, b AuditAnswer) bool
+}
+
+// DefaultComparator agrees when both servers either have addresses or have
+// none, and any CNAME chains they both return end in the same registrable
+// domain. Exact addresses are not compared, load balanced names with short
+// TTLs answer differently from one query to the next.
+type DefaultComparator struct{}
+
+func (DefaultComparator) Agree(a, b AuditAnswer) bool {
+	if (len(a.Addrs) > 0) != (len(b.Addrs) > 0) {
+		return false
+	}
+	if (a.Rcode == RcodeNameError) != (b.Rcode == RcodeNameError) {
+		return false
+	}
+
+	if len(a.CNAMEs) > 0 && len(b.CNAMEs) > 0 {
+		return registrableDomain(a.CNAMEs[len(a.CNAMEs)-1]) == registrableDomain(b.CNAMEs[len(b.CNAMEs)-1])
+	}
+
+	return true
+}
+
+// ServerAudit is the record of a server in the answer audit.
+type ServerAudit struct {
+	Addr          string
+	Audits        int
+	Disagreements int
+	Flagged       bool
+}
+
+type auditTable struct {
+	servers map[string]*ServerAudit
+	mu      sync.Mutex
+}
+
+func newAuditTable() *auditTable {
+	return &auditTable{servers: make(map[string]*ServerAudit)}
+}
+
+// record counts an audit of addr and reports whether its disagreement rate
+// crossed the threshold with it.
+func (t *auditTable) record(addr string, agree bool, s *Settings) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	a, ok := t.servers[addr]
+	if !ok {
+		a = &ServerAudit{Addr: addr}
+		t.servers[addr] = a
+	}
+
+	a.Audits++
+	if !agree {
+		a.Disagreements++
+	}
+
+	if a.Flagged || a.Audits < s.AuditMinSamples {
+		return false
+	}
+
+	a.Flagged = float64(a.Disagreements)/float64(a.Audits) > s.AuditThreshold
+	return a.Flagged
+}
+
+// AuditReport returns the audit record of every audited server.
+func (r *Resolver) AuditReport() []ServerAudit {
+	r.audits.mu.Lock()
+	defer r.audits.mu.Unlock()
+
+	list := make([]ServerAudit, 0, len(r.audits.servers))
+	for _, a := range r.audits.servers {
+		list = append(list, *a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Addr < list[j].Addr
+	})
+
+	return list
+}
+
+// auditType returns the record type to audit a lookup with, false for the
+// lookups that are not audited.
+func auditType(qtype string) (Type, bool) {
+	switch qtype {
+	case `IP`, `A`:
+		return TypeA, true
+	case `AAAA`:
+		return TypeAAAA, true
+	}
+
+	return 0, false
+}
+
+// maybeAudit samples AuditFraction of the successful lookups for an audit
+// in the background.
+func (r *Resolver) maybeAudit(qtype, name, server string, s *Settings) {
+	if s.AuditFraction <= 0 || rand.Float64() >= s.AuditFraction {
+		return
+	}
+
+	t, ok := auditType(qtype)
+	if !ok {
+		return
+	}
+	// audits are optional, they don't wait for the rate limiter
+	if limiter := r.rateLimiter(s); limiter != nil && !limiter.Allow() {
+		return
+	}
+
+	go r.audit(name, t, server, *s)
+}
+
+// audit asks server and a second random server for name and records whether
+// they agree for both of them.
+func (r *Resolver) audit(name string, qtype Type, server string, s Settings) {
+	var others []string
+	for _, srv := range r.Servers.All() {
+		if srv.Addr != server && r.serverAllowed(srv.Addr) {
+			others = append(others, srv.Addr)
+		}
+	}
+	if len(others) == 0 {
+		return
+	}
+	other := others[rand.Intn(len(others))]
+
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	a, err := r.auditAnswer(ctx, server, name, qtype)
+	if err != nil {
+		return
+	}
+	b, err := r.auditAnswer(ctx, other, name, qtype)
+	if err != nil {
+		return
+	}
+
+	var cmp AnswerComparator = DefaultComparator{}
+	if s.AuditComparator != nil {
+		cmp = s.AuditComparator
+	}
+	agree := cmp.Agree(a, b)
+
+	for _, addr := range []string{server, other} {
+		if r.audits.record(addr, agree, &s) && s.EvictLying {
+			r.health.setLying(addr)
+			r.events.emit(EventServerEvicted, addr, `disagrees with other servers`)
+			r.checkPool(&s)
+			if s.Logger != nil {
+				s.Logger.Warn(`resolver: server evicted`, `server`, addr, `reason`, `disagrees with other servers`)
+			}
+		}
+	}
+}
+
+func (r *Resolver) auditAnswer(ctx context.Context, addr, name string, qtype Type) (AuditAnswer, error) {
+	resp, err := r.exchange(ctx, addr, newQuery(name, qtype))
+	if err != nil {
+		return AuditAnswer{}, err
+	}
+
+	a := AuditAnswer{Server: addr, Rcode: resp.Rcode, Addrs: answerIPs(resp)}
+	for _, rr := range resp.Answers {
+		if rr.Type == TypeCNAME {
+			a.CNAMEs = append(a.CNAMEs, strings.ToLower(rr.Target))
+		}
+	}
+
+	return a, nil
+}
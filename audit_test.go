@@ -0,0 +1,106 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDefaultComparator(t *testing.T) {
+	ip := []net.IP{net.ParseIP(`192.0.2.1`)}
+	other := []net.IP{net.ParseIP(`192.0.2.99`)}
+
+	tests := []struct {
+		a, b  AuditAnswer
+		agree bool
+	}{
+		{AuditAnswer{Addrs: ip}, AuditAnswer{Addrs: other}, true},
+		{AuditAnswer{Addrs: ip}, AuditAnswer{}, false},
+		{AuditAnswer{Rcode: RcodeNameError}, AuditAnswer{}, false},
+		{AuditAnswer{Addrs: ip, CNAMEs: []string{`a.cdn.example.net.`}}, AuditAnswer{Addrs: other, CNAMEs: []string{`b.edge.example.net.`}}, true},
+		{AuditAnswer{Addrs: ip, CNAMEs: []string{`d1.cloudfront.net.`}}, AuditAnswer{Addrs: ip, CNAMEs: []string{`d2.cloudfront.net.`}}, false},
+		{AuditAnswer{Addrs: ip, CNAMEs: []string{`www.example.co.uk.`}}, AuditAnswer{Addrs: ip, CNAMEs: []string{`parked.example.com.`}}, false},
+	}
+
+	for i, tt := range tests {
+		if got := (DefaultComparator{}).Agree(tt.a, tt.b); got != tt.agree {
+			t.Errorf(`%d: agree %v, want %v`, i, got, tt.agree)
+		}
+	}
+}
+
+func TestRegistrableDomain(t *testing.T) {
+	tests := map[string]string{
+		`www.example.com.`:   `example.com`,
+		`a.b.example.co.uk`:  `example.co.uk`,
+		`d1.cloudfront.net.`: `d1.cloudfront.net`,
+		`foo.github.io`:      `foo.github.io`,
+		`a.foo.github.io`:    `foo.github.io`,
+		`x.co.za`:            `x.co.za`,
+		`www.x.co.za`:        `x.co.za`,
+		`a.b.example.com.br`: `example.com.br`,
+		`github.io`:          `github.io`,
+		`com`:                `com`,
+	}
+
+	for name, want := range tests {
+		if got := registrableDomain(name); got != want {
+			t.Errorf(`%s: got %s, want %s`, name, got, want)
+		}
+	}
+}
+
+func TestAuditFlagsLyingServer(t *testing.T) {
+	zone := answerA(map[string]string{`example.com`: `192.0.2.1`})
+	liar := newTestServer(t, func(q Question, resp *Message) { resp.Rcode = RcodeNameError })
+
+	var honest []string
+	servers := liar.Addr
+	for i := 0; i < 4; i++ {
+		s := newTestServer(t, zone)
+		honest = append(honest, s.Addr)
+		servers += "\n" + s.Addr
+	}
+
+	r := New()
+	r.DialTimeout = time.Second * 2
+	r.AuditThreshold = 0.9
+	r.AuditMinSamples = 5
+	r.EvictLying = true
+	_, _ = r.LoadServersFromString(servers)
+
+	s := r.settings()
+	for i := 0; i < 60; i++ {
+		r.audit(`example.com`, TypeA, honest[i%len(honest)], s)
+	}
+
+	for _, a := range r.AuditReport() {
+		if a.Flagged != (a.Addr == liar.Addr) {
+			t.Errorf(`unexpected audit record %+v`, a)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		if _, err := r.Query(context.Background(), `example.com`, TypeA); err != nil {
+			t.Errorf(`lookup reached the evicted server: %v`, err)
+		}
+	}
+}
+
+func TestAuditSampling(t *testing.T) {
+	r := New()
+	s := r.settings()
+
+	// disabled by default, nothing is started even without servers
+	for i := 0; i < 100; i++ {
+		r.maybeAudit(`IP`, `example.com`, `10.0.0.1`, &s)
+	}
+	if len(r.AuditReport()) != 0 {
+		t.Error(`audit ran while disabled`)
+	}
+
+	if _, ok := auditType(`MX`); ok {
+		t.Error(`MX lookups should not be audited`)
+	}
+}
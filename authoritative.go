@@ -0,0 +1,62 @@
+package resolver
+
+import (
+	"context"
+)
+
+// AuthoritativeAnswer is the answer of a nameserver of the zone, see
+// LookupAuthoritative. Nameserver is its name and Addr the address asked.
+type AuthoritativeAnswer struct {
+	Message    *Message
+	Nameserver string
+	Addr       string
+}
+
+// LookupAuthoritative asks the nameservers of the registrable domain of
+// host for its records directly, past the caches of the servers of the
+// list: what a zone publishes right now. The NS records of the domain and
+// the addresses of the nameservers are looked up the normal way, then the
+// nameservers are asked in turn until one answers with authority. A
+// referral to a zone below the domain is followed the way ResolveIterative
+// does.
+//
+// A CNAME answer to a name the nameserver has no records of is chased the
+// normal way, with Query, and Nameserver is the one that answered the CNAME.
+// Every query to a nameserver is a try of the returned *LookupError and an
+// attempt of WithTrace. A name that does not exist fails with
+// ErrNoSuchHost, one without records of qtype with ErrNoData.
+func (r *Resolver) LookupAuthoritative(ctx context.Context, host string, qtype Type, opts ...LookupOption) (a *AuthoritativeAnswer, err error) {
+	it, err := r.newIteration(ctx, host, qtype, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer it.end(&err)
+	it.normal = true
+
+	host = it.err.Name
+	domain := registrableDomain(host)
+	nsList, err := r.LookupNS(domain, WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	var servers []string
+	for _, ns := range nsList {
+		ips, err := r.LookupIPAddr(ns.Host, WithContext(ctx))
+		if isCallerError(err) {
+			return nil, it.err.fail(err)
+		}
+		for _, ip := range ips {
+			servers = append(servers, it.nameserver(ns.Host, ip.IP))
+		}
+	}
+	if len(servers) == 0 {
+		return nil, it.err.fail(ErrLameDelegation)
+	}
+
+	m, err := it.walk(host, qtype, spread(servers), canonicalName(domain), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthoritativeAnswer{Message: m, Nameserver: it.hosts[it.addr], Addr: it.addr}, nil
+}
@@ -0,0 +1,77 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLookupAuthoritative(t *testing.T) {
+	a := func(name, ip string) RR { return RR{Name: name, Type: TypeA, TTL: 60, IP: net.ParseIP(ip)} }
+
+	conn, err := net.ListenPacket(`udp`, `127.0.0.3:0`)
+	if err != nil {
+		t.Skipf(`no loopback address 127.0.0.3: %v`, err)
+	}
+	_ = conn.Close()
+	auth := newTestServerAt(t, `127.0.0.3:0`, func(q Question, resp *Message) {
+		resp.Authoritative = true
+		switch q.Name {
+		case `www.example.com.`:
+			resp.Answers = []RR{a(q.Name, `192.0.2.1`)}
+		case `alias.example.com.`:
+			resp.Answers = []RR{{Name: q.Name, Type: TypeCNAME, TTL: 60, Target: `cdn.other.net.`}}
+		default:
+			resp.Rcode = RcodeNameError
+		}
+	})
+	_, port, _ := net.SplitHostPort(auth.Addr)
+	defer func(saved string) { iterativePort = saved }(iterativePort)
+	iterativePort = port
+
+	// the servers of the list still have the old address cached
+	cache := newTestServer(t, func(q Question, resp *Message) {
+		switch {
+		case q.Name == `example.com.` && q.Type == TypeNS:
+			resp.Answers = []RR{
+				{Name: q.Name, Type: TypeNS, TTL: 60, Target: `ns1.example.com.`},
+				{Name: q.Name, Type: TypeNS, TTL: 60, Target: `ns2.example.com.`},
+			}
+		case q.Name == `ns1.example.com.` && q.Type == TypeA:
+			// nothing listens there
+			resp.Answers = []RR{a(q.Name, `127.0.0.2`)}
+		case q.Name == `ns2.example.com.` && q.Type == TypeA:
+			resp.Answers = []RR{a(q.Name, `127.0.0.3`)}
+		case q.Name == `www.example.com.` && q.Type == TypeA:
+			resp.Answers = []RR{a(q.Name, `192.0.2.99`)}
+		case q.Name == `cdn.other.net.` && q.Type == TypeA:
+			resp.Answers = []RR{a(q.Name, `192.0.2.7`)}
+		}
+	})
+
+	r := New()
+	r.DialTimeout = time.Second
+	if _, err := r.LoadServersFromString(cache.Addr); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	answer, err := r.LookupAuthoritative(ctx, `www.example.com`, TypeA)
+	if err != nil || answer.Message.Answers[0].IP.String() != `192.0.2.1` {
+		t.Fatalf(`expected the address of the zone, got %+v, %v`, answer, err)
+	}
+	if answer.Nameserver != `ns2.example.com` || answer.Addr != auth.Addr {
+		t.Errorf(`expected ns2 to answer, got %s at %s`, answer.Nameserver, answer.Addr)
+	}
+
+	answer, err = r.LookupAuthoritative(ctx, `alias.example.com`, TypeA)
+	if err != nil || len(answer.Message.Answers) != 2 || answer.Message.Answers[1].IP.String() != `192.0.2.7` {
+		t.Errorf(`expected the CNAME chased through the servers, got %+v, %v`, answer, err)
+	}
+
+	if _, err := r.LookupAuthoritative(ctx, `missing.example.com`, TypeA); !errors.Is(err, ErrNoSuchHost) {
+		t.Errorf(`expected ErrNoSuchHost, got %v`, err)
+	}
+}
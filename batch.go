@@ -0,0 +1,296 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBatchConcurrency is how many lookups of a batch run at once when
+// the concurrency given is 0.
+const DefaultBatchConcurrency = 32
+
+// BatchResult is the outcome of one host of a batch.
+type BatchResult struct {
+	IPs      []net.IPAddr
+	Err      error
+	Duration time.Duration
+}
+
+// ReverseResult is the outcome of one address of a reverse batch. An
+// address without PTR records, NXDOMAIN or NODATA, is NotFound, not an
+// error.
+type ReverseResult struct {
+	IP       string
+	Names    []string
+	NotFound bool
+	Err      error
+}
+
+// BatchOption adjusts a batch of lookups.
+type BatchOption func(o *batchOptions)
+
+type batchOptions struct {
+	progress func(done, total int)
+	lookup   []LookupOption
+	shared   bool
+}
+
+// WithProgress has fn called after every lookup of the batch with how many
+// are done out of total, one call at a time.
+func WithProgress(fn func(done, total int)) BatchOption {
+	return func(o *batchOptions) {
+		o.progress = fn
+	}
+}
+
+// WithLookupOptions applies opts to every lookup of the batch.
+func WithLookupOptions(opts ...LookupOption) BatchOption {
+	return func(o *batchOptions) {
+		o.lookup = append(o.lookup, opts...)
+	}
+}
+
+func newBatchOptions(ctx context.Context, opts []BatchOption) *batchOptions {
+	o := &batchOptions{lookup: []LookupOption{WithContext(ctx)}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	// lookups with options of their own cannot share a flight
+	o.shared = len(o.lookup) == 1
+
+	return o
+}
+
+// LookupIPAddrBatch looks up hosts with up to concurrency lookups at once,
+// each distinct name once however often it is given. Without
+// WithLookupOptions a name already being looked up, by another batch or
+// LookupIPAddrAsync, shares that lookup. Every host gets its own result, a
+// failed one does not stop the others. Once ctx is done no new lookup starts
+// and the hosts left out are missing from the result.
+func (r *Resolver) LookupIPAddrBatch(ctx context.Context, hosts []string, concurrency int, opts ...BatchOption) map[string]BatchResult {
+	o := newBatchOptions(ctx, opts)
+
+	index := make(map[string]int, len(hosts))
+	var names []string
+	for _, host := range hosts {
+		key := nameKey(host)
+		if _, ok := index[key]; !ok {
+			index[key] = len(names)
+			names = append(names, key)
+		}
+	}
+
+	results := make([]BatchResult, len(names))
+	ran := make([]bool, len(names))
+	r.batch(ctx, len(names), concurrency, o.progress, func(i int) {
+		start := time.Now()
+		var ips []net.IPAddr
+		var err error
+		if o.shared {
+			ips, err = r.LookupIPAddrAsync(ctx, names[i]).Result()
+		} else {
+			ips, err = r.LookupIPAddr(names[i], o.lookup...)
+		}
+		results[i] = BatchResult{IPs: ips, Err: err, Duration: time.Since(start)}
+		ran[i] = true
+	})
+
+	m := make(map[string]BatchResult, len(hosts))
+	for _, host := range hosts {
+		if i := index[nameKey(host)]; ran[i] {
+			m[host] = results[i]
+		}
+	}
+
+	return m
+}
+
+// LookupAddrBatch looks up the names of the IPv4 and IPv6 addresses ips the
+// way LookupIPAddrBatch does hosts. The results are appended to dst[:0] in
+// the order of ips, repeated addresses share the Names of one lookup. Once
+// ctx is done the addresses left out get ctx.Err().
+func (r *Resolver) LookupAddrBatch(ctx context.Context, ips []string, concurrency int, dst []ReverseResult, opts ...BatchOption) []ReverseResult {
+	o := newBatchOptions(ctx, opts)
+
+	dst = dst[:0]
+	index := make(map[string]int, len(ips))
+	which := make([]int, len(ips)) // the distinct address of each of ips
+	var first []int                // the first of ips for each distinct address
+	for j, ip := range ips {
+		key := ip
+		if a, err := netip.ParseAddr(ip); err == nil {
+			key = a.String()
+		}
+
+		i, ok := index[key]
+		if !ok {
+			i = len(first)
+			index[key] = i
+			first = append(first, j)
+		}
+		which[j] = i
+		dst = append(dst, ReverseResult{IP: ip})
+	}
+
+	ran := make([]bool, len(first))
+	r.batch(ctx, len(first), concurrency, o.progress, func(i int) {
+		res := &dst[first[i]]
+		names, err := r.LookupAddr(res.IP, o.lookup...)
+		res.Names, res.NotFound, res.Err = names, errors.Is(err, ErrNoSuchHost) || errors.Is(err, ErrNoData), err
+		if res.NotFound {
+			res.Err = nil
+		}
+		ran[i] = true
+	})
+
+	for j := range dst {
+		i := which[j]
+		if !ran[i] {
+			dst[j].Err = ctx.Err()
+		} else if k := first[i]; k != j {
+			dst[j].Names, dst[j].NotFound, dst[j].Err = dst[k].Names, dst[k].NotFound, dst[k].Err
+		}
+	}
+
+	return dst
+}
+
+// batch calls fn for 0 to n-1 from up to concurrency goroutines, it stops
+// handing out work once ctx is done and returns when the calls made are
+// over.
+func (r *Resolver) batch(ctx context.Context, n, concurrency int, progress func(done, total int), fn func(i int)) {
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+	if concurrency > n {
+		concurrency = n
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				fn(i)
+
+				if progress != nil {
+					mu.Lock()
+					done++
+					progress(done, n)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := 0; i < n; i++ {
+		// a done ctx wins over a free worker
+		if ctx.Err() != nil {
+			break
+		}
+
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+
+	wg.Wait()
+}
+
+// StreamResult is the outcome of one host of ResolveStream.
+type StreamResult struct {
+	Host     string
+	IPs      []net.IPAddr
+	Err      error
+	Duration time.Duration
+}
+
+// ResolveStream looks up the hosts read from in with up to concurrency
+// lookups at once and writes their results to out in no particular order.
+// It returns nil once in is closed and every result is written, or
+// ctx.Err() when ctx being done left hosts unread or results unwritten.
+// Hosts are not deduplicated, out is not closed and WithProgress gets a
+// total of 0.
+func (r *Resolver) ResolveStream(ctx context.Context, in <-chan string, out chan<- StreamResult, concurrency int, opts ...BatchOption) error {
+	o := newBatchOptions(ctx, opts)
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var stopped int32
+	done := 0
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				var host string
+				var ok bool
+				select {
+				case host, ok = <-in:
+				case <-ctx.Done():
+					// a drained in was not cut short
+					select {
+					case _, ok = <-in:
+					default:
+						ok = true
+					}
+					if ok {
+						atomic.StoreInt32(&stopped, 1)
+					}
+					return
+				}
+				if !ok {
+					return
+				}
+				if ctx.Err() != nil {
+					atomic.StoreInt32(&stopped, 1)
+					return
+				}
+
+				start := time.Now()
+				ips, err := r.LookupIPAddr(host, o.lookup...)
+				res := StreamResult{Host: host, IPs: ips, Err: err, Duration: time.Since(start)}
+
+				select {
+				case out <- res:
+				case <-ctx.Done():
+					atomic.StoreInt32(&stopped, 1)
+					return
+				}
+
+				if o.progress != nil {
+					mu.Lock()
+					done++
+					o.progress(done, 0)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if atomic.LoadInt32(&stopped) != 0 {
+		return ctx.Err()
+	}
+	return nil
+}
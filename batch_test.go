@@ -0,0 +1,256 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLookupIPAddrBatch(t *testing.T) {
+	server := newTestServer(t, answerA(map[string]string{
+		`a.example.com`: `192.0.2.1`,
+		`b.example.com`: `192.0.2.2`,
+	}))
+
+	r := New()
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	var calls, last int
+	hosts := []string{`a.example.com`, `b.example.com`, `A.Example.com.`, `missing.example.com`, `a.example.com`}
+	results := r.LookupIPAddrBatch(context.Background(), hosts, 2, WithProgress(func(done, total int) {
+		calls++
+		if total != 3 || done != last+1 {
+			t.Errorf(`unexpected progress %d/%d after %d`, done, total, last)
+		}
+		last = done
+	}))
+
+	if len(results) != 4 || calls != 3 {
+		t.Fatalf(`expected 4 hosts from 3 lookups, got %d from %d`, len(results), calls)
+	}
+	if res := results[`A.Example.com.`]; res.Err != nil || len(res.IPs) != 1 || res.IPs[0].IP.String() != `192.0.2.1` {
+		t.Errorf(`unexpected result %+v`, res)
+	}
+	if res := results[`b.example.com`]; res.Err != nil || res.IPs[0].IP.String() != `192.0.2.2` {
+		t.Errorf(`unexpected result %+v`, res)
+	}
+	if res := results[`missing.example.com`]; !errors.Is(res.Err, ErrNoSuchHost) {
+		t.Errorf(`expected ErrNoSuchHost, got %v`, res.Err)
+	}
+
+	// deduplicated names are asked once
+	for _, q := range server.Queries() {
+		if q.Name != `a.example.com.` && q.Name != `b.example.com.` && q.Name != `missing.example.com.` {
+			t.Errorf(`unexpected query for %s`, q.Name)
+		}
+	}
+}
+
+func TestBatchCancel(t *testing.T) {
+	r := New()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var ran int32
+	r.batch(ctx, 100, 4, nil, func(i int) {
+		if atomic.AddInt32(&ran, 1) == 10 {
+			cancel()
+		}
+	})
+
+	// the workers busy when ctx was canceled finish their work
+	if n := atomic.LoadInt32(&ran); n < 10 || n > 14 {
+		t.Errorf(`expected the batch to stop after about 10, ran %d`, n)
+	}
+
+	results := r.LookupIPAddrBatch(ctx, []string{`example.com`}, 1)
+	if len(results) != 0 {
+		t.Errorf(`expected nothing from a canceled batch, got %v`, results)
+	}
+}
+
+func TestLookupAddrBatch(t *testing.T) {
+	server := newTestServer(t, func(q Question, resp *Message) {
+		switch q.Name {
+		case `1.2.0.192.in-addr.arpa.`:
+			resp.Answers = append(resp.Answers, RR{Name: q.Name, Type: TypePTR, TTL: 60, Target: `one.example.com.`})
+		case `1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.`:
+			resp.Answers = append(resp.Answers, RR{Name: q.Name, Type: TypePTR, TTL: 60, Target: `six.example.com.`})
+		case `2.2.0.192.in-addr.arpa.`:
+			// NODATA, the name exists without PTR records
+		default:
+			resp.Rcode = RcodeNameError
+		}
+	})
+
+	r := New()
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	dst := make([]ReverseResult, 0, 8)
+	ips := []string{`192.0.2.1`, `2001:db8::1`, `192.0.2.9`, `2001:DB8:0::1`, `192.0.2.1`, `192.0.2.2`}
+	var lookups int
+	res := r.LookupAddrBatch(context.Background(), ips, 4, dst, WithProgress(func(done, total int) { lookups = total }))
+
+	if len(res) != len(ips) || &res[0] != &dst[:1][0] {
+		t.Fatalf(`expected the results in dst, got %d`, len(res))
+	}
+	if lookups != 4 {
+		t.Errorf(`expected 4 distinct addresses, got %d`, lookups)
+	}
+	for i, want := range []string{`one.example.com`, `six.example.com`, ``, `six.example.com`, `one.example.com`, ``} {
+		if res[i].IP != ips[i] || res[i].Err != nil {
+			t.Errorf(`%s: unexpected result %+v`, ips[i], res[i])
+			continue
+		}
+		if want == `` {
+			if !res[i].NotFound || len(res[i].Names) != 0 {
+				t.Errorf(`%s: expected NotFound, got %+v`, ips[i], res[i])
+			}
+		} else if len(res[i].Names) != 1 || res[i].Names[0] != want {
+			t.Errorf(`%s: expected %s, got %v`, ips[i], want, res[i].Names)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res = r.LookupAddrBatch(ctx, ips[:1], 1, res)
+	if len(res) != 1 || !errors.Is(res[0].Err, context.Canceled) {
+		t.Errorf(`expected a canceled result, got %+v`, res)
+	}
+}
+
+func TestResolveStream(t *testing.T) {
+	zone := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		zone[fmt.Sprintf(`h%d.example.com`, i)] = fmt.Sprintf(`192.0.2.%d`, i)
+	}
+	server := newTestServer(t, answerA(zone))
+
+	r := New()
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	const n = 10000
+	in := make(chan string)
+	out := make(chan StreamResult, 16)
+	go func() {
+		for i := 0; i < n; i++ {
+			in <- fmt.Sprintf(`h%d.example.com`, i)
+		}
+		close(in)
+	}()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- r.ResolveStream(context.Background(), in, out, 64)
+		close(out)
+	}()
+
+	seen := make(map[string]bool, n)
+	for res := range out {
+		if seen[res.Host] {
+			t.Fatalf(`%s twice`, res.Host)
+		}
+		seen[res.Host] = true
+
+		ip, ok := zone[res.Host]
+		if !ok {
+			if !errors.Is(res.Err, ErrNoSuchHost) {
+				t.Errorf(`%s: expected ErrNoSuchHost, got %v`, res.Host, res.Err)
+			}
+			continue
+		}
+		if res.Err != nil || len(res.IPs) != 1 || res.IPs[0].IP.String() != ip {
+			t.Errorf(`%s: unexpected result %v %v`, res.Host, res.IPs, res.Err)
+		}
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != n {
+		t.Errorf(`expected %d results, got %d`, n, len(seen))
+	}
+}
+
+func TestResolveStreamCancel(t *testing.T) {
+	r := New()
+	_, _ = r.LoadServersFromString("10.0.0.1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan string) // never closed
+	errc := make(chan error, 1)
+	go func() { errc <- r.ResolveStream(ctx, in, make(chan StreamResult), 4) }()
+	cancel()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf(`expected context.Canceled, got %v`, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal(`stream did not stop`)
+	}
+}
+
+func TestLookupIPAddrBatchShared(t *testing.T) {
+	zone := answerA(map[string]string{`hot.example.com`: `192.0.2.1`})
+	server := newTestServer(t, func(q Question, resp *Message) {
+		time.Sleep(time.Millisecond * 20)
+		zone(q, resp)
+	})
+
+	r := New()
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	results := make(chan map[string]BatchResult, 4)
+	for i := 0; i < cap(results); i++ {
+		go func() {
+			results <- r.LookupIPAddrBatch(context.Background(), []string{`hot.example.com`, `HOT.example.com.`}, 2)
+		}()
+	}
+	for i := 0; i < cap(results); i++ {
+		res := <-results
+		if got := res[`HOT.example.com.`]; got.Err != nil || len(got.IPs) != 1 || got.IPs[0].IP.String() != `192.0.2.1` {
+			t.Errorf(`unexpected result %+v`, got)
+		}
+	}
+
+	if st := r.Stats(); st.Lookups != 1 {
+		t.Errorf(`expected the batches to share one lookup, got %d`, st.Lookups)
+	}
+}
+
+func TestResolveStreamLateCancel(t *testing.T) {
+	server := newTestServer(t, answerA(map[string]string{`a.example.com`: `192.0.2.1`}))
+
+	r := New()
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan string, 2)
+	in <- `a.example.com`
+	in <- `b.example.com`
+	close(in)
+
+	out := make(chan StreamResult, 2)
+	n := 0
+	err := r.ResolveStream(ctx, in, out, 1, WithProgress(func(done, total int) {
+		// canceled once the last result is written
+		if n++; n == 2 {
+			cancel()
+		}
+	}))
+	if err != nil {
+		t.Errorf(`expected nil after every result was written, got %v`, err)
+	}
+	if len(out) != 2 {
+		t.Errorf(`expected 2 results, got %d`, len(out))
+	}
+}
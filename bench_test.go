@@ -0,0 +1,94 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// The benchmarks talk to no server, they measure what the resolver itself
+// costs around the attempts.
+
+var errBenchRefused = errors.New(`connection refused`)
+
+func benchResolver(b *testing.B, servers string) *Resolver {
+	r := New()
+	r.RetrySleep = 0
+	if _, err := r.LoadServersFromString(servers); err != nil {
+		b.Fatal(err)
+	}
+
+	return r
+}
+
+func benchOK(_ context.Context, addr, _ string, s *Settings) error {
+	return nil
+}
+
+// lookupAllocBudget is what a successful first attempt may allocate, the
+// fn of the lookup aside. The single allocation is the *lookupOptions with
+// the settings snapshot: it escapes to the heap because the query log defer
+// and the hooks keep it. Everything else on that path (server selection,
+// the default health policy, stats and the LookupError of a failure) is
+// kept off the heap on purpose, a change needing more should remove an
+// allocation elsewhere rather than raise this. There is no answer cache,
+// so this is the cheapest path there is. Measured with BenchmarkLookup.
+const lookupAllocBudget = 1
+
+func TestLookupAllocs(t *testing.T) {
+	r := New()
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2")
+
+	n := testing.AllocsPerRun(100, func() {
+		_ = r.attempt(`A`, `example.com`, benchOK, nil)
+	})
+	if n > lookupAllocBudget {
+		t.Errorf(`a lookup allocates %v times, the budget is %d`, n, lookupAllocBudget)
+	}
+}
+
+func BenchmarkLookup(b *testing.B) {
+	r := benchResolver(b, "10.0.0.1\n10.0.0.2\n10.0.0.3")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := r.attempt(`A`, `example.com`, benchOK, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLookupParallel(b *testing.B) {
+	r := benchResolver(b, "10.0.0.1\n10.0.0.2\n10.0.0.3")
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := r.attempt(`A`, `example.com`, benchOK, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkLookupRetry fails the first attempt of every lookup, the servers
+// are not quarantined for the failures adding up.
+func BenchmarkLookupRetry(b *testing.B) {
+	r := benchResolver(b, "10.0.0.1\n10.0.0.2\n10.0.0.3")
+	r.MaxFails = 0
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		first := true
+		err := r.attempt(`A`, `example.com`, func(_ context.Context, addr, _ string, s *Settings) error {
+			if first {
+				first = false
+				return errBenchRefused
+			}
+			return nil
+		}, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+)
+
+var ErrOnlyBogusAddresses = errors.New(`resolver: only bogus addresses in answer`)
+
+// DefaultBogonPrefixes are the private, loopback, link local and otherwise
+// reserved ranges no public name should resolve to.
+var DefaultBogonPrefixes = []netip.Prefix{
+	netip.MustParsePrefix(`0.0.0.0/8`),
+	netip.MustParsePrefix(`10.0.0.0/8`),
+	netip.MustParsePrefix(`100.64.0.0/10`),
+	netip.MustParsePrefix(`127.0.0.0/8`),
+	netip.MustParsePrefix(`169.254.0.0/16`),
+	netip.MustParsePrefix(`172.16.0.0/12`),
+	netip.MustParsePrefix(`192.0.0.0/24`),
+	netip.MustParsePrefix(`192.0.2.0/24`),
+	netip.MustParsePrefix(`192.168.0.0/16`),
+	netip.MustParsePrefix(`198.18.0.0/15`),
+	netip.MustParsePrefix(`198.51.100.0/24`),
+	netip.MustParsePrefix(`203.0.113.0/24`),
+	netip.MustParsePrefix(`224.0.0.0/4`),
+	netip.MustParsePrefix(`240.0.0.0/4`),
+	netip.MustParsePrefix(`::/128`),
+	netip.MustParsePrefix(`::1/128`),
+	netip.MustParsePrefix(`2001:db8::/32`),
+	netip.MustParsePrefix(`fc00::/7`),
+	netip.MustParsePrefix(`fe80::/10`),
+	netip.MustParsePrefix(`ff00::/8`),
+}
+
+// BogusAddressesError is an answer left empty by FilterBogons, it matches
+// ErrOnlyBogusAddresses.
+type BogusAddressesError struct {
+	Host   string
+	Server string
+	IPs    []net.IP
+}
+
+func (e *BogusAddressesError) Error() string {
+	if e.Server == `` {
+		return ErrOnlyBogusAddresses.Error() + `: ` + e.Host
+	}
+
+	return ErrOnlyBogusAddresses.Error() + ` ` + e.Server + `: ` + e.Host
+}
+
+func (e *BogusAddressesError) Is(target error) bool {
+	return target == ErrOnlyBogusAddresses
+}
+
+func (e *BogusAddressesError) Timeout() bool {
+	return false
+}
+
+func (e *BogusAddressesError) Temporary() bool {
+	return false
+}
+
+// stripBogons removes the bogon addresses from ipList when FilterBogons is
+// set and fails with a BogusAddressesError when none is left.
+func stripBogons(s *Settings, host, server string, ipList []net.IPAddr) ([]net.IPAddr, error) {
+	if !s.FilterBogons || len(ipList) == 0 {
+		return ipList, nil
+	}
+
+	prefixes := s.BogonPrefixes
+	if prefixes == nil {
+		prefixes = DefaultBogonPrefixes
+	}
+
+	var kept []net.IPAddr
+	var bogus []net.IP
+	for _, ip := range ipList {
+		addr, ok := netip.AddrFromSlice(ip.IP)
+		if !ok || inPrefixes(addr.Unmap(), prefixes) {
+			bogus = append(bogus, ip.IP)
+			continue
+		}
+		kept = append(kept, ip)
+	}
+
+	if len(kept) == 0 {
+		return nil, &BogusAddressesError{Host: host, Server: server, IPs: bogus}
+	}
+
+	return kept, nil
+}
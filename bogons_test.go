@@ -0,0 +1,54 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestFilterBogons(t *testing.T) {
+	server := newTestServer(t, func(q Question, resp *Message) {
+		if q.Type != TypeA {
+			return
+		}
+		switch q.Name {
+		case `mixed.example.`:
+			resp.Answers = append(resp.Answers,
+				RR{Name: q.Name, Type: TypeA, TTL: 60, IP: net.ParseIP(`10.1.2.3`)},
+				RR{Name: q.Name, Type: TypeA, TTL: 60, IP: net.ParseIP(`8.8.8.8`)},
+			)
+		case `private.example.`:
+			resp.Answers = append(resp.Answers,
+				RR{Name: q.Name, Type: TypeA, TTL: 60, IP: net.ParseIP(`169.254.169.254`)},
+				RR{Name: q.Name, Type: TypeA, TTL: 60, IP: net.ParseIP(`127.0.0.1`)},
+			)
+		}
+	})
+
+	r := New()
+	r.RetryLimit = 5
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	if ips, err := r.LookupIPAddr(`mixed.example`); err != nil || len(ips) != 2 {
+		t.Errorf(`expected both addresses without the filter, got %v %v`, ips, err)
+	}
+
+	r.FilterBogons = true
+
+	if ips, err := r.LookupIPAddr(`mixed.example`); err != nil || len(ips) != 1 || ips[0].IP.String() != `8.8.8.8` {
+		t.Errorf(`expected only the public address, got %v %v`, ips, err)
+	}
+
+	ips, err := r.LookupIPAddr(`private.example`)
+	var bogus *BogusAddressesError
+	if !errors.Is(err, ErrOnlyBogusAddresses) || !errors.As(err, &bogus) || len(bogus.IPs) != 2 || ips != nil {
+		t.Errorf(`expected ErrOnlyBogusAddresses, got %v %v`, ips, err)
+	}
+
+	r.health.mu.Lock()
+	defer r.health.mu.Unlock()
+	if h := r.health.servers[server.Addr]; h != nil && (h.fails != 0 || h.streak != 0) {
+		t.Errorf(`server counted as failing: %+v`, h)
+	}
+}
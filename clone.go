@@ -0,0 +1,63 @@
+package resolver
+
+// Clone returns a resolver derived from r with opts applied, checked the
+// way NewWithOptions checks them.
+//
+// Shared with r: the server list, the health accounting and quarantines,
+// the audits, the network state and the per-server query slots. Servers
+// loaded, removed or quarantined through either are so for both.
+//
+// Copied from r, then its own: the settings, the selection mode, the
+// routes, the server tags, the server filter, the middleware, the
+// fallbacks, the root hints, the domain policy and the trust anchors.
+//
+// Its own from the start: stats, events, the query log buffer, rate and
+// in-flight limits, asynchronous lookups, watches and NextIP cursors.
+// Closing the clone leaves r alone and the other way round.
+func (r *Resolver) Clone(opts ...Option) (*Resolver, error) {
+	c := newResolver()
+	c.Settings = r.settings()
+
+	r.mu.Lock()
+	c.Servers = r.Servers
+	c.selectMode, c.banThreshold = r.selectMode, r.banThreshold
+	c.filter = r.filter
+	c.middleware = append([]Middleware(nil), r.middleware...)
+	c.fallbacks = append([]Lookuper(nil), r.fallbacks...)
+	c.rootHints = r.rootHints
+	if r.routes != nil {
+		c.routes = make(map[string]*route, len(r.routes))
+		for suffix, rt := range r.routes {
+			c.routes[suffix] = rt
+		}
+	}
+	if r.tags != nil {
+		c.tags = make(map[string]map[string]string, len(r.tags))
+		for addr, tags := range r.tags {
+			c.tags[addr] = tags
+		}
+	}
+	r.mu.Unlock()
+	if p := r.domainPolicy.Load(); p != nil {
+		c.domainPolicy.Store(p)
+	}
+	if t := r.trust.Load(); t != nil {
+		c.trust.Store(t)
+	}
+
+	c.health = r.health
+	c.audits = r.audits
+	c.network = r.network
+	c.slots = r.slots
+
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Settings.validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
@@ -0,0 +1,68 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClone(t *testing.T) {
+	r, err := NewWithServers(`127.0.0.1`, `127.0.0.2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.RetrySleep = 0
+	r.MaxFails = 1
+	if err := r.AddRoute(`corp.example`, []string{`127.0.0.3`}); err != nil {
+		t.Fatal(err)
+	}
+	events := r.Events()
+
+	c, err := r.Clone(WithRetry(1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.RetryLimit != 1 || r.RetryLimit != DefaultSettings().RetryLimit || c.MaxFails != 1 {
+		t.Errorf(`unexpected settings %d %d %d`, c.RetryLimit, r.RetryLimit, c.MaxFails)
+	}
+	if c.Servers != r.Servers {
+		t.Error(`expected the server list to be shared`)
+	}
+
+	// a clone's routes are its own
+	if !c.RemoveRoute(`corp.example`) || r.matchRoute(`www.corp.example`) == nil {
+		t.Error(`expected the parent to keep its route`)
+	}
+
+	// the health accounting is shared
+	failed := 0
+	_ = c.lookup(`A`, `example.com`, func(res *net.Resolver) error {
+		failed++
+		return errors.New(`connection refused`)
+	})
+	if failed != 1 {
+		t.Errorf(`expected the clone's retry limit, made %d attempts`, failed)
+	}
+	if len(r.QuarantinedServers()) != 1 {
+		t.Errorf(`expected the clone's failure quarantines for the parent too, got %v`, r.QuarantinedServers())
+	}
+	if r.Stats().Lookups != 0 || c.Stats().Lookups != 1 {
+		t.Error(`expected stats of their own`)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, ok := <-events:
+		if !ok {
+			t.Error(`closing the clone closed the parent's events`)
+		}
+	case <-time.After(time.Millisecond * 10):
+	}
+
+	if _, err := r.Clone(WithRetry(-1, 0)); err != ErrBadOption {
+		t.Errorf(`expected ErrBadOption, got %v`, err)
+	}
+}
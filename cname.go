@@ -0,0 +1,79 @@
+package resolver
+
+import (
+	"errors"
+	"strconv"
+)
+
+var ErrCNAMELoop = errors.New(`resolver: CNAME loop`)
+
+// DefaultMaxCNAMEDepth is the longest CNAME chain followed, longer ones are
+// almost always misconfigured.
+const DefaultMaxCNAMEDepth = 10
+
+// CNAMELoopError is a CNAME chain that comes back to Target or is longer
+// than the depth allowed, it matches ErrCNAMELoop. The records are broken,
+// not the server, so it does not count as a server failure.
+type CNAMELoopError struct {
+	Host   string
+	Target string
+	Depth  int
+}
+
+func (e *CNAMELoopError) Error() string {
+	if e.Depth > 0 {
+		return ErrCNAMELoop.Error() + ` ` + e.Host + `: chain longer than ` + strconv.Itoa(e.Depth)
+	}
+
+	return ErrCNAMELoop.Error() + ` ` + e.Host + `: back to ` + e.Target
+}
+
+func (e *CNAMELoopError) Is(target error) bool {
+	return target == ErrCNAMELoop
+}
+
+func (e *CNAMELoopError) Timeout() bool {
+	return false
+}
+
+func (e *CNAMELoopError) Temporary() bool {
+	return false
+}
+
+// cnameChain follows the CNAME records of name in rrs and returns the name
+// the chain ends at, or a CNAMELoopError when it repeats or goes deeper than
+// maxDepth.
+func cnameChain(name string, rrs []RR, maxDepth int) (string, error) {
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxCNAMEDepth
+	}
+
+	name = nameKey(name)
+	seen := map[string]bool{name: true}
+
+	for depth := 0; ; depth++ {
+		target, ok := cnameOf(name, rrs)
+		if !ok {
+			return name, nil
+		}
+		if seen[target] {
+			return ``, &CNAMELoopError{Host: name, Target: target}
+		}
+		if depth >= maxDepth {
+			return ``, &CNAMELoopError{Host: name, Target: target, Depth: maxDepth}
+		}
+
+		seen[target] = true
+		name = target
+	}
+}
+
+func cnameOf(name string, rrs []RR) (string, bool) {
+	for _, rr := range rrs {
+		if rr.Type == TypeCNAME && nameKey(rr.Name) == name {
+			return nameKey(rr.Target), true
+		}
+	}
+
+	return ``, false
+}
@@ -0,0 +1,61 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func cnameRR(name, target string) RR {
+	return RR{Name: name, Type: TypeCNAME, TTL: 60, Target: target}
+}
+
+func TestCNAMEChain(t *testing.T) {
+	target, err := cnameChain(`a.example`, []RR{cnameRR(`a.example.`, `B.example.`), cnameRR(`b.example.`, `c.example.`)}, 10)
+	if err != nil || target != `c.example` {
+		t.Errorf(`unexpected end of chain %q %v`, target, err)
+	}
+
+	var loopErr *CNAMELoopError
+	_, err = cnameChain(`a.example`, []RR{cnameRR(`a.example.`, `b.example.`), cnameRR(`b.example.`, `a.example.`)}, 10)
+	if !errors.Is(err, ErrCNAMELoop) || !errors.As(err, &loopErr) || loopErr.Target != `a.example` || loopErr.Depth != 0 {
+		t.Errorf(`expected a loop back to a.example, got %v`, err)
+	}
+
+	var deep []RR
+	for i := 0; i < 12; i++ {
+		deep = append(deep, cnameRR(strconv.Itoa(i)+`.example.`, strconv.Itoa(i+1)+`.example.`))
+	}
+	if _, err := cnameChain(`0.example`, deep, 12); err != nil {
+		t.Errorf(`unexpected error %v`, err)
+	}
+	_, err = cnameChain(`0.example`, deep, 0)
+	if !errors.As(err, &loopErr) || loopErr.Depth != DefaultMaxCNAMEDepth {
+		t.Errorf(`expected the default depth to be exceeded, got %v`, err)
+	}
+}
+
+func TestCNAMELoopNotCounted(t *testing.T) {
+	server := newTestServer(t, func(q Question, resp *Message) {
+		resp.Answers = append(resp.Answers, cnameRR(`a.example.`, `b.example.`), cnameRR(`b.example.`, `a.example.`))
+	})
+
+	r := New()
+	r.RetryLimit = 5
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	if _, err := r.LookupIPAddr(`a.example`); !errors.Is(err, ErrCNAMELoop) {
+		t.Errorf(`lookup: expected ErrCNAMELoop, got %v`, err)
+	}
+	if _, err := r.Query(context.Background(), `a.example`, TypeA); !errors.Is(err, ErrCNAMELoop) {
+		t.Errorf(`query: expected ErrCNAMELoop, got %v`, err)
+	}
+
+	r.health.mu.Lock()
+	defer r.health.mu.Unlock()
+	if h := r.health.servers[server.Addr]; h != nil && (h.fails != 0 || h.streak != 0) {
+		t.Errorf(`server counted as failing: %+v`, h)
+	}
+}
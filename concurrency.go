@@ -0,0 +1,152 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// errServersBusy is returned by pickServer when every usable server already
+// has MaxConcurrentPerServer queries in flight.
+var errServersBusy = errors.New(`resolver: every server is busy`)
+
+// releases wakes the goroutines waiting for something to be given back.
+type releases struct {
+	waiters int32
+	freed   chan struct{}
+	mu      sync.Mutex
+}
+
+func newReleases() *releases {
+	return &releases{freed: make(chan struct{})}
+}
+
+// watch returns a channel closed by the next notify, done must be called
+// once the caller stops waiting on it.
+func (rl *releases) watch() (<-chan struct{}, func()) {
+	atomic.AddInt32(&rl.waiters, 1)
+
+	rl.mu.Lock()
+	ch := rl.freed
+	rl.mu.Unlock()
+
+	return ch, func() { atomic.AddInt32(&rl.waiters, -1) }
+}
+
+func (rl *releases) notify() {
+	if atomic.LoadInt32(&rl.waiters) > 0 {
+		rl.mu.Lock()
+		close(rl.freed)
+		rl.freed = make(chan struct{})
+		rl.mu.Unlock()
+	}
+}
+
+// serverSlots counts the queries in flight per server and wakes the lookups
+// waiting for one of them to finish.
+type serverSlots struct {
+	counts sync.Map // string -> *int64
+	*releases
+}
+
+func newServerSlots() *serverSlots {
+	return &serverSlots{releases: newReleases()}
+}
+
+func (sl *serverSlots) count(addr string) *int64 {
+	n, ok := sl.counts.Load(addr)
+	if !ok {
+		n, _ = sl.counts.LoadOrStore(addr, new(int64))
+	}
+
+	return n.(*int64)
+}
+
+// full reports whether addr has max queries in flight, never with max 0.
+func (sl *serverSlots) full(addr string, max int) bool {
+	return max > 0 && atomic.LoadInt64(sl.count(addr)) >= int64(max)
+}
+
+// take counts a query to addr unless it has max in flight already.
+func (sl *serverSlots) take(addr string, max int) bool {
+	return takeSlot(sl.count(addr), max)
+}
+
+// takeSlot adds one to n unless that makes it more than max, max 0 has no
+// limit.
+func takeSlot(n *int64, max int) bool {
+	for {
+		cur := atomic.LoadInt64(n)
+		if max > 0 && cur >= int64(max) {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(n, cur, cur+1) {
+			return true
+		}
+	}
+}
+
+func (sl *serverSlots) release(addr string) {
+	atomic.AddInt64(sl.count(addr), -1)
+	sl.notify()
+}
+
+// snapshot returns the servers with queries in flight.
+func (sl *serverSlots) snapshot() map[string]int64 {
+	m := make(map[string]int64)
+	sl.counts.Range(func(k, v interface{}) bool {
+		if n := atomic.LoadInt64(v.(*int64)); n > 0 {
+			m[k.(string)] = n
+		}
+		return true
+	})
+
+	return m
+}
+
+// reserveServer is getServer that also takes a slot of the server it
+// returns, waiting while every server has MaxConcurrentPerServer queries in
+// flight. The slot must be given back with release.
+func (r *Resolver) reserveServer(pool ServerList, value string, tried []Attempt, o *lookupOptions) (*Server, error) {
+	max := o.settings.MaxConcurrentPerServer
+	if max <= 0 {
+		server, err := r.getServer(pool, value, tried, o)
+		if err == nil {
+			r.slots.take(server.Addr, 0)
+		}
+		return server, err
+	}
+
+	for {
+		// watching before the servers are looked at, a release in between
+		// is not missed
+		freed, done := r.slots.watch()
+
+		server, err := r.getServer(pool, value, tried, o)
+		if err == nil && r.slots.take(server.Addr, max) {
+			done()
+			return server, nil
+		}
+		if err != nil && err != errServersBusy {
+			done()
+			return nil, err
+		}
+
+		select {
+		case <-freed:
+			done()
+		case <-o.ctx.Done():
+			done()
+			return nil, o.ctx.Err()
+		}
+	}
+}
+
+// send makes one attempt to addr under ctx, its slot is given back even
+// when fn panics.
+func (r *Resolver) send(ctx context.Context, addr, name string, fn func(ctx context.Context, addr, name string, s *Settings) error, s *Settings) error {
+	defer r.slots.release(addr)
+
+	return fn(ctx, addr, name, s)
+}
@@ -0,0 +1,94 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMaxConcurrentPerServer(t *testing.T) {
+	r := New()
+	r.MaxConcurrentPerServer = 1
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2")
+
+	started := make(chan string, 2)
+	unblock := make(chan struct{})
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- r.attempt(`A`, `example.com`, func(_ context.Context, addr, _ string, s *Settings) error {
+				started <- addr
+				<-unblock
+				return nil
+			}, nil)
+		}()
+	}
+
+	a, b := <-started, <-started
+	if a == b {
+		t.Fatalf(`both lookups went to %s`, a)
+	}
+	if st := r.Stats(); st.ServerInFlight[a] != 1 || st.ServerInFlight[b] != 1 {
+		t.Errorf(`unexpected in flight %v`, st.ServerInFlight)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	err := r.attempt(`A`, `example.com`, func(_ context.Context, addr, _ string, s *Settings) error {
+		t.Errorf(`saturated server %s was used`, addr)
+		return nil
+	}, nil, WithContext(ctx))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf(`expected the wait to time out, got %v`, err)
+	}
+
+	// a waiting lookup goes on once a server is free
+	waited := make(chan error, 1)
+	go func() {
+		waited <- r.attempt(`A`, `example.com`, func(_ context.Context, addr, _ string, s *Settings) error { return nil }, nil)
+	}()
+	time.Sleep(time.Millisecond * 20)
+	close(unblock)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal(`waiting lookup never went on`)
+	}
+
+	if st := r.Stats(); len(st.ServerInFlight) != 0 {
+		t.Errorf(`expected nothing in flight, got %v`, st.ServerInFlight)
+	}
+}
+
+func TestServerInFlightPanic(t *testing.T) {
+	r := New()
+	r.MaxConcurrentPerServer = 1
+	_, _ = r.LoadServersFromString("10.0.0.1")
+
+	func() {
+		defer func() { _ = recover() }()
+		_ = r.attempt(`A`, `example.com`, func(_ context.Context, addr, _ string, s *Settings) error {
+			panic(`boom`)
+		}, nil)
+	}()
+
+	if st := r.Stats(); len(st.ServerInFlight) != 0 {
+		t.Errorf(`panic leaked a slot: %v`, st.ServerInFlight)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := r.attempt(`A`, `example.com`, func(_ context.Context, addr, _ string, s *Settings) error { return nil }, nil, WithContext(ctx)); err != nil {
+		t.Errorf(`server still saturated after a panic: %v`, err)
+	}
+}
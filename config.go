@@ -0,0 +1,574 @@
+package resolver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/zofan/go-slist"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/netip"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Duration is a time.Duration written as a string like `1.5s` in configs.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return fmt.Errorf(`%w: %s`, ErrBadOption, err)
+	}
+	*d = Duration(v)
+
+	return nil
+}
+
+// Config is the part of the settings that can be written down, along with
+// where the servers come from, for reading the resolver setup from a file.
+// The fields are those of Settings. DefaultConfig matches what New uses.
+type Config struct {
+	Servers      []string `json:"servers,omitempty" yaml:"servers,omitempty"`
+	ServerFile   string   `json:"server_file,omitempty" yaml:"server_file,omitempty"`
+	ServerURL    string   `json:"server_url,omitempty" yaml:"server_url,omitempty"`
+	SelectMode   string   `json:"select_mode" yaml:"select_mode"` // rotate, random or time
+	BanThreshold int      `json:"ban_threshold" yaml:"ban_threshold"`
+
+	DialTimeout      Duration    `json:"dial_timeout" yaml:"dial_timeout"`
+	DisableKeepAlive bool        `json:"disable_keep_alive" yaml:"disable_keep_alive"`
+	MaxFails         uint32      `json:"max_fails" yaml:"max_fails"`
+	RetryLimit       int         `json:"retry_limit" yaml:"retry_limit"`
+	RetrySleep       Duration    `json:"retry_sleep" yaml:"retry_sleep"`
+	BypassNative     bool        `json:"bypass_native" yaml:"bypass_native"`
+	StickyByHost     bool        `json:"sticky_by_host" yaml:"sticky_by_host"`
+	RequireTags      TagSelector `json:"require_tags,omitempty" yaml:"require_tags,omitempty"`
+	TagFallback      bool        `json:"tag_fallback" yaml:"tag_fallback"`
+	RelaxedNames     bool        `json:"relaxed_names" yaml:"relaxed_names"`
+	RawNames         bool        `json:"raw_names" yaml:"raw_names"`
+	DisableIDNA      bool        `json:"disable_idna" yaml:"disable_idna"`
+	DecodeIDN        bool        `json:"decode_idn" yaml:"decode_idn"`
+	SearchDomains    []string    `json:"search_domains,omitempty" yaml:"search_domains,omitempty"`
+	NDots            int         `json:"ndots" yaml:"ndots"`
+	HostsFile        bool        `json:"hosts_file" yaml:"hosts_file"`
+	HostsPath        string      `json:"hosts_path,omitempty" yaml:"hosts_path,omitempty"`
+	SpecialUse       bool        `json:"special_use" yaml:"special_use"`
+	EmbeddedFallback bool        `json:"embedded_fallback" yaml:"embedded_fallback"`
+
+	BypassOn             []string     `json:"bypass_on,omitempty" yaml:"bypass_on,omitempty"` // empty_list, retry_limit or network_down
+	NativeFirst          bool         `json:"native_first" yaml:"native_first"`
+	ServerOverrideHealth bool         `json:"server_override_health" yaml:"server_override_health"`
+	NativeTimeout        Duration     `json:"native_timeout" yaml:"native_timeout"`
+	FallbackOnNotFound   bool         `json:"fallback_on_not_found" yaml:"fallback_on_not_found"`
+	DNSSEC               string       `json:"dnssec" yaml:"dnssec"` // off, trust_ad or validate
+	DNS64                bool         `json:"dns64" yaml:"dns64"`
+	DNS64Prefix          netip.Prefix `json:"dns64_prefix" yaml:"dns64_prefix"`
+
+	SpecialUseNames map[string]string `json:"special_use_names,omitempty" yaml:"special_use_names,omitempty"` // send, loopback, fail or native
+
+	MaxConcurrentPerServer int      `json:"max_concurrent_per_server" yaml:"max_concurrent_per_server"`
+	QPS                    float64  `json:"qps" yaml:"qps"`
+	Burst                  int      `json:"burst" yaml:"burst"`
+	DomainQPS              float64  `json:"domain_qps" yaml:"domain_qps"`
+	DomainBurst            int      `json:"domain_burst" yaml:"domain_burst"`
+	DomainFailFast         bool     `json:"domain_fail_fast" yaml:"domain_fail_fast"`
+	DomainLimiters         int      `json:"domain_limiters" yaml:"domain_limiters"`
+	MaxInFlight            int      `json:"max_in_flight" yaml:"max_in_flight"`
+	MaxInFlightWait        Duration `json:"max_in_flight_wait" yaml:"max_in_flight_wait"`
+
+	SplitFamilies       bool     `json:"split_families" yaml:"split_families"`
+	RequireBothFamilies bool     `json:"require_both_families" yaml:"require_both_families"`
+	RoundRobinTTL       Duration `json:"round_robin_ttl" yaml:"round_robin_ttl"`
+	RoundRobinFamily    string   `json:"round_robin_family,omitempty" yaml:"round_robin_family,omitempty"` // A or AAAA
+	SweepMinBits        int      `json:"sweep_min_bits" yaml:"sweep_min_bits"`
+	MaxCNAMEDepth       int      `json:"max_cname_depth" yaml:"max_cname_depth"`
+	MaxReferrals        int      `json:"max_referrals" yaml:"max_referrals"`
+
+	GoodAfter             int            `json:"good_after" yaml:"good_after"`
+	CircuitThreshold      int            `json:"circuit_threshold" yaml:"circuit_threshold"`
+	CircuitCooldown       Duration       `json:"circuit_cooldown" yaml:"circuit_cooldown"`
+	ProbeName             string         `json:"probe_name" yaml:"probe_name"`
+	NonceZone             string         `json:"nonce_zone" yaml:"nonce_zone"`
+	RecheckInterval       Duration       `json:"recheck_interval" yaml:"recheck_interval"`
+	FailHalfLife          Duration       `json:"fail_half_life" yaml:"fail_half_life"`
+	MaxFailureRatio       float64        `json:"max_failure_ratio" yaml:"max_failure_ratio"`
+	FailureRatioWindow    Duration       `json:"failure_ratio_window" yaml:"failure_ratio_window"`
+	FailureRatioSamples   int            `json:"failure_ratio_samples" yaml:"failure_ratio_samples"`
+	QuarantineDuration    Duration       `json:"quarantine_duration" yaml:"quarantine_duration"`
+	QuarantineGrowth      float64        `json:"quarantine_growth" yaml:"quarantine_growth"`
+	MaxQuarantineDuration Duration       `json:"max_quarantine_duration" yaml:"max_quarantine_duration"`
+	QuarantineDecay       Duration       `json:"quarantine_decay" yaml:"quarantine_decay"`
+	QuarantineSteps       []float64      `json:"quarantine_steps,omitempty" yaml:"quarantine_steps,omitempty"`
+	ProbationSuccesses    int            `json:"probation_successes" yaml:"probation_successes"`
+	FailureWeights        FailureWeights `json:"failure_weights" yaml:"failure_weights"`
+
+	FilteredAnswers  string         `json:"filtered_answers" yaml:"filtered_answers"` // ignore, retry or error
+	FilteredPrefixes []netip.Prefix `json:"filtered_prefixes,omitempty" yaml:"filtered_prefixes,omitempty"`
+	EvictFiltering   bool           `json:"evict_filtering" yaml:"evict_filtering"`
+	FilterBogons     bool           `json:"filter_bogons" yaml:"filter_bogons"`
+	BogonPrefixes    []netip.Prefix `json:"bogon_prefixes,omitempty" yaml:"bogon_prefixes,omitempty"`
+
+	AuditFraction   float64 `json:"audit_fraction" yaml:"audit_fraction"`
+	AuditThreshold  float64 `json:"audit_threshold" yaml:"audit_threshold"`
+	AuditMinSamples int     `json:"audit_min_samples" yaml:"audit_min_samples"`
+	EvictLying      bool    `json:"evict_lying" yaml:"evict_lying"`
+
+	NetworkDownServers   int      `json:"network_down_servers" yaml:"network_down_servers"`
+	NetworkDownWindow    Duration `json:"network_down_window" yaml:"network_down_window"`
+	ConnectivityProbes   []string `json:"connectivity_probes,omitempty" yaml:"connectivity_probes,omitempty"`
+	ConnectivityInterval Duration `json:"connectivity_interval" yaml:"connectivity_interval"`
+
+	MinHealthyServers  int      `json:"min_healthy_servers" yaml:"min_healthy_servers"`
+	MinHealthyFraction float64  `json:"min_healthy_fraction" yaml:"min_healthy_fraction"`
+	HealthyFreshness   Duration `json:"healthy_freshness" yaml:"healthy_freshness"`
+	EventBuffer        int      `json:"event_buffer" yaml:"event_buffer"`
+}
+
+var (
+	selectModes = map[string]slist.SelectMode{
+		`rotate`: slist.ModeRotate,
+		`random`: slist.ModeRandom,
+		`time`:   slist.ModeTime,
+	}
+	filteredPolicies = map[string]FilteredAnswerPolicy{
+		`ignore`: FilteredIgnore,
+		`retry`:  FilteredRetry,
+		`error`:  FilteredError,
+	}
+	dnssecModes = map[string]DNSSECMode{
+		`off`:      DNSSECOff,
+		`trust_ad`: DNSSECTrustAD,
+		`validate`: DNSSECValidate,
+	}
+	specialUseActions = map[string]SpecialUseAction{
+		`send`:     SpecialUseSend,
+		`loopback`: SpecialUseLoopback,
+		`fail`:     SpecialUseFail,
+		`native`:   SpecialUseNative,
+	}
+	fallbackPolicies = map[string]FallbackPolicy{
+		`empty_list`:   FallbackEmptyList,
+		`retry_limit`:  FallbackRetryLimit,
+		`network_down`: FallbackNetworkDown,
+	}
+)
+
+// DefaultConfig returns the config of a resolver made by New.
+func DefaultConfig() Config {
+	return configFrom(DefaultSettings(), DefaultSelectMode, DefaultBanThreshold)
+}
+
+// ParseConfig reads a JSON config over DefaultConfig, so that the fields
+// left out keep their defaults. With strict set unknown fields are errors.
+func ParseConfig(data []byte, strict bool) (Config, error) {
+	c := DefaultConfig()
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(&c); err != nil {
+		return Config{}, err
+	}
+
+	return c, c.Validate()
+}
+
+// ParseConfigYAML is ParseConfig for a YAML config, with the same keys.
+func ParseConfigYAML(data []byte, strict bool) (Config, error) {
+	c := DefaultConfig()
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(strict)
+	if err := dec.Decode(&c); err != nil && err != io.EOF {
+		return Config{}, err
+	}
+
+	return c, c.Validate()
+}
+
+// Validate checks the config the way NewWithOptions checks options.
+func (c Config) Validate() error {
+	_, _, err := c.settings()
+	return err
+}
+
+// NewFromConfig returns a resolver set up by cfg, with the servers of all
+// of its sources loaded.
+func NewFromConfig(cfg Config) (*Resolver, error) {
+	s, mode, err := cfg.settings()
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := NewWithOptions(WithSelectionMode(mode, cfg.BanThreshold))
+	if err != nil {
+		return nil, err
+	}
+	r.Settings = s
+
+	if len(cfg.Servers) > 0 {
+		if err := WithServers(cfg.Servers)(r); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ServerFile != `` {
+		f, err := os.Open(cfg.ServerFile)
+		if err != nil {
+			return nil, err
+		}
+		_, err = r.LoadServers(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ServerURL != `` {
+		if _, err := r.LoadServersFromURL(cfg.ServerURL); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func (c Config) settings() (Settings, slist.SelectMode, error) {
+	mode, ok := selectModes[c.SelectMode]
+	if !ok {
+		return Settings{}, 0, fmt.Errorf(`%w: select mode %q`, ErrBadOption, c.SelectMode)
+	}
+	var bypassOn FallbackPolicy
+	for _, name := range c.BypassOn {
+		p, ok := fallbackPolicies[name]
+		if !ok {
+			return Settings{}, 0, fmt.Errorf(`%w: bypass on %q`, ErrBadOption, name)
+		}
+		bypassOn |= p
+	}
+	filtered, ok := filteredPolicies[c.FilteredAnswers]
+	if !ok {
+		return Settings{}, 0, fmt.Errorf(`%w: filtered answers %q`, ErrBadOption, c.FilteredAnswers)
+	}
+	dnssec, ok := dnssecModes[c.DNSSEC]
+	if !ok {
+		return Settings{}, 0, fmt.Errorf(`%w: dnssec %q`, ErrBadOption, c.DNSSEC)
+	}
+	var specialUse map[string]SpecialUseAction
+	if c.SpecialUseNames != nil {
+		specialUse = make(map[string]SpecialUseAction, len(c.SpecialUseNames))
+	}
+	for suffix, name := range c.SpecialUseNames {
+		a, ok := specialUseActions[name]
+		if !ok {
+			return Settings{}, 0, fmt.Errorf(`%w: special use %q`, ErrBadOption, name)
+		}
+		specialUse[nameKey(suffix)] = a
+	}
+	var family Type
+	switch c.RoundRobinFamily {
+	case ``:
+	case `A`:
+		family = TypeA
+	case `AAAA`:
+		family = TypeAAAA
+	default:
+		return Settings{}, 0, fmt.Errorf(`%w: round robin family %q`, ErrBadOption, c.RoundRobinFamily)
+	}
+	if err := validateSelection(mode, c.BanThreshold); err != nil {
+		return Settings{}, 0, err
+	}
+
+	s := DefaultSettings()
+	s.DialTimeout = time.Duration(c.DialTimeout)
+	s.DisableKeepAlive = c.DisableKeepAlive
+	s.MaxFails = c.MaxFails
+	s.RetryLimit = c.RetryLimit
+	s.RetrySleep = time.Duration(c.RetrySleep)
+	s.BypassNative = c.BypassNative
+	s.StickyByHost = c.StickyByHost
+	s.RequireTags = c.RequireTags
+	s.TagFallback = c.TagFallback
+	s.RelaxedNames = c.RelaxedNames
+	s.RawNames = c.RawNames
+	s.DisableIDNA = c.DisableIDNA
+	s.DecodeIDN = c.DecodeIDN
+	s.SearchDomains = c.SearchDomains
+	s.NDots = c.NDots
+	s.HostsFile = c.HostsFile
+	s.HostsPath = c.HostsPath
+	s.SpecialUse = c.SpecialUse
+	s.SpecialUseNames = specialUse
+	s.EmbeddedFallback = c.EmbeddedFallback
+	s.BypassOn = bypassOn
+	s.NativeFirst = c.NativeFirst
+	s.ServerOverrideHealth = c.ServerOverrideHealth
+	s.NativeTimeout = time.Duration(c.NativeTimeout)
+	s.FallbackOnNotFound = c.FallbackOnNotFound
+	s.DNSSEC = dnssec
+	s.DNS64 = c.DNS64
+	s.DNS64Prefix = c.DNS64Prefix
+
+	s.MaxConcurrentPerServer = c.MaxConcurrentPerServer
+	s.QPS = c.QPS
+	s.Burst = c.Burst
+	s.DomainQPS = c.DomainQPS
+	s.DomainBurst = c.DomainBurst
+	s.DomainFailFast = c.DomainFailFast
+	s.DomainLimiters = c.DomainLimiters
+	s.MaxInFlight = c.MaxInFlight
+	s.MaxInFlightWait = time.Duration(c.MaxInFlightWait)
+
+	s.SplitFamilies = c.SplitFamilies
+	s.RequireBothFamilies = c.RequireBothFamilies
+	s.RoundRobinTTL = time.Duration(c.RoundRobinTTL)
+	s.RoundRobinFamily = family
+	s.SweepMinBits = c.SweepMinBits
+	s.MaxCNAMEDepth = c.MaxCNAMEDepth
+	s.MaxReferrals = c.MaxReferrals
+
+	s.GoodAfter = c.GoodAfter
+	s.CircuitThreshold = c.CircuitThreshold
+	s.CircuitCooldown = time.Duration(c.CircuitCooldown)
+	s.ProbeName = c.ProbeName
+	s.NonceZone = c.NonceZone
+	s.RecheckInterval = time.Duration(c.RecheckInterval)
+	s.FailHalfLife = time.Duration(c.FailHalfLife)
+	s.MaxFailureRatio = c.MaxFailureRatio
+	s.FailureRatioWindow = time.Duration(c.FailureRatioWindow)
+	s.FailureRatioSamples = c.FailureRatioSamples
+	s.QuarantineDuration = time.Duration(c.QuarantineDuration)
+	s.QuarantineGrowth = c.QuarantineGrowth
+	s.MaxQuarantineDuration = time.Duration(c.MaxQuarantineDuration)
+	s.QuarantineDecay = time.Duration(c.QuarantineDecay)
+	s.QuarantineSteps = c.QuarantineSteps
+	s.ProbationSuccesses = c.ProbationSuccesses
+	s.FailureWeights = c.FailureWeights
+
+	s.FilteredAnswers = filtered
+	s.FilteredPrefixes = c.FilteredPrefixes
+	s.EvictFiltering = c.EvictFiltering
+	s.FilterBogons = c.FilterBogons
+	s.BogonPrefixes = c.BogonPrefixes
+
+	s.AuditFraction = c.AuditFraction
+	s.AuditThreshold = c.AuditThreshold
+	s.AuditMinSamples = c.AuditMinSamples
+	s.EvictLying = c.EvictLying
+
+	s.NetworkDownServers = c.NetworkDownServers
+	s.NetworkDownWindow = time.Duration(c.NetworkDownWindow)
+	s.ConnectivityProbes = c.ConnectivityProbes
+	s.ConnectivityInterval = time.Duration(c.ConnectivityInterval)
+
+	s.MinHealthyServers = c.MinHealthyServers
+	s.MinHealthyFraction = c.MinHealthyFraction
+	s.HealthyFreshness = time.Duration(c.HealthyFreshness)
+	s.EventBuffer = c.EventBuffer
+
+	return s, mode, s.validate()
+}
+
+// configFrom is the config of the settings s with the selection mode and
+// ban threshold given.
+func configFrom(s Settings, mode slist.SelectMode, banThreshold int) Config {
+	c := Config{BanThreshold: banThreshold}
+	for name, m := range selectModes {
+		if m == mode {
+			c.SelectMode = name
+		}
+	}
+	for name, p := range filteredPolicies {
+		if p == s.FilteredAnswers {
+			c.FilteredAnswers = name
+		}
+	}
+	for name, m := range dnssecModes {
+		if m == s.DNSSEC {
+			c.DNSSEC = name
+		}
+	}
+	switch s.RoundRobinFamily {
+	case TypeA, TypeAAAA:
+		c.RoundRobinFamily = s.RoundRobinFamily.String()
+	}
+
+	c.DialTimeout = Duration(s.DialTimeout)
+	c.DisableKeepAlive = s.DisableKeepAlive
+	c.MaxFails = s.MaxFails
+	c.RetryLimit = s.RetryLimit
+	c.RetrySleep = Duration(s.RetrySleep)
+	c.BypassNative = s.BypassNative
+	c.StickyByHost = s.StickyByHost
+	c.RequireTags = s.RequireTags
+	c.TagFallback = s.TagFallback
+	c.RelaxedNames = s.RelaxedNames
+	c.RawNames = s.RawNames
+	c.DisableIDNA = s.DisableIDNA
+	c.DecodeIDN = s.DecodeIDN
+	c.SearchDomains = s.SearchDomains
+	c.NDots = s.NDots
+	c.HostsFile = s.HostsFile
+	c.HostsPath = s.HostsPath
+	c.SpecialUse = s.SpecialUse
+	if s.SpecialUseNames != nil {
+		c.SpecialUseNames = make(map[string]string, len(s.SpecialUseNames))
+	}
+	for suffix, a := range s.SpecialUseNames {
+		c.SpecialUseNames[suffix] = a.String()
+	}
+	c.EmbeddedFallback = s.EmbeddedFallback
+	for _, name := range []string{`empty_list`, `retry_limit`, `network_down`} {
+		if s.BypassOn&fallbackPolicies[name] != 0 {
+			c.BypassOn = append(c.BypassOn, name)
+		}
+	}
+	c.NativeFirst = s.NativeFirst
+	c.ServerOverrideHealth = s.ServerOverrideHealth
+	c.NativeTimeout = Duration(s.NativeTimeout)
+	c.FallbackOnNotFound = s.FallbackOnNotFound
+	c.DNS64 = s.DNS64
+	c.DNS64Prefix = s.DNS64Prefix
+
+	c.MaxConcurrentPerServer = s.MaxConcurrentPerServer
+	c.QPS = s.QPS
+	c.Burst = s.Burst
+	c.DomainQPS = s.DomainQPS
+	c.DomainBurst = s.DomainBurst
+	c.DomainFailFast = s.DomainFailFast
+	c.DomainLimiters = s.DomainLimiters
+	c.MaxInFlight = s.MaxInFlight
+	c.MaxInFlightWait = Duration(s.MaxInFlightWait)
+
+	c.SplitFamilies = s.SplitFamilies
+	c.RequireBothFamilies = s.RequireBothFamilies
+	c.RoundRobinTTL = Duration(s.RoundRobinTTL)
+	c.SweepMinBits = s.SweepMinBits
+	c.MaxCNAMEDepth = s.MaxCNAMEDepth
+	c.MaxReferrals = s.MaxReferrals
+
+	c.GoodAfter = s.GoodAfter
+	c.CircuitThreshold = s.CircuitThreshold
+	c.CircuitCooldown = Duration(s.CircuitCooldown)
+	c.ProbeName = s.ProbeName
+	c.NonceZone = s.NonceZone
+	c.RecheckInterval = Duration(s.RecheckInterval)
+	c.FailHalfLife = Duration(s.FailHalfLife)
+	c.MaxFailureRatio = s.MaxFailureRatio
+	c.FailureRatioWindow = Duration(s.FailureRatioWindow)
+	c.FailureRatioSamples = s.FailureRatioSamples
+	c.QuarantineDuration = Duration(s.QuarantineDuration)
+	c.QuarantineGrowth = s.QuarantineGrowth
+	c.MaxQuarantineDuration = Duration(s.MaxQuarantineDuration)
+	c.QuarantineDecay = Duration(s.QuarantineDecay)
+	c.QuarantineSteps = s.QuarantineSteps
+	c.ProbationSuccesses = s.ProbationSuccesses
+	c.FailureWeights = s.FailureWeights
+
+	c.FilteredPrefixes = s.FilteredPrefixes
+	c.EvictFiltering = s.EvictFiltering
+	c.FilterBogons = s.FilterBogons
+	c.BogonPrefixes = s.BogonPrefixes
+
+	c.AuditFraction = s.AuditFraction
+	c.AuditThreshold = s.AuditThreshold
+	c.AuditMinSamples = s.AuditMinSamples
+	c.EvictLying = s.EvictLying
+
+	c.NetworkDownServers = s.NetworkDownServers
+	c.NetworkDownWindow = Duration(s.NetworkDownWindow)
+	c.ConnectivityProbes = s.ConnectivityProbes
+	c.ConnectivityInterval = Duration(s.ConnectivityInterval)
+
+	c.MinHealthyServers = s.MinHealthyServers
+	c.MinHealthyFraction = s.MinHealthyFraction
+	c.HealthyFreshness = Duration(s.HealthyFreshness)
+	c.EventBuffer = s.EventBuffer
+
+	return c
+}
+
+// ConfigSnapshot returns the config r works with now, Servers being the
+// addresses of the servers loaded. It shares nothing with r.
+func (r *Resolver) ConfigSnapshot() Config {
+	r.mu.Lock()
+	mode, banThreshold := r.selectMode, r.banThreshold
+	r.mu.Unlock()
+
+	c := configFrom(r.settings(), mode, banThreshold)
+	c.RequireTags = copyTags(c.RequireTags)
+	c.FilteredPrefixes = append([]netip.Prefix(nil), c.FilteredPrefixes...)
+	c.BogonPrefixes = append([]netip.Prefix(nil), c.BogonPrefixes...)
+	c.ConnectivityProbes = append([]string(nil), c.ConnectivityProbes...)
+	for _, srv := range r.Servers.All() {
+		c.Servers = append(c.Servers, srv.Addr)
+	}
+
+	return c
+}
+
+// configState is what MarshalJSON writes: the config snapshot along with
+// the counts of servers and the values the zero settings stand for.
+type configState struct {
+	Config
+	ServerCount            int      `json:"server_count"`
+	HealthyServers         int      `json:"healthy_servers"`
+	QuarantinedCount       int      `json:"quarantined_servers"`
+	Routes                 int      `json:"routes"`
+	Closed                 bool     `json:"closed"`
+	EffectiveRoundRobinTTL Duration `json:"effective_round_robin_ttl"`
+	EffectiveSweepMinBits  int      `json:"effective_sweep_min_bits"`
+}
+
+// MarshalJSON writes the ConfigSnapshot of r along with the server counts,
+// for logs and support dumps.
+func (r *Resolver) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.configState())
+}
+
+// String is a one line summary of the setup of r for startup logs.
+func (r *Resolver) String() string {
+	st := r.configState()
+
+	return fmt.Sprintf(`resolver: %d servers (%d healthy, %d quarantined), %d routes, %s, dial %s, retry %d/%s, max fails %d`,
+		st.ServerCount, st.HealthyServers, st.QuarantinedCount, st.Routes, st.SelectMode,
+		time.Duration(st.DialTimeout), st.RetryLimit, time.Duration(st.RetrySleep), st.MaxFails)
+}
+
+func (r *Resolver) configState() configState {
+	st := configState{Config: r.ConfigSnapshot()}
+	st.ServerCount = len(st.Servers)
+	st.HealthyServers = r.HealthyServers()
+	st.QuarantinedCount = len(r.QuarantinedServers())
+	st.Closed = atomic.LoadInt32(&r.closed) != 0
+
+	r.mu.Lock()
+	st.Routes = len(r.routes)
+	r.mu.Unlock()
+
+	if st.EffectiveRoundRobinTTL = st.RoundRobinTTL; st.EffectiveRoundRobinTTL <= 0 {
+		st.EffectiveRoundRobinTTL = Duration(DefaultRoundRobinTTL)
+	}
+	if st.EffectiveSweepMinBits = st.SweepMinBits; st.EffectiveSweepMinBits <= 0 {
+		st.EffectiveSweepMinBits = DefaultSweepMinBits
+	}
+
+	return st
+}
+
+func copyTags(tags TagSelector) TagSelector {
+	if tags == nil {
+		return nil
+	}
+
+	c := make(TagSelector, len(tags))
+	for k, v := range tags {
+		c[k] = v
+	}
+
+	return c
+}
@@ -0,0 +1,209 @@
+package resolver
+
+import (
+	"encoding/json"
+	"errors"
+	"gopkg.in/yaml.v3"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDefaultConfig(t *testing.T) {
+	r, err := NewFromConfig(DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := New()
+	if !reflect.DeepEqual(r.Settings, want.Settings) {
+		t.Errorf("settings differ from New:\n%+v\n%+v", r.Settings, want.Settings)
+	}
+	if r.selectMode != want.selectMode || r.banThreshold != want.banThreshold {
+		t.Errorf(`expected mode %v/%d, got %v/%d`, want.selectMode, want.banThreshold, r.selectMode, r.banThreshold)
+	}
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Servers = []string{`10.0.0.1`, `10.0.0.2:5353`}
+	cfg.SelectMode = `random`
+	cfg.BanThreshold = 4
+	cfg.DialTimeout = Duration(time.Millisecond * 1500)
+	cfg.RetryLimit = 2
+	cfg.RequireTags = TagSelector{`region`: `eu`}
+	cfg.RoundRobinFamily = `AAAA`
+	cfg.FilteredAnswers = `retry`
+	cfg.FilteredPrefixes = []netip.Prefix{netip.MustParsePrefix(`10.10.0.0/16`)}
+	cfg.FailureWeights.Timeout = 5
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseConfig(data, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, cfg) {
+		t.Fatalf("round trip differs:\n%+v\n%+v", got, cfg)
+	}
+
+	data, err = yaml.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromYAML, err := ParseConfigYAML(data, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromYAML, cfg) {
+		t.Fatalf("YAML round trip differs:\n%+v\n%+v", fromYAML, cfg)
+	}
+
+	r, err := NewFromConfig(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := r.settings()
+	if s.DialTimeout != time.Millisecond*1500 || s.RetryLimit != 2 || s.RoundRobinFamily != TypeAAAA ||
+		s.FilteredAnswers != FilteredRetry || s.FailureWeights.Timeout != 5 || s.RequireTags[`region`] != `eu` {
+		t.Errorf(`unexpected settings %+v`, s)
+	}
+	if r.banThreshold != 4 || len(r.Servers.All()) != 2 {
+		t.Errorf(`unexpected servers %v, ban threshold %d`, r.Servers.All(), r.banThreshold)
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`{"retry_limit": 1, "retry_sleep": "20ms"}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RetryLimit != 1 || cfg.RetrySleep != Duration(time.Millisecond*20) {
+		t.Errorf(`unexpected config %+v`, cfg)
+	}
+	if cfg.MaxFails != DefaultConfig().MaxFails {
+		t.Errorf(`expected the default max fails, got %d`, cfg.MaxFails)
+	}
+
+	if _, err := ParseConfig([]byte(`{"retry_limt": 1}`), true); err == nil {
+		t.Error(`expected an unknown field to fail in strict mode`)
+	}
+	if _, err := ParseConfig([]byte(`{"retry_limt": 1}`), false); err != nil {
+		t.Errorf(`expected an unknown field to pass, got %v`, err)
+	}
+
+	bad := []string{
+		`{"retry_sleep": "soon"}`,
+		`{"retry_sleep": "-1s"}`,
+		`{"select_mode": "fastest"}`,
+		`{"filtered_answers": "drop"}`,
+		`{"round_robin_family": "MX"}`,
+		`{"audit_fraction": 2}`,
+		`{"bypass_on": ["retry_limit", "always"]}`,
+	}
+	for _, data := range bad {
+		if _, err := ParseConfig([]byte(data), true); err == nil {
+			t.Errorf(`%s: expected an error`, data)
+		}
+	}
+	if _, err := ParseConfig([]byte(`{"select_mode": "fastest"}`), true); !errors.Is(err, ErrBadOption) {
+		t.Errorf(`expected ErrBadOption, got %v`, err)
+	}
+}
+
+func TestParseConfigYAML(t *testing.T) {
+	cfg, err := ParseConfigYAML([]byte("retry_limit: 1\nretry_sleep: 20ms\nfiltered_prefixes: [10.10.0.0/16]\n"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RetryLimit != 1 || cfg.RetrySleep != Duration(time.Millisecond*20) || len(cfg.FilteredPrefixes) != 1 {
+		t.Errorf(`unexpected config %+v`, cfg)
+	}
+	if cfg, err := ParseConfigYAML(nil, true); err != nil || !reflect.DeepEqual(cfg, DefaultConfig()) {
+		t.Errorf(`expected the defaults for an empty config, got %v`, err)
+	}
+
+	if _, err := ParseConfigYAML([]byte(`retry_limt: 1`), true); err == nil {
+		t.Error(`expected an unknown field to fail in strict mode`)
+	}
+	if _, err := ParseConfigYAML([]byte(`retry_limt: 1`), false); err != nil {
+		t.Errorf(`expected an unknown field to pass, got %v`, err)
+	}
+	if _, err := ParseConfigYAML([]byte(`failure_weights: {timout: 1}`), true); err == nil {
+		t.Error(`expected an unknown nested field to fail in strict mode`)
+	}
+	if _, err := ParseConfigYAML([]byte(`select_mode: fastest`), true); !errors.Is(err, ErrBadOption) {
+		t.Errorf(`expected ErrBadOption, got %v`, err)
+	}
+}
+
+func TestNewFromConfigServerFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), `servers`)
+	if err := os.WriteFile(path, []byte("10.0.0.1\n10.0.0.2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.ServerFile = path
+	r, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(r.Servers.All()); n != 2 {
+		t.Errorf(`expected 2 servers, got %d`, n)
+	}
+
+	cfg.ServerFile = filepath.Join(t.TempDir(), `missing`)
+	if _, err := NewFromConfig(cfg); err == nil {
+		t.Error(`expected a missing server file to fail`)
+	}
+}
+
+func TestConfigSnapshot(t *testing.T) {
+	r, err := NewWithServers(`10.0.0.1`, `10.0.0.2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.RequireTags = TagSelector{`region`: `eu`}
+	r.RetryLimit = 3
+
+	c := r.ConfigSnapshot()
+	if !reflect.DeepEqual(c.Servers, []string{`10.0.0.1`, `10.0.0.2`}) || c.RetryLimit != 3 {
+		t.Errorf(`unexpected snapshot %+v`, c)
+	}
+	c.RequireTags[`region`] = `us`
+	if r.RequireTags[`region`] != `eu` {
+		t.Error(`expected the snapshot to share nothing with the resolver`)
+	}
+
+	clone, err := NewFromConfig(r.ConfigSnapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(clone.Settings, r.Settings) {
+		t.Errorf("settings differ:\n%+v\n%+v", clone.Settings, r.Settings)
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st map[string]interface{}
+	if err := json.Unmarshal(data, &st); err != nil {
+		t.Fatal(err)
+	}
+	if st[`server_count`] != 2.0 || st[`healthy_servers`] != 2.0 || st[`retry_limit`] != 3.0 ||
+		st[`effective_round_robin_ttl`] != `30s` || st[`select_mode`] != `rotate` {
+		t.Errorf(`unexpected json %s`, data)
+	}
+
+	want := `resolver: 2 servers (2 healthy, 0 quarantined), 0 routes, rotate, dial 2s, retry 3/500ms, max fails 30`
+	if s := r.String(); s != want {
+		t.Errorf(`expected %q, got %q`, want, s)
+	}
+}
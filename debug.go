@@ -0,0 +1,175 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// debugEvents is the number of recent events the debug page shows.
+const debugEvents = 100
+
+type debugHandler struct {
+	r       *Resolver
+	actions bool
+
+	events []ServerEvent
+	mu     sync.Mutex
+}
+
+// debugReport is what the debug page shows.
+type debugReport struct {
+	Settings    map[string]interface{}
+	Stats       Stats
+	Healthy     int
+	Servers     []ServerStat
+	Quarantined []QuarantinedServer
+	Events      []ServerEvent
+}
+
+// DebugHandler returns a page showing the settings, the servers with their
+// health, the stats and the recent events of the resolver, as JSON when
+// asked for with Accept: application/json and as HTML otherwise. With
+// actions set it also takes POSTs with an action form value:
+// validate re-validates the servers in the background, remove takes the
+// server form value out of rotation and flush empties the cache, which the
+// resolver does not have yet.
+func (r *Resolver) DebugHandler(actions bool) http.Handler {
+	h := &debugHandler{r: r, actions: actions}
+
+	events, _ := r.Subscribe(debugEvents)
+	go func() {
+		for e := range events {
+			h.mu.Lock()
+			if len(h.events) == debugEvents {
+				copy(h.events, h.events[1:])
+				h.events = h.events[:debugEvents-1]
+			}
+			h.events = append(h.events, e)
+			h.mu.Unlock()
+		}
+	}()
+
+	return h
+}
+
+func (h *debugHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		h.show(w, req)
+	case http.MethodPost:
+		h.act(w, req)
+	default:
+		w.Header().Set(`Allow`, `GET, HEAD, POST`)
+		http.Error(w, `method not allowed`, http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *debugHandler) report() debugReport {
+	h.mu.Lock()
+	events := append([]ServerEvent(nil), h.events...)
+	h.mu.Unlock()
+
+	return debugReport{
+		Settings:    settingsView(h.r.settings()),
+		Stats:       h.r.Stats(),
+		Healthy:     h.r.HealthyServers(),
+		Servers:     h.r.ServerStats(),
+		Quarantined: h.r.QuarantinedServers(),
+		Events:      events,
+	}
+}
+
+func (h *debugHandler) show(w http.ResponseWriter, req *http.Request) {
+	report := h.report()
+
+	if strings.Contains(req.Header.Get(`Accept`), `application/json`) {
+		w.Header().Set(`Content-Type`, `application/json`)
+		_ = json.NewEncoder(w).Encode(report)
+		return
+	}
+
+	w.Header().Set(`Content-Type`, `text/html; charset=utf-8`)
+	_ = debugPage.Execute(w, struct {
+		debugReport
+		Actions bool
+	}{report, h.actions})
+}
+
+func (h *debugHandler) act(w http.ResponseWriter, req *http.Request) {
+	if !h.actions {
+		http.Error(w, `actions are disabled`, http.StatusForbidden)
+		return
+	}
+
+	switch req.FormValue(`action`) {
+	case `validate`:
+		go h.r.ValidateServers(context.Background())
+	case `remove`:
+		if !h.r.RemoveServer(req.FormValue(`server`)) {
+			http.Error(w, `unknown server`, http.StatusNotFound)
+			return
+		}
+	case `flush`:
+		http.Error(w, `the resolver has no cache`, http.StatusNotImplemented)
+		return
+	default:
+		http.Error(w, `unknown action`, http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, req, req.URL.Path, http.StatusSeeOther)
+}
+
+// settingsView returns the settings fit for JSON, callbacks and other
+// interfaces are reduced to whether they are set.
+func settingsView(s Settings) map[string]interface{} {
+	view := make(map[string]interface{})
+
+	v := reflect.ValueOf(s)
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		name := v.Type().Field(i).Name
+
+		switch {
+		case f.Kind() == reflect.Func || f.Kind() == reflect.Interface:
+			view[name] = !f.IsNil()
+		case f.Type() == reflect.TypeOf(time.Duration(0)):
+			view[name] = time.Duration(f.Int()).String()
+		default:
+			view[name] = f.Interface()
+		}
+	}
+
+	return view
+}
+
+var debugPage = template.Must(template.New(`debug`).Parse(`<!DOCTYPE html>
+<html><head><title>resolver</title>
+<style>body{font-family:monospace}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:2px 6px;text-align:left}</style>
+</head><body>
+<h2>Stats</h2>
+<p>{{.Stats.Lookups}} lookups, {{.Stats.Successes}} successful, {{.Stats.NotFound}} not found, {{.Stats.RetryLimit}} over the retry limit,
+{{.Stats.EmptyList}} without servers, {{.Stats.Attempts}} attempts, {{.Stats.InFlight}} in flight, mean {{.Stats.MeanLatency}}</p>
+<h2>Servers</h2>
+<p>{{.Healthy}} healthy out of {{len .Servers}}</p>
+<table><tr><th>server</th><th>state</th><th>successes</th><th>failures</th><th>in a row</th><th>mean latency</th><th>last success</th><th>last error</th>{{if .Actions}}<th></th>{{end}}</tr>
+{{range .Servers}}<tr><td>{{.Addr}}</td><td>{{.State}}</td><td>{{.Successes}}</td><td>{{.Failures}}</td><td>{{.ConsecutiveFails}}</td><td>{{.MeanLatency}}</td>
+<td>{{if not .LastSuccess.IsZero}}{{.LastSuccess.Format "15:04:05"}}{{end}}</td><td>{{.LastError}}</td>
+{{if $.Actions}}<td><form method="post"><input type="hidden" name="action" value="remove"><input type="hidden" name="server" value="{{.Addr}}"><button>remove</button></form></td>{{end}}</tr>
+{{end}}</table>
+{{if .Actions}}<form method="post"><input type="hidden" name="action" value="validate"><button>validate servers</button></form>{{end}}
+<h2>Recent events</h2>
+<table><tr><th>time</th><th>event</th><th>server</th><th>reason</th></tr>
+{{range .Events}}<tr><td>{{.Time.Format "15:04:05.000"}}</td><td>{{.Type}}</td><td>{{.Server}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>
+<h2>Settings</h2>
+<table>{{range $name, $value := .Settings}}<tr><td>{{$name}}</td><td>{{$value}}</td></tr>
+{{end}}</table>
+</body></html>
+`))
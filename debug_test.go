@@ -0,0 +1,75 @@
+package resolver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDebugHandler(t *testing.T) {
+	r := New()
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2")
+	defer r.Close()
+
+	h := r.DebugHandler(false)
+
+	req := httptest.NewRequest(http.MethodGet, `/debug/resolver`, nil)
+	req.Header.Set(`Accept`, `application/json`)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var report map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf(`%v: %s`, err, rec.Body.String())
+	}
+	for _, key := range []string{`Settings`, `Stats`, `Servers`, `Events`} {
+		if _, ok := report[key]; !ok {
+			t.Errorf(`missing %s`, key)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, `/debug/resolver`, nil))
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, `10.0.0.2`) || strings.Contains(body, `<form`) {
+		t.Errorf(`unexpected page %d %s`, rec.Code, body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, `/debug/resolver?action=validate`, nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf(`expected actions to be refused, got %d`, rec.Code)
+	}
+}
+
+func TestDebugHandlerActions(t *testing.T) {
+	r := New()
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2")
+	defer r.Close()
+
+	h := r.DebugHandler(true)
+
+	post := func(form url.Values) int {
+		req := httptest.NewRequest(http.MethodPost, `/debug/resolver`, strings.NewReader(form.Encode()))
+		req.Header.Set(`Content-Type`, `application/x-www-form-urlencoded`)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := post(url.Values{`action`: {`remove`}, `server`: {`10.0.0.1`}}); code != http.StatusSeeOther {
+		t.Errorf(`remove: unexpected status %d`, code)
+	}
+	if code := post(url.Values{`action`: {`remove`}, `server`: {`10.0.0.9`}}); code != http.StatusNotFound {
+		t.Errorf(`remove unknown: unexpected status %d`, code)
+	}
+	if code := post(url.Values{`action`: {`flush`}}); code != http.StatusNotImplemented {
+		t.Errorf(`flush: unexpected status %d`, code)
+	}
+
+	if r.HealthyServers() != 1 {
+		t.Errorf(`expected one server left in rotation, got %d`, r.HealthyServers())
+	}
+}
@@ -0,0 +1,174 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// ResolvConfPath is where DefaultFromSystem reads the system servers.
+	ResolvConfPath = `/etc/resolv.conf`
+
+	defaultRetryMin = time.Second
+	defaultRetryMax = time.Minute * 5
+)
+
+// std is the resolver of the package-level lookups.
+var std struct {
+	r     *Resolver
+	err   error
+	retry time.Time // when a failed load may be made again
+	wait  time.Duration
+	mu    sync.Mutex
+}
+
+// loadDefault makes the default resolver on first use.
+var loadDefault = func() (*Resolver, error) {
+	r := New()
+	r.EmbeddedFallback = true
+	report, err := r.LoadServersFromURL(ServerListURL)
+	if err != nil {
+		return nil, err
+	}
+	if report.Added == 0 {
+		return nil, ErrNoValidServer
+	}
+
+	return r, nil
+}
+
+// Default returns the resolver of the package-level lookups.
+//
+// Unless SetDefault or DefaultFromSystem came first, the first call makes
+// it by fetching ServerListURL over the network, the other callers meanwhile
+// wait for it. The embedded servers are loaded when the fetch fails. A
+// failed load is returned to every call for a while, one second at first
+// and twice as long after every failure up to five minutes, then tried
+// again.
+func Default() (*Resolver, error) {
+	std.mu.Lock()
+	defer std.mu.Unlock()
+
+	if std.r != nil {
+		return std.r, nil
+	}
+	if std.err != nil && time.Now().Before(std.retry) {
+		return nil, std.err
+	}
+
+	r, err := loadDefault()
+	if err != nil {
+		if std.wait = std.wait * 2; std.wait < defaultRetryMin {
+			std.wait = defaultRetryMin
+		} else if std.wait > defaultRetryMax {
+			std.wait = defaultRetryMax
+		}
+		std.err, std.retry = err, time.Now().Add(std.wait)
+		return nil, err
+	}
+	std.r, std.err, std.wait = r, nil, 0
+
+	return r, nil
+}
+
+// SetDefault makes r the resolver of the package-level lookups, no server
+// list is fetched then.
+func SetDefault(r *Resolver) {
+	std.mu.Lock()
+	defer std.mu.Unlock()
+
+	std.r, std.err, std.wait = r, nil, 0
+}
+
+// DefaultFromSystem makes the resolver of the package-level lookups one
+// set up from ResolvConfPath, see ResolvConf.Options, instead of the list
+// fetched from ServerListURL.
+func DefaultFromSystem() error {
+	conf, err := ReadResolvConf(ResolvConfPath)
+	if err != nil {
+		return err
+	}
+	if len(conf.Nameservers) == 0 {
+		return ErrNoValidServer
+	}
+
+	r, err := NewWithOptions(conf.Options()...)
+	if err != nil {
+		return err
+	}
+	SetDefault(r)
+
+	return nil
+}
+
+// LookupIPAddr is Resolver.LookupIPAddr of the Default resolver.
+func LookupIPAddr(host string, opts ...LookupOption) ([]net.IPAddr, error) {
+	r, err := Default()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.LookupIPAddr(host, opts...)
+}
+
+// LookupAddr is Resolver.LookupAddr of the Default resolver.
+func LookupAddr(ip string, opts ...LookupOption) ([]string, error) {
+	r, err := Default()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.LookupAddr(ip, opts...)
+}
+
+// LookupNS is Resolver.LookupNS of the Default resolver.
+func LookupNS(host string, opts ...LookupOption) ([]*net.NS, error) {
+	r, err := Default()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.LookupNS(host, opts...)
+}
+
+// LookupTXT is Resolver.LookupTXT of the Default resolver.
+func LookupTXT(host string, opts ...LookupOption) ([]string, error) {
+	r, err := Default()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.LookupTXT(host, opts...)
+}
+
+// LookupCNAME is Resolver.LookupCNAME of the Default resolver.
+func LookupCNAME(host string, opts ...LookupOption) (string, error) {
+	r, err := Default()
+	if err != nil {
+		return ``, err
+	}
+
+	return r.LookupCNAME(host, opts...)
+}
+
+// LookupMX is Resolver.LookupMX of the Default resolver.
+func LookupMX(host string, opts ...LookupOption) ([]*net.MX, error) {
+	r, err := Default()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.LookupMX(host, opts...)
+}
+
+// Query is Resolver.Query of the Default resolver.
+func Query(ctx context.Context, name string, qtype Type, opts ...LookupOption) (*Message, error) {
+	r, err := Default()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Query(ctx, name, qtype, opts...)
+}
@@ -0,0 +1,85 @@
+package resolver
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubDefault replaces the load of the default resolver for the test.
+func stubDefault(t *testing.T, load func() (*Resolver, error)) {
+	saved := loadDefault
+	loadDefault = load
+	SetDefault(nil)
+	t.Cleanup(func() {
+		loadDefault = saved
+		SetDefault(nil)
+	})
+}
+
+func TestDefaultConcurrentInit(t *testing.T) {
+	var loads int32
+	want := New()
+	stubDefault(t, func() (*Resolver, error) {
+		atomic.AddInt32(&loads, 1)
+		time.Sleep(time.Millisecond * 20)
+		return want, nil
+	})
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if r, err := Default(); err != nil || r != want {
+				t.Errorf(`expected the loaded resolver, got %p, %v`, r, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if loads != 1 {
+		t.Errorf(`expected one load, got %d`, loads)
+	}
+	var empty *EmptyListError
+	if _, err := LookupIPAddr(`example.com`); !errors.As(err, &empty) {
+		t.Errorf(`expected the lookup through the default resolver, got %v`, err)
+	}
+}
+
+func TestDefaultRetry(t *testing.T) {
+	var loads int32
+	down := errors.New(`down`)
+	stubDefault(t, func() (*Resolver, error) {
+		atomic.AddInt32(&loads, 1)
+		return nil, down
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := LookupTXT(`example.com`); err != down {
+			t.Errorf(`expected the load error, got %v`, err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf(`expected the failure kept, got %d loads`, loads)
+	}
+
+	std.mu.Lock()
+	wait := std.wait
+	std.retry = time.Time{}
+	std.mu.Unlock()
+	if wait != defaultRetryMin {
+		t.Errorf(`expected a wait of %s, got %s`, defaultRetryMin, wait)
+	}
+
+	_, _ = Default()
+	std.mu.Lock()
+	wait = std.wait
+	std.mu.Unlock()
+	if loads != 2 || wait != defaultRetryMin*2 {
+		t.Errorf(`expected a second load waiting twice as long, got %d loads, %s`, loads, wait)
+	}
+}
@@ -0,0 +1,81 @@
+package resolver
+
+import (
+	"context"
+	"net"
+)
+
+// DialContext connects to address, a host and port, the way net.Dialer
+// does but with the host looked up by r. The addresses are tried in the
+// order of LookupIPAddr, those of RoundRobinFamily first when it is set,
+// until one connects, the error of the last one is returned otherwise.
+// The tcp4, udp4, tcp6 and udp6 networks keep to the addresses of their
+// family. An IP literal host is dialed as it is. It can be set as the
+// DialContext of an http.Transport.
+func (r *Resolver) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	if net.ParseIP(host) != nil {
+		return d.DialContext(ctx, network, address)
+	}
+
+	ips, err := r.LookupIPAddr(host, WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	ips = familyFirst(ips, r.settings().RoundRobinFamily)
+
+	var last error
+	for _, ip := range ips {
+		if !networkTakes(network, ip.IP) {
+			continue
+		}
+
+		conn, err := d.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		last = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if last == nil {
+		last = &net.OpError{Op: `dial`, Net: network, Err: &net.AddrError{Err: `no suitable address found`, Addr: host}}
+	}
+
+	return nil, last
+}
+
+// familyFirst moves the addresses of family ahead of the others.
+func familyFirst(ips []net.IPAddr, family Type) []net.IPAddr {
+	if family != TypeA && family != TypeAAAA {
+		return ips
+	}
+
+	sorted := make([]net.IPAddr, 0, len(ips))
+	for _, first := range []bool{true, false} {
+		for _, ip := range ips {
+			if ((ip.IP.To4() != nil) == (family == TypeA)) == first {
+				sorted = append(sorted, ip)
+			}
+		}
+	}
+
+	return sorted
+}
+
+func networkTakes(network string, ip net.IP) bool {
+	switch network {
+	case `tcp4`, `udp4`:
+		return ip.To4() != nil
+	case `tcp6`, `udp6`:
+		return ip.To4() == nil
+	}
+
+	return true
+}
@@ -0,0 +1,77 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestDialContext(t *testing.T) {
+	ln, err := net.Listen(`tcp`, `127.0.0.1:0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	server := newTestServer(t, func(q Question, resp *Message) {
+		if q.Type != TypeA {
+			return
+		}
+		// nothing listens on 127.0.0.2, the dial moves on to 127.0.0.1
+		for _, ip := range []string{`127.0.0.2`, `127.0.0.1`} {
+			resp.Answers = append(resp.Answers, RR{Name: q.Name, Type: TypeA, TTL: 60, IP: net.ParseIP(ip)})
+		}
+	})
+	r := New()
+	if _, err := r.LoadServersFromString(server.Addr); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := r.DialContext(context.Background(), `tcp`, net.JoinHostPort(`svc.example.com`, port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := conn.RemoteAddr().String(); got != ln.Addr().String() {
+		t.Errorf(`expected %s, got %s`, ln.Addr(), got)
+	}
+	conn.Close()
+
+	queries := len(server.Queries())
+	conn, err = r.DialContext(context.Background(), `tcp`, ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if len(server.Queries()) != queries {
+		t.Error(`expected an IP literal to be dialed without a lookup`)
+	}
+
+	if _, err := r.DialContext(context.Background(), `tcp6`, net.JoinHostPort(`svc.example.com`, port)); err == nil {
+		t.Error(`expected tcp6 to find no address`)
+	}
+	if _, err := r.DialContext(context.Background(), `tcp`, `svc.example.com`); err == nil {
+		t.Error(`expected an address without a port to fail`)
+	}
+}
+
+func TestFamilyFirst(t *testing.T) {
+	ips := []net.IPAddr{{IP: net.ParseIP(`192.0.2.1`)}, {IP: net.ParseIP(`2001:db8::1`)}, {IP: net.ParseIP(`192.0.2.2`)}}
+
+	got := familyFirst(ips, TypeAAAA)
+	if got[0].String() != `2001:db8::1` || got[1].String() != `192.0.2.1` || got[2].String() != `192.0.2.2` {
+		t.Errorf(`unexpected order %v`, got)
+	}
+	if got := familyFirst(ips, 0); &got[0] != &ips[0] {
+		t.Errorf(`expected the addresses left alone, got %v`, got)
+	}
+}
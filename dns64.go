@@ -0,0 +1,181 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+var ErrNoDNS64 = errors.New(`resolver: no DNS64 prefix`)
+
+// dns64Retry is how long a failed discovery of the DNS64 prefix is kept
+// before it is tried again, and the shortest a discovered one is kept.
+const dns64Retry = time.Minute
+
+var (
+	// ipv4onlyAddrs are the addresses of ipv4only.arpa, RFC 7050.
+	ipv4onlyAddrs = []netip.Addr{netip.MustParseAddr(`192.0.0.170`), netip.MustParseAddr(`192.0.0.171`)}
+
+	// dns64Lengths are the prefix lengths of RFC 6052, the longest first.
+	dns64Lengths = []int{96, 64, 56, 48, 40, 32}
+)
+
+// dns64State is the DNS64 prefix discovered last and until when it holds.
+type dns64State struct {
+	mu      sync.Mutex
+	prefix  netip.Prefix
+	err     error
+	expires time.Time
+}
+
+// DiscoverDNS64Prefix finds the prefix the DNS64 of the servers of the list
+// embeds the IPv4 addresses in, the way RFC 7050 does: it asks for the AAAA
+// records of ipv4only.arpa, a name with IPv4 addresses only, and looks for
+// those in the answer. Without a DNS64 it fails with ErrNoDNS64.
+func (r *Resolver) DiscoverDNS64Prefix(ctx context.Context) (netip.Prefix, error) {
+	prefix, _, err := r.discoverDNS64(ctx)
+	return prefix, err
+}
+
+// discoverDNS64 is DiscoverDNS64Prefix, with the TTL of the record.
+func (r *Resolver) discoverDNS64(ctx context.Context) (netip.Prefix, time.Duration, error) {
+	m, err := r.Query(ctx, `ipv4only.arpa`, TypeAAAA)
+	if errors.Is(err, ErrNoData) || errors.Is(err, ErrNoSuchHost) {
+		return netip.Prefix{}, 0, ErrNoDNS64
+	}
+	if err != nil {
+		return netip.Prefix{}, 0, err
+	}
+
+	for _, rr := range m.Answers {
+		addr, ok := netip.AddrFromSlice(rr.IP)
+		if rr.Type != TypeAAAA || !ok {
+			continue
+		}
+		for _, bits := range dns64Lengths {
+			v4 := extractIPv4(addr, bits)
+			if v4 == ipv4onlyAddrs[0] || v4 == ipv4onlyAddrs[1] {
+				return netip.PrefixFrom(addr, bits).Masked(), time.Duration(rr.TTL) * time.Second, nil
+			}
+		}
+	}
+
+	return netip.Prefix{}, 0, ErrNoDNS64
+}
+
+// dns64Prefix returns DNS64Prefix, or when it is zero the discovered one,
+// discovering it again once the TTL of the answer has passed.
+func (r *Resolver) dns64Prefix(ctx context.Context, s *Settings) (netip.Prefix, error) {
+	if s.DNS64Prefix.IsValid() {
+		return s.DNS64Prefix, nil
+	}
+
+	d := r.dns64
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if time.Now().Before(d.expires) {
+		return d.prefix, d.err
+	}
+
+	var ttl time.Duration
+	d.prefix, ttl, d.err = r.discoverDNS64(ctx)
+	if ttl < dns64Retry {
+		ttl = dns64Retry
+	}
+	d.expires = time.Now().Add(ttl)
+	if d.err != nil && ctx.Err() != nil {
+		// the caller gave up, not the discovery
+		d.expires = time.Time{}
+	}
+
+	return d.prefix, d.err
+}
+
+// synthesize adds the IPv6 addresses of DNS64 to an answer of LookupIPAddr
+// with IPv4 addresses only. An answer with an IPv6 address is left as it is,
+// so is one when there is no prefix.
+func (r *Resolver) synthesize(host string, ipList []net.IPAddr, opts []LookupOption) []net.IPAddr {
+	o := r.lookupOptions(opts)
+	if !o.settings.DNS64 {
+		return ipList
+	}
+	for _, ip := range ipList {
+		if ip.IP.To4() == nil {
+			return ipList
+		}
+	}
+
+	prefix, err := r.dns64Prefix(o.ctx, &o.settings)
+	if err != nil {
+		if l := o.settings.Logger; l != nil {
+			l.Debug(`resolver: no DNS64 prefix`, `host`, host, `err`, err)
+		}
+		return ipList
+	}
+
+	var synthesized []net.IPAddr
+	for _, ip := range ipList {
+		v4, ok := netip.AddrFromSlice(ip.IP.To4())
+		if !ok || v4.IsLoopback() || v4.IsLinkLocalUnicast() || v4.IsUnspecified() {
+			continue
+		}
+		synthesized = append(synthesized, net.IPAddr{IP: embedIPv4(prefix, v4).AsSlice()})
+	}
+	if len(synthesized) > 0 && o.meta != nil {
+		o.meta.Synthesized = true
+	}
+
+	return append(ipList, synthesized...)
+}
+
+// embedIPv4 returns the IPv6 address of v4 in prefix, RFC 6052 section 2.2:
+// the bits 64 to 71 stay zero.
+func embedIPv4(prefix netip.Prefix, v4 netip.Addr) netip.Addr {
+	b := prefix.Masked().Addr().As16()
+	ip := v4.As4()
+	for i, j := 0, prefix.Bits()/8; i < len(ip); j++ {
+		if j == 8 {
+			continue
+		}
+		b[j] = ip[i]
+		i++
+	}
+
+	return netip.AddrFrom16(b)
+}
+
+// extractIPv4 is the reverse of embedIPv4 for a prefix of bits.
+func extractIPv4(addr netip.Addr, bits int) netip.Addr {
+	b := addr.As16()
+	var ip [4]byte
+	for i, j := 0, bits/8; i < len(ip); j++ {
+		if j == 8 {
+			continue
+		}
+		ip[i] = b[j]
+		i++
+	}
+
+	return netip.AddrFrom4(ip)
+}
+
+// validDNS64Prefix reports a DNS64Prefix of a length RFC 6052 has no place
+// for the IPv4 address in.
+func validDNS64Prefix(p netip.Prefix) error {
+	if !p.IsValid() {
+		return nil
+	}
+	if p.Addr().Is6() && !p.Addr().Is4In6() {
+		for _, bits := range dns64Lengths {
+			if p.Bits() == bits {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf(`%w: DNS64 prefix %s`, ErrBadOption, p)
+}
@@ -0,0 +1,111 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+func TestEmbedIPv4(t *testing.T) {
+	// the examples of RFC 6052 section 2.4
+	v4 := netip.MustParseAddr(`192.0.2.33`)
+	for prefix, want := range map[string]string{
+		`2001:db8::/32`:         `2001:db8:c000:221::`,
+		`2001:db8:100::/40`:     `2001:db8:1c0:2:21::`,
+		`2001:db8:122::/48`:     `2001:db8:122:c000:2:2100::`,
+		`2001:db8:122:300::/56`: `2001:db8:122:3c0:0:221::`,
+		`2001:db8:122:344::/64`: `2001:db8:122:344:c0:2:2100:0`,
+		`2001:db8:122:344::/96`: `2001:db8:122:344::c000:221`,
+	} {
+		p := netip.MustParsePrefix(prefix)
+		got := embedIPv4(p, v4)
+		if got != netip.MustParseAddr(want) {
+			t.Errorf(`%s: expected %s, got %s`, prefix, want, got)
+		}
+		if back := extractIPv4(got, p.Bits()); back != v4 {
+			t.Errorf(`%s: expected %s back, got %s`, prefix, v4, back)
+		}
+	}
+}
+
+func TestDiscoverDNS64Prefix(t *testing.T) {
+	prefix := netip.MustParsePrefix(`2001:db8:122:344::/64`)
+	nat64 := newTestServer(t, func(q Question, resp *Message) {
+		if q.Name == `ipv4only.arpa.` && q.Type == TypeAAAA {
+			for _, v4 := range ipv4onlyAddrs {
+				resp.Answers = append(resp.Answers, RR{Name: q.Name, Type: TypeAAAA, TTL: 600, IP: embedIPv4(prefix, v4).AsSlice()})
+			}
+		}
+	})
+	plain := newTestServer(t, func(q Question, resp *Message) {
+		if q.Name == `ipv4only.arpa.` && q.Type == TypeA {
+			resp.Answers = append(resp.Answers, RR{Name: q.Name, Type: TypeA, TTL: 600, IP: net.ParseIP(`192.0.0.170`)})
+		}
+	})
+
+	r := New()
+	r.RetryLimit = 1
+	if _, err := r.LoadServersFromString(nat64.Addr); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := r.DiscoverDNS64Prefix(context.Background()); err != nil || got != prefix {
+		t.Errorf(`expected %s, got %s, %v`, prefix, got, err)
+	}
+
+	r = New()
+	r.RetryLimit = 1
+	if _, err := r.LoadServersFromString(plain.Addr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.DiscoverDNS64Prefix(context.Background()); !errors.Is(err, ErrNoDNS64) {
+		t.Errorf(`expected ErrNoDNS64, got %v`, err)
+	}
+}
+
+func TestDNS64Synthesis(t *testing.T) {
+	ts := newTestServer(t, func(q Question, resp *Message) {
+		switch {
+		case q.Name == `ipv4only.arpa.` && q.Type == TypeAAAA:
+			resp.Answers = []RR{{Name: q.Name, Type: TypeAAAA, TTL: 600, IP: net.ParseIP(`64:ff9b::c000:aa`)}}
+		case q.Type == TypeA:
+			resp.Answers = []RR{{Name: q.Name, Type: TypeA, TTL: 60, IP: net.ParseIP(`192.0.2.1`)}}
+		case q.Name == `dual.example.` && q.Type == TypeAAAA:
+			resp.Answers = []RR{{Name: q.Name, Type: TypeAAAA, TTL: 60, IP: net.ParseIP(`2001:db8::1`)}}
+		}
+	})
+
+	r := New()
+	r.DNS64 = true
+	r.RetryLimit = 1
+	if _, err := r.LoadServersFromString(ts.Addr); err != nil {
+		t.Fatal(err)
+	}
+
+	var meta LookupMeta
+	ips, err := r.LookupIPAddr(`v4only.example`, WithMeta(&meta))
+	if err != nil || len(ips) != 2 || ips[1].IP.String() != `64:ff9b::c000:201` || !meta.Synthesized {
+		t.Errorf(`expected an address made up in the discovered prefix, got %v, %+v, %v`, ips, meta, err)
+	}
+
+	ips, err = r.LookupIPAddr(`dual.example`, WithMeta(&meta))
+	if err != nil || len(ips) != 2 || meta.Synthesized {
+		t.Errorf(`expected the AAAA record only, got %v, %+v, %v`, ips, meta, err)
+	}
+	for _, ip := range ips {
+		if ip.IP.String() == `64:ff9b::c000:201` {
+			t.Errorf(`expected no address made up next to a real AAAA, got %v`, ips)
+		}
+	}
+
+	r.DNS64Prefix = netip.MustParsePrefix(`2001:db8:64::/96`)
+	if ips, err := r.LookupIPAddr(`v4only.example`); err != nil || len(ips) != 2 || ips[1].IP.String() != `2001:db8:64::c000:201` {
+		t.Errorf(`expected an address made up in the configured prefix, got %v, %v`, ips, err)
+	}
+
+	r.DNS64Prefix = netip.MustParsePrefix(`2001:db8::/33`)
+	if err := r.Settings.validate(); !errors.Is(err, ErrBadOption) {
+		t.Errorf(`expected ErrBadOption for a /33, got %v`, err)
+	}
+}
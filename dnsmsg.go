@@ -0,0 +1,476 @@
+package resolver
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Type is a DNS record type.
+type Type uint16
+
+const (
+	TypeA      Type = 1
+	TypeNS     Type = 2
+	TypeCNAME  Type = 5
+	TypeSOA    Type = 6
+	TypePTR    Type = 12
+	TypeMX     Type = 15
+	TypeTXT    Type = 16
+	TypeAAAA   Type = 28
+	TypeSRV    Type = 33
+	TypeOPT    Type = 41
+	TypeDS     Type = 43
+	TypeRRSIG  Type = 46
+	TypeNSEC   Type = 47
+	TypeDNSKEY Type = 48
+	TypeNSEC3  Type = 50
+	TypeANY    Type = 255
+)
+
+const classINET = 1
+
+// DNS response codes.
+const (
+	RcodeSuccess        = 0
+	RcodeFormatError    = 1
+	RcodeServerFailure  = 2
+	RcodeNameError      = 3
+	RcodeNotImplemented = 4
+	RcodeRefused        = 5
+)
+
+var typeNames = map[Type]string{
+	TypeA:      `A`,
+	TypeNS:     `NS`,
+	TypeCNAME:  `CNAME`,
+	TypeSOA:    `SOA`,
+	TypePTR:    `PTR`,
+	TypeMX:     `MX`,
+	TypeTXT:    `TXT`,
+	TypeAAAA:   `AAAA`,
+	TypeSRV:    `SRV`,
+	TypeOPT:    `OPT`,
+	TypeDS:     `DS`,
+	TypeRRSIG:  `RRSIG`,
+	TypeNSEC:   `NSEC`,
+	TypeDNSKEY: `DNSKEY`,
+	TypeNSEC3:  `NSEC3`,
+	TypeANY:    `ANY`,
+}
+
+func (t Type) String() string {
+	if s, ok := typeNames[t]; ok {
+		return s
+	}
+	return `TYPE` + strconv.Itoa(int(t))
+}
+
+// RcodeName returns the conventional mnemonic of a response code.
+func RcodeName(rcode int) string {
+	switch rcode {
+	case RcodeSuccess:
+		return `NOERROR`
+	case RcodeFormatError:
+		return `FORMERR`
+	case RcodeServerFailure:
+		return `SERVFAIL`
+	case RcodeNameError:
+		return `NXDOMAIN`
+	case RcodeNotImplemented:
+		return `NOTIMP`
+	case RcodeRefused:
+		return `REFUSED`
+	}
+	return `RCODE` + strconv.Itoa(rcode)
+}
+
+var (
+	errMsgShort = errors.New(`resolver: short dns message`)
+	errMsgName  = errors.New(`resolver: bad name in dns message`)
+	errMsgData  = errors.New(`resolver: bad record data in dns message`)
+)
+
+type Header struct {
+	ID                 uint16
+	Response           bool
+	Opcode             int
+	Authoritative      bool
+	Truncated          bool
+	RecursionDesired   bool
+	RecursionAvailable bool
+	AuthenticData      bool
+	CheckingDisabled   bool
+	Rcode              int
+}
+
+type Question struct {
+	Name string
+	Type Type
+}
+
+// RR is a resource record. Data is the raw record data with names inside it
+// decompressed, the commonly used record types are also decoded into the
+// typed fields.
+type RR struct {
+	Name  string
+	Type  Type
+	Class uint16
+	TTL   uint32
+	Data  []byte
+
+	IP       net.IP   // A, AAAA
+	Target   string   // CNAME, NS, PTR, MX, SRV; SOA primary server
+	Pref     uint16   // MX preference, SRV priority
+	Weight   uint16   // SRV
+	Port     uint16   // SRV
+	Text     []string // TXT
+	MinTTL   uint32   // SOA negative caching TTL
+	Mailbox  string   // SOA
+	ExtRcode int      // OPT upper rcode bits
+}
+
+type Message struct {
+	Header
+	Questions   []Question
+	Answers     []RR
+	Authorities []RR
+	Additionals []RR
+}
+
+func (h Header) flags() uint16 {
+	f := uint16(h.Opcode&0xf)<<11 | uint16(h.Rcode&0xf)
+	f |= flagBit(h.Response, 15) | flagBit(h.Authoritative, 10) | flagBit(h.Truncated, 9)
+	f |= flagBit(h.RecursionDesired, 8) | flagBit(h.RecursionAvailable, 7)
+	f |= flagBit(h.AuthenticData, 5) | flagBit(h.CheckingDisabled, 4)
+
+	return f
+}
+
+func flagBit(set bool, bit uint) uint16 {
+	if set {
+		return 1 << bit
+	}
+	return 0
+}
+
+func (h *Header) setFlags(f uint16) {
+	h.Response = f&(1<<15) != 0
+	h.Opcode = int(f>>11) & 0xf
+	h.Authoritative = f&(1<<10) != 0
+	h.Truncated = f&(1<<9) != 0
+	h.RecursionDesired = f&(1<<8) != 0
+	h.RecursionAvailable = f&(1<<7) != 0
+	h.AuthenticData = f&(1<<5) != 0
+	h.CheckingDisabled = f&(1<<4) != 0
+	h.Rcode = int(f & 0xf)
+}
+
+// Pack encodes the message without name compression. Records use Data when
+// it is set and otherwise are encoded from their typed fields.
+func (m *Message) Pack() ([]byte, error) {
+	b := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(b[0:], m.ID)
+	binary.BigEndian.PutUint16(b[2:], m.flags())
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.Questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.Answers)))
+	binary.BigEndian.PutUint16(b[8:], uint16(len(m.Authorities)))
+	binary.BigEndian.PutUint16(b[10:], uint16(len(m.Additionals)))
+
+	var err error
+	for _, q := range m.Questions {
+		if b, err = appendName(b, q.Name); err != nil {
+			return nil, err
+		}
+		b = appendUint16(b, uint16(q.Type))
+		b = appendUint16(b, classINET)
+	}
+
+	for _, section := range [][]RR{m.Answers, m.Authorities, m.Additionals} {
+		for i := range section {
+			if b, err = section[i].pack(b); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return b, nil
+}
+
+func (rr *RR) pack(b []byte) ([]byte, error) {
+	b, err := appendName(b, rr.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	class := rr.Class
+	if class == 0 {
+		class = classINET
+	}
+
+	b = appendUint16(b, uint16(rr.Type))
+	b = appendUint16(b, class)
+	b = append(b, byte(rr.TTL>>24), byte(rr.TTL>>16), byte(rr.TTL>>8), byte(rr.TTL))
+
+	data := rr.Data
+	if data == nil {
+		if data, err = rr.packData(); err != nil {
+			return nil, err
+		}
+	}
+
+	b = appendUint16(b, uint16(len(data)))
+	return append(b, data...), nil
+}
+
+func (rr *RR) packData() ([]byte, error) {
+	switch rr.Type {
+	case TypeA:
+		return rr.IP.To4(), nil
+	case TypeAAAA:
+		return rr.IP.To16(), nil
+	case TypeCNAME, TypeNS, TypePTR:
+		return appendName(nil, rr.Target)
+	case TypeMX:
+		return appendName(appendUint16(nil, rr.Pref), rr.Target)
+	case TypeSRV:
+		b := appendUint16(nil, rr.Pref)
+		b = appendUint16(b, rr.Weight)
+		b = appendUint16(b, rr.Port)
+		return appendName(b, rr.Target)
+	case TypeTXT:
+		var b []byte
+		for _, s := range rr.Text {
+			b = append(append(b, byte(len(s))), s...)
+		}
+		return b, nil
+	case TypeSOA:
+		b, err := appendName(nil, rr.Target)
+		if err != nil {
+			return nil, err
+		}
+		if b, err = appendName(b, rr.Mailbox); err != nil {
+			return nil, err
+		}
+		b = append(b, make([]byte, 16)...)
+		return append(b, byte(rr.MinTTL>>24), byte(rr.MinTTL>>16), byte(rr.MinTTL>>8), byte(rr.MinTTL)), nil
+	}
+	return nil, nil
+}
+
+// Unpack decodes a message, following compression pointers in names.
+func (m *Message) Unpack(msg []byte) error {
+	if len(msg) < 12 {
+		return errMsgShort
+	}
+
+	*m = Message{}
+	m.ID = binary.BigEndian.Uint16(msg[0:])
+	m.setFlags(binary.BigEndian.Uint16(msg[2:]))
+
+	counts := [4]int{}
+	for i := range counts {
+		counts[i] = int(binary.BigEndian.Uint16(msg[4+i*2:]))
+	}
+
+	off := 12
+	for i := 0; i < counts[0]; i++ {
+		name, n, err := readName(msg, off)
+		if err != nil {
+			return err
+		}
+		if off = n + 4; off > len(msg) {
+			return errMsgShort
+		}
+		m.Questions = append(m.Questions, Question{
+			Name: name,
+			Type: Type(binary.BigEndian.Uint16(msg[n:])),
+		})
+	}
+
+	sections := []*[]RR{&m.Answers, &m.Authorities, &m.Additionals}
+	for s, section := range sections {
+		for i := 0; i < counts[s+1]; i++ {
+			var rr RR
+			var err error
+			if off, err = rr.unpack(msg, off); err != nil {
+				return err
+			}
+			if rr.Type == TypeOPT {
+				rr.ExtRcode = int(rr.TTL >> 24)
+				m.Rcode |= rr.ExtRcode << 4
+			}
+			*section = append(*section, rr)
+		}
+	}
+
+	return nil
+}
+
+func (rr *RR) unpack(msg []byte, off int) (int, error) {
+	name, off, err := readName(msg, off)
+	if err != nil {
+		return 0, err
+	}
+	if off+10 > len(msg) {
+		return 0, errMsgShort
+	}
+
+	rr.Name = name
+	rr.Type = Type(binary.BigEndian.Uint16(msg[off:]))
+	rr.Class = binary.BigEndian.Uint16(msg[off+2:])
+	rr.TTL = binary.BigEndian.Uint32(msg[off+4:])
+	size := int(binary.BigEndian.Uint16(msg[off+8:]))
+	off += 10
+
+	end := off + size
+	if end > len(msg) {
+		return 0, errMsgShort
+	}
+	data := msg[off:end]
+
+	switch rr.Type {
+	case TypeA:
+		if size != net.IPv4len {
+			return 0, errMsgData
+		}
+		rr.IP = append(net.IP(nil), data...)
+	case TypeAAAA:
+		if size != net.IPv6len {
+			return 0, errMsgData
+		}
+		rr.IP = append(net.IP(nil), data...)
+	case TypeCNAME, TypeNS, TypePTR:
+		rr.Target, err = readDataName(msg, off, end)
+	case TypeMX:
+		if size < 2 {
+			return 0, errMsgShort
+		}
+		rr.Pref = binary.BigEndian.Uint16(data)
+		rr.Target, err = readDataName(msg, off+2, end)
+	case TypeSRV:
+		if size < 6 {
+			return 0, errMsgShort
+		}
+		rr.Pref = binary.BigEndian.Uint16(data)
+		rr.Weight = binary.BigEndian.Uint16(data[2:])
+		rr.Port = binary.BigEndian.Uint16(data[4:])
+		rr.Target, err = readDataName(msg, off+6, end)
+	case TypeTXT:
+		for i := 0; i < len(data); {
+			n := int(data[i])
+			if i+1+n > len(data) {
+				return 0, errMsgShort
+			}
+			rr.Text = append(rr.Text, string(data[i+1:i+1+n]))
+			i += 1 + n
+		}
+	case TypeSOA:
+		var n int
+		if rr.Target, n, err = readName(msg, off); err == nil {
+			if rr.Mailbox, n, err = readName(msg, n); err == nil && n+20 <= end {
+				rr.MinTTL = binary.BigEndian.Uint32(msg[n+16:])
+				if rr.Data, err = appendName(nil, rr.Target); err == nil {
+					rr.Data, err = appendName(rr.Data, rr.Mailbox)
+					rr.Data = append(rr.Data, msg[n:end]...)
+				}
+			}
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	switch rr.Type {
+	case TypeCNAME, TypeNS, TypePTR, TypeMX, TypeSRV:
+		rr.Data, err = rr.packData()
+	case TypeSOA:
+	default:
+		rr.Data = append([]byte(nil), data...)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return end, nil
+}
+
+// appendName encodes a dotted name, the root is `.` or the empty string.
+func appendName(b []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, `.`)
+	if name != `` {
+		for _, label := range strings.Split(name, `.`) {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, errMsgName
+			}
+			b = append(append(b, byte(len(label))), label...)
+		}
+	}
+
+	return append(b, 0), nil
+}
+
+// readName decodes the name at off and returns it in dotted form with the
+// trailing dot, along with the offset right after the name.
+func readName(msg []byte, off int) (string, int, error) {
+	var name []byte
+	end := -1
+
+	for hops := 0; ; {
+		if off >= len(msg) {
+			return ``, 0, errMsgShort
+		}
+
+		c := int(msg[off])
+		switch c & 0xc0 {
+		case 0x00:
+			if c == 0 {
+				if end < 0 {
+					end = off + 1
+				}
+				if len(name) == 0 {
+					return `.`, end, nil
+				}
+				return string(name), end, nil
+			}
+			if off+1+c > len(msg) {
+				return ``, 0, errMsgShort
+			}
+			name = append(append(name, msg[off+1:off+1+c]...), '.')
+			if len(name) > 255 {
+				return ``, 0, errMsgName
+			}
+			off += 1 + c
+		case 0xc0:
+			if off+1 >= len(msg) {
+				return ``, 0, errMsgShort
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			if hops++; hops > 64 {
+				return ``, 0, errMsgName
+			}
+			off = (c&0x3f)<<8 | int(msg[off+1])
+		default:
+			return ``, 0, errMsgName
+		}
+	}
+}
+
+// readDataName decodes the name at off of a record whose data ends at end,
+// the name must not run past it.
+func readDataName(msg []byte, off, end int) (string, error) {
+	name, n, err := readName(msg, off)
+	if err == nil && n > end {
+		err = errMsgData
+	}
+
+	return name, err
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
@@ -0,0 +1,112 @@
+package resolver
+
+import (
+	"net"
+	"testing"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	m := newQuery(`www.Example.com`, TypeMX)
+	m.Response = true
+	m.RecursionAvailable = true
+	m.Rcode = RcodeServerFailure
+	m.Answers = []RR{
+		{Name: `www.example.com.`, Type: TypeCNAME, TTL: 30, Target: `example.com.`},
+		{Name: `example.com.`, Type: TypeMX, TTL: 60, Pref: 10, Target: `mx.example.com.`},
+		{Name: `example.com.`, Type: TypeA, TTL: 60, IP: net.IPv4(192, 0, 2, 1)},
+		{Name: `example.com.`, Type: TypeAAAA, TTL: 60, IP: net.ParseIP(`2001:db8::1`)},
+		{Name: `example.com.`, Type: TypeTXT, TTL: 60, Text: []string{`v=spf1 -all`, ``}},
+		{Name: `_sip._udp.example.com.`, Type: TypeSRV, TTL: 60, Pref: 1, Weight: 2, Port: 5060, Target: `sip.example.com.`},
+	}
+	m.Authorities = []RR{{Name: `example.com.`, Type: TypeSOA, TTL: 60, Target: `ns.example.com.`, Mailbox: `root.example.com.`, MinTTL: 300}}
+
+	b, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Message
+	if err := got.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.ID != m.ID || !got.Response || !got.RecursionDesired || !got.RecursionAvailable || got.Rcode != RcodeServerFailure {
+		t.Errorf(`header mismatch: %+v`, got.Header)
+	}
+	if got.Questions[0].Name != `www.Example.com.` || got.Questions[0].Type != TypeMX {
+		t.Errorf(`question mismatch: %+v`, got.Questions[0])
+	}
+	if len(got.Answers) != 6 || got.Answers[1].Target != `mx.example.com.` || got.Answers[1].Pref != 10 {
+		t.Fatalf(`answers mismatch: %+v`, got.Answers)
+	}
+	if !got.Answers[2].IP.Equal(net.IPv4(192, 0, 2, 1)) || !got.Answers[3].IP.Equal(net.ParseIP(`2001:db8::1`)) {
+		t.Error(`address mismatch`)
+	}
+	if txt := got.Answers[4].Text; len(txt) != 2 || txt[0] != `v=spf1 -all` {
+		t.Errorf(`txt mismatch: %q`, txt)
+	}
+	if srv := got.Answers[5]; srv.Port != 5060 || srv.Weight != 2 || srv.Target != `sip.example.com.` {
+		t.Errorf(`srv mismatch: %+v`, srv)
+	}
+	if soa := got.Authorities[0]; soa.MinTTL != 300 || soa.Mailbox != `root.example.com.` {
+		t.Errorf(`soa mismatch: %+v`, soa)
+	}
+}
+
+func TestUnpackCompressed(t *testing.T) {
+	// response to example.com A with the answer name and the CNAME target
+	// compressed against the question
+	msg := []byte{
+		0x12, 0x34, 0x81, 0x80, 0, 1, 0, 1, 0, 0, 0, 0,
+		7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, 0, 1, 0, 1,
+		0xc0, 12, 0, 5, 0, 1, 0, 0, 0, 60, 0, 6, 3, 'w', 'w', 'w', 0xc0, 12,
+	}
+
+	var m Message
+	if err := m.Unpack(msg); err != nil {
+		t.Fatal(err)
+	}
+	if m.Answers[0].Name != `example.com.` || m.Answers[0].Target != `www.example.com.` {
+		t.Errorf(`unexpected answer %+v`, m.Answers[0])
+	}
+
+	loop := append([]byte(nil), msg[:12]...)
+	loop = append(loop, 0xc0, 12)
+	if err := m.Unpack(loop); err == nil {
+		t.Error(`expected a compression loop to fail`)
+	}
+	if err := m.Unpack(msg[:20]); err == nil {
+		t.Error(`expected a short message to fail`)
+	}
+}
+
+func TestUnpackBadData(t *testing.T) {
+	question := []byte{
+		0x12, 0x34, 0x81, 0x80, 0, 1, 0, 1, 0, 0, 0, 0,
+		7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, 0, 1, 0, 1,
+	}
+	answer := func(typ byte, data ...byte) []byte {
+		msg := append([]byte(nil), question...)
+		msg = append(msg, 0xc0, 12, 0, typ, 0, 1, 0, 0, 0, 60, 0, byte(len(data)))
+		return append(msg, data...)
+	}
+
+	tests := map[string][]byte{
+		`short A`:  answer(byte(TypeA), 192, 0, 2),
+		`long A`:   answer(byte(TypeA), 192, 0, 2, 1, 0),
+		`AAAA`:     answer(byte(TypeAAAA), 192, 0, 2, 1),
+		`CNAME`:    append(answer(byte(TypeCNAME), 3, 'w', 'w'), 'w', 0),
+		`overflow`: append(answer(byte(TypePTR), 3, 'w', 'w', 'w'), 0xc0, 12),
+	}
+	for name, msg := range tests {
+		var m Message
+		if err := m.Unpack(msg); err != errMsgData {
+			t.Errorf(`%s: expected errMsgData, got %v`, name, err)
+		}
+	}
+
+	var m Message
+	if err := m.Unpack(answer(byte(TypeA), 192, 0, 2, 1)); err != nil || !m.Answers[0].IP.Equal(net.IPv4(192, 0, 2, 1)) {
+		t.Errorf(`unexpected answer %+v %v`, m.Answers, err)
+	}
+}
@@ -0,0 +1,1215 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrBogus = errors.New(`resolver: dnssec validation failed`)
+
+// DNSSECMode is how Query treats the DNSSEC records of its answers, see
+// Settings.DNSSEC.
+type DNSSECMode int
+
+const (
+	// DNSSECOff sends the queries without the DO bit and leaves the
+	// answers unchecked.
+	DNSSECOff DNSSECMode = iota
+	// DNSSECTrustAD takes the AD bit of the server as the status: it is
+	// Secure with the bit set and Insecure without. Bogus answers are those
+	// a validating server fails with SERVFAIL. It is only as safe as the
+	// path to the server.
+	DNSSECTrustAD
+	// DNSSECValidate checks the signatures itself, from the trust anchors
+	// down, fetching the DS and DNSKEY records from the server that
+	// answered.
+	DNSSECValidate
+)
+
+// ValidationStatus is the DNSSEC status of an answer.
+type ValidationStatus int
+
+const (
+	// ValidationNone is an answer that was not validated, DNSSECOff.
+	ValidationNone ValidationStatus = iota
+	// ValidationSecure is an answer signed from a trust anchor down.
+	ValidationSecure
+	// ValidationInsecure is an answer of a name in an unsigned zone, or
+	// signed with algorithms not supported, proven so.
+	ValidationInsecure
+	// ValidationBogus is an answer that should have been signed and is not
+	// or whose signatures do not check out. Query does not return these.
+	ValidationBogus
+)
+
+func (s ValidationStatus) String() string {
+	switch s {
+	case ValidationNone:
+		return `none`
+	case ValidationSecure:
+		return `secure`
+	case ValidationInsecure:
+		return `insecure`
+	case ValidationBogus:
+		return `bogus`
+	}
+
+	return `status` + strconv.Itoa(int(s))
+}
+
+// BogusError is an answer of Server failing DNSSECValidate, it matches
+// ErrBogus. It counts as a failure of the server, the query moves on.
+type BogusError struct {
+	Server string
+	Name   string
+	Type   Type
+	Reason string
+}
+
+func (e *BogusError) Error() string {
+	return ErrBogus.Error() + `: ` + e.Name + ` ` + e.Type.String() + ` from ` + e.Server + `: ` + e.Reason
+}
+
+func (e *BogusError) Is(target error) bool {
+	return target == ErrBogus
+}
+
+// bogusError is a validation failure, made into a *BogusError by Query.
+type bogusError string
+
+func (e bogusError) Error() string {
+	return string(e)
+}
+
+// TrustAnchor is a DS record of a zone whose keys are trusted without a
+// signature of its parent.
+type TrustAnchor struct {
+	Zone       string
+	KeyTag     uint16
+	Algorithm  uint8
+	DigestType uint8
+	Digest     []byte
+}
+
+// rootAnchors are the DS records of the root keys published by IANA,
+// KSK-2017 and KSK-2024.
+var rootAnchors = []string{
+	`. IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D`,
+	`. IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16`,
+}
+
+// RootTrustAnchors returns the embedded trust anchors, those of the root.
+func RootTrustAnchors() []TrustAnchor {
+	anchors := make([]TrustAnchor, len(rootAnchors))
+	for i, s := range rootAnchors {
+		anchors[i], _ = ParseTrustAnchor(s)
+	}
+
+	return anchors
+}
+
+// ParseTrustAnchor parses a DS record in the zone file format, like
+// `. IN DS 20326 8 2 E06D44B8...`, the TTL and class being optional.
+func ParseTrustAnchor(s string) (TrustAnchor, error) {
+	f := strings.Fields(s)
+	i := 1
+	for i < len(f) && f[i] != `DS` {
+		i++
+	}
+	if len(f) < i+5 {
+		return TrustAnchor{}, fmt.Errorf(`%w: trust anchor %q`, ErrBadOption, s)
+	}
+
+	tag, err1 := strconv.ParseUint(f[i+1], 10, 16)
+	alg, err2 := strconv.ParseUint(f[i+2], 10, 8)
+	digestType, err3 := strconv.ParseUint(f[i+3], 10, 8)
+	digest, err4 := hex.DecodeString(strings.Join(f[i+4:], ``))
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || len(digest) == 0 {
+		return TrustAnchor{}, fmt.Errorf(`%w: trust anchor %q`, ErrBadOption, s)
+	}
+
+	return TrustAnchor{
+		Zone:       canonicalName(f[0]),
+		KeyTag:     uint16(tag),
+		Algorithm:  uint8(alg),
+		DigestType: uint8(digestType),
+		Digest:     digest,
+	}, nil
+}
+
+// SetTrustAnchors replaces the trust anchors of DNSSECValidate, by default
+// RootTrustAnchors, for a key rollover or a zone of its own. The keys and
+// proofs validated so far are dropped. Without anchors every answer is
+// Insecure. It may be called while lookups run.
+func (r *Resolver) SetTrustAnchors(anchors ...TrustAnchor) {
+	r.trust.Store(newTrustStore(anchors))
+}
+
+// trustStore holds the trust anchors and what was validated from them,
+// replaced whole by SetTrustAnchors.
+type trustStore struct {
+	anchors map[string][]TrustAnchor // by zone
+	zones   sync.Map                 // string -> *zoneState
+}
+
+// zoneState is a zone found secure, with its DNSKEY records, or insecure.
+type zoneState struct {
+	status  ValidationStatus
+	keys    []RR
+	expires time.Time
+}
+
+// maxDNSSECCacheTTL caps how long zone states are kept, whatever their TTL.
+const maxDNSSECCacheTTL = time.Hour
+
+// maxNSEC3Iterations is the most NSEC3 hash iterations worked through, a
+// zone with more is taken as unsigned (RFC 9276).
+const maxNSEC3Iterations = 150
+
+func newTrustStore(anchors []TrustAnchor) *trustStore {
+	t := &trustStore{anchors: make(map[string][]TrustAnchor)}
+	for _, a := range anchors {
+		a.Zone = canonicalName(a.Zone)
+		t.anchors[a.Zone] = append(t.anchors[a.Zone], a)
+	}
+
+	return t
+}
+
+func (r *Resolver) trustStore() *trustStore {
+	if t, ok := r.trust.Load().(*trustStore); ok {
+		return t
+	}
+
+	r.trust.CompareAndSwap(nil, newTrustStore(RootTrustAnchors()))
+	return r.trust.Load().(*trustStore)
+}
+
+// setDO adds an OPT record with the DO bit to the query m, asking for the
+// DNSSEC records.
+func (m *Message) setDO() {
+	m.Additionals = append(m.Additionals, RR{Name: `.`, Type: TypeOPT, Class: maxUDPSize, TTL: 1 << 15})
+}
+
+// validator validates the answers of one server, the queries it makes for
+// the keys and proofs go to the same server.
+type validator struct {
+	r     *Resolver
+	ctx   context.Context
+	addr  string
+	trust *trustStore
+}
+
+// validate returns the status of the response m to name and qtype, a
+// bogusError when it is bogus. An answer expanded from a wildcard needs the
+// proof that the name itself does not exist.
+func (v *validator) validate(m *Message, name string, qtype Type) (ValidationStatus, error) {
+	status := ValidationSecure
+	for _, set := range rrsets(m.Answers) {
+		s, sig, err := v.check(set.rrs, set.sigs, set.name, set.name)
+		if err != nil {
+			return ValidationBogus, err
+		}
+		if s == ValidationInsecure {
+			status = s
+		}
+		if sig != nil && int(sig.labels) < labelCount(set.name) {
+			if err := v.expansion(m, set.name, sig); err != nil {
+				return ValidationBogus, err
+			}
+		}
+	}
+
+	if m.Rcode == RcodeNameError || !hasType(m.Answers, qtype) {
+		target, err := cnameChain(name, m.Answers, 0)
+		if err != nil {
+			return ValidationBogus, err
+		}
+		target = canonicalName(target)
+		s, err := v.denial(m, target, qtype, target, false)
+		if err != nil {
+			return ValidationBogus, err
+		}
+		if s == ValidationInsecure {
+			status = s
+		}
+	}
+
+	return status, nil
+}
+
+// fetch queries the server for name and qtype with the DO and CD bits.
+func (v *validator) fetch(name string, qtype Type) (*Message, error) {
+	q := newQuery(name, qtype)
+	q.CheckingDisabled = true
+	q.setDO()
+
+	m, err := v.r.exchange(v.ctx, v.addr, q)
+	if err != nil {
+		if v.ctx.Err() != nil {
+			return nil, v.ctx.Err()
+		}
+		return nil, err
+	}
+	if m.Rcode != RcodeSuccess && m.Rcode != RcodeNameError {
+		return nil, &ResponseError{Server: v.addr, Code: m.Rcode}
+	}
+
+	return m, nil
+}
+
+// check validates the RRset set of name with its RRSIGs sigs, returning the
+// signature that checks out. The signer must be within, or one of its
+// parents. An RRset without a signature that checks out is insecure when
+// the zone of within is, bogus otherwise.
+func (v *validator) check(set, sigs []RR, name, within string) (ValidationStatus, *rrsig, error) {
+	var failure error = bogusError(`no signature for ` + name + ` ` + set[0].Type.String())
+	for _, rr := range sigs {
+		sig, err := parseRRSIG(rr.Data)
+		if err != nil || !inZone(within, sig.signer) {
+			continue
+		}
+		zs, err := v.keys(sig.signer)
+		if err != nil {
+			return ValidationBogus, nil, err
+		}
+		if zs.status != ValidationSecure {
+			continue
+		}
+		if err := verifyRRset(set, sig, zs.keys); err != nil {
+			failure = err
+			continue
+		}
+		return ValidationSecure, sig, nil
+	}
+
+	zone, err := v.zoneOf(within)
+	if err != nil {
+		return ValidationBogus, nil, err
+	}
+	zs, err := v.keys(zone)
+	if err != nil {
+		return ValidationBogus, nil, err
+	}
+	if zs.status == ValidationSecure {
+		return ValidationBogus, nil, failure
+	}
+
+	return ValidationInsecure, nil, nil
+}
+
+// expansion checks that the response m with the RRset of name expanded from
+// a wildcard, signed by sig, proves name does not exist itself: an NSEC
+// record covers it, or an NSEC3 one the next closer name (RFC 4035 section
+// 5.3.4, RFC 5155 section 8.8).
+func (v *validator) expansion(m *Message, name string, sig *rrsig) error {
+	zs, err := v.keys(sig.signer)
+	if err != nil {
+		return err
+	}
+	nsecs, nsec3s, err := denialRecords(m, sig.signer, zs.keys)
+	if err != nil {
+		return err
+	}
+
+	for _, rr := range nsecs {
+		if nsecCovers(rr, name) {
+			return nil
+		}
+	}
+	next := lastLabels(name, int(sig.labels)+1)
+	for _, rr := range nsec3s {
+		if n := parseNSEC3(rr, sig.signer); n != nil && n.covers(next) {
+			return nil
+		}
+	}
+
+	return bogusError(`no proof that ` + name + ` does not exist for its wildcard answer`)
+}
+
+// zoneOf returns the zone name is in, the owner of the SOA record the
+// server returns for it or one of its parents.
+func (v *validator) zoneOf(name string) (string, error) {
+	for n := name; ; n = parentName(n) {
+		m, err := v.fetch(n, TypeSOA)
+		if err != nil {
+			return ``, err
+		}
+		for _, rr := range append(m.Answers, m.Authorities...) {
+			if soa := canonicalName(rr.Name); rr.Type == TypeSOA && inZone(n, soa) {
+				return soa, nil
+			}
+		}
+		if n == `.` {
+			return ``, bogusError(`no SOA record for ` + name)
+		}
+	}
+}
+
+// keys returns the state of zone, validated from a trust anchor down.
+func (v *validator) keys(zone string) (*zoneState, error) {
+	zone = canonicalName(zone)
+	if zs, ok := v.trust.zones.Load(zone); ok && time.Now().Before(zs.(*zoneState).expires) {
+		return zs.(*zoneState), nil
+	}
+
+	var zs *zoneState
+	var err error
+	if anchors, ok := v.trust.anchors[zone]; ok {
+		zs, err = v.verifyKeys(zone, anchors, uint32(maxDNSSECCacheTTL/time.Second))
+	} else if zone == `.` {
+		zs = &zoneState{status: ValidationInsecure, expires: time.Now().Add(maxDNSSECCacheTTL)}
+	} else {
+		zs, err = v.delegation(zone)
+	}
+	if err != nil {
+		return nil, err
+	}
+	v.trust.zones.Store(zone, zs)
+
+	return zs, nil
+}
+
+// delegation returns the state of zone from the DS records in its parent.
+func (v *validator) delegation(zone string) (*zoneState, error) {
+	m, err := v.fetch(zone, TypeDS)
+	if err != nil {
+		return nil, err
+	}
+
+	parent := parentName(zone)
+	if ds, sigs := rrset(m.Answers, zone, TypeDS); len(ds) > 0 {
+		status, _, err := v.check(ds, sigs, zone, parent)
+		if err != nil {
+			return nil, err
+		}
+		if status != ValidationSecure {
+			return insecureZone(minTTL(ds)), nil
+		}
+
+		anchors := make([]TrustAnchor, 0, len(ds))
+		for _, rr := range ds {
+			if len(rr.Data) > 4 {
+				anchors = append(anchors, TrustAnchor{
+					Zone:       zone,
+					KeyTag:     binary.BigEndian.Uint16(rr.Data),
+					Algorithm:  rr.Data[2],
+					DigestType: rr.Data[3],
+					Digest:     rr.Data[4:],
+				})
+			}
+		}
+		return v.verifyKeys(zone, anchors, minTTL(ds))
+	}
+
+	// no DS, the parent proves there is none when it is signed
+	if m.Rcode == RcodeNameError {
+		return nil, bogusError(`zone ` + zone + ` does not exist`)
+	}
+	if _, err := v.denial(m, zone, TypeDS, parent, true); err != nil {
+		return nil, err
+	}
+
+	return insecureZone(minTTL(m.Authorities)), nil
+}
+
+// verifyKeys fetches the DNSKEY records of zone and checks them against
+// anchors, the DS records of the zone. A zone whose anchors all use
+// algorithms or digests not supported is insecure.
+func (v *validator) verifyKeys(zone string, anchors []TrustAnchor, ttl uint32) (*zoneState, error) {
+	supported := false
+	for _, a := range anchors {
+		supported = supported || supportedAlgorithm(a.Algorithm) && digestOf(a.DigestType, nil) != nil
+	}
+	if !supported {
+		return insecureZone(ttl), nil
+	}
+
+	m, err := v.fetch(zone, TypeDNSKEY)
+	if err != nil {
+		return nil, err
+	}
+	keys, sigs := rrset(m.Answers, zone, TypeDNSKEY)
+
+	for _, key := range keys {
+		matched := false
+		for _, a := range anchors {
+			matched = matched || dsMatches(a, zone, key.Data)
+		}
+		if !matched {
+			continue
+		}
+
+		for _, rr := range sigs {
+			sig, err := parseRRSIG(rr.Data)
+			if err != nil || sig.signer != zone {
+				continue
+			}
+			if verifyRRset(keys, sig, []RR{key}) == nil {
+				if t := minTTL(keys); t < ttl {
+					ttl = t
+				}
+				return &zoneState{status: ValidationSecure, keys: keys, expires: expiresAfter(ttl)}, nil
+			}
+		}
+	}
+
+	return nil, bogusError(`no DNSKEY of ` + zone + ` matches its DS records`)
+}
+
+// denial checks that the negative response m proves name has no records of
+// qtype, or with NXDOMAIN does not exist and neither does a wildcard that
+// would have matched it, and with cut that name is an unsigned delegation.
+// It is insecure when the zone of the SOA record in m is, within as for
+// check.
+func (v *validator) denial(m *Message, name string, qtype Type, within string, cut bool) (ValidationStatus, error) {
+	zone := ``
+	for _, rr := range m.Authorities {
+		if soa := canonicalName(rr.Name); rr.Type == TypeSOA && inZone(within, soa) {
+			zone = soa
+		}
+	}
+	if zone == `` {
+		var err error
+		if zone, err = v.zoneOf(within); err != nil {
+			return ValidationBogus, err
+		}
+	}
+	zs, err := v.keys(zone)
+	if err != nil {
+		return ValidationBogus, err
+	}
+	if zs.status != ValidationSecure {
+		return ValidationInsecure, nil
+	}
+
+	nsecs, nsec3s, err := denialRecords(m, zone, zs.keys)
+	if err != nil {
+		return ValidationBogus, err
+	}
+
+	if m.Rcode == RcodeNameError {
+		if nsecNameError(nsecs, name) {
+			return ValidationSecure, nil
+		}
+		switch proven, optOut := nsec3NameError(nsec3s, zone, name); {
+		case optOut:
+			return ValidationInsecure, nil
+		case proven:
+			return ValidationSecure, nil
+		}
+		return ValidationBogus, bogusError(`no proof that ` + name + ` does not exist`)
+	}
+
+	for _, rr := range nsecs {
+		if nsecProves(rr, name, qtype, cut) {
+			return ValidationSecure, nil
+		}
+	}
+	for _, rr := range nsec3s {
+		proven, optOut := nsec3Proves(rr, zone, name, qtype, cut)
+		if optOut {
+			return ValidationInsecure, nil
+		}
+		if proven {
+			return ValidationSecure, nil
+		}
+	}
+
+	return ValidationBogus, bogusError(`no proof that ` + name + ` ` + qtype.String() + ` does not exist`)
+}
+
+// denialRecords returns the NSEC and NSEC3 records of zone in the authority
+// section of m, bogus when a set of them is not signed by keys.
+func denialRecords(m *Message, zone string, keys []RR) (nsecs, nsec3s []RR, err error) {
+	for _, set := range rrsets(m.Authorities) {
+		t := set.rrs[0].Type
+		if t != TypeNSEC && t != TypeNSEC3 || !inZone(set.name, zone) {
+			continue
+		}
+		if !signedBy(set, zone, keys) {
+			return nil, nil, bogusError(`bad signature of ` + set.name + ` ` + t.String())
+		}
+		if t == TypeNSEC {
+			nsecs = append(nsecs, set.rrs...)
+		} else {
+			nsec3s = append(nsec3s, set.rrs...)
+		}
+	}
+
+	return nsecs, nsec3s, nil
+}
+
+// signedBy tells whether one of the RRSIGs of set by zone checks out.
+func signedBy(set rrSet, zone string, keys []RR) bool {
+	for _, rr := range set.sigs {
+		if sig, err := parseRRSIG(rr.Data); err == nil && sig.signer == zone && verifyRRset(set.rrs, sig, keys) == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func insecureZone(ttl uint32) *zoneState {
+	return &zoneState{status: ValidationInsecure, expires: expiresAfter(ttl)}
+}
+
+func expiresAfter(ttl uint32) time.Time {
+	d := time.Duration(ttl) * time.Second
+	if d > maxDNSSECCacheTTL {
+		d = maxDNSSECCacheTTL
+	}
+
+	return time.Now().Add(d)
+}
+
+func minTTL(rrs []RR) uint32 {
+	ttl := uint32(maxDNSSECCacheTTL / time.Second)
+	for _, rr := range rrs {
+		if rr.TTL < ttl {
+			ttl = rr.TTL
+		}
+	}
+
+	return ttl
+}
+
+// rrSet is the records of one name and type with the RRSIGs covering them.
+type rrSet struct {
+	name string
+	rrs  []RR
+	sigs []RR
+}
+
+// rrsets groups rrs by name and type, in the order they come in, RRSIGs
+// going with the records they cover.
+func rrsets(rrs []RR) []rrSet {
+	var sets []rrSet
+	index := make(map[string]int)
+	for _, rr := range rrs {
+		if rr.Type == TypeRRSIG || rr.Type == TypeOPT {
+			continue
+		}
+		name := canonicalName(rr.Name)
+		key := name + ` ` + rr.Type.String()
+		i, ok := index[key]
+		if !ok {
+			i = len(sets)
+			index[key] = i
+			sets = append(sets, rrSet{name: name})
+		}
+		sets[i].rrs = append(sets[i].rrs, rr)
+	}
+	for i := range sets {
+		_, sets[i].sigs = rrset(rrs, sets[i].name, sets[i].rrs[0].Type)
+	}
+
+	return sets
+}
+
+// rrset returns the records of rrs named name of type t and the RRSIGs
+// covering them.
+func rrset(rrs []RR, name string, t Type) (set, sigs []RR) {
+	for _, rr := range rrs {
+		if canonicalName(rr.Name) != name {
+			continue
+		}
+		if rr.Type == t {
+			set = append(set, rr)
+		} else if rr.Type == TypeRRSIG && len(rr.Data) >= 2 && Type(binary.BigEndian.Uint16(rr.Data)) == t {
+			sigs = append(sigs, rr)
+		}
+	}
+
+	return set, sigs
+}
+
+// rrsig is the decoded data of an RRSIG record.
+type rrsig struct {
+	covered    Type
+	algorithm  uint8
+	labels     uint8
+	origTTL    uint32
+	expiration uint32
+	inception  uint32
+	keyTag     uint16
+	signer     string
+	signature  []byte
+	header     []byte // the data before the signature, signer lowercased
+}
+
+func parseRRSIG(data []byte) (*rrsig, error) {
+	if len(data) < 19 {
+		return nil, errMsgData
+	}
+	signer, end, err := readName(data, 18)
+	if err != nil {
+		return nil, err
+	}
+
+	sig := &rrsig{
+		covered:    Type(binary.BigEndian.Uint16(data)),
+		algorithm:  data[2],
+		labels:     data[3],
+		origTTL:    binary.BigEndian.Uint32(data[4:]),
+		expiration: binary.BigEndian.Uint32(data[8:]),
+		inception:  binary.BigEndian.Uint32(data[12:]),
+		keyTag:     binary.BigEndian.Uint16(data[16:]),
+		signer:     canonicalName(signer),
+		signature:  data[end:],
+	}
+	if sig.header, err = appendName(append([]byte(nil), data[:18]...), sig.signer); err != nil {
+		return nil, err
+	}
+
+	return sig, nil
+}
+
+// verifyRRset checks the signature sig of set with one of keys, the DNSKEY
+// records of the signer.
+func verifyRRset(set []RR, sig *rrsig, keys []RR) error {
+	now := uint32(time.Now().Unix())
+	// serial number arithmetic, the times wrap around in 2106
+	if int32(now-sig.inception) < 0 || int32(sig.expiration-now) < 0 {
+		return bogusError(`signature of ` + canonicalName(set[0].Name) + ` ` + set[0].Type.String() + ` expired or not yet valid`)
+	}
+	if sig.covered != set[0].Type {
+		return bogusError(`signature covers ` + sig.covered.String())
+	}
+
+	data, err := signedData(set, sig)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		k := key.Data
+		// the zone key flag, protocol 3
+		if len(k) < 4 || k[0]&1 == 0 || k[2] != 3 || k[3] != sig.algorithm || keyTag(k) != sig.keyTag {
+			continue
+		}
+		if verifySignature(sig.algorithm, k[4:], data, sig.signature) == nil {
+			return nil
+		}
+	}
+
+	return bogusError(`bad signature of ` + canonicalName(set[0].Name) + ` ` + set[0].Type.String())
+}
+
+// signedData is what the signature sig of set is made over, the RRSIG data
+// and the records in canonical form and order (RFC 4034 section 6).
+func signedData(set []RR, sig *rrsig) ([]byte, error) {
+	owner := canonicalName(set[0].Name)
+	if labels := labelCount(owner); int(sig.labels) < labels {
+		// a wildcard expansion, signed over the wildcard name
+		owner = `*.` + lastLabels(owner, int(sig.labels))
+	}
+
+	datas := make([][]byte, 0, len(set))
+	for i := range set {
+		d, err := canonicalData(&set[i])
+		if err != nil {
+			return nil, err
+		}
+		datas = append(datas, d)
+	}
+	sort.Slice(datas, func(i, j int) bool { return bytes.Compare(datas[i], datas[j]) < 0 })
+
+	b := append([]byte(nil), sig.header...)
+	for i, d := range datas {
+		if i > 0 && bytes.Equal(d, datas[i-1]) {
+			continue
+		}
+		var err error
+		if b, err = appendName(b, owner); err != nil {
+			return nil, err
+		}
+		b = appendUint16(b, uint16(set[0].Type))
+		b = appendUint16(b, classINET)
+		b = append(b, byte(sig.origTTL>>24), byte(sig.origTTL>>16), byte(sig.origTTL>>8), byte(sig.origTTL))
+		b = appendUint16(b, uint16(len(d)))
+		b = append(b, d...)
+	}
+
+	return b, nil
+}
+
+// canonicalData is the data of rr with the names in it lowercased.
+func canonicalData(rr *RR) ([]byte, error) {
+	switch rr.Type {
+	case TypeNS, TypeCNAME, TypePTR, TypeMX, TypeSRV:
+		c := *rr
+		c.Target = strings.ToLower(c.Target)
+		return c.packData()
+	case TypeSOA:
+		data := rr.Data
+		if data == nil {
+			data, _ = rr.packData()
+		}
+		b, err := appendName(nil, strings.ToLower(rr.Target))
+		if err == nil {
+			b, err = appendName(b, strings.ToLower(rr.Mailbox))
+		}
+		if err != nil || len(data) < 20 {
+			return nil, errMsgData
+		}
+		return append(b, data[len(data)-20:]...), nil
+	}
+	if rr.Data == nil {
+		return rr.packData()
+	}
+
+	return rr.Data, nil
+}
+
+// DNSSEC algorithm numbers.
+const (
+	algRSASHA256       = 8
+	algRSASHA512       = 10
+	algECDSAP256SHA256 = 13
+	algECDSAP384SHA384 = 14
+	algED25519         = 15
+)
+
+func supportedAlgorithm(alg uint8) bool {
+	switch alg {
+	case algRSASHA256, algRSASHA512, algECDSAP256SHA256, algECDSAP384SHA384, algED25519:
+		return true
+	}
+
+	return false
+}
+
+func verifySignature(alg uint8, pub, data, sig []byte) error {
+	errBad := bogusError(`bad key or signature`)
+
+	switch alg {
+	case algRSASHA256, algRSASHA512:
+		key := rsaKey(pub)
+		if key == nil {
+			return errBad
+		}
+		h := crypto.SHA256
+		if alg == algRSASHA512 {
+			h = crypto.SHA512
+		}
+		sum := h.New()
+		sum.Write(data)
+		return rsa.VerifyPKCS1v15(key, h, sum.Sum(nil), sig)
+	case algECDSAP256SHA256, algECDSAP384SHA384:
+		curve, h := elliptic.P256(), crypto.SHA256
+		if alg == algECDSAP384SHA384 {
+			curve, h = elliptic.P384(), crypto.SHA384
+		}
+		size := curve.Params().BitSize / 8
+		if len(pub) != 2*size || len(sig) != 2*size {
+			return errBad
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(pub[:size]), Y: new(big.Int).SetBytes(pub[size:])}
+		sum := h.New()
+		sum.Write(data)
+		if !ecdsa.Verify(key, sum.Sum(nil), new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])) {
+			return errBad
+		}
+		return nil
+	case algED25519:
+		if len(pub) != ed25519.PublicKeySize || !ed25519.Verify(pub, data, sig) {
+			return errBad
+		}
+		return nil
+	}
+
+	return bogusError(`algorithm ` + strconv.Itoa(int(alg)) + ` not supported`)
+}
+
+// rsaKey decodes an RSA public key of a DNSKEY record (RFC 3110), nil when
+// it is malformed.
+func rsaKey(pub []byte) *rsa.PublicKey {
+	if len(pub) < 3 {
+		return nil
+	}
+	n, off := int(pub[0]), 1
+	if n == 0 {
+		n, off = int(binary.BigEndian.Uint16(pub[1:])), 3
+	}
+	if n == 0 || n > 4 || off+n >= len(pub) {
+		return nil
+	}
+
+	e := 0
+	for _, b := range pub[off : off+n] {
+		e = e<<8 | int(b)
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(pub[off+n:]), E: e}
+}
+
+// keyTag computes the key tag of the DNSKEY data k (RFC 4034 appendix B).
+func keyTag(k []byte) uint16 {
+	var ac uint32
+	for i, b := range k {
+		if i&1 == 0 {
+			ac += uint32(b) << 8
+		} else {
+			ac += uint32(b)
+		}
+	}
+	ac += ac >> 16 & 0xffff
+
+	return uint16(ac)
+}
+
+// digestOf is the digest of a DS record of digest type t over data, nil for
+// digest types not supported.
+func digestOf(t uint8, data []byte) []byte {
+	switch t {
+	case 1:
+		sum := sha1.Sum(data)
+		return sum[:]
+	case 2:
+		sum := sha256.Sum256(data)
+		return sum[:]
+	case 4:
+		sum := sha512.Sum384(data)
+		return sum[:]
+	}
+
+	return nil
+}
+
+// dsMatches tells whether the anchor a is the DS record of the DNSKEY data k
+// of zone.
+func dsMatches(a TrustAnchor, zone string, k []byte) bool {
+	if len(k) < 4 || a.KeyTag != keyTag(k) || a.Algorithm != k[3] {
+		return false
+	}
+	b, err := appendName(nil, zone)
+	if err != nil {
+		return false
+	}
+	sum := digestOf(a.DigestType, append(b, k...))
+
+	return sum != nil && bytes.Equal(sum, a.Digest)
+}
+
+// nsecProves tells whether the NSEC record rr proves name has no records of
+// qtype. With cut name must be a delegation as well, with NS records and no
+// SOA.
+func nsecProves(rr RR, name string, qtype Type, cut bool) bool {
+	_, off, err := readName(rr.Data, 0)
+	if err != nil {
+		return false
+	}
+
+	return canonicalName(rr.Name) == name && typesDenied(rr.Data[off:], qtype, cut)
+}
+
+// nsecCovers tells whether name falls between the owner of the NSEC record
+// rr and the next name, so that it does not exist.
+func nsecCovers(rr RR, name string) bool {
+	next, _, err := readName(rr.Data, 0)
+	if err != nil {
+		return false
+	}
+	owner, next := canonicalName(rr.Name), canonicalName(next)
+
+	// the last NSEC of the zone points back at the apex
+	return canonicalCompare(owner, name) < 0 && (canonicalCompare(name, next) < 0 || canonicalCompare(next, owner) <= 0)
+}
+
+// nsecNameError tells whether nsecs prove name does not exist: one covers
+// name and one the wildcard at the closest encloser of name, the longest
+// ancestor it shares with the owner or the next name of the first (RFC 4035
+// section 5.4).
+func nsecNameError(nsecs []RR, name string) bool {
+	for _, rr := range nsecs {
+		if !nsecCovers(rr, name) {
+			continue
+		}
+		next, _, _ := readName(rr.Data, 0)
+		encloser := commonAncestor(name, canonicalName(rr.Name))
+		if e := commonAncestor(name, canonicalName(next)); labelCount(e) > labelCount(encloser) {
+			encloser = e
+		}
+
+		for _, w := range nsecs {
+			if nsecCovers(w, wildcardName(encloser)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// typesDenied tells whether the type bitmap of a record matching the name
+// proves qtype absent, see nsecProves for cut.
+func typesDenied(bitmap []byte, qtype Type, cut bool) bool {
+	if cut && (!bitmapHas(bitmap, TypeNS) || bitmapHas(bitmap, TypeSOA)) {
+		return false
+	}
+
+	return !bitmapHas(bitmap, qtype) && !bitmapHas(bitmap, TypeCNAME)
+}
+
+var nsec3Encoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// nsec3 is the decoded data of an NSEC3 record.
+type nsec3 struct {
+	flags      uint8
+	iterations uint16
+	salt       []byte
+	owner      []byte // the hash of the owner name
+	next       []byte
+	bitmap     []byte
+}
+
+// parseNSEC3 decodes the NSEC3 record rr of zone, nil when it is malformed,
+// of another zone or hashed with another algorithm than SHA-1.
+func parseNSEC3(rr RR, zone string) *nsec3 {
+	d := rr.Data
+	if len(d) < 5 || d[0] != 1 || len(d) < 5+int(d[4])+1 {
+		return nil
+	}
+	off := 5 + int(d[4])
+	if len(d) < off+1+int(d[off]) {
+		return nil
+	}
+
+	owner := canonicalName(rr.Name)
+	if parentName(owner) != zone {
+		return nil
+	}
+	hash, err := nsec3Encoding.DecodeString(strings.ToUpper(owner[:strings.IndexByte(owner, '.')]))
+	if err != nil {
+		return nil
+	}
+
+	return &nsec3{
+		flags:      d[1],
+		iterations: binary.BigEndian.Uint16(d[2:]),
+		salt:       d[5:off],
+		owner:      hash,
+		next:       d[off+1 : off+1+int(d[off])],
+		bitmap:     d[off+1+int(d[off]):],
+	}
+}
+
+func (n *nsec3) optOut() bool {
+	return n.flags&1 != 0
+}
+
+func (n *nsec3) matches(name string) bool {
+	return bytes.Equal(nsec3Hash(name, n.salt, n.iterations), n.owner)
+}
+
+// covers tells whether the hash of name falls between the owner and the
+// next hash, so that name does not exist.
+func (n *nsec3) covers(name string) bool {
+	hash := nsec3Hash(name, n.salt, n.iterations)
+
+	return bytes.Compare(n.owner, hash) < 0 && bytes.Compare(hash, n.next) < 0 ||
+		bytes.Compare(n.next, n.owner) <= 0 && (bytes.Compare(n.owner, hash) < 0 || bytes.Compare(hash, n.next) < 0)
+}
+
+// nsec3Proves is nsecProves for an NSEC3 record rr of zone. optOut is an
+// opt-out record covering name, which leaves it unsigned.
+func nsec3Proves(rr RR, zone, name string, qtype Type, cut bool) (proven, optOut bool) {
+	n := parseNSEC3(rr, zone)
+	switch {
+	case n == nil:
+		return false, false
+	case n.iterations > maxNSEC3Iterations:
+		return false, true
+	case n.matches(name):
+		return typesDenied(n.bitmap, qtype, cut), false
+	case n.covers(name):
+		return false, n.optOut()
+	}
+
+	return false, false
+}
+
+// nsec3NameError tells whether the NSEC3 records nsec3s of zone prove name
+// does not exist: one matches its closest encloser, one covers the next
+// closer name and one the wildcard at the closest encloser (RFC 5155 section
+// 8.4). optOut is the next closer name covered by an opt-out record, or
+// records hashed too many times to check, which leave name unsigned.
+func nsec3NameError(nsec3s []RR, zone, name string) (proven, optOut bool) {
+	records := make([]*nsec3, 0, len(nsec3s))
+	for _, rr := range nsec3s {
+		if n := parseNSEC3(rr, zone); n != nil {
+			if n.iterations > maxNSEC3Iterations {
+				return false, true
+			}
+			records = append(records, n)
+		}
+	}
+	find := func(fn func(n *nsec3) bool) *nsec3 {
+		for _, n := range records {
+			if fn(n) {
+				return n
+			}
+		}
+		return nil
+	}
+
+	if find(func(n *nsec3) bool { return n.matches(name) }) != nil {
+		return false, false
+	}
+	next := name
+	for encloser := parentName(name); inZone(encloser, zone); encloser, next = parentName(encloser), encloser {
+		if find(func(n *nsec3) bool { return n.matches(encloser) }) == nil {
+			if encloser == zone {
+				break
+			}
+			continue
+		}
+
+		cover := find(func(n *nsec3) bool { return n.covers(next) })
+		if cover == nil {
+			return false, false
+		}
+		wildcard := find(func(n *nsec3) bool { return n.covers(wildcardName(encloser)) }) != nil
+
+		return wildcard, cover.optOut()
+	}
+
+	return false, false
+}
+
+// nsec3Hash is the hashed owner name of name (RFC 5155 section 5).
+func nsec3Hash(name string, salt []byte, iterations uint16) []byte {
+	b, _ := appendName(nil, name)
+	sum := sha1.Sum(append(b, salt...))
+	for i := 0; i < int(iterations); i++ {
+		sum = sha1.Sum(append(sum[:], salt...))
+	}
+
+	return sum[:]
+}
+
+// bitmapHas tells whether the type bitmap of an NSEC or NSEC3 record has t.
+func bitmapHas(bitmap []byte, t Type) bool {
+	for i := 0; i+2 <= len(bitmap); {
+		window, n := bitmap[i], int(bitmap[i+1])
+		if i+2+n > len(bitmap) {
+			return false
+		}
+		if window == byte(t>>8) {
+			idx := int(t&0xff) / 8
+			return idx < n && bitmap[i+2+idx]&(0x80>>(t%8)) != 0
+		}
+		i += 2 + n
+	}
+
+	return false
+}
+
+// canonicalName is name lowercased with the trailing dot, the root `.`.
+func canonicalName(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, `.`) {
+		name += `.`
+	}
+
+	return name
+}
+
+// inZone tells whether the canonical name is zone or under it.
+func inZone(name, zone string) bool {
+	return zone == `.` || name == zone || strings.HasSuffix(name, `.`+zone)
+}
+
+// parentName is the canonical name without its first label, the root for a
+// top-level domain and the root itself.
+func parentName(name string) string {
+	i := strings.IndexByte(name, '.')
+	if i < 0 || i == len(name)-1 {
+		return `.`
+	}
+
+	return name[i+1:]
+}
+
+func labelCount(name string) int {
+	if name == `.` {
+		return 0
+	}
+	n := strings.Count(name, `.`)
+	if strings.HasPrefix(name, `*.`) {
+		n--
+	}
+
+	return n
+}
+
+// lastLabels is the canonical name made of the last n labels of name.
+func lastLabels(name string, n int) string {
+	for labelCount(name) > n {
+		name = parentName(name)
+	}
+	if name == `.` {
+		return ``
+	}
+
+	return name
+}
+
+// canonicalCompare orders canonical names the DNSSEC way, label by label
+// from the right (RFC 4034 section 6.1).
+func canonicalCompare(a, b string) int {
+	la := strings.Split(strings.TrimSuffix(a, `.`), `.`)
+	lb := strings.Split(strings.TrimSuffix(b, `.`), `.`)
+	if a == `.` {
+		la = nil
+	}
+	if b == `.` {
+		lb = nil
+	}
+
+	for i := 1; i <= len(la) && i <= len(lb); i++ {
+		if c := strings.Compare(la[len(la)-i], lb[len(lb)-i]); c != 0 {
+			return c
+		}
+	}
+
+	return len(la) - len(lb)
+}
+
+// commonAncestor is the longest canonical name both a and b are in.
+func commonAncestor(a, b string) string {
+	for !inZone(b, a) {
+		a = parentName(a)
+	}
+
+	return a
+}
+
+// wildcardName is the wildcard name right below the canonical name.
+func wildcardName(name string) string {
+	if name == `.` {
+		return `*.`
+	}
+
+	return `*.` + name
+}
@@ -0,0 +1,299 @@
+package resolver
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// signedZone is a test zone with an Ed25519 key signing its records.
+type signedZone struct {
+	name   string
+	key    ed25519.PrivateKey
+	dnskey RR
+}
+
+func newSignedZone(name string, seed byte) *signedZone {
+	key := ed25519.NewKeyFromSeed(append(make([]byte, ed25519.SeedSize-1), seed))
+	data := append([]byte{1, 1, 3, algED25519}, key.Public().(ed25519.PublicKey)...)
+
+	return &signedZone{name: name, key: key, dnskey: RR{Name: name, Type: TypeDNSKEY, TTL: 3600, Data: data}}
+}
+
+// sign returns the RRSIG of the RRset rrs.
+func (z *signedZone) sign(rrs ...RR) RR {
+	now := uint32(time.Now().Unix())
+	data := appendUint16(nil, uint16(rrs[0].Type))
+	data = append(data, algED25519, byte(labelCount(canonicalName(rrs[0].Name))))
+	for _, v := range []uint32{rrs[0].TTL, now + 3600, now - 3600} {
+		data = append(data, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	data = appendUint16(data, keyTag(z.dnskey.Data))
+	data, _ = appendName(data, z.name)
+
+	sig, _ := parseRRSIG(data)
+	signed, _ := signedData(rrs, sig)
+
+	return RR{Name: rrs[0].Name, Type: TypeRRSIG, TTL: rrs[0].TTL, Data: append(data, ed25519.Sign(z.key, signed)...)}
+}
+
+func (z *signedZone) ds() RR {
+	b, _ := appendName(nil, z.name)
+	data := appendUint16(nil, keyTag(z.dnskey.Data))
+	data = append(data, algED25519, 2)
+
+	return RR{Name: z.name, Type: TypeDS, TTL: 3600, Data: append(data, digestOf(2, append(b, z.dnskey.Data...))...)}
+}
+
+func (z *signedZone) soa() RR {
+	return RR{Name: z.name, Type: TypeSOA, TTL: 60, Target: `ns.` + z.name, Mailbox: `hostmaster.` + z.name, MinTTL: 60}
+}
+
+func typeBitmap(types ...Type) []byte {
+	bits := make([]byte, 32)
+	n := 0
+	for _, t := range types {
+		bits[t/8] |= 0x80 >> (t % 8)
+		if int(t/8)+1 > n {
+			n = int(t/8) + 1
+		}
+	}
+
+	return append([]byte{0, byte(n)}, bits[:n]...)
+}
+
+func nsecRR(owner, next string, types ...Type) RR {
+	data, _ := appendName(nil, next)
+	return RR{Name: owner, Type: TypeNSEC, TTL: 60, Data: append(data, typeBitmap(types...)...)}
+}
+
+// nsec3RR is an NSEC3 record of zone without salt or extra iterations, from
+// the hash owner to next.
+func nsec3RR(zone string, owner, next []byte, flags byte, types ...Type) RR {
+	data := append([]byte{1, flags, 0, 0, 0, byte(len(next))}, next...)
+	return RR{Name: nsec3Encoding.EncodeToString(owner) + `.` + zone, Type: TypeNSEC3, TTL: 60, Data: append(data, typeBitmap(types...)...)}
+}
+
+// nsec3Around returns the hash of name moved by d.
+func nsec3Around(name string, d int64) []byte {
+	h := new(big.Int).SetBytes(nsec3Hash(name, nil, 0))
+	return h.Add(h, big.NewInt(d)).FillBytes(make([]byte, sha1.Size))
+}
+
+// signedServer serves a root and an example. zone signed, with
+// insecure.example. delegated without DS records.
+func signedServer(t *testing.T) (*testServer, *signedZone) {
+	root, example := newSignedZone(`.`, 1), newSignedZone(`example.`, 2)
+
+	a := func(name, ip string) RR { return RR{Name: name, Type: TypeA, TTL: 60, IP: net.ParseIP(ip)} }
+	www := a(`www.example.`, `192.0.2.1`)
+	forged := a(`forged.example.`, `192.0.2.2`)
+	forgedSig := example.sign(forged)
+	forged.IP = net.ParseIP(`192.0.2.3`)
+	gap := nsecRR(`insecure.example.`, `www.example.`, TypeNS, TypeRRSIG, TypeNSEC)
+	exampleSOA := example.soa()
+	exampleNeg := []RR{exampleSOA, example.sign(exampleSOA), gap, example.sign(gap)}
+	apex := nsecRR(`example.`, `forged.example.`, TypeSOA, TypeNS, TypeDNSKEY, TypeNSEC, TypeRRSIG)
+
+	wildcard := a(`*.wild.example.`, `192.0.2.5`)
+	expanded, expandedSig := wildcard, example.sign(wildcard)
+	expanded.Name, expandedSig.Name = `a.wild.example.`, `a.wild.example.`
+	noWild := nsecRR(`*.wild.example.`, `www.example.`, TypeA, TypeRRSIG, TypeNSEC)
+
+	// the closest encloser proof of a name right below the apex
+	nsec3Neg := func(name string, optOut byte, withWildcard bool) []RR {
+		rrs := []RR{exampleSOA, example.sign(exampleSOA)}
+		add := func(rr RR) { rrs = append(rrs, rr, example.sign(rr)) }
+		add(nsec3RR(`example.`, nsec3Around(`example.`, 0), nsec3Around(`example.`, 1), 0, TypeSOA, TypeNS, TypeDNSKEY, TypeRRSIG))
+		add(nsec3RR(`example.`, nsec3Around(name, -1), nsec3Around(name, 1), optOut, TypeA, TypeRRSIG))
+		if withWildcard {
+			add(nsec3RR(`example.`, nsec3Around(`*.example.`, -1), nsec3Around(`*.example.`, 1), 0, TypeA, TypeRRSIG))
+		}
+		return rrs
+	}
+
+	insecureSOA := newSignedZone(`insecure.example.`, 3).soa()
+
+	answers := map[string][]RR{
+		`. DNSKEY`:                 {root.dnskey, root.sign(root.dnskey)},
+		`example. DS`:              {example.ds(), root.sign(example.ds())},
+		`example. DNSKEY`:          {example.dnskey, example.sign(example.dnskey)},
+		`example. SOA`:             {exampleSOA, example.sign(exampleSOA)},
+		`www.example. A`:           {www, example.sign(www)},
+		`forged.example. A`:        {forged, forgedSig},
+		`insecure.example. SOA`:    {insecureSOA},
+		`host.insecure.example. A`: {a(`host.insecure.example.`, `192.0.2.4`)},
+	}
+	ts := newTestServer(t, func(q Question, resp *Message) {
+		name := canonicalName(q.Name)
+		key := name + ` ` + q.Type.String()
+		switch key {
+		case `missing.example. A`:
+			resp.Rcode = RcodeNameError
+			resp.Authorities = append(append([]RR(nil), exampleNeg...), apex, example.sign(apex))
+		case `nowild.example. A`:
+			resp.Rcode = RcodeNameError
+			resp.Authorities = exampleNeg
+		case `a.wild.example. A`:
+			resp.Answers = []RR{expanded, expandedSig}
+			resp.Authorities = []RR{noWild, example.sign(noWild)}
+		case `b.wild.example. A`:
+			expanded.Name, expandedSig.Name = q.Name, q.Name
+			resp.Answers = []RR{expanded, expandedSig}
+		case `gone.example. A`:
+			resp.Rcode = RcodeNameError
+			resp.Authorities = nsec3Neg(name, 0, true)
+		case `gone3.example. A`:
+			resp.Rcode = RcodeNameError
+			resp.Authorities = nsec3Neg(name, 0, false)
+		case `optout.example. A`:
+			resp.Rcode = RcodeNameError
+			resp.Authorities = nsec3Neg(name, 1, false)
+		case `stripped.example. A`:
+			resp.Rcode = RcodeNameError
+			resp.Authorities = []RR{exampleSOA}
+		case `host.insecure.example. SOA`:
+			resp.Authorities = []RR{insecureSOA}
+		case `insecure.example. DS`, `forged.example. SOA`, `www.example. SOA`:
+			resp.Authorities = exampleNeg
+		default:
+			resp.Answers = answers[key]
+		}
+	})
+
+	return ts, root
+}
+
+func TestDNSSECValidate(t *testing.T) {
+	ts, root := signedServer(t)
+
+	// every bogus answer is a failure of the one server
+	r := New(WithSelectionMode(DefaultSelectMode, 100))
+	r.DNSSEC = DNSSECValidate
+	r.RetryLimit = 1
+	r.RetrySleep = 0
+	r.MaxFails = 100
+	if _, err := r.LoadServersFromString(ts.Addr); err != nil {
+		t.Fatal(err)
+	}
+	r.SetTrustAnchors(TrustAnchor{Zone: `.`, KeyTag: keyTag(root.dnskey.Data), Algorithm: algED25519, DigestType: 2,
+		Digest: root.ds().Data[4:]})
+
+	var meta LookupMeta
+	m, err := r.Query(context.Background(), `www.example`, TypeA, WithMeta(&meta))
+	if err != nil || meta.DNSSEC != ValidationSecure || !m.AuthenticData {
+		t.Fatalf(`expected a secure answer, got %v, %v`, meta.DNSSEC, err)
+	}
+
+	if _, err := r.Query(context.Background(), `host.insecure.example`, TypeA, WithMeta(&meta)); err != nil || meta.DNSSEC != ValidationInsecure {
+		t.Errorf(`expected an insecure answer, got %v, %v`, meta.DNSSEC, err)
+	}
+
+	for _, name := range []string{`missing.example`, `gone.example`} {
+		if _, err := r.Query(context.Background(), name, TypeA); !errors.Is(err, ErrNoSuchHost) {
+			t.Errorf(`%s: expected a proven NXDOMAIN, got %v`, name, err)
+		}
+	}
+	if _, err := r.Query(context.Background(), `optout.example`, TypeA, WithMeta(&meta)); !errors.Is(err, ErrNoSuchHost) {
+		t.Errorf(`expected an NXDOMAIN under opt-out, got %v`, err)
+	}
+
+	if _, err := r.Query(context.Background(), `a.wild.example`, TypeA, WithMeta(&meta)); err != nil || meta.DNSSEC != ValidationSecure {
+		t.Errorf(`expected a secure wildcard answer, got %v, %v`, meta.DNSSEC, err)
+	}
+
+	// bogus: no wildcard proof for an NXDOMAIN, over NSEC and NSEC3, and no
+	// proof the name of a wildcard answer does not exist
+	for _, name := range []string{`forged.example`, `stripped.example`, `nowild.example`, `gone3.example`, `b.wild.example`} {
+		_, err := r.Query(context.Background(), name, TypeA)
+		var bogus *BogusError
+		if !errors.As(err, &bogus) || bogus.Server != ts.Addr || !errors.Is(err, ErrBogus) {
+			t.Errorf(`%s: expected a *BogusError, got %v`, name, err)
+		}
+	}
+
+	// with another root key nothing checks out
+	r.SetTrustAnchors(TrustAnchor{Zone: `.`, KeyTag: 1, Algorithm: algED25519, DigestType: 2, Digest: make([]byte, 32)})
+	if _, err := r.Query(context.Background(), `www.example`, TypeA); !errors.Is(err, ErrBogus) {
+		t.Errorf(`expected the answer to be bogus, got %v`, err)
+	}
+}
+
+func TestDNSSECTrustAD(t *testing.T) {
+	ts := newTestServer(t, func(q Question, resp *Message) {
+		resp.AuthenticData = q.Name == `secure.example.`
+		resp.Answers = append(resp.Answers, RR{Name: q.Name, Type: TypeA, TTL: 60, IP: net.ParseIP(`192.0.2.1`)})
+	})
+
+	r := New()
+	r.DNSSEC = DNSSECTrustAD
+	if _, err := r.LoadServersFromString(ts.Addr); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]ValidationStatus{`secure.example`: ValidationSecure, `other.example`: ValidationInsecure} {
+		var meta LookupMeta
+		if _, err := r.Query(context.Background(), name, TypeA, WithMeta(&meta)); err != nil || meta.DNSSEC != want {
+			t.Errorf(`%s: expected %v, got %v, %v`, name, want, meta.DNSSEC, err)
+		}
+	}
+}
+
+func TestParseTrustAnchor(t *testing.T) {
+	anchors := RootTrustAnchors()
+	if len(anchors) != 2 || anchors[0].Zone != `.` || anchors[0].KeyTag != 20326 || len(anchors[0].Digest) != 32 {
+		t.Errorf(`unexpected root anchors %+v`, anchors)
+	}
+
+	a, err := ParseTrustAnchor(`example. 3600 IN DS 12345 13 2 0102 0304`)
+	if err != nil || a.Zone != `example.` || a.KeyTag != 12345 || a.Algorithm != 13 || binary.BigEndian.Uint32(a.Digest) != 0x01020304 {
+		t.Errorf(`unexpected anchor %+v, %v`, a, err)
+	}
+	if _, err := ParseTrustAnchor(`example. IN DS 12345 13`); !errors.Is(err, ErrBadOption) {
+		t.Errorf(`expected ErrBadOption, got %v`, err)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	data := []byte(`signed data`)
+	sum := sha256.Sum256(data)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaSig, _ := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, sum[:])
+	rsaPub := append([]byte{3, 1, 0, 1}, rsaKey.N.Bytes()...)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, s, _ := ecdsa.Sign(rand.Reader, ecKey, sum[:])
+	ecSig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	ecPub := append(ecKey.X.FillBytes(make([]byte, 32)), ecKey.Y.FillBytes(make([]byte, 32))...)
+
+	for _, c := range []struct {
+		alg      uint8
+		pub, sig []byte
+	}{{algRSASHA256, rsaPub, rsaSig}, {algECDSAP256SHA256, ecPub, ecSig}} {
+		if err := verifySignature(c.alg, c.pub, data, c.sig); err != nil {
+			t.Errorf(`algorithm %d: %v`, c.alg, err)
+		}
+		if err := verifySignature(c.alg, c.pub, []byte(`other data`), c.sig); err == nil {
+			t.Errorf(`algorithm %d: expected other data to fail`, c.alg)
+		}
+	}
+}
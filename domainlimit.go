@@ -0,0 +1,101 @@
+package resolver
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+)
+
+// DefaultDomainLimiters is how many registrable domains keep a rate limiter
+// when DomainLimiters is 0.
+const DefaultDomainLimiters = 10000
+
+var ErrDomainRateLimited = errors.New(`resolver: domain rate limited`)
+
+// DomainRateLimitError is a lookup refused with DomainFailFast because its
+// registrable domain is over DomainQPS, it matches ErrDomainRateLimited.
+type DomainRateLimitError struct {
+	Host   string
+	Domain string
+}
+
+func (e *DomainRateLimitError) Error() string {
+	return ErrDomainRateLimited.Error() + `: ` + e.Domain
+}
+
+func (e *DomainRateLimitError) Is(target error) bool {
+	return target == ErrDomainRateLimited
+}
+
+func (e *DomainRateLimitError) Timeout() bool {
+	return false
+}
+
+func (e *DomainRateLimitError) Temporary() bool {
+	return true
+}
+
+// domainLimits are the limiters of the most recently looked up domains, the
+// least recently used one is dropped past the size.
+type domainLimits struct {
+	qps     float64
+	burst   int
+	size    int
+	order   *list.List // of *domainLimit, most recent first
+	domains map[string]*list.Element
+	mu      sync.Mutex
+}
+
+type domainLimit struct {
+	domain string
+	bucket *tokenBucket
+}
+
+// limiter returns the limiter of domain, starting over when the settings
+// changed.
+func (d *domainLimits) limiter(domain string, s *Settings) *tokenBucket {
+	size := s.DomainLimiters
+	if size <= 0 {
+		size = DefaultDomainLimiters
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.domains == nil || d.qps != s.DomainQPS || d.burst != s.DomainBurst || d.size != size {
+		d.qps, d.burst, d.size = s.DomainQPS, s.DomainBurst, size
+		d.order = list.New()
+		d.domains = make(map[string]*list.Element)
+	}
+
+	if e, ok := d.domains[domain]; ok {
+		d.order.MoveToFront(e)
+		return e.Value.(*domainLimit).bucket
+	}
+
+	b := newTokenBucket(d.qps, d.burst)
+	d.domains[domain] = d.order.PushFront(&domainLimit{domain: domain, bucket: b})
+	if d.order.Len() > d.size {
+		last := d.order.Back()
+		d.order.Remove(last)
+		delete(d.domains, last.Value.(*domainLimit).domain)
+	}
+
+	return b
+}
+
+// limitDomain waits until the registrable domain of host is under
+// DomainQPS, or with DomainFailFast refuses the lookup right away.
+func (r *Resolver) limitDomain(host string, o *lookupOptions) error {
+	domain := registrableDomain(host)
+	b := r.domains.limiter(domain, &o.settings)
+
+	if o.settings.DomainFailFast {
+		if !b.Allow() {
+			return &DomainRateLimitError{Host: host, Domain: domain}
+		}
+		return nil
+	}
+
+	return b.Wait(o.ctx)
+}
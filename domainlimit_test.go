@@ -0,0 +1,81 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDomainFailFast(t *testing.T) {
+	r := New()
+	r.DomainQPS = 1
+	r.DomainBurst = 2
+	r.DomainFailFast = true
+	_, _ = r.LoadServersFromString("10.0.0.1")
+
+	ok := func(*net.Resolver) error { return nil }
+	for _, host := range []string{`a.example.com`, `b.example.com`, `a.example.org`, `www.example.co.uk`} {
+		if err := r.lookup(`A`, host, ok); err != nil {
+			t.Errorf(`%s: %v`, host, err)
+		}
+	}
+
+	err := r.lookup(`A`, `c.example.com`, ok)
+	var limited *DomainRateLimitError
+	if !errors.As(err, &limited) || !errors.Is(err, ErrDomainRateLimited) || limited.Domain != `example.com` {
+		t.Fatalf(`expected example.com to be rate limited, got %v`, err)
+	}
+	if !limited.Temporary() || limited.Timeout() {
+		t.Error(`unexpected error flags`)
+	}
+
+	if err := r.lookup(`PTR`, `1.0.0.10.in-addr.arpa`, ok); err != nil {
+		t.Errorf(`reverse lookups should not be limited: %v`, err)
+	}
+}
+
+func TestDomainWait(t *testing.T) {
+	r := New()
+	r.DomainQPS = 20
+	_, _ = r.LoadServersFromString("10.0.0.1")
+
+	ok := func(*net.Resolver) error { return nil }
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := r.lookup(`A`, fmt.Sprintf(`h%d.example.com`, i), ok); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < time.Millisecond*90 {
+		t.Errorf(`three lookups at 20 per second took only %s`, d)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if err := r.lookup(`A`, `h3.example.com`, ok, WithContext(ctx)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf(`expected the wait to time out, got %v`, err)
+	}
+}
+
+func TestDomainLimitsEviction(t *testing.T) {
+	d := &domainLimits{}
+	s := &Settings{DomainQPS: 1, DomainLimiters: 2}
+
+	a := d.limiter(`a.com`, s)
+	d.limiter(`b.com`, s)
+	d.limiter(`a.com`, s)
+	d.limiter(`c.com`, s)
+
+	if len(d.domains) != 2 || d.order.Len() != 2 {
+		t.Fatalf(`expected 2 limiters, got %d`, len(d.domains))
+	}
+	if _, ok := d.domains[`b.com`]; ok {
+		t.Error(`least recently used domain kept`)
+	}
+	if d.limiter(`a.com`, s) != a {
+		t.Error(`recently used domain lost its limiter`)
+	}
+}
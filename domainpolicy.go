@@ -0,0 +1,167 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrDomainBlocked = errors.New(`resolver: domain blocked`)
+
+// DomainBlockedError is a lookup refused by the domain policy, it matches
+// ErrDomainBlocked. Denied tells a name on the deny list from one missing
+// from the allow list.
+type DomainBlockedError struct {
+	Name   string
+	Denied bool
+}
+
+func (e *DomainBlockedError) Error() string {
+	if e.Denied {
+		return ErrDomainBlocked.Error() + `: ` + e.Name + ` is denied`
+	}
+
+	return ErrDomainBlocked.Error() + `: ` + e.Name + ` is not allowed`
+}
+
+func (e *DomainBlockedError) Is(target error) bool {
+	return target == ErrDomainBlocked
+}
+
+// domainPolicy is a compiled SetDomainPolicy, replaced whole on a change.
+type domainPolicy struct {
+	allow *domainTrie // nil allows every name
+	deny  *domainTrie
+}
+
+// domainTrie holds domains by their labels from the right, com then
+// example for example.com.
+type domainTrie struct {
+	children map[string]*domainTrie
+	self     bool // the domain and its subdomains
+	below    bool // the subdomains only, *.domain
+}
+
+// SetDomainPolicy limits the names r looks up. A name under one of deny
+// fails with a *DomainBlockedError, as does one under none of allow when
+// allow is not empty, before any server, the system resolver or the
+// fallbacks are asked and before MaxInFlight and the hooks. An entry takes
+// the domain and its subdomains, `*.internal.example` the subdomains only.
+// Reverse lookups are checked on their reverse name. An allow entry that is
+// a public suffix, like `com` or `*.co.uk`, is too broad and fails with
+// ErrBadOption. It may be called while lookups run, calling it with neither
+// list removes the policy.
+func (r *Resolver) SetDomainPolicy(allow, deny []string) error {
+	p := &domainPolicy{}
+	if len(allow) > 0 {
+		p.allow = &domainTrie{}
+		for _, rule := range allow {
+			domain, below, err := parseDomainRule(rule)
+			if err != nil {
+				return err
+			}
+			if _, err := RegistrableDomain(domain); errors.Is(err, ErrPublicSuffix) {
+				return fmt.Errorf(`%w: allowed domain %q is a public suffix`, ErrBadOption, rule)
+			}
+			p.allow.add(domain, below)
+		}
+	}
+	if len(deny) > 0 {
+		p.deny = &domainTrie{}
+		for _, rule := range deny {
+			domain, below, err := parseDomainRule(rule)
+			if err != nil {
+				return err
+			}
+			p.deny.add(domain, below)
+		}
+	}
+	if p.allow == nil && p.deny == nil {
+		p = nil
+	}
+	r.domainPolicy.Store(p)
+
+	return nil
+}
+
+// checkDomain returns the *DomainBlockedError of name, nil when it may be
+// looked up.
+func (r *Resolver) checkDomain(name string) error {
+	p, _ := r.domainPolicy.Load().(*domainPolicy)
+	if p == nil {
+		return nil
+	}
+
+	name = nameKey(name)
+	if p.deny != nil && p.deny.match(name) {
+		return &DomainBlockedError{Name: name, Denied: true}
+	}
+	if p.allow != nil && !p.allow.match(name) {
+		return &DomainBlockedError{Name: name}
+	}
+
+	return nil
+}
+
+func parseDomainRule(rule string) (domain string, below bool, err error) {
+	domain = nameKey(strings.TrimSpace(rule))
+	if strings.HasPrefix(domain, `*.`) {
+		domain, below = domain[2:], true
+	}
+	if domain == `` || strings.Contains(domain, `*`) || validateName(domain) != nil {
+		return ``, false, fmt.Errorf(`%w: domain rule %q`, ErrBadOption, rule)
+	}
+
+	return domain, below, nil
+}
+
+func (t *domainTrie) add(domain string, below bool) {
+	node := t
+	for rest := domain; rest != ``; {
+		i := strings.LastIndexByte(rest, '.')
+		label := rest[i+1:]
+		if i < 0 {
+			rest = ``
+		} else {
+			rest = rest[:i]
+		}
+
+		child := node.children[label]
+		if child == nil {
+			if node.children == nil {
+				node.children = make(map[string]*domainTrie)
+			}
+			child = &domainTrie{}
+			node.children[label] = child
+		}
+		node = child
+	}
+
+	if below {
+		node.below = true
+	} else {
+		node.self = true
+	}
+}
+
+// match tells whether name is taken by a rule of t, walking its labels from
+// the right without allocating.
+func (t *domainTrie) match(name string) bool {
+	node := t
+	for rest := name; rest != ``; {
+		i := strings.LastIndexByte(rest, '.')
+		node = node.children[rest[i+1:]]
+		if node == nil {
+			return false
+		}
+		if i < 0 {
+			return node.self
+		}
+		rest = rest[:i]
+		if node.self || node.below {
+			return true
+		}
+	}
+
+	return false
+}
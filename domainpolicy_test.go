@@ -0,0 +1,86 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDomainTrie(t *testing.T) {
+	var trie domainTrie
+	trie.add(`example.com`, false)
+	trie.add(`internal.example`, true)
+
+	cases := map[string]bool{
+		`example.com`:          true,
+		`www.example.com`:      true,
+		`a.b.example.com`:      true,
+		`notexample.com`:       false,
+		`com`:                  false,
+		`internal.example`:     false,
+		`svc.internal.example`: true,
+		`example`:              false,
+	}
+	for name, want := range cases {
+		if got := trie.match(name); got != want {
+			t.Errorf(`%s: expected %v, got %v`, name, want, got)
+		}
+	}
+}
+
+func TestSetDomainPolicy(t *testing.T) {
+	ts := newTestServer(t, answerA(map[string]string{
+		`api.example.com`:   `192.0.2.1`,
+		`leak.example.com`:  `192.0.2.2`,
+		`other.example.org`: `192.0.2.3`,
+	}))
+
+	r := New()
+	if _, err := r.LoadServersFromString(ts.Addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetDomainPolicy([]string{`example.com`, `*.internal.example`}, []string{`leak.example.com`}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.LookupIPAddr(`api.example.com`); err != nil {
+		t.Errorf(`expected an allowed name to resolve, got %v`, err)
+	}
+
+	var blocked *DomainBlockedError
+	_, err := r.LookupIPAddr(`Leak.Example.COM.`)
+	if !errors.As(err, &blocked) || !blocked.Denied || !errors.Is(err, ErrDomainBlocked) {
+		t.Errorf(`expected a denied name, got %v`, err)
+	}
+	if _, err := r.LookupTXT(`other.example.org`); !errors.As(err, &blocked) || blocked.Denied {
+		t.Errorf(`expected a name not allowed, got %v`, err)
+	}
+	if _, err := r.Query(context.Background(), `other.example.org`, TypeA); !errors.Is(err, ErrDomainBlocked) {
+		t.Errorf(`expected the query blocked, got %v`, err)
+	}
+	if _, err := r.AsNetResolver().LookupHost(context.Background(), `other.example.org`); err == nil {
+		t.Error(`expected the stdlib lookup blocked`)
+	}
+	for _, q := range ts.Queries() {
+		if q.Name != `api.example.com.` {
+			t.Errorf(`unexpected query for %s`, q.Name)
+		}
+	}
+	if n := r.Stats().Blocked; n != 3 {
+		t.Errorf(`expected 3 blocked lookups, got %d`, n)
+	}
+
+	// the policy is swapped whole
+	if err := r.SetDomainPolicy(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.LookupIPAddr(`other.example.org`); err != nil {
+		t.Errorf(`expected no policy, got %v`, err)
+	}
+
+	for _, allow := range [][]string{{`com`}, {`*.co.uk`}, {`*`}, {`a..b`}, {``}} {
+		if err := r.SetDomainPolicy(allow, nil); !errors.Is(err, ErrBadOption) {
+			t.Errorf(`%q: expected ErrBadOption, got %v`, allow, err)
+		}
+	}
+}
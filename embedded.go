@@ -0,0 +1,19 @@
+package resolver
+
+import (
+	_ "embed"
+	"strings"
+)
+
+// embeddedServers are well-known anycast resolvers, kept in a plain text
+// file so that updating them is a change of data.
+//
+//go:embed fallback_servers.txt
+var embeddedServers string
+
+// LoadEmbeddedServers loads the well-known anycast resolvers of Google,
+// Cloudflare, Quad9 and OpenDNS built into the package, tagged with their
+// provider, the way LoadServers does.
+func (r *Resolver) LoadEmbeddedServers() (LoadReport, error) {
+	return r.LoadServers(strings.NewReader(embeddedServers))
+}
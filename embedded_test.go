@@ -0,0 +1,62 @@
+package resolver
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEmbeddedServers(t *testing.T) {
+	scanner := bufio.NewScanner(strings.NewReader(embeddedServers))
+	entries := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == `` || line[0] == '#' {
+			continue
+		}
+		entries++
+
+		addr, tags, ok := parseServerLine(line)
+		if !ok {
+			t.Errorf(`%q does not parse`, line)
+			continue
+		}
+		if _, ok := normalizeServer(addr); !ok || tags[`provider`] == `` {
+			t.Errorf(`%q: expected a valid address with a provider`, line)
+		}
+	}
+
+	r := New()
+	report, err := r.LoadEmbeddedServers()
+	if err != nil || report.Added != entries || report.Invalid != 0 {
+		t.Errorf(`expected %d servers, got %+v, %v`, entries, report, err)
+	}
+	if r.ServerTags(`1.1.1.1`)[`provider`] != `cloudflare` {
+		t.Errorf(`expected the provider tag, got %v`, r.ServerTags(`1.1.1.1`))
+	}
+}
+
+func TestEmbeddedFallback(t *testing.T) {
+	empty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("# nothing\n"))
+	}))
+	defer empty.Close()
+
+	r := New()
+	if report, err := r.LoadServersFromURL(empty.URL); err != nil || report.Added != 0 {
+		t.Errorf(`expected nothing loaded without the fallback, got %+v, %v`, report, err)
+	}
+
+	r.EmbeddedFallback = true
+	if report, err := r.LoadServersFromURL(empty.URL); err != nil || report.Added == 0 {
+		t.Errorf(`expected the embedded servers, got %+v, %v`, report, err)
+	}
+
+	r = New()
+	r.EmbeddedFallback = true
+	if report, err := r.LoadServersFromURL(`http://127.0.0.1:0/`); err != nil || report.Added == 0 {
+		t.Errorf(`expected the embedded servers after a failed fetch, got %+v, %v`, report, err)
+	}
+}
@@ -0,0 +1,409 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// maxAttempts is how many of the latest failed attempts a LookupError keeps.
+const maxAttempts = 8
+
+// Attempt is one query of a lookup sent to one server.
+type Attempt struct {
+	Server   string
+	Err      error
+	Duration time.Duration
+}
+
+// LookupError is returned by every failed lookup, Err is the reason the
+// lookup gave up, ErrRetryLimit for example. Tries counts the failed
+// queries and Attempts lists the latest of them in order. When the retry
+// limit is reached Err also unwraps to the error of the last attempt.
+// Searched are the names tried with the search domains, see
+// Settings.SearchDomains, Err is the failure of the one that came closest.
+type LookupError struct {
+	Name     string
+	Type     string
+	Tries    int
+	Attempts []Attempt
+	Err      error
+	Searched []string
+
+	pinned bool // made on a route or WithServer, not to fall back
+}
+
+func (e *LookupError) Error() string {
+	var b strings.Builder
+
+	b.WriteString(`resolver: lookup `)
+	b.WriteString(e.Type)
+	b.WriteString(` `)
+	b.WriteString(e.Name)
+	if len(e.Searched) > 0 {
+		b.WriteString(` (tried `)
+		b.WriteString(strings.Join(e.Searched, `, `))
+		b.WriteString(`)`)
+	}
+	b.WriteString(`: `)
+	b.WriteString(strings.TrimPrefix(e.Err.Error(), `resolver: `))
+
+	if n := len(e.Attempts); n > 0 {
+		last := e.Attempts[n-1]
+
+		b.WriteString(` after `)
+		b.WriteString(strconv.Itoa(e.Tries))
+		if e.Tries == 1 {
+			b.WriteString(` attempt`)
+		} else {
+			b.WriteString(` attempts`)
+		}
+		b.WriteString(`, last server `)
+		b.WriteString(last.Server)
+		if last.Err != nil {
+			b.WriteString(`: `)
+			b.WriteString(last.Err.Error())
+		}
+	}
+
+	return b.String()
+}
+
+func (e *LookupError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether the lookup gave up because of a deadline.
+func (e *LookupError) Timeout() bool {
+	return isTimeout(e.Err)
+}
+
+// Temporary reports whether the same lookup may succeed when repeated later,
+// true when the servers failed to answer and false for a missing host.
+func (e *LookupError) Temporary() bool {
+	var t interface{ Temporary() bool }
+	return errors.As(e.Err, &t) && t.Temporary()
+}
+
+// Rcode returns the response code behind the failure, -1 when it did not
+// come from a DNS response.
+func (e *LookupError) Rcode() int {
+	return rcodeOf(e.Err)
+}
+
+// fail returns a copy of e failed with err, so that e stays on the stack of
+// the lookups that succeed.
+func (e LookupError) fail(err error) *LookupError {
+	e.Err = err
+	return &e
+}
+
+// pinned tells whether err is that of a lookup on a route or WithServer.
+func pinned(err error) bool {
+	var lookupErr *LookupError
+	return errors.As(err, &lookupErr) && lookupErr.pinned
+}
+
+func (e *LookupError) add(a Attempt) {
+	e.Tries++
+	if len(e.Attempts) == maxAttempts {
+		copy(e.Attempts, e.Attempts[1:])
+		e.Attempts = e.Attempts[:maxAttempts-1]
+	}
+	e.Attempts = append(e.Attempts, a)
+}
+
+// NotFoundError is the reason of a lookup for a host that does not exist,
+// it matches ErrNoSuchHost and unwraps to the error of the server.
+type NotFoundError struct {
+	Host   string
+	Server string
+	Err    error
+}
+
+func (e *NotFoundError) Error() string {
+	return ErrNoSuchHost.Error() + `: ` + e.Host
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNoSuchHost
+}
+
+func (e *NotFoundError) Unwrap() error {
+	return e.Err
+}
+
+func (e *NotFoundError) Timeout() bool {
+	return false
+}
+
+func (e *NotFoundError) Temporary() bool {
+	return false
+}
+
+func (e *NotFoundError) Rcode() int {
+	return RcodeNameError
+}
+
+// NoDataError is the reason of a lookup for a host that exists but has no
+// records of the requested type, it matches ErrNoData.
+type NoDataError struct {
+	Host   string
+	Type   string
+	Server string
+}
+
+func (e *NoDataError) Error() string {
+	return ErrNoData.Error() + `: ` + e.Type + ` ` + e.Host
+}
+
+func (e *NoDataError) Is(target error) bool {
+	return target == ErrNoData
+}
+
+func (e *NoDataError) Timeout() bool {
+	return false
+}
+
+func (e *NoDataError) Temporary() bool {
+	return false
+}
+
+func (e *NoDataError) Rcode() int {
+	return RcodeSuccess
+}
+
+// RetryLimitError is the reason of a lookup that used up its attempts, it
+// matches ErrRetryLimit and unwraps to the error of the last attempt.
+type RetryLimitError struct {
+	Host string
+	Err  error
+}
+
+func (e *RetryLimitError) Error() string {
+	return ErrRetryLimit.Error() + `: ` + e.Host
+}
+
+func (e *RetryLimitError) Is(target error) bool {
+	return target == ErrRetryLimit
+}
+
+func (e *RetryLimitError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RetryLimitError) Timeout() bool {
+	return isTimeout(e.Err)
+}
+
+func (e *RetryLimitError) Temporary() bool {
+	return true
+}
+
+func (e *RetryLimitError) Rcode() int {
+	return rcodeOf(e.Err)
+}
+
+// EmptyListError is the reason of a lookup that found no usable server, it
+// tells how many servers the list has and why none of them was used. It
+// matches ErrServerListEmpty.
+type EmptyListError struct {
+	Size           int
+	Quarantined    int
+	Filtered       int
+	LastQuarantine time.Time
+
+	// BypassNative is set when the system resolver was tried as well and
+	// failed with NativeErr.
+	BypassNative bool
+	NativeErr    error
+}
+
+func (e *EmptyListError) Error() string {
+	var b strings.Builder
+
+	b.WriteString(ErrServerListEmpty.Error())
+	if e.Size == 0 {
+		b.WriteString(`, no servers loaded`)
+	} else {
+		b.WriteString(`, `)
+		b.WriteString(strconv.Itoa(e.Quarantined))
+		b.WriteString(` of `)
+		b.WriteString(strconv.Itoa(e.Size))
+		b.WriteString(` quarantined`)
+		if !e.LastQuarantine.IsZero() {
+			b.WriteString(` (last at `)
+			b.WriteString(e.LastQuarantine.Format(time.RFC3339))
+			b.WriteString(`)`)
+		}
+		if e.Filtered > 0 {
+			b.WriteString(`, `)
+			b.WriteString(strconv.Itoa(e.Filtered))
+			b.WriteString(` filtered`)
+		}
+	}
+	if e.BypassNative {
+		b.WriteString(`, system resolver: `)
+		b.WriteString(e.NativeErr.Error())
+	}
+
+	return b.String()
+}
+
+func (e *EmptyListError) Is(target error) bool {
+	return target == ErrServerListEmpty
+}
+
+func (e *EmptyListError) Unwrap() error {
+	return e.NativeErr
+}
+
+func (e *EmptyListError) Timeout() bool {
+	return false
+}
+
+func (e *EmptyListError) Temporary() bool {
+	return e.Quarantined > 0
+}
+
+func (r *Resolver) emptyListError(pool ServerList) *EmptyListError {
+	servers := pool.All()
+	e := &EmptyListError{Size: len(servers)}
+
+	quarantined := make(map[string]QuarantinedServer)
+	for _, q := range r.health.quarantined() {
+		quarantined[q.Addr] = q
+	}
+
+	for _, s := range servers {
+		if !r.serverAllowed(s.Addr) {
+			e.Filtered++
+		} else if q, ok := quarantined[s.Addr]; ok {
+			e.Quarantined++
+			if q.Since.After(e.LastQuarantine) {
+				e.LastQuarantine = q.Since
+			}
+		}
+	}
+
+	return e
+}
+
+// ResponseError is a response of a server with an error code.
+type ResponseError struct {
+	Server string
+	Code   int
+}
+
+func (e *ResponseError) Error() string {
+	return `resolver: server ` + e.Server + ` answered ` + RcodeName(e.Code)
+}
+
+func (e *ResponseError) Timeout() bool {
+	return false
+}
+
+func (e *ResponseError) Temporary() bool {
+	return e.Code == RcodeServerFailure
+}
+
+func (e *ResponseError) Rcode() int {
+	return e.Code
+}
+
+// rcodeOf returns the response code carried in the chain of err, -1 if none.
+// A stdlib lookup only reports NXDOMAIN, other codes are indistinguishable.
+func rcodeOf(err error) int {
+	var rc interface{ Rcode() int }
+	if errors.As(err, &rc) {
+		return rc.Rcode()
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return RcodeNameError
+	}
+
+	return -1
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound || rcodeOf(err) == RcodeNameError
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func isRefused(err error) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && strings.HasSuffix(dnsErr.Err, syscall.ECONNREFUSED.Error())
+}
+
+// isServerFailure reports a SERVFAIL answer, the stdlib reports it as a
+// misbehaving server.
+func isServerFailure(err error) bool {
+	if rcodeOf(err) == RcodeServerFailure {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.Err == `server misbehaving`
+}
+
+// isCallerError reports errors caused by the caller rather than the server,
+// a cancelled or expired context and input the stdlib refuses to send.
+func isCallerError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.Err == `unrecognized address`
+}
+
+// isTransportError reports a query that got no answer at all.
+func isTransportError(err error) bool {
+	return err != nil && !isCallerError(err) && (isTimeout(err) || isLocalError(err))
+}
+
+var localErrnos = []syscall.Errno{syscall.ENETUNREACH, syscall.EHOSTUNREACH, syscall.EACCES, syscall.EPERM, syscall.EADDRNOTAVAIL}
+
+// isLocalError reports socket errors of the local host, which would fail
+// the same way with any server. The stdlib resolver keeps only the text of
+// dial errors, so that is matched too.
+func isLocalError(err error) bool {
+	for _, errno := range localErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		for _, errno := range localErrnos {
+			if strings.HasSuffix(dnsErr.Err, errno.Error()) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
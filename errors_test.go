@@ -0,0 +1,240 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"github.com/zofan/go-slist"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLookupErrorAttempts(t *testing.T) {
+	r := New()
+	r.RetryLimit = 3
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2\n10.0.0.3")
+
+	var tried []string
+	err := r.lookup(`MX`, `example.com`, func(res *net.Resolver) error {
+		tried = append(tried, dialedServer(t, res))
+		return &net.DNSError{Err: `i/o timeout`, IsTimeout: true}
+	})
+
+	var lookupErr *LookupError
+	if !errors.As(err, &lookupErr) {
+		t.Fatalf(`expected *LookupError, got %T`, err)
+	}
+	if !errors.Is(err, ErrRetryLimit) {
+		t.Errorf(`expected ErrRetryLimit, got %v`, lookupErr.Err)
+	}
+	if lookupErr.Name != `example.com` || lookupErr.Type != `MX` || len(lookupErr.Attempts) != 3 {
+		t.Fatalf(`unexpected error %+v`, lookupErr)
+	}
+
+	for i, a := range lookupErr.Attempts {
+		if serverAddress(a.Server) != tried[i] || a.Err == nil {
+			t.Errorf(`attempt %d: unexpected %+v`, i, a)
+		}
+	}
+
+	msg := err.Error()
+	last := lookupErr.Attempts[2].Server
+	if strings.Contains(msg, "\n") || !strings.Contains(msg, last) || !strings.Contains(msg, `i/o timeout`) {
+		t.Errorf(`unexpected message %q`, msg)
+	}
+}
+
+func TestLookupErrorWithoutAttempts(t *testing.T) {
+	r := New()
+
+	err := r.lookup(`A`, `example.com`, func(*net.Resolver) error { return nil })
+	if msg := err.Error(); msg != `resolver: lookup A example.com: slist: server list is empty, no servers loaded` {
+		t.Errorf(`unexpected message %q`, msg)
+	}
+}
+
+func TestNoSuchHostKeepsDNSError(t *testing.T) {
+	r := New()
+	_, _ = r.LoadServersFromString(`10.0.0.1`)
+
+	err := r.lookup(`A`, `nx.example.com`, func(*net.Resolver) error {
+		return &net.DNSError{Err: `no such host`, Name: `nx.example.com`, Server: `10.0.0.1:53`, IsNotFound: true}
+	})
+
+	if !errors.Is(err, ErrNoSuchHost) {
+		t.Errorf(`expected ErrNoSuchHost, got %v`, err)
+	}
+
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) {
+		t.Fatalf(`expected *net.DNSError in the chain of %v`, err)
+	}
+	if dnsErr.Name != `nx.example.com` || dnsErr.Server != `10.0.0.1:53` || !dnsErr.IsNotFound || dnsErr.IsTemporary {
+		t.Errorf(`unexpected DNS error %+v`, dnsErr)
+	}
+}
+
+func TestRetryLimitCause(t *testing.T) {
+	r := New()
+	r.RetryLimit = 12
+	r.RetrySleep = 0
+	r.MaxFails = 100
+	r.banThreshold = 100
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2\n10.0.0.3")
+
+	calls := 0
+	err := r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		calls++
+		if calls == 12 {
+			return &net.DNSError{Err: `server misbehaving`, IsTemporary: true}
+		}
+		return &net.DNSError{Err: `i/o timeout`, IsTimeout: true}
+	})
+
+	if !errors.Is(err, ErrRetryLimit) {
+		t.Errorf(`expected ErrRetryLimit, got %v`, err)
+	}
+
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || dnsErr.Err != `server misbehaving` {
+		t.Errorf(`expected the last attempt error, got %v`, dnsErr)
+	}
+
+	var lookupErr *LookupError
+	if !errors.As(err, &lookupErr) || lookupErr.Tries != 12 || len(lookupErr.Attempts) != maxAttempts {
+		t.Fatalf(`unexpected error %+v`, lookupErr)
+	}
+	if !strings.Contains(err.Error(), `after 12 attempts`) {
+		t.Errorf(`unexpected message %q`, err.Error())
+	}
+}
+
+func TestNotFoundError(t *testing.T) {
+	r := New()
+	_, _ = r.LoadServersFromString(`10.0.0.1`)
+
+	err := r.lookup(`A`, `nx.example.com`, func(*net.Resolver) error {
+		return &net.DNSError{Err: `no such host`, IsNotFound: true}
+	})
+
+	var nf *NotFoundError
+	if !errors.As(err, &nf) {
+		t.Fatalf(`expected *NotFoundError, got %v`, err)
+	}
+	if nf.Host != `nx.example.com` || nf.Server != `10.0.0.1` || !errors.Is(nf, ErrNoSuchHost) {
+		t.Errorf(`unexpected error %+v`, nf)
+	}
+	if !strings.Contains(nf.Error(), `nx.example.com`) {
+		t.Errorf(`host missing from %q`, nf.Error())
+	}
+}
+
+func TestRetryLimitErrorHost(t *testing.T) {
+	r := New()
+	r.RetryLimit = 1
+	_, _ = r.LoadServersFromString(`10.0.0.1`)
+
+	err := r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		return &net.DNSError{Err: `i/o timeout`, IsTimeout: true}
+	})
+
+	var rl *RetryLimitError
+	if !errors.As(err, &rl) || rl.Host != `example.com` || !errors.Is(rl, ErrRetryLimit) {
+		t.Errorf(`unexpected error %v`, err)
+	}
+}
+
+func TestErrorClassification(t *testing.T) {
+	r := New()
+	r.RetryLimit = 1
+	_, _ = r.LoadServersFromString(`10.0.0.1`)
+
+	tests := []struct {
+		name      string
+		err       error
+		timeout   bool
+		temporary bool
+	}{
+		{`timeout`, &net.DNSError{Err: `i/o timeout`, IsTimeout: true}, true, true},
+		{`deadline`, context.DeadlineExceeded, true, true},
+		{`servfail`, &net.DNSError{Err: `server misbehaving`, IsTemporary: true}, false, true},
+		{`refused`, errors.New(`connection refused`), false, true},
+		{`nxdomain`, &net.DNSError{Err: `no such host`, IsNotFound: true}, false, false},
+	}
+
+	for _, tt := range tests {
+		r.health = newHealthTable()
+
+		err := r.lookup(`A`, `example.com`, func(*net.Resolver) error { return tt.err })
+
+		netErr, ok := err.(net.Error)
+		if !ok {
+			t.Fatalf(`%s: %T does not implement net.Error`, tt.name, err)
+		}
+		if netErr.Timeout() != tt.timeout || netErr.Temporary() != tt.temporary {
+			t.Errorf(`%s: got timeout %v temporary %v`, tt.name, netErr.Timeout(), netErr.Temporary())
+		}
+	}
+
+	var _ net.Error = &NotFoundError{}
+	var _ net.Error = &RetryLimitError{}
+}
+
+func TestRcodeWithoutResponse(t *testing.T) {
+	r := New()
+	r.RetryLimit = 1
+	_, _ = r.LoadServersFromString(`10.0.0.1`)
+
+	err := r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		return &net.DNSError{Err: `i/o timeout`, IsTimeout: true}
+	})
+
+	var lookupErr *LookupError
+	if !errors.As(err, &lookupErr) || lookupErr.Rcode() != -1 {
+		t.Errorf(`expected no response code, got %v`, err)
+	}
+}
+
+func TestEmptyListError(t *testing.T) {
+	r := New()
+	r.RetryLimit = 1
+	r.MaxFails = 1
+	r.QuarantineDuration = time.Hour
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2\n10.0.0.3")
+	r.SetServerFilter(nil, []netip.Prefix{netip.MustParsePrefix(`10.0.0.3/32`)})
+
+	fail := func(*net.Resolver) error { return errTestRefused }
+	_ = r.lookup(`A`, `example.com`, fail)
+	_ = r.lookup(`A`, `example.com`, fail)
+
+	err := r.lookup(`A`, `example.com`, fail)
+	if !errors.Is(err, slist.ErrServerListEmpty) {
+		t.Fatalf(`expected ErrServerListEmpty, got %v`, err)
+	}
+
+	var empty *EmptyListError
+	if !errors.As(err, &empty) {
+		t.Fatalf(`expected *EmptyListError, got %v`, err)
+	}
+	if empty.Size != 3 || empty.Quarantined != 2 || empty.Filtered != 1 || empty.LastQuarantine.IsZero() || empty.BypassNative {
+		t.Errorf(`unexpected error %+v`, empty)
+	}
+	if !strings.Contains(err.Error(), `2 of 3 quarantined`) {
+		t.Errorf(`unexpected message %q`, err.Error())
+	}
+}
+
+func TestEmptyListBypassNative(t *testing.T) {
+	r := New()
+	r.BypassNative = true
+
+	_, err := r.LookupIPAddr(`nx.invalid`)
+
+	var empty *EmptyListError
+	if !errors.As(err, &empty) || !empty.BypassNative || empty.NativeErr == nil || empty.Size != 0 {
+		t.Errorf(`expected the failed system lookup to be recorded, got %v`, err)
+	}
+}
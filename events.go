@@ -0,0 +1,182 @@
+package resolver
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultEventBuffer is the number of events a subscriber may fall behind
+// before the oldest ones are dropped.
+const DefaultEventBuffer = 64
+
+// EventType is what happened in a ServerEvent.
+type EventType int
+
+const (
+	// EventServerFailed is a failed attempt counted against the server.
+	EventServerFailed EventType = iota
+	// EventServerQuarantined is a server taken out of rotation for a while.
+	EventServerQuarantined
+	// EventServerRecovered is a server back from probation.
+	EventServerRecovered
+	// EventServerEvicted is a server caught misbehaving and no longer used.
+	EventServerEvicted
+	// EventListLoaded is a load of servers into the list, Server is empty.
+	EventListLoaded
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventServerFailed:
+		return `failed`
+	case EventServerQuarantined:
+		return `quarantined`
+	case EventServerRecovered:
+		return `recovered`
+	case EventServerEvicted:
+		return `evicted`
+	case EventListLoaded:
+		return `list loaded`
+	}
+
+	return `unknown`
+}
+
+func (t EventType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// ServerEvent is a change of a server or of the list.
+type ServerEvent struct {
+	Type   EventType
+	Server string
+	Time   time.Time
+	Reason string
+}
+
+type subscriber struct {
+	ch chan ServerEvent
+}
+
+// eventBus hands events to the subscribers without ever blocking, a
+// subscriber that falls behind loses its oldest events.
+type eventBus struct {
+	subs    []*subscriber
+	main    *subscriber
+	closed  bool
+	count   int32
+	dropped uint64
+	mu      sync.Mutex
+}
+
+func (b *eventBus) emit(t EventType, server, reason string) {
+	if atomic.LoadInt32(&b.count) == 0 {
+		return
+	}
+
+	e := ServerEvent{Type: t, Server: server, Time: time.Now(), Reason: reason}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, sub := range b.subs {
+		select {
+		case sub.ch <- e:
+			continue
+		default:
+		}
+
+		select {
+		case <-sub.ch:
+			atomic.AddUint64(&b.dropped, 1)
+		default:
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			atomic.AddUint64(&b.dropped, 1)
+		}
+	}
+}
+
+func (b *eventBus) subscribe(buffer int) *subscriber {
+	if buffer <= 0 {
+		buffer = DefaultEventBuffer
+	}
+	sub := &subscriber{ch: make(chan ServerEvent, buffer)}
+
+	if b.closed {
+		close(sub.ch)
+		return sub
+	}
+
+	b.subs = append(b.subs, sub)
+	atomic.AddInt32(&b.count, 1)
+
+	return sub
+}
+
+func (b *eventBus) unsubscribe(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, s := range b.subs {
+		if s == sub {
+			b.subs = append(b.subs[:i], b.subs[i+1:]...)
+			atomic.AddInt32(&b.count, -1)
+			close(sub.ch)
+			return
+		}
+	}
+}
+
+func (b *eventBus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.closed = true
+	for _, sub := range b.subs {
+		close(sub.ch)
+	}
+	b.subs = nil
+	atomic.StoreInt32(&b.count, 0)
+}
+
+// Events returns the channel of server events of the resolver, the same
+// one on every call. Events are only kept once it was asked for, it is
+// closed by Close.
+func (r *Resolver) Events() <-chan ServerEvent {
+	r.events.mu.Lock()
+	defer r.events.mu.Unlock()
+
+	if r.events.main == nil {
+		r.events.main = r.events.subscribe(r.settings().EventBuffer)
+	}
+
+	return r.events.main.ch
+}
+
+// Subscribe returns a channel of its own receiving every server event and
+// the function ending the subscription, buffer 0 is DefaultEventBuffer.
+func (r *Resolver) Subscribe(buffer int) (<-chan ServerEvent, func()) {
+	r.events.mu.Lock()
+	sub := r.events.subscribe(buffer)
+	r.events.mu.Unlock()
+
+	return sub.ch, func() { r.events.unsubscribe(sub) }
+}
+
+// DroppedEvents counts the events lost by subscribers falling behind.
+func (r *Resolver) DroppedEvents() uint64 {
+	return atomic.LoadUint64(&r.events.dropped)
+}
+
+func loadReason(report LoadReport) string {
+	return strconv.Itoa(report.Added) + ` added, ` + strconv.Itoa(report.Duplicates) + ` duplicates`
+}
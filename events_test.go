@@ -0,0 +1,68 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestEvents(t *testing.T) {
+	r := New()
+	r.RetryLimit = 1
+	r.RetrySleep = 0
+	r.MaxFails = 1
+	r.NetworkDownServers = 0
+
+	events := r.Events()
+	if r.Events() != events {
+		t.Errorf(`Events returned another channel`)
+	}
+	_, _ = r.LoadServersFromString("10.0.0.1")
+
+	_ = r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		return errors.New(`connection refused`)
+	})
+
+	var got []EventType
+	for len(events) > 0 {
+		e := <-events
+		if e.Time.IsZero() || (e.Type != EventListLoaded && e.Server == ``) {
+			t.Errorf(`incomplete event %+v`, e)
+		}
+		got = append(got, e.Type)
+	}
+
+	want := []EventType{EventListLoaded, EventServerFailed, EventServerQuarantined}
+	if len(got) != len(want) {
+		t.Fatalf(`expected %v, got %v`, want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf(`event %d: expected %s, got %s`, i, want[i], got[i])
+		}
+	}
+
+	if err := r.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, ok := <-events; ok {
+		t.Errorf(`channel not closed`)
+	}
+}
+
+func TestEventsDropOldest(t *testing.T) {
+	r := New()
+
+	ch, unsubscribe := r.Subscribe(2)
+	for i := 0; i < 5; i++ {
+		_, _ = r.LoadServersFromString(``)
+	}
+	if len(ch) != 2 || r.DroppedEvents() != 3 {
+		t.Errorf(`expected 2 events kept and 3 dropped, got %d and %d`, len(ch), r.DroppedEvents())
+	}
+
+	unsubscribe()
+	for range ch {
+	}
+	_, _ = r.LoadServersFromString(``)
+}
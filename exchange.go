@@ -0,0 +1,132 @@
+package resolver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// maxUDPSize is the largest UDP response read, which is also the EDNS
+// buffer size advertised when a query carries an OPT record.
+const maxUDPSize = 1232
+
+var errMsgMismatch = errors.New(`resolver: response does not match the query`)
+
+func newQuery(name string, qtype Type) *Message {
+	var id [2]byte
+	_, _ = rand.Read(id[:])
+
+	if !strings.HasSuffix(name, `.`) {
+		name += `.`
+	}
+
+	return &Message{
+		Header: Header{
+			ID:               binary.BigEndian.Uint16(id[:]),
+			RecursionDesired: true,
+		},
+		Questions: []Question{{Name: name, Type: qtype}},
+	}
+}
+
+// exchange sends the query to the server over UDP and returns the response,
+// repeating the query over TCP when the UDP response is truncated. The
+// exchange is bounded by DialTimeout, or by the deadline of ctx when that
+// comes first.
+func (r *Resolver) exchange(ctx context.Context, addr string, q *Message) (*Message, error) {
+	s := r.settings()
+	if s.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.DialTimeout)
+		defer cancel()
+	}
+
+	query, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := roundTrip(ctx, `udp`, serverAddress(addr), query, &s)
+	if err == nil && resp.Truncated {
+		resp, err = roundTrip(ctx, `tcp`, serverAddress(addr), query, &s)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.ID != q.ID || !resp.Response || len(resp.Questions) != 1 ||
+		!strings.EqualFold(resp.Questions[0].Name, q.Questions[0].Name) || resp.Questions[0].Type != q.Questions[0].Type {
+		return nil, errMsgMismatch
+	}
+
+	return resp, nil
+}
+
+func roundTrip(ctx context.Context, network, addr string, query []byte, s *Settings) (*Message, error) {
+	d := net.Dialer{}
+	if s.DisableKeepAlive {
+		d.KeepAlive = -1
+	}
+
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if ctx.Done() != nil {
+		done := make(chan struct{})
+		defer close(done)
+
+		go func() {
+			select {
+			case <-ctx.Done():
+				_ = conn.SetDeadline(time.Unix(1, 0))
+			case <-done:
+			}
+		}()
+	}
+
+	var buf []byte
+	if network == `tcp` {
+		if _, err = conn.Write(append(appendUint16(nil, uint16(len(query))), query...)); err != nil {
+			return nil, err
+		}
+
+		var size [2]byte
+		if _, err = io.ReadFull(conn, size[:]); err != nil {
+			return nil, err
+		}
+		buf = make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err = io.ReadFull(conn, buf); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err = conn.Write(query); err != nil {
+			return nil, err
+		}
+
+		buf = make([]byte, maxUDPSize)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[:n]
+	}
+
+	var resp Message
+	if err := resp.Unpack(buf); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,87 @@
+package resolver
+
+import (
+	"errors"
+	"expvar"
+	"sync"
+)
+
+var ErrExpvarTaken = errors.New(`resolver: expvar name taken`)
+
+// expvarOwners are the resolvers behind the prefixes published, a closed
+// one leaves nil so that the expvar, which cannot be removed, lets go of it.
+var (
+	expvarOwners   = make(map[string]*Resolver)
+	expvarOwnersMu sync.Mutex
+)
+
+// PublishExpvar publishes the counters of Stats, the number of healthy
+// servers and the lookups in flight as one expvar map named prefix. The
+// values are read when the variable is, not kept up to date. Publishing
+// again under the same prefix does nothing, a prefix taken by another
+// resolver or variable fails with ErrExpvarTaken. Close gives the prefix
+// up, it then reads null until another resolver publishes under it.
+func (r *Resolver) PublishExpvar(prefix string) error {
+	expvarOwnersMu.Lock()
+	defer expvarOwnersMu.Unlock()
+
+	owner, ok := expvarOwners[prefix]
+	switch {
+	case owner == r:
+		return nil
+	case owner != nil:
+		return ErrExpvarTaken
+	case !ok:
+		if expvar.Get(prefix) != nil {
+			return ErrExpvarTaken
+		}
+		expvar.Publish(prefix, expvar.Func(func() interface{} {
+			return expvarValue(prefix)
+		}))
+	}
+	expvarOwners[prefix] = r
+
+	return nil
+}
+
+// unpublishExpvar gives up the prefixes of r.
+func (r *Resolver) unpublishExpvar() {
+	expvarOwnersMu.Lock()
+	defer expvarOwnersMu.Unlock()
+
+	for prefix, owner := range expvarOwners {
+		if owner == r {
+			expvarOwners[prefix] = nil
+		}
+	}
+}
+
+func expvarValue(prefix string) interface{} {
+	expvarOwnersMu.Lock()
+	owner := expvarOwners[prefix]
+	expvarOwnersMu.Unlock()
+
+	if owner == nil {
+		return nil
+	}
+	return owner.expvarValue()
+}
+
+func (r *Resolver) expvarValue() interface{} {
+	s := r.Stats()
+
+	return map[string]interface{}{
+		`lookups`:         s.Lookups,
+		`lookups_by_type`: s.ByType,
+		`successes`:       s.Successes,
+		`failures`:        s.Failures,
+		`not_found`:       s.NotFound,
+		`retry_limit`:     s.RetryLimit,
+		`empty_list`:      s.EmptyList,
+		`attempts`:        s.Attempts,
+		`in_flight`:       s.InFlight,
+		`rejected`:        s.Rejected,
+		`latency_ns`:      int64(s.Latency),
+		`healthy_servers`: r.HealthyServers(),
+	}
+}
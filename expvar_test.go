@@ -0,0 +1,79 @@
+package resolver
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	r := New()
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2")
+
+	if err := r.PublishExpvar(`resolver_test`); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.PublishExpvar(`resolver_test`); err != nil {
+		t.Errorf(`publishing again: %v`, err)
+	}
+	if err := New().PublishExpvar(`resolver_test`); !errors.Is(err, ErrExpvarTaken) {
+		t.Errorf(`expected ErrExpvarTaken, got %v`, err)
+	}
+
+	_ = r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	expvar.Handler().ServeHTTP(rec, httptest.NewRequest(`GET`, `/debug/vars`, nil))
+
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatal(err)
+	}
+
+	var v map[string]interface{}
+	if err := json.Unmarshal(vars[`resolver_test`], &v); err != nil {
+		t.Fatalf(`resolver_test not published: %v`, err)
+	}
+	for _, key := range []string{`lookups`, `lookups_by_type`, `successes`, `failures`, `attempts`, `in_flight`, `healthy_servers`} {
+		if _, ok := v[key]; !ok {
+			t.Errorf(`missing %s`, key)
+		}
+	}
+	if v[`lookups`] != 1.0 || v[`healthy_servers`] != 2.0 {
+		t.Errorf(`unexpected values %v`, v)
+	}
+}
+
+func TestPublishExpvarClose(t *testing.T) {
+	r := New()
+	if err := r.PublishExpvar(`resolver_test_close`); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expvarOwnersMu.Lock()
+	owner := expvarOwners[`resolver_test_close`]
+	expvarOwnersMu.Unlock()
+	if owner != nil {
+		t.Error(`expected the closed resolver to be let go`)
+	}
+	if v := expvar.Get(`resolver_test_close`).String(); v != `null` {
+		t.Errorf(`expected null, got %s`, v)
+	}
+
+	// the prefix is free for another resolver
+	other := New()
+	if err := other.PublishExpvar(`resolver_test_close`); err != nil {
+		t.Errorf(`expected the prefix to be free, got %v`, err)
+	}
+	if v := expvar.Get(`resolver_test_close`).String(); v == `null` {
+		t.Error(`expected the new resolver's stats`)
+	}
+}
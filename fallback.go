@@ -0,0 +1,310 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultNativeTimeout is how long NativeFirst waits on the system resolver
+// when NativeTimeout is 0.
+const DefaultNativeTimeout = time.Second * 2
+
+// systemResolver is where NativeFirst and BypassNative look names up.
+var systemResolver = net.DefaultResolver
+
+// Lookup paths counted by Stats.ByPath. The fallbacks are counted as
+// PathFallback with their place in the chain, `fallback1` for the first.
+const (
+	PathServers  = `servers`
+	PathFallback = `fallback`
+	PathNative   = `native`
+)
+
+// FallbackPolicy is the set of failures of the servers on which the system
+// resolver of BypassNative is tried, see BypassOn.
+type FallbackPolicy int
+
+const (
+	// FallbackEmptyList is when no server is left, *EmptyListError.
+	FallbackEmptyList FallbackPolicy = 1 << iota
+	// FallbackRetryLimit is when the attempts ran out, *RetryLimitError.
+	// RetryLimit is the retry budget of a lookup.
+	FallbackRetryLimit
+	// FallbackNetworkDown is when the lookup failed fast on a network
+	// found to be down, *NetworkDownError.
+	FallbackNetworkDown
+)
+
+// takes tells whether the servers failing with err trigger the fallback, 0
+// is FallbackEmptyList.
+func (p FallbackPolicy) takes(err error) bool {
+	if p == 0 {
+		p = FallbackEmptyList
+	}
+
+	var empty *EmptyListError
+	return p&FallbackEmptyList != 0 && errors.As(err, &empty) ||
+		p&FallbackRetryLimit != 0 && errors.Is(err, ErrRetryLimit) ||
+		p&FallbackNetworkDown != 0 && errors.Is(err, ErrNetworkDown)
+}
+
+// BypassError is the error of a lookup the servers failed, other than with
+// an *EmptyListError which records it itself, and that the system resolver
+// of BypassNative failed as well. Err is that of the servers.
+type BypassError struct {
+	Err       error
+	NativeErr error
+}
+
+func (e *BypassError) Error() string {
+	return e.Err.Error() + `, system resolver: ` + e.NativeErr.Error()
+}
+
+func (e *BypassError) Unwrap() error {
+	return e.Err
+}
+
+// SetFallbacks sets the resolvers a lookup falls back to, in order, when
+// the servers fail it with an *EmptyListError or a *RetryLimitError, those
+// of routes and WithServer excepted. Each
+// layer is tried when the one before it fails as well, the first answer is
+// returned. A layer that does not find the name ends the chain with its
+// error, unless FallbackOnNotFound is set. When every layer fails the
+// lookup fails with a *FallbackError, and the system resolver of
+// BypassNative still comes last. Wrap a layer in TimeoutLookuper to bound
+// it. Calling it without layers removes them.
+func (r *Resolver) SetFallbacks(layers ...Lookuper) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.fallbacks = append([]Lookuper(nil), layers...)
+}
+
+// FallbackError is the error of a lookup that went through the fallbacks
+// and failed on all of them. Err is that of the servers.
+type FallbackError struct {
+	Err    error
+	Layers []error // one per fallback, in order
+}
+
+func (e *FallbackError) Error() string {
+	var b strings.Builder
+
+	b.WriteString(e.Err.Error())
+	for i, err := range e.Layers {
+		b.WriteString(`, fallback `)
+		b.WriteString(strconv.Itoa(i + 1))
+		b.WriteString(`: `)
+		b.WriteString(err.Error())
+	}
+
+	return b.String()
+}
+
+func (e *FallbackError) Unwrap() error {
+	return e.Err
+}
+
+// fallback runs lookup on the fallbacks in turn when the servers failed
+// with err, and counts the path that answered.
+func (r *Resolver) fallback(err error, lookup func(l Lookuper) error) error {
+	if err == nil {
+		r.stats.path(PathServers)
+		return nil
+	}
+
+	var empty *EmptyListError
+	if !errors.As(err, &empty) && !errors.Is(err, ErrRetryLimit) || pinned(err) {
+		return err
+	}
+
+	r.mu.Lock()
+	layers := r.fallbacks
+	r.mu.Unlock()
+	if len(layers) == 0 {
+		return err
+	}
+
+	onNotFound := r.settings().FallbackOnNotFound
+	failed := &FallbackError{Err: err, Layers: make([]error, 0, len(layers))}
+	for i, l := range layers {
+		layerErr := lookup(l)
+		if layerErr == nil {
+			r.stats.path(PathFallback + strconv.Itoa(i+1))
+			return nil
+		}
+		if !onNotFound && (errors.Is(layerErr, ErrNoSuchHost) || errors.Is(layerErr, ErrNoData) || isNotFound(layerErr)) {
+			return layerErr
+		}
+		failed.Layers = append(failed.Layers, layerErr)
+	}
+
+	return failed
+}
+
+// nativeFirst runs the lookup on the system resolver first when NativeFirst
+// is set, unless it is on a route or WithServer or blocked by the domain
+// policy, which the servers then report. It is done when that answers, or
+// when it does not find host and FallbackOnNotFound is not set, the servers
+// are asked otherwise.
+func (r *Resolver) nativeFirst(host string, native func(ctx context.Context) error, opts []LookupOption) (done bool, err error) {
+	o := r.lookupOptions(opts)
+	s := &o.settings
+	if !s.NativeFirst || o.servers != nil {
+		return false, nil
+	}
+	routed := host
+	if net.ParseIP(host) != nil {
+		routed = reverseName(host)
+	}
+	if r.matchRoute(routed) != nil || r.checkDomain(routed) != nil {
+		return false, nil
+	}
+
+	timeout := s.NativeTimeout
+	if timeout == 0 {
+		timeout = DefaultNativeTimeout
+	}
+	ctx, cancel := context.WithTimeout(o.ctx, timeout)
+	defer cancel()
+
+	err = native(ctx)
+	if err == nil {
+		r.stats.path(PathNative)
+		return true, nil
+	}
+	if isNotFound(err) && !s.FallbackOnNotFound {
+		return true, &NotFoundError{Host: host, Err: err}
+	}
+
+	return false, nil
+}
+
+// TimeoutLookuper returns l with every lookup bounded by d: a lookup still
+// running then is left behind and fails with context.DeadlineExceeded.
+// The context handed to l is cancelled as well.
+func TimeoutLookuper(l Lookuper, d time.Duration) Lookuper {
+	return timeoutLookuper{l: l, d: d}
+}
+
+type timeoutLookuper struct {
+	l Lookuper
+	d time.Duration
+}
+
+// run runs lookup with a context ending after t.d, returning early then.
+// The results lookup sets must not be read after an error.
+func (t timeoutLookuper) run(ctx context.Context, lookup func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, t.d)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- lookup(ctx) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// withContext returns opts with ctx last, leaving opts as it is.
+func withContext(opts []LookupOption, ctx context.Context) []LookupOption {
+	return append(opts[:len(opts):len(opts)], WithContext(ctx))
+}
+
+func (t timeoutLookuper) LookupIPAddr(host string, opts ...LookupOption) ([]net.IPAddr, error) {
+	var ips []net.IPAddr
+	err := t.run(lookupContext(opts), func(ctx context.Context) (err error) {
+		ips, err = t.l.LookupIPAddr(host, withContext(opts, ctx)...)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ips, nil
+}
+
+func (t timeoutLookuper) LookupAddr(ip string, opts ...LookupOption) ([]string, error) {
+	var names []string
+	err := t.run(lookupContext(opts), func(ctx context.Context) (err error) {
+		names, err = t.l.LookupAddr(ip, withContext(opts, ctx)...)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+func (t timeoutLookuper) LookupNS(host string, opts ...LookupOption) ([]*net.NS, error) {
+	var nsList []*net.NS
+	err := t.run(lookupContext(opts), func(ctx context.Context) (err error) {
+		nsList, err = t.l.LookupNS(host, withContext(opts, ctx)...)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return nsList, nil
+}
+
+func (t timeoutLookuper) LookupTXT(host string, opts ...LookupOption) ([]string, error) {
+	var txt []string
+	err := t.run(lookupContext(opts), func(ctx context.Context) (err error) {
+		txt, err = t.l.LookupTXT(host, withContext(opts, ctx)...)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return txt, nil
+}
+
+func (t timeoutLookuper) LookupCNAME(host string, opts ...LookupOption) (string, error) {
+	var cname string
+	err := t.run(lookupContext(opts), func(ctx context.Context) (err error) {
+		cname, err = t.l.LookupCNAME(host, withContext(opts, ctx)...)
+		return
+	})
+	if err != nil {
+		return ``, err
+	}
+
+	return cname, nil
+}
+
+func (t timeoutLookuper) LookupMX(host string, opts ...LookupOption) ([]*net.MX, error) {
+	var mxList []*net.MX
+	err := t.run(lookupContext(opts), func(ctx context.Context) (err error) {
+		mxList, err = t.l.LookupMX(host, withContext(opts, ctx)...)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mxList, nil
+}
+
+func (t timeoutLookuper) Query(ctx context.Context, name string, qtype Type, opts ...LookupOption) (*Message, error) {
+	var m *Message
+	err := t.run(ctx, func(ctx context.Context) (err error) {
+		m, err = t.l.Query(ctx, name, qtype, opts...)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
@@ -0,0 +1,187 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// hangingLookuper blocks its address lookups until release is closed.
+type hangingLookuper struct {
+	NopResolver
+	release chan struct{}
+}
+
+func (l hangingLookuper) LookupIPAddr(string, ...LookupOption) ([]net.IPAddr, error) {
+	<-l.release
+	return nil, ErrNopResolver
+}
+
+func TestFallbacks(t *testing.T) {
+	down := errors.New(`down`)
+	found := &StaticResolver{Records: map[string]StaticRecords{
+		`example.com`: {IPs: []net.IPAddr{{IP: net.ParseIP(`192.0.2.1`)}}, TXT: []string{`fallback`}},
+	}}
+
+	r := New()
+	r.SetFallbacks(NopResolver{Err: down}, found)
+
+	ips, err := r.LookupIPAddr(`example.com`)
+	if err != nil || len(ips) != 1 {
+		t.Fatalf(`expected the address of the second fallback, got %v, %v`, ips, err)
+	}
+	if n := r.Stats().ByPath[`fallback2`]; n != 1 {
+		t.Errorf(`expected one answer of the second fallback, got %d`, n)
+	}
+
+	_, err = r.LookupIPAddr(`missing.example`)
+	if !errors.Is(err, ErrNoSuchHost) {
+		t.Errorf(`expected the not found error of the layer, got %v`, err)
+	}
+
+	r.SetFallbacks(&StaticResolver{}, found)
+	if _, err := r.LookupTXT(`example.com`); !errors.Is(err, ErrNoSuchHost) {
+		t.Errorf(`expected not found to end the chain, got %v`, err)
+	}
+	r.FallbackOnNotFound = true
+	if txt, err := r.LookupTXT(`example.com`); err != nil || len(txt) != 1 {
+		t.Errorf(`expected the next layer to answer, got %v, %v`, txt, err)
+	}
+
+	r.SetFallbacks(NopResolver{Err: down})
+	_, err = r.LookupMX(`example.com`)
+	var fe *FallbackError
+	if !errors.As(err, &fe) || len(fe.Layers) != 1 || fe.Layers[0] != down || !errors.Is(err, ErrServerListEmpty) {
+		t.Errorf(`expected a *FallbackError over the empty list, got %v`, err)
+	}
+}
+
+func TestFallbacksOnRetryLimit(t *testing.T) {
+	ts := newTestServer(t, func(q Question, resp *Message) {
+		resp.Rcode = RcodeServerFailure
+	})
+
+	r := New()
+	r.RetryLimit = 2
+	r.RetrySleep = 0
+	if _, err := r.LoadServersFromString(ts.Addr); err != nil {
+		t.Fatal(err)
+	}
+	r.SetFallbacks(&StaticResolver{Records: map[string]StaticRecords{`example.com`: {TXT: []string{`fallback`}}}})
+
+	txt, err := r.LookupTXT(`example.com`)
+	if err != nil || len(txt) != 1 || txt[0] != `fallback` {
+		t.Errorf(`expected the fallback to answer, got %v, %v`, txt, err)
+	}
+}
+
+func TestTimeoutLookuper(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	r := New()
+	r.SetFallbacks(TimeoutLookuper(hangingLookuper{release: release}, time.Millisecond*20), &StaticResolver{Records: map[string]StaticRecords{
+		`example.com`: {IPs: []net.IPAddr{{IP: net.ParseIP(`192.0.2.1`)}}},
+	}})
+
+	start := time.Now()
+	ips, err := r.LookupIPAddr(`example.com`)
+	if err != nil || len(ips) != 1 {
+		t.Errorf(`expected the layer after the hanging one to answer, got %v, %v`, ips, err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf(`expected the hanging layer to be cut off, took %v`, d)
+	}
+}
+
+func TestNativeFirst(t *testing.T) {
+	system := newTestServer(t, answerA(map[string]string{`system.example`: `192.0.2.1`}))
+	defer func(saved *net.Resolver) { systemResolver = saved }(systemResolver)
+	systemResolver = &net.Resolver{PreferGo: true, Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, system.Addr)
+	}}
+	ts := newTestServer(t, answerA(map[string]string{`servers.example`: `192.0.2.2`}))
+
+	r := New()
+	r.NativeFirst = true
+	if _, err := r.LoadServersFromString(ts.Addr); err != nil {
+		t.Fatal(err)
+	}
+
+	if ips, err := r.LookupIPAddr(`system.example`); err != nil || len(ips) != 1 {
+		t.Fatalf(`expected the system resolver to answer, got %v, %v`, ips, err)
+	}
+	if n := len(ts.Queries()); n != 0 {
+		t.Errorf(`expected no queries to the servers, got %d`, n)
+	}
+
+	if _, err := r.LookupIPAddr(`servers.example`); !errors.Is(err, ErrNoSuchHost) {
+		t.Errorf(`expected not found of the system resolver, got %v`, err)
+	}
+	r.FallbackOnNotFound = true
+	if ips, err := r.LookupIPAddr(`servers.example`); err != nil || len(ips) != 1 {
+		t.Errorf(`expected the servers to answer, got %v, %v`, ips, err)
+	}
+
+	st := r.Stats()
+	if st.ByPath[PathNative] != 1 || st.ByPath[PathServers] != 1 {
+		t.Errorf(`expected one lookup on each path, got %v`, st.ByPath)
+	}
+
+	// a system resolver that never answers is given up on
+	silent, err := net.ListenPacket(`udp`, `127.0.0.1:0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	system.Addr = silent.LocalAddr().String()
+	r.NativeTimeout = time.Millisecond * 50
+
+	start := time.Now()
+	if ips, err := r.LookupIPAddr(`servers.example`); err != nil || len(ips) != 1 {
+		t.Errorf(`expected the servers to answer, got %v, %v`, ips, err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf(`expected the system resolver to be cut off, took %v`, d)
+	}
+}
+
+func TestBypassOn(t *testing.T) {
+	system := newTestServer(t, answerA(map[string]string{`example.com`: `192.0.2.1`}))
+	defer func(saved *net.Resolver) { systemResolver = saved }(systemResolver)
+	systemResolver = &net.Resolver{PreferGo: true, Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, system.Addr)
+	}}
+	ts := newTestServer(t, func(q Question, resp *Message) {
+		resp.Rcode = RcodeServerFailure
+	})
+
+	r := New()
+	r.RetryLimit = 1
+	r.BypassNative = true
+	if _, err := r.LoadServersFromString(ts.Addr); err != nil {
+		t.Fatal(err)
+	}
+
+	// by default the retry limit is not a trigger
+	_, err := r.LookupIPAddr(`example.com`)
+	var rl *RetryLimitError
+	if !errors.As(err, &rl) || len(system.Queries()) != 0 {
+		t.Errorf(`expected the retry limit error alone, got %v`, err)
+	}
+
+	r.BypassOn = FallbackEmptyList | FallbackRetryLimit
+	if ips, err := r.LookupIPAddr(`example.com`); err != nil || len(ips) != 1 {
+		t.Errorf(`expected the system resolver to answer, got %v, %v`, ips, err)
+	}
+
+	_, err = r.LookupIPAddr(`missing.example`)
+	var be *BypassError
+	if !errors.As(err, &be) || be.NativeErr == nil || !errors.Is(err, ErrRetryLimit) {
+		t.Errorf(`expected a *BypassError over the retry limit, got %v`, err)
+	}
+}
@@ -0,0 +1,140 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+var ErrFamilyFailed = errors.New(`resolver: address family lookup failed`)
+
+// FamilyError is the reason of an address lookup with SplitFamilies of
+// which one family failed, Family is TypeA or TypeAAAA. It matches
+// ErrFamilyFailed and unwraps to the error of that family.
+type FamilyError struct {
+	Host   string
+	Family Type
+	Err    error
+}
+
+func (e *FamilyError) Error() string {
+	return ErrFamilyFailed.Error() + `: ` + e.Family.String() + ` ` + e.Host + `: ` + e.Err.Error()
+}
+
+func (e *FamilyError) Is(target error) bool {
+	return target == ErrFamilyFailed
+}
+
+func (e *FamilyError) Unwrap() error {
+	return e.Err
+}
+
+func (e *FamilyError) Timeout() bool {
+	return isTimeout(e.Err)
+}
+
+func (e *FamilyError) Temporary() bool {
+	return true
+}
+
+// lookupFamilies is LookupIPAddr with SplitFamilies: A and AAAA are asked
+// at the same time, each as a lookup of its own.
+func (r *Resolver) lookupFamilies(host string, s *Settings, opts []LookupOption) ([]net.IPAddr, error) {
+	families := [2]Type{TypeA, TypeAAAA}
+	var ips [2][]net.IPAddr
+	var errs [2]error
+
+	var wg sync.WaitGroup
+	for i := range families {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ips[i], errs[i] = r.lookupFamily(host, families[i], opts)
+		}(i)
+	}
+	wg.Wait()
+
+	// a family without records is no failure as long as the other has some
+	for i := range errs {
+		if errs[i] != nil && errors.Is(errs[i], ErrNoData) && errs[1-i] == nil {
+			errs[i] = nil
+		}
+	}
+
+	switch {
+	case errs[0] == nil && errs[1] == nil:
+		return append(ips[0], ips[1]...), nil
+	case errs[0] != nil && errs[1] != nil:
+		return nil, worseFamilyError(errs[0], errs[1])
+	}
+
+	i := 0
+	if errs[1] != nil {
+		i = 1
+	}
+	err := &FamilyError{Host: host, Family: families[i], Err: errs[i]}
+	if s.RequireBothFamilies {
+		return nil, err
+	}
+
+	return ips[1-i], err
+}
+
+// worseFamilyError picks the error of a lookup of which both families
+// failed: a failure beats a host not found, which beats no data.
+func worseFamilyError(a, b error) error {
+	rank := func(err error) int {
+		switch {
+		case errors.Is(err, ErrNoData):
+			return 0
+		case errors.Is(err, ErrNoSuchHost):
+			return 1
+		}
+		return 2
+	}
+
+	if rank(b) > rank(a) {
+		return b
+	}
+	return a
+}
+
+// lookupFamily asks for the addresses of one family with raw queries.
+func (r *Resolver) lookupFamily(host string, qtype Type, opts []LookupOption) (ipList []net.IPAddr, err error) {
+	err = r.attempt(qtype.String(), host, func(ctx context.Context, addr, name string, s *Settings) error {
+		m, err := r.exchange(ctx, addr, newQuery(name, qtype))
+		if err != nil {
+			return err
+		}
+		if m.Rcode != RcodeSuccess {
+			return &ResponseError{Server: addr, Code: m.Rcode}
+		}
+		if _, err := cnameChain(name, m.Answers, s.MaxCNAMEDepth); err != nil {
+			return err
+		}
+
+		var list []net.IPAddr
+		var ips []net.IP
+		for _, rr := range m.Answers {
+			if rr.Type == qtype {
+				list = append(list, net.IPAddr{IP: rr.IP})
+				ips = append(ips, rr.IP)
+			}
+		}
+		if len(list) == 0 {
+			return ErrNoData
+		}
+		if err := filteredAnswer(s, name, addr, ips); err != nil {
+			return err
+		}
+
+		ipList, err = stripBogons(s, name, addr, list)
+		return err
+	}, func() string { return ipSummary(ipList) }, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ipList, nil
+}
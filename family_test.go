@@ -0,0 +1,58 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestSplitFamilies(t *testing.T) {
+	server := newTestServer(t, func(q Question, resp *Message) {
+		switch {
+		case q.Name == `gone.example.com.`:
+			resp.Rcode = RcodeNameError
+		case q.Type == TypeA:
+			resp.Answers = append(resp.Answers, RR{Name: q.Name, Type: TypeA, TTL: 60, IP: net.ParseIP(`192.0.2.1`)})
+		case q.Name == `dual.example.com.`:
+			resp.Answers = append(resp.Answers, RR{Name: q.Name, Type: TypeAAAA, TTL: 60, IP: net.ParseIP(`2001:db8::1`)})
+		case q.Name == `broken.example.com.`:
+			resp.Rcode = RcodeServerFailure
+		}
+	})
+
+	r := New()
+	r.RetrySleep = 0
+	r.RetryLimit = 2
+	r.SplitFamilies = true
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	ips, err := r.LookupIPAddr(`dual.example.com`)
+	if err != nil || len(ips) != 2 || ips[0].IP.String() != `192.0.2.1` || ips[1].IP.String() != `2001:db8::1` {
+		t.Errorf(`unexpected dual-stack result %v %v`, ips, err)
+	}
+
+	// a family without records is no failure
+	ips, err = r.LookupIPAddr(`v4.example.com`)
+	if err != nil || len(ips) != 1 {
+		t.Errorf(`unexpected v4-only result %v %v`, ips, err)
+	}
+
+	ips, err = r.LookupIPAddr(`broken.example.com`)
+	var famErr *FamilyError
+	if !errors.As(err, &famErr) || famErr.Family != TypeAAAA || !errors.Is(err, ErrFamilyFailed) || !errors.Is(err, ErrRetryLimit) {
+		t.Errorf(`expected an AAAA FamilyError, got %v`, err)
+	}
+	if len(ips) != 1 || ips[0].IP.String() != `192.0.2.1` {
+		t.Errorf(`expected the A records along with the error, got %v`, ips)
+	}
+
+	if _, err := r.LookupIPAddr(`gone.example.com`); !errors.Is(err, ErrNoSuchHost) || errors.Is(err, ErrFamilyFailed) {
+		t.Errorf(`expected ErrNoSuchHost, got %v`, err)
+	}
+
+	r.RequireBothFamilies = true
+	ips, err = r.LookupIPAddr(`broken.example.com`)
+	if !errors.Is(err, ErrFamilyFailed) || ips != nil {
+		t.Errorf(`expected a strict failure, got %v %v`, ips, err)
+	}
+}
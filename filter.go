@@ -0,0 +1,316 @@
+package resolver
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// LoadReport tells what happened to the entries of a server list load.
+type LoadReport struct {
+	Added      int
+	Filtered   int
+	Duplicates int
+	Invalid    int
+}
+
+type serverFilter struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+func (f *serverFilter) allowed(addr string) bool {
+	if f == nil {
+		return true
+	}
+
+	ip, err := netip.ParseAddr(serverHost(addr))
+	if err != nil {
+		return len(f.allow) == 0
+	}
+	ip = ip.Unmap()
+
+	for _, p := range f.deny {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, p := range f.allow {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetServerFilter rejects servers inside a deny prefix, and when allow is not
+// empty also every server outside all of the allow prefixes. The filter
+// applies to later loads and to servers already in the list, which are
+// skipped by selection from now on, the number of them is returned.
+// Nil prefixes remove the filter.
+func (r *Resolver) SetServerFilter(allow []netip.Prefix, deny []netip.Prefix) int {
+	var f *serverFilter
+	if len(allow) > 0 || len(deny) > 0 {
+		f = &serverFilter{allow: allow, deny: deny}
+	}
+
+	r.mu.Lock()
+	r.filter = f
+	r.mu.Unlock()
+
+	filtered := 0
+	for _, s := range r.Servers.All() {
+		if !f.allowed(s.Addr) {
+			filtered++
+		}
+	}
+
+	return filtered
+}
+
+func (r *Resolver) serverAllowed(addr string) bool {
+	r.mu.Lock()
+	f := r.filter
+	r.mu.Unlock()
+
+	return f.allowed(addr)
+}
+
+// AddServer normalizes addr and adds it to the list unless the server filter
+// rejects it or the list already has the same server.
+func (r *Resolver) AddServer(addr string) bool {
+	var report LoadReport
+	r.addServers([]serverLine{{addr: addr}}, r.knownServers(), &report)
+
+	return report.Added == 1
+}
+
+// RemoveServer takes the server at addr out of rotation and reports whether
+// it was in. The list keeps the entry, adding the server again puts it back.
+func (r *Resolver) RemoveServer(addr string) bool {
+	addr, ok := normalizeServer(addr)
+	if !ok {
+		return false
+	}
+	if _, known := r.knownServers()[addr]; !known || !r.health.setRemoved(addr, true) {
+		return false
+	}
+
+	r.events.emit(EventServerEvicted, addr, `removed`)
+	s := r.settings()
+	r.checkPool(&s)
+
+	return true
+}
+
+type serverLine struct {
+	addr string
+	tags map[string]string
+}
+
+// LoadServers adds one server per line read from reader, blank lines and
+// lines starting with # are ignored. A line may tag its server with
+// key=value pairs after the address: `9.9.9.9 provider=quad9 region=eu`.
+// Addresses are normalized so different spellings of one server collapse
+// into the entry that is already loaded, tags of a duplicate still apply.
+func (r *Resolver) LoadServers(reader io.Reader) (LoadReport, error) {
+	var report LoadReport
+	var lines []serverLine
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == `` || line[0] == '#' {
+			continue
+		}
+
+		addr, tags, ok := parseServerLine(line)
+		if !ok {
+			report.Invalid++
+			continue
+		}
+		lines = append(lines, serverLine{addr: addr, tags: tags})
+	}
+
+	r.addServers(lines, r.knownServers(), &report)
+	r.events.emit(EventListLoaded, ``, loadReason(report))
+
+	s := r.settings()
+	r.checkPool(&s)
+	if l := s.Logger; l != nil {
+		l.Info(`resolver: servers loaded`, `added`, report.Added, `duplicates`, report.Duplicates, `invalid`, report.Invalid, `filtered`, report.Filtered)
+	}
+
+	return report, scanner.Err()
+}
+
+func (r *Resolver) addServers(lines []serverLine, known map[string]struct{}, report *LoadReport) {
+	for _, line := range lines {
+		addr, ok := normalizeServer(line.addr)
+		switch {
+		case !ok:
+			report.Invalid++
+		case !r.serverAllowed(addr):
+			report.Filtered++
+		default:
+			if line.tags != nil {
+				r.TagServer(addr, line.tags)
+			}
+
+			if _, ok := known[addr]; ok {
+				if r.health.setRemoved(addr, false) {
+					report.Added++
+				} else {
+					report.Duplicates++
+				}
+				continue
+			}
+
+			known[addr] = struct{}{}
+			r.Servers.Add(addr)
+			report.Added++
+		}
+	}
+}
+
+// knownServers returns the normalized addresses of the loaded servers.
+func (r *Resolver) knownServers() map[string]struct{} {
+	servers := r.Servers.All()
+	known := make(map[string]struct{}, len(servers))
+
+	for _, s := range servers {
+		if addr, ok := normalizeServer(s.Addr); ok {
+			known[addr] = struct{}{}
+		}
+	}
+
+	return known
+}
+
+func (r *Resolver) LoadServersFromString(servers string) (LoadReport, error) {
+	return r.LoadServers(strings.NewReader(servers))
+}
+
+// LoadServersFromURL loads the servers listed at url. With
+// EmbeddedFallback the embedded servers are loaded instead when the fetch
+// fails or the list has no valid server, the failure is then only logged.
+func (r *Resolver) LoadServersFromURL(url string) (LoadReport, error) {
+	report, err := r.loadServersFromURL(url)
+	if err == nil && report.Added+report.Duplicates > 0 {
+		return report, nil
+	}
+
+	s := r.settings()
+	if !s.EmbeddedFallback {
+		return report, err
+	}
+	if l := s.Logger; l != nil {
+		l.Warn(`resolver: server list unusable, loading the embedded servers`, `url`, url, `error`, err)
+	}
+
+	return r.LoadEmbeddedServers()
+}
+
+func (r *Resolver) loadServersFromURL(url string) (LoadReport, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return LoadReport{}, err
+	}
+
+	defer resp.Body.Close()
+
+	return r.LoadServers(resp.Body)
+}
+
+// serverHost strips the port and IPv6 brackets from a server address.
+func serverHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return strings.TrimSuffix(strings.TrimPrefix(addr, `[`), `]`)
+}
+
+// normalizeServer returns the canonical form of a server address: the IP in
+// its shortest textual form, followed by the port unless it is 53. Dotted
+// IPv4 with leading zeros is read as decimal. Host names are lowercased.
+func normalizeServer(addr string) (string, bool) {
+	addr = strings.TrimSpace(addr)
+	if addr == `` {
+		return ``, false
+	}
+
+	host, port := addr, strings.TrimPrefix(addressSuffix, `:`)
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		host, port = h, p
+	} else {
+		host = strings.TrimSuffix(strings.TrimPrefix(host, `[`), `]`)
+	}
+
+	n, err := strconv.Atoi(port)
+	if err != nil || n <= 0 || n > 65535 || strings.Trim(port, `0123456789`) != `` {
+		return ``, false
+	}
+	port = strconv.Itoa(n)
+
+	var name string
+	if ip, ok := parseServerIP(host); ok {
+		name = ip.String()
+	} else if strings.ContainsAny(host, ` /:`) || numericTLD(host) {
+		return ``, false
+	} else {
+		name = strings.ToLower(host)
+	}
+
+	if `:`+port == addressSuffix {
+		return name, true
+	}
+
+	return net.JoinHostPort(name, port), true
+}
+
+// numericTLD reports whether the last label of host is made of digits and
+// signs, which no TLD is: a malformed IPv4 address, not a host name.
+func numericTLD(host string) bool {
+	tld := strings.TrimSuffix(host, `.`)
+	if i := strings.LastIndexByte(tld, '.'); i >= 0 {
+		tld = tld[i+1:]
+	}
+
+	return strings.Trim(tld, `+-0123456789`) == ``
+}
+
+func parseServerIP(host string) (netip.Addr, bool) {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return ip.Unmap(), true
+	}
+
+	parts := strings.Split(host, `.`)
+	if len(parts) != 4 {
+		return netip.Addr{}, false
+	}
+
+	var b [4]byte
+	for i, p := range parts {
+		if p == `` || len(p) > 3 || strings.Trim(p, `0123456789`) != `` {
+			// digits only, Atoi would take a sign
+			return netip.Addr{}, false
+		}
+		n, _ := strconv.Atoi(p)
+		if n > 255 {
+			return netip.Addr{}, false
+		}
+		b[i] = byte(n)
+	}
+
+	return netip.AddrFrom4(b), true
+}
@@ -0,0 +1,128 @@
+package resolver
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerFilter(t *testing.T) {
+	r := New()
+
+	_, err := r.LoadServersFromString("10.1.2.3\n192.0.2.1\n198.51.100.7:5353")
+	if err != nil {
+		t.Error(err)
+	}
+
+	deny := []netip.Prefix{netip.MustParsePrefix(`10.0.0.0/8`)}
+	allow := []netip.Prefix{netip.MustParsePrefix(`192.0.2.0/24`), netip.MustParsePrefix(`10.0.0.0/8`)}
+
+	if n := r.SetServerFilter(allow, deny); n != 2 {
+		t.Errorf(`expected 2 loaded servers filtered, got %d`, n)
+	}
+
+	for i := 0; i < 6; i++ {
+		_ = r.lookup(`A`, `example.com`, func(res *net.Resolver) error {
+			if got := dialedServer(t, res); got != `192.0.2.1:53` {
+				t.Errorf(`filtered server %s was selected`, got)
+			}
+			return nil
+		})
+	}
+
+	report, err := r.LoadServersFromString("# comment\n10.9.9.9\n192.0.2.2\n\n203.0.113.1\n[::ffff:192.0.2.3]:53\n")
+	if err != nil {
+		t.Error(err)
+	}
+	if report.Added != 2 || report.Filtered != 2 {
+		t.Errorf(`unexpected load report %+v`, report)
+	}
+
+	if n := r.SetServerFilter(nil, nil); n != 0 {
+		t.Errorf(`expected no servers filtered without a filter, got %d`, n)
+	}
+}
+
+func TestNormalizeServer(t *testing.T) {
+	cases := map[string]string{
+		`1.1.1.1`:              `1.1.1.1`,
+		`1.1.1.1:53`:           `1.1.1.1`,
+		`01.1.1.1`:             `1.1.1.1`,
+		` 001.001.001.001:053`: `1.1.1.1`,
+		`127.0.0.1:8600`:       `127.0.0.1:8600`,
+		`2001:DB8::0:1`:        `2001:db8::1`,
+		`[2001:db8::1]:53`:     `2001:db8::1`,
+		`[2001:db8::1]:5353`:   `[2001:db8::1]:5353`,
+		`::ffff:8.8.8.8`:       `8.8.8.8`,
+		`DNS.Example.com`:      `dns.example.com`,
+	}
+
+	for in, want := range cases {
+		got, ok := normalizeServer(in)
+		if !ok || got != want {
+			t.Errorf(`%q: expected %q, got %q`, in, want, got)
+		}
+	}
+
+	for _, in := range []string{``, `1.1.1.1:0`, `1.1.1.1:x`, `https://1.1.1.1`, `a b`, `-1.1.1.1`, `+1.1.1.1`, `1.1.-0.1`, `1.1.1.256`, `1.1.1`, `1.1.1.1:+53`} {
+		if got, ok := normalizeServer(in); ok {
+			t.Errorf(`%q: expected invalid, got %q`, in, got)
+		}
+		if ip, ok := parseServerIP(strings.TrimSpace(in)); ok {
+			t.Errorf(`%q: expected no address, got %s`, in, ip)
+		}
+	}
+}
+
+func TestDeduplicateServers(t *testing.T) {
+	r := New()
+
+	report, err := r.LoadServersFromString("1.1.1.1\n1.1.1.1:53\n01.1.1.1\n8.8.8.8")
+	if err != nil {
+		t.Error(err)
+	}
+	if report.Added != 2 || report.Duplicates != 2 {
+		t.Errorf(`unexpected load report %+v`, report)
+	}
+
+	r.health.failure(`1.1.1.1`, 1, healthConfig{maxStreak: 10}, time.Now())
+
+	report, err = r.LoadServersFromString("001.1.1.1:53\n9.9.9.9")
+	if err != nil {
+		t.Error(err)
+	}
+	if report.Added != 1 || report.Duplicates != 1 {
+		t.Errorf(`unexpected load report %+v`, report)
+	}
+	if r.AddServer(`1.1.1.1`) {
+		t.Error(`duplicate server added`)
+	}
+	if r.Servers.Count() != 3 {
+		t.Errorf(`expected 3 servers, got %d`, r.Servers.Count())
+	}
+	if r.health.servers[`1.1.1.1`].fails != 1 {
+		t.Error(`health state of the surviving entry was lost`)
+	}
+}
+
+func TestRemoveServer(t *testing.T) {
+	r := New()
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2")
+
+	if !r.RemoveServer(`10.0.0.1`) || r.RemoveServer(`10.0.0.1`) || r.RemoveServer(`10.0.0.9`) {
+		t.Fatal(`unexpected removal results`)
+	}
+
+	for i := 0; i < 4; i++ {
+		server, err := r.getServer(r.Servers, `example.com`, nil, r.lookupOptions(nil))
+		if err != nil || strings.HasPrefix(server.Addr, `10.0.0.1`) {
+			t.Errorf(`removed server picked: %v %v`, server, err)
+		}
+	}
+
+	if !r.AddServer(`10.0.0.1`) || r.HealthyServers() != 2 {
+		t.Errorf(`server not put back`)
+	}
+}
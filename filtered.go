@@ -0,0 +1,94 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+)
+
+var ErrFilteredAnswer = errors.New(`resolver: answer filtered by the server`)
+
+// FilteredAnswerPolicy is what a lookup does with an address answer that
+// only has blocking addresses in it, see FilteredPrefixes.
+type FilteredAnswerPolicy int
+
+const (
+	// FilteredIgnore returns such answers like any other.
+	FilteredIgnore FilteredAnswerPolicy = iota
+	// FilteredRetry asks the next server and flags the first one as
+	// filtering when another server answers the name normally.
+	FilteredRetry
+	// FilteredError fails the lookup with ErrFilteredAnswer.
+	FilteredError
+)
+
+// DefaultFilteredPrefixes are the addresses filtering resolvers answer with
+// for blocked names.
+var DefaultFilteredPrefixes = []netip.Prefix{
+	netip.MustParsePrefix(`0.0.0.0/32`),
+	netip.MustParsePrefix(`127.0.0.0/8`),
+	netip.MustParsePrefix(`::/128`),
+	netip.MustParsePrefix(`::1/128`),
+}
+
+// FilteredAnswerError is an answer made only of blocking addresses, it
+// matches ErrFilteredAnswer.
+type FilteredAnswerError struct {
+	Host   string
+	Server string
+	IPs    []net.IP
+}
+
+func (e *FilteredAnswerError) Error() string {
+	return ErrFilteredAnswer.Error() + ` ` + e.Server + `: ` + e.Host
+}
+
+func (e *FilteredAnswerError) Is(target error) bool {
+	return target == ErrFilteredAnswer
+}
+
+func (e *FilteredAnswerError) Timeout() bool {
+	return false
+}
+
+func (e *FilteredAnswerError) Temporary() bool {
+	return false
+}
+
+// filteredAnswer returns a FilteredAnswerError when the policy asks for the
+// check and every one of ips is in a blocking prefix.
+func filteredAnswer(s *Settings, host, server string, ips []net.IP) error {
+	if s.FilteredAnswers == FilteredIgnore || len(ips) == 0 {
+		return nil
+	}
+
+	prefixes := s.FilteredPrefixes
+	if prefixes == nil {
+		prefixes = DefaultFilteredPrefixes
+	}
+
+	for _, ip := range ips {
+		addr, ok := netip.AddrFromSlice(ip)
+		if !ok || !inPrefixes(addr.Unmap(), prefixes) {
+			return nil
+		}
+	}
+
+	return &FilteredAnswerError{Host: host, Server: server, IPs: ips}
+}
+
+func inPrefixes(addr netip.Addr, prefixes []netip.Prefix) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FilteringServers returns the servers caught answering blocked names with
+// blocking addresses.
+func (r *Resolver) FilteringServers() []string {
+	return r.health.filtering()
+}
@@ -0,0 +1,89 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func blockingServer(t *testing.T, ip string) *testServer {
+	return newTestServer(t, func(q Question, resp *Message) {
+		if q.Type == TypeA {
+			resp.Answers = append(resp.Answers, RR{Name: q.Name, Type: TypeA, TTL: 60, IP: net.ParseIP(ip)})
+		}
+	})
+}
+
+func TestFilteredRetry(t *testing.T) {
+	blocking := blockingServer(t, `0.0.0.0`)
+	honest := newTestServer(t, answerA(map[string]string{`example.com`: `192.0.2.1`}))
+
+	r := New()
+	r.RetrySleep = 0
+	r.DialTimeout = time.Second * 2
+	r.FilteredAnswers = FilteredRetry
+	r.EvictFiltering = true
+	_, _ = r.LoadServersFromString(blocking.Addr + "\n" + honest.Addr)
+
+	for i := 0; i < 4; i++ {
+		ips, err := r.LookupIPAddr(`example.com`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ips) != 1 || ips[0].IP.String() != `192.0.2.1` {
+			t.Errorf(`unexpected answer %v`, ips)
+		}
+	}
+
+	if got := r.FilteringServers(); len(got) != 1 || got[0] != blocking.Addr {
+		t.Errorf(`unexpected filtering servers %v`, got)
+	}
+
+	n := len(blocking.Queries())
+	for i := 0; i < 4; i++ {
+		if _, err := r.Query(context.Background(), `example.com`, TypeA); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(blocking.Queries()) != n {
+		t.Error(`evicted filtering server still used`)
+	}
+}
+
+func TestFilteredError(t *testing.T) {
+	blocking := blockingServer(t, `198.51.100.10`)
+
+	r := New()
+	r.DialTimeout = time.Second * 2
+	r.FilteredAnswers = FilteredError
+	r.FilteredPrefixes = []netip.Prefix{netip.MustParsePrefix(`198.51.100.10/32`)}
+	_, _ = r.LoadServersFromString(blocking.Addr)
+
+	ips, err := r.LookupIPAddr(`example.com`)
+	var filtered *FilteredAnswerError
+	if !errors.As(err, &filtered) || filtered.Server != blocking.Addr || len(filtered.IPs) != 1 || ips != nil {
+		t.Errorf(`expected a filtered answer error, got %v %v`, ips, err)
+	}
+	if !errors.Is(err, ErrFilteredAnswer) {
+		t.Errorf(`expected ErrFilteredAnswer, got %v`, err)
+	}
+	if len(r.FilteringServers()) != 0 {
+		t.Error(`server flagged without another server to compare`)
+	}
+}
+
+func TestFilteredIgnore(t *testing.T) {
+	blocking := blockingServer(t, `127.0.0.1`)
+
+	r := New()
+	r.DialTimeout = time.Second * 2
+	_, _ = r.LoadServersFromString(blocking.Addr)
+
+	ips, err := r.LookupIPAddr(`localhost.example.com`)
+	if err != nil || len(ips) != 1 || !ips[0].IP.IsLoopback() {
+		t.Errorf(`unexpected answer %v %v`, ips, err)
+	}
+}
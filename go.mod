@@ -1,5 +1,11 @@
 module github.com/zofan/go-resolver
 
-go 1.16
+go 1.18
 
-require github.com/zofan/go-slist v0.0.0-20210406203728-48b54876780f
+require (
+	github.com/zofan/go-slist v0.0.0-20210406203728-48b54876780f
+	golang.org/x/net v0.21.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/text v0.14.0 // indirect
@@ -0,0 +1,237 @@
+// Package grpcresolver lets gRPC clients look their targets up with a
+// resolver. It is a module of its own so the resolver does not depend on
+// gRPC.
+package grpcresolver
+
+import (
+	"context"
+	"errors"
+	"github.com/zofan/go-resolver"
+	grpcr "google.golang.org/grpc/resolver"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultScheme is the target scheme a builder takes when none is
+	// given, that of the gRPC DNS resolver it stands in for.
+	DefaultScheme = `dns`
+
+	// DefaultInterval is how often the addresses of a target are looked up
+	// again when no interval is given, or every TTL when that is longer.
+	DefaultInterval = time.Second * 30
+
+	defaultPort = `443`
+)
+
+var ErrNoAddress = errors.New(`grpcresolver: no address`)
+
+// Builder is a gRPC resolver.Builder looking targets up with a resolver.
+// Targets are `scheme:///host:port`, the port being 443 when left out. A
+// host starting with an underscore, like `_grpc._tcp.service`, is an SRV
+// name, its targets are looked up in turn and dialed at the SRV ports.
+// The addresses are watched with Resolver.Watch, the client is updated
+// whenever they change.
+type Builder struct {
+	r        *resolver.Resolver
+	scheme   string
+	interval time.Duration
+}
+
+// NewBuilder returns a builder looking targets up with r, for scheme, or
+// DefaultScheme when it is empty, every interval, or DefaultInterval when
+// it is 0. Pass it to grpc.WithResolvers so that it replaces the gRPC DNS
+// resolver for one client only.
+func NewBuilder(r *resolver.Resolver, scheme string, interval time.Duration) *Builder {
+	if scheme == `` {
+		scheme = DefaultScheme
+	}
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	return &Builder{r: r, scheme: scheme, interval: interval}
+}
+
+func (b *Builder) Scheme() string {
+	return b.scheme
+}
+
+func (b *Builder) Build(target grpcr.Target, cc grpcr.ClientConn, _ grpcr.BuildOptions) (grpcr.Resolver, error) {
+	host, port, err := splitTarget(target.Endpoint())
+	if err != nil {
+		return nil, err
+	}
+
+	if net.ParseIP(host) != nil {
+		addr := grpcr.Address{Addr: net.JoinHostPort(host, port)}
+		return nopResolver{}, cc.UpdateState(grpcr.State{Addresses: []grpcr.Address{addr}})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &watch{r: b.r, cc: cc, ctx: ctx, cancel: cancel, port: port}
+
+	if strings.HasPrefix(host, `_`) {
+		srv, err := b.r.Watch(ctx, host, resolver.TypeSRV, b.interval)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		go w.services(srv)
+
+		return w, nil
+	}
+
+	v4, err := b.r.Watch(ctx, host, resolver.TypeA, b.interval)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	v6, err := b.r.Watch(ctx, host, resolver.TypeAAAA, b.interval)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go w.hosts(v4, v6)
+
+	return w, nil
+}
+
+// watch is the gRPC resolver of one target.
+type watch struct {
+	r      *resolver.Resolver
+	cc     grpcr.ClientConn
+	ctx    context.Context
+	cancel context.CancelFunc
+	port   string
+}
+
+// ResolveNow does nothing, the addresses are watched all along.
+func (w *watch) ResolveNow(grpcr.ResolveNowOptions) {}
+
+func (w *watch) Close() {
+	w.cancel()
+}
+
+// hosts updates the client with the addresses of both families once both
+// have been looked up, and again on every change.
+func (w *watch) hosts(v4, v6 <-chan resolver.WatchUpdate) {
+	var last4, last6 *resolver.WatchUpdate
+	for v4 != nil || v6 != nil {
+		select {
+		case u, ok := <-v4:
+			if !ok {
+				v4 = nil
+				continue
+			}
+			last4 = &u
+		case u, ok := <-v6:
+			if !ok {
+				v6 = nil
+				continue
+			}
+			last6 = &u
+		}
+		if last4 == nil || last6 == nil {
+			continue
+		}
+
+		var addrs []grpcr.Address
+		for _, u := range []*resolver.WatchUpdate{last4, last6} {
+			for _, ip := range u.Records {
+				addrs = append(addrs, grpcr.Address{Addr: net.JoinHostPort(ip, w.port)})
+			}
+		}
+
+		w.update(addrs, last4.Err, last6.Err)
+	}
+}
+
+// services updates the client with the addresses of the SRV targets on
+// every change of the SRV records.
+func (w *watch) services(srv <-chan resolver.WatchUpdate) {
+	for u := range srv {
+		var addrs []grpcr.Address
+		var lookupErr error
+		for _, rec := range u.Records {
+			target, port, ok := parseSRV(rec)
+			if !ok {
+				continue
+			}
+
+			ips, err := w.r.LookupIPAddr(target, resolver.WithContext(w.ctx))
+			if err != nil {
+				lookupErr = err
+				continue
+			}
+			for _, ip := range ips {
+				addrs = append(addrs, grpcr.Address{
+					Addr:       net.JoinHostPort(ip.IP.String(), port),
+					ServerName: strings.TrimSuffix(target, `.`),
+				})
+			}
+		}
+
+		w.update(addrs, u.Err, lookupErr)
+	}
+}
+
+// update hands addrs to the client, or the first of errs when there are
+// none.
+func (w *watch) update(addrs []grpcr.Address, errs ...error) {
+	if w.ctx.Err() != nil {
+		return
+	}
+
+	if len(addrs) == 0 {
+		err := ErrNoAddress
+		for _, e := range errs {
+			if e != nil {
+				err = e
+				break
+			}
+		}
+		w.cc.ReportError(err)
+		return
+	}
+
+	_ = w.cc.UpdateState(grpcr.State{Addresses: addrs})
+}
+
+// splitTarget returns the host and port of a target endpoint.
+func splitTarget(endpoint string) (host, port string, err error) {
+	if endpoint == `` {
+		return ``, ``, ErrNoAddress
+	}
+	if host, port, err = net.SplitHostPort(endpoint); err == nil {
+		if host == `` || port == `` {
+			return ``, ``, ErrNoAddress
+		}
+		return host, port, nil
+	}
+
+	// a bare IPv6 address or a name without a port
+	return strings.Trim(endpoint, `[]`), defaultPort, nil
+}
+
+// parseSRV reads the target and port of an SRV record in the form of
+// Watch, `priority weight port target`.
+func parseSRV(rec string) (target, port string, ok bool) {
+	f := strings.Fields(rec)
+	if len(f) != 4 {
+		return ``, ``, false
+	}
+	if _, err := strconv.ParseUint(f[2], 10, 16); err != nil {
+		return ``, ``, false
+	}
+
+	return f[3], f[2], true
+}
+
+type nopResolver struct{}
+
+func (nopResolver) ResolveNow(grpcr.ResolveNowOptions) {}
+
+func (nopResolver) Close() {}
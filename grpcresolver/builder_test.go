@@ -0,0 +1,173 @@
+package grpcresolver
+
+import (
+	"github.com/zofan/go-resolver"
+	grpcr "google.golang.org/grpc/resolver"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testConn struct {
+	grpcr.ClientConn
+	states chan grpcr.State
+	errs   chan error
+}
+
+func (c *testConn) UpdateState(s grpcr.State) error {
+	c.states <- s
+	return nil
+}
+
+func (c *testConn) ReportError(err error) {
+	c.errs <- err
+}
+
+// serve answers the queries on a local port from zone, by name and type.
+func serve(t *testing.T, zone map[string][]resolver.RR) (addr string, set func(name string, rrs []resolver.RR)) {
+	conn, err := net.ListenPacket(`udp`, `127.0.0.1:0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	var mu sync.Mutex
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			var query resolver.Message
+			if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) != 1 {
+				continue
+			}
+			q := query.Questions[0]
+			resp := &resolver.Message{
+				Header:    resolver.Header{ID: query.ID, Response: true, RecursionAvailable: true},
+				Questions: query.Questions,
+			}
+
+			mu.Lock()
+			rrs, ok := zone[strings.ToLower(strings.TrimSuffix(q.Name, `.`))]
+			mu.Unlock()
+			if !ok {
+				resp.Rcode = resolver.RcodeNameError
+			}
+			for _, rr := range rrs {
+				if rr.Type == q.Type {
+					rr.Name = q.Name
+					resp.Answers = append(resp.Answers, rr)
+				}
+			}
+
+			if b, err := resp.Pack(); err == nil {
+				_, _ = conn.WriteTo(b, from)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String(), func(name string, rrs []resolver.RR) {
+		mu.Lock()
+		zone[name] = rrs
+		mu.Unlock()
+	}
+}
+
+func build(t *testing.T, b *Builder, endpoint string) *testConn {
+	cc := &testConn{states: make(chan grpcr.State, 8), errs: make(chan error, 8)}
+	res, err := b.Build(grpcr.Target{URL: url.URL{Scheme: b.Scheme(), Path: `/` + endpoint}}, cc, grpcr.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(res.Close)
+
+	return cc
+}
+
+// await waits for the client to get the addresses want, the updates on
+// the way there are skipped.
+func await(t *testing.T, cc *testConn, want string) {
+	t.Helper()
+
+	timeout := time.After(time.Second * 5)
+	var got []string
+	for {
+		select {
+		case s := <-cc.states:
+			got = got[:0]
+			for _, a := range s.Addresses {
+				got = append(got, a.Addr)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ` `) == want {
+				return
+			}
+		case err := <-cc.errs:
+			t.Fatal(err)
+		case <-timeout:
+			t.Fatalf(`expected %s, got %v`, want, got)
+		}
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	a := func(ip string) resolver.RR {
+		return resolver.RR{Type: resolver.TypeA, TTL: 0, IP: net.ParseIP(ip)}
+	}
+	dns, set := serve(t, map[string][]resolver.RR{
+		`svc.example.com`: {a(`192.0.2.1`), {Type: resolver.TypeAAAA, IP: net.ParseIP(`2001:db8::1`)}},
+		`_grpc._tcp.svc.example.com`: {
+			{Type: resolver.TypeSRV, Pref: 1, Weight: 1, Port: 50051, Target: `b1.example.com.`},
+			{Type: resolver.TypeSRV, Pref: 1, Weight: 1, Port: 50052, Target: `b2.example.com.`},
+		},
+		`b1.example.com`: {a(`192.0.2.11`)},
+		`b2.example.com`: {a(`192.0.2.12`)},
+	})
+
+	r := resolver.New()
+	if _, err := r.LoadServersFromString(dns); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b := NewBuilder(r, ``, time.Millisecond*50)
+	if b.Scheme() != `dns` {
+		t.Errorf(`expected the dns scheme, got %s`, b.Scheme())
+	}
+
+	cc := build(t, b, `svc.example.com:8080`)
+	await(t, cc, `192.0.2.1:8080 [2001:db8::1]:8080`)
+
+	// the change is seen on the next poll
+	set(`svc.example.com`, []resolver.RR{a(`192.0.2.2`)})
+	await(t, cc, `192.0.2.2:8080`)
+
+	await(t, build(t, b, `_grpc._tcp.svc.example.com`), `192.0.2.11:50051 192.0.2.12:50052`)
+	await(t, build(t, b, `192.0.2.9`), `192.0.2.9:443`)
+}
+
+func TestSplitTarget(t *testing.T) {
+	cases := map[string][2]string{
+		`svc.example.com:50051`: {`svc.example.com`, `50051`},
+		`svc.example.com`:       {`svc.example.com`, `443`},
+		`[2001:db8::1]:80`:      {`2001:db8::1`, `80`},
+		`2001:db8::1`:           {`2001:db8::1`, `443`},
+	}
+	for endpoint, want := range cases {
+		host, port, err := splitTarget(endpoint)
+		if err != nil || host != want[0] || port != want[1] {
+			t.Errorf(`%s: expected %v, got %s %s %v`, endpoint, want, host, port, err)
+		}
+	}
+	for _, endpoint := range []string{``, `:80`, `svc.example.com:`} {
+		if _, _, err := splitTarget(endpoint); err == nil {
+			t.Errorf(`%s: expected an error`, endpoint)
+		}
+	}
+}
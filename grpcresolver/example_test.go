@@ -0,0 +1,22 @@
+package grpcresolver_test
+
+import (
+	"github.com/zofan/go-resolver"
+	"github.com/zofan/go-resolver/grpcresolver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"time"
+)
+
+func Example() {
+	r := resolver.New()
+	_, _ = r.LoadServersFromString(`8.8.8.8`)
+
+	conn, err := grpc.Dial(`dns:///_grpc._tcp.service.example.com`,
+		grpc.WithResolvers(grpcresolver.NewBuilder(r, ``, time.Minute)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+}
@@ -0,0 +1,21 @@
+module github.com/zofan/go-resolver/grpcresolver
+
+go 1.18
+
+require (
+	github.com/zofan/go-resolver v0.0.0-00010101000000-000000000000
+	google.golang.org/grpc v1.56.3
+)
+
+require (
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/zofan/go-slist v0.0.0-20210406203728-48b54876780f // indirect
+	golang.org/x/net v0.21.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
+	google.golang.org/protobuf v1.30.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/zofan/go-resolver => ../
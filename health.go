@@ -0,0 +1,704 @@
+package resolver
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// probationShare limits a probationary server to one of every probationShare
+// picks while healthy servers are available.
+const probationShare = 4
+
+type admission int
+
+const (
+	admitOK admission = iota
+	admitProbation
+	admitSkip
+	admitRecheck
+)
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return `open`
+	case CircuitHalfOpen:
+		return `half-open`
+	default:
+		return `closed`
+	}
+}
+
+// ServerState is where a server stands in rotation.
+type ServerState int
+
+const (
+	ServerHealthy ServerState = iota
+	ServerProbation
+	ServerQuarantined
+	// ServerEvicted servers were caught misbehaving and are not used.
+	ServerEvicted
+)
+
+func (s ServerState) String() string {
+	switch s {
+	case ServerProbation:
+		return `probation`
+	case ServerQuarantined:
+		return `quarantined`
+	case ServerEvicted:
+		return `evicted`
+	default:
+		return `healthy`
+	}
+}
+
+func (s ServerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ServerStat is the record of a server in ServerStats.
+type ServerStat struct {
+	Addr             string
+	State            ServerState
+	Successes        uint64
+	Failures         uint64
+	ConsecutiveFails int
+	LastError        string
+	LastSuccess      time.Time
+	MeanLatency      time.Duration
+	Level            int
+	FailureRatio     float64
+	Circuit          CircuitState
+}
+
+type QuarantinedServer struct {
+	Addr         string
+	Fails        int
+	Level        int
+	FailureRatio float64
+	Since        time.Time
+	Until        time.Time
+}
+
+// FailureWeights sets how many MaxFails units one failure counts for by its
+// kind, a timing out server costs callers more than one failing fast.
+type FailureWeights struct {
+	Timeout       int `json:"timeout" yaml:"timeout"`
+	Refused       int `json:"refused" yaml:"refused"`
+	ServerFailure int `json:"server_failure" yaml:"server_failure"`
+	Other         int `json:"other" yaml:"other"`
+}
+
+func DefaultFailureWeights() FailureWeights {
+	return FailureWeights{
+		Timeout:       3,
+		Refused:       2,
+		ServerFailure: 1,
+		Other:         1,
+	}
+}
+
+func (w FailureWeights) weigh(err error) int {
+	n := w.Other
+	switch {
+	case isTimeout(err):
+		n = w.Timeout
+	case isRefused(err):
+		n = w.Refused
+	case isServerFailure(err):
+		n = w.ServerFailure
+	}
+
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// healthConfig is the part of the Resolver settings the health table
+// needs to judge a server and size its quarantine.
+type healthConfig struct {
+	maxFails  int
+	maxStreak int
+	halfLife  time.Duration
+	goodAfter int
+	probation int
+
+	circuitFails    int
+	circuitCooldown time.Duration
+
+	recheck        time.Duration
+	evictFiltering bool
+
+	ratioWindow time.Duration
+	maxRatio    float64
+	minSamples  int
+
+	base   time.Duration
+	growth float64
+	steps  []float64
+	max    time.Duration
+	decay  time.Duration
+}
+
+// duration returns the quarantine for a server at the given penalty level,
+// level 0 is the first offence: the step of the level, or past the steps
+// the last one grown once per level beyond it.
+func (c healthConfig) duration(level int) time.Duration {
+	d := float64(c.base)
+	if len(c.steps) > 0 {
+		step := level
+		if step >= len(c.steps) {
+			step = len(c.steps) - 1
+		}
+		d *= c.steps[step]
+		level -= step
+	}
+	for i := 0; i < level && (c.max <= 0 || d < float64(c.max)); i++ {
+		d *= c.growth
+	}
+
+	if c.max > 0 && d > float64(c.max) {
+		return c.max
+	}
+	return time.Duration(d)
+}
+
+// overFails adds the failure to the server's failure score and reports
+// whether MaxFails is reached. Without a half-life the score is the plain
+// failure count, with one every failure loses half its weight per half-life
+// so only failures close together in time add up to MaxFails.
+func (c healthConfig) overFails(h *serverHealth, weight int, now time.Time) bool {
+	if c.maxFails <= 0 {
+		return false
+	}
+	if c.halfLife <= 0 {
+		return h.fails >= c.maxFails
+	}
+
+	if !h.scoreAt.IsZero() {
+		h.score *= math.Exp2(-float64(now.Sub(h.scoreAt)) / float64(c.halfLife))
+	}
+	h.score += float64(weight)
+	h.scoreAt = now
+
+	return h.score >= float64(c.maxFails)
+}
+
+// overRatio reports whether the failure ratio over the rolling window went
+// above the allowed error budget, servers with fewer than minSamples queries
+// in the window are never judged by their ratio.
+func (c healthConfig) overRatio(h *serverHealth) bool {
+	if c.maxRatio <= 0 || c.ratioWindow <= 0 {
+		return false
+	}
+
+	ratio, samples := h.window.ratio()
+	return samples >= c.minSamples && ratio > c.maxRatio
+}
+
+// admitCircuit keeps servers with an open circuit out of rotation until the
+// cooldown is over, then lets a single half-open probe through. A probe that
+// never reports back is replaced by a new one after another cooldown.
+func (c healthConfig) admitCircuit(h *serverHealth, now time.Time) bool {
+	switch h.circuit {
+	case CircuitOpen, CircuitHalfOpen:
+		if now.Sub(h.circuitAt) < c.circuitCooldown {
+			return false
+		}
+
+		h.circuit = CircuitHalfOpen
+		h.circuitAt = now
+	}
+
+	return true
+}
+
+// failCircuit opens the circuit after circuitFails consecutive failures, a
+// failed half-open probe opens it again for a full cooldown.
+func (c healthConfig) failCircuit(h *serverHealth, now time.Time) {
+	if c.circuitFails <= 0 {
+		return
+	}
+
+	h.circuitFails++
+	if h.circuit == CircuitHalfOpen || h.circuitFails >= c.circuitFails {
+		h.circuit = CircuitOpen
+		h.circuitAt = now
+	}
+}
+
+// serverHealth is the per-server accounting kept beside the slist entry,
+// keyed by the server address.
+type serverHealth struct {
+	fails   int
+	streak  int
+	goodRun int
+	score   float64
+	scoreAt time.Time
+
+	quarantined bool
+	since       time.Time
+	until       time.Time
+	level       int
+
+	probation int
+	offers    int
+
+	window ratioWindow
+
+	circuit      CircuitState
+	circuitFails int
+	circuitAt    time.Time
+
+	noRecursion bool
+	hijack      bool
+	filtering   bool
+	lying       bool
+	removed     bool
+	probedAt    time.Time
+	probing     bool
+
+	successes   uint64
+	failures    uint64
+	consecutive int
+	lastErr     string
+	lastSuccess time.Time
+	latency     time.Duration
+}
+
+const ratioBuckets = 6
+
+// ratioWindow counts outcomes over a rolling window split in ratioBuckets
+// buckets, the oldest bucket is dropped as the window moves on.
+type ratioWindow struct {
+	epoch int64
+	ok    [ratioBuckets]int
+	bad   [ratioBuckets]int
+}
+
+func (w *ratioWindow) add(now time.Time, window time.Duration, failed bool) {
+	epoch, ok := w.advance(now, window)
+	if !ok {
+		return
+	}
+
+	if failed {
+		w.bad[epoch%ratioBuckets]++
+	} else {
+		w.ok[epoch%ratioBuckets]++
+	}
+}
+
+// advance moves the window on to now, dropping the buckets that fell out.
+func (w *ratioWindow) advance(now time.Time, window time.Duration) (epoch int64, ok bool) {
+	width := int64(window / ratioBuckets)
+	if width <= 0 {
+		return 0, false
+	}
+
+	epoch = now.UnixNano() / width
+	if epoch-w.epoch >= ratioBuckets {
+		*w = ratioWindow{}
+	} else {
+		for e := w.epoch + 1; e <= epoch; e++ {
+			w.ok[e%ratioBuckets], w.bad[e%ratioBuckets] = 0, 0
+		}
+	}
+	w.epoch = epoch
+
+	return epoch, true
+}
+
+func (w *ratioWindow) ratio() (ratio float64, samples int) {
+	ok, bad := 0, 0
+	for i := 0; i < ratioBuckets; i++ {
+		ok += w.ok[i]
+		bad += w.bad[i]
+	}
+
+	if ok+bad == 0 {
+		return 0, 0
+	}
+	return float64(bad) / float64(ok+bad), ok + bad
+}
+
+type healthTable struct {
+	servers map[string]*serverHealth
+	mu      sync.Mutex
+}
+
+func newHealthTable() *healthTable {
+	return &healthTable{servers: make(map[string]*serverHealth)}
+}
+
+func (t *healthTable) get(addr string) *serverHealth {
+	h, ok := t.servers[addr]
+	if !ok {
+		h = &serverHealth{}
+		t.servers[addr] = h
+	}
+	return h
+}
+
+// admit decides whether the server may take the next query, releasing it
+// from quarantine onto probation once its quarantine is over.
+// A server that failed recently and has not yet had goodAfter successes in
+// a row is deprioritized the same way as a probationary one.
+func (t *healthTable) admit(addr string, c healthConfig, now time.Time) admission {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.servers[addr]
+	if !ok {
+		return admitOK
+	}
+
+	if a := h.evicted(c, now); a != admitOK {
+		return a
+	}
+
+	if h.quarantined {
+		if now.Before(h.until) {
+			return admitSkip
+		}
+
+		h.quarantined = false
+		h.fails = 0
+		h.streak = 0
+		h.score = 0
+		h.window = ratioWindow{}
+		h.goodRun = 0
+		h.probation = c.probation
+		h.offers = 0
+	}
+
+	if !c.admitCircuit(h, now) {
+		return admitSkip
+	}
+
+	if h.probation > 0 || (c.goodAfter > 1 && h.streak > 0) {
+		if h.offers++; h.offers%probationShare != 0 {
+			return admitProbation
+		}
+	}
+
+	return admitOK
+}
+
+// evicted checks the flags taking a server out of rotation whatever the
+// health policy, a server due for a re-check is let through once to it.
+func (h *serverHealth) evicted(c healthConfig, now time.Time) admission {
+	if h.lying || h.removed || h.filtering && c.evictFiltering {
+		return admitSkip
+	}
+
+	if h.noRecursion || h.hijack {
+		if c.recheck > 0 && !h.probing && now.Sub(h.probedAt) >= c.recheck {
+			h.probing = true
+			return admitRecheck
+		}
+		return admitSkip
+	}
+
+	return admitOK
+}
+
+// evicted is admit for the servers of a custom health policy, only the
+// eviction flags are looked at.
+func (t *healthTable) evicted(addr string, c healthConfig, now time.Time) admission {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.servers[addr]
+	if !ok {
+		return admitOK
+	}
+
+	return h.evicted(c, now)
+}
+
+// success records a successful attempt and reports whether it took the
+// server off probation.
+func (t *healthTable) success(addr string, c healthConfig, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := t.get(addr)
+	h.window.add(now, c.ratioWindow, false)
+	if h.goodRun++; h.goodRun >= c.goodAfter {
+		h.streak = 0
+	}
+
+	h.circuit = CircuitClosed
+	h.circuitFails = 0
+	if h.probation > 0 {
+		h.probation--
+		return h.probation == 0
+	}
+
+	return false
+}
+
+// failure records a failed attempt weighing weight towards maxFails and
+// reports whether the server was quarantined by it, a failure while on
+// probation quarantines immediately.
+// Every quarantine raises the penalty level of the server, the level goes
+// back down by one for each decay period it stays out of quarantine.
+func (t *healthTable) failure(addr string, weight int, c healthConfig, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := t.get(addr)
+	if h.quarantined {
+		return false
+	}
+
+	c.failCircuit(h, now)
+
+	h.fails += weight
+	h.streak++
+	h.goodRun = 0
+	h.window.add(now, c.ratioWindow, true)
+
+	if h.probation == 0 && !c.overFails(h, weight, now) && !c.overRatio(h) && h.streak < c.maxStreak {
+		return false
+	}
+
+	h.level = h.levelAt(c.decay, now)
+	h.quarantined = true
+	h.score = 0
+	h.probation = 0
+	h.since = now
+	h.until = now.Add(c.duration(h.level))
+	h.level++
+
+	return true
+}
+
+// levelAt is the penalty level of h at now, down by one for every decay
+// period since its last quarantine ended.
+func (h *serverHealth) levelAt(decay time.Duration, now time.Time) int {
+	if h.level == 0 || decay <= 0 || h.quarantined || !now.After(h.until) {
+		return h.level
+	}
+	if level := h.level - int(now.Sub(h.until)/decay); level > 0 {
+		return level
+	}
+
+	return 0
+}
+
+func (t *healthTable) quarantined() []QuarantinedServer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var list []QuarantinedServer
+	for addr, h := range t.servers {
+		if h.quarantined {
+			ratio, _ := h.window.ratio()
+			list = append(list, QuarantinedServer{
+				Addr:         addr,
+				Fails:        h.fails,
+				Level:        h.level,
+				FailureRatio: ratio,
+				Since:        h.since,
+				Until:        h.until,
+			})
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Since.Before(list[j].Since)
+	})
+
+	return list
+}
+
+// healthy counts the servers of addrs that are neither quarantined nor
+// caught misbehaving.
+func (t *healthTable) healthy(addrs []string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := 0
+	for _, addr := range addrs {
+		h := t.servers[addr]
+		if h == nil || !(h.quarantined || h.lying || h.removed || h.noRecursion || h.hijack) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// record counts the outcome of an attempt for ServerStats, whatever the
+// health policy.
+func (t *healthTable) record(addr string, err error, latency time.Duration, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := t.get(addr)
+	if err != nil {
+		h.failures++
+		h.consecutive++
+		h.lastErr = err.Error()
+		return
+	}
+
+	h.successes++
+	h.consecutive = 0
+	h.lastSuccess = now
+	h.latency += latency
+}
+
+// stats returns the records of addrs, all taken under one lock, with the
+// penalty levels decayed at now.
+func (t *healthTable) stats(addrs []string, decay time.Duration, now time.Time) []ServerStat {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	list := make([]ServerStat, 0, len(addrs))
+	for _, addr := range addrs {
+		stat := ServerStat{Addr: addr}
+		if h := t.servers[addr]; h != nil {
+			stat.Successes = h.successes
+			stat.Failures = h.failures
+			stat.ConsecutiveFails = h.consecutive
+			stat.LastError = h.lastErr
+			stat.LastSuccess = h.lastSuccess
+			stat.Level = h.levelAt(decay, now)
+			stat.FailureRatio, _ = h.window.ratio()
+			stat.Circuit = h.circuit
+			if h.successes > 0 {
+				stat.MeanLatency = h.latency / time.Duration(h.successes)
+			}
+
+			switch {
+			case h.lying || h.removed || h.noRecursion || h.hijack:
+				stat.State = ServerEvicted
+			case h.quarantined:
+				stat.State = ServerQuarantined
+			case h.probation > 0:
+				stat.State = ServerProbation
+			}
+		}
+		list = append(list, stat)
+	}
+
+	return list
+}
+
+// ServerStats returns the record of every server of the list, in list
+// order. MeanLatency is over the successful attempts.
+func (r *Resolver) ServerStats() []ServerStat {
+	servers := r.Servers.All()
+	addrs := make([]string, len(servers))
+	for i, srv := range servers {
+		addrs[i] = srv.Addr
+	}
+
+	return r.health.stats(addrs, r.settings().QuarantineDecay, time.Now())
+}
+
+// QuarantinedServers returns the servers currently parked for failures,
+// oldest first. They rejoin rotation on probation once Until has passed.
+func (r *Resolver) QuarantinedServers() []QuarantinedServer {
+	return r.health.quarantined()
+}
+
+// setProbe stores the outcome of a server probe, nil when the probe could
+// not reach the server.
+func (t *healthTable) setProbe(addr string, res *probeResult, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := t.get(addr)
+	h.probing = false
+	if res != nil {
+		h.noRecursion = !res.recursive
+		h.hijack = res.hijack != nil
+		h.probedAt = now
+	}
+}
+
+// setFiltering flags the server as answering blocked names with blocking
+// addresses.
+func (t *healthTable) setFiltering(addr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.get(addr).filtering = true
+}
+
+// setLying takes the server out of rotation for disagreeing with the others.
+func (t *healthTable) setLying(addr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.get(addr).lying = true
+}
+
+// setRemoved takes the server out of rotation, or puts it back, and reports
+// whether that changed anything.
+func (t *healthTable) setRemoved(addr string, removed bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := t.get(addr)
+	changed := h.removed != removed
+	h.removed = removed
+
+	return changed
+}
+
+// forget drops everything known about the servers addrs.
+func (t *healthTable) forget(addrs []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, addr := range addrs {
+		delete(t.servers, addr)
+	}
+}
+
+func (t *healthTable) filtering() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var list []string
+	for addr, h := range t.servers {
+		if h.filtering {
+			list = append(list, addr)
+		}
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+func (t *healthTable) circuitState(addr string) CircuitState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if h, ok := t.servers[addr]; ok {
+		return h.circuit
+	}
+	return CircuitClosed
+}
+
+// CircuitState returns the circuit breaker state of the server.
+func (r *Resolver) CircuitState(addr string) CircuitState {
+	return r.health.circuitState(addr)
+}
@@ -0,0 +1,534 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/zofan/go-slist"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+var errTestRefused = &net.DNSError{Err: `connection refused`}
+
+// expired quarantines on the first failure for a period that is already over.
+var expired = healthConfig{maxFails: 1, maxStreak: DefaultBanThreshold, base: -time.Second}
+
+func TestQuarantine(t *testing.T) {
+	r := New()
+	r.RetryLimit = 1
+	r.MaxFails = 2
+	r.QuarantineDuration = time.Hour
+	r.FailureWeights.Refused = 1
+
+	_, err := r.LoadServersFromString("127.0.0.1\n127.0.0.2")
+	if err != nil {
+		t.Error(err)
+	}
+
+	fail := func(*net.Resolver) error { return errTestRefused }
+	for i := 0; i < 4; i++ {
+		if err := r.lookup(`A`, `example.com`, fail); !errors.Is(err, ErrRetryLimit) {
+			t.Error(err)
+		}
+	}
+
+	list := r.QuarantinedServers()
+	if len(list) != 2 {
+		t.Fatalf(`expected 2 quarantined servers, got %d`, len(list))
+	}
+	if list[0].Fails != 2 || !list[0].Until.After(list[0].Since) {
+		t.Errorf(`unexpected quarantine entry %+v`, list[0])
+	}
+
+	if err := r.lookup(`A`, `example.com`, fail); !errors.Is(err, slist.ErrServerListEmpty) {
+		t.Error(err)
+	}
+}
+
+func TestQuarantineRelease(t *testing.T) {
+	r := New()
+	r.RetryLimit = 1
+	r.MaxFails = 1
+	r.ProbationSuccesses = 2
+
+	_, err := r.LoadServersFromString("127.0.0.1\n127.0.0.2")
+	if err != nil {
+		t.Error(err)
+	}
+
+	// park 127.0.0.1 and make its quarantine already expired
+	now := time.Now()
+	r.health.failure(`127.0.0.1`, 1, expired, now)
+
+	picks := map[string]int{}
+	pick := func(n int) {
+		for i := 0; i < n; i++ {
+			_ = r.lookup(`A`, `example.com`, func(res *net.Resolver) error {
+				picks[dialedServer(t, res)]++
+				return nil
+			})
+		}
+	}
+
+	pick(8)
+	if len(r.QuarantinedServers()) != 0 {
+		t.Error(`expected the server to be released`)
+	}
+	if n := picks[`127.0.0.1:53`]; n == 0 || n > 2 {
+		t.Errorf(`probationary server expected limited traffic, got %d of 8`, n)
+	}
+
+	pick(40)
+	if n := picks[`127.0.0.1:53`]; n < 15 {
+		t.Errorf(`server expected full traffic after probation, got %d of 48`, n)
+	}
+}
+
+func TestProbationFailure(t *testing.T) {
+	r := New()
+	r.RetryLimit = 1
+	r.ProbationSuccesses = 1
+
+	_, err := r.LoadServersFromString("127.0.0.1")
+	if err != nil {
+		t.Error(err)
+	}
+
+	r.health.failure(`127.0.0.1`, 1, expired, time.Now())
+
+	err = r.lookup(`A`, `example.com`, func(*net.Resolver) error { return errTestRefused })
+	if !errors.Is(err, ErrRetryLimit) {
+		t.Error(err)
+	}
+	if len(r.QuarantinedServers()) != 1 {
+		t.Error(`a failure on probation should quarantine again`)
+	}
+}
+
+func TestRouteExhausted(t *testing.T) {
+	r := New()
+	r.RetryLimit = 0
+	r.RetrySleep = 0
+	r.MaxFails = 1
+
+	_, err := r.LoadServersFromString("127.0.0.1")
+	if err != nil {
+		t.Error(err)
+	}
+	if err := r.AddRoute(`corp.example`, []string{`127.0.0.2`}); err != nil {
+		t.Error(err)
+	}
+
+	err = r.lookup(`A`, `www.corp.example`, func(*net.Resolver) error { return errTestRefused })
+	if !errors.Is(err, ErrRouteExhausted) {
+		t.Error(err)
+	}
+}
+
+func TestQuarantineEscalation(t *testing.T) {
+	c := healthConfig{
+		maxFails:  1,
+		maxStreak: DefaultBanThreshold,
+		base:      time.Minute,
+		growth:    5,
+		steps:     DefaultQuarantineSteps,
+		max:       time.Minute * 30,
+		decay:     time.Hour,
+	}
+	table := newHealthTable()
+	now := time.Now()
+
+	for _, want := range []time.Duration{time.Minute, time.Minute * 5, time.Minute * 30, time.Minute * 30, time.Minute * 30} {
+		if !table.failure(`127.0.0.1`, 1, c, now) {
+			t.Fatal(`expected quarantine`)
+		}
+
+		h := table.servers[`127.0.0.1`]
+		if got := h.until.Sub(now); got != want {
+			t.Errorf(`level %d: expected %s quarantine, got %s`, h.level, want, got)
+		}
+
+		now = h.until
+		table.admit(`127.0.0.1`, c, now)
+	}
+
+	// four quiet hours bring a level 5 offender down to level 1, reported
+	// before its next quarantine
+	now = now.Add(time.Hour * 4)
+	if got := table.stats([]string{`127.0.0.1`}, c.decay, now)[0].Level; got != 1 {
+		t.Errorf(`expected decayed penalty level 1, got %d`, got)
+	}
+	table.failure(`127.0.0.1`, 1, c, now)
+	if got := table.servers[`127.0.0.1`].until.Sub(now); got != time.Minute*5 {
+		t.Errorf(`expected decayed 5m quarantine, got %s`, got)
+	}
+	if got := table.quarantined()[0].Level; got != 2 {
+		t.Errorf(`expected penalty level 2, got %d`, got)
+	}
+
+	// without steps every quarantine grows from the one before
+	c.steps = nil
+	for level, want := range []time.Duration{time.Minute, time.Minute * 5, time.Minute * 25, time.Minute * 30} {
+		if got := c.duration(level); got != want {
+			t.Errorf(`level %d without steps: expected %s, got %s`, level, want, got)
+		}
+	}
+}
+
+func TestFailureDecay(t *testing.T) {
+	c := healthConfig{
+		maxFails:  5,
+		maxStreak: 100,
+		halfLife:  time.Minute,
+		base:      time.Minute,
+	}
+
+	sparse := newHealthTable()
+	now := time.Now()
+	for i := 0; i < 6; i++ {
+		if sparse.failure(`127.0.0.1`, 1, c, now) {
+			t.Fatalf(`sparse failure %d evicted the server`, i+1)
+		}
+		now = now.Add(time.Hour)
+	}
+
+	burst := newHealthTable()
+	evicted := false
+	for i := 0; i < 6; i++ {
+		evicted = burst.failure(`127.0.0.1`, 1, c, now)
+		now = now.Add(time.Second)
+	}
+	if !evicted {
+		t.Error(`a burst of failures expected to evict the server`)
+	}
+
+	c.halfLife = 0
+	lifetime := newHealthTable()
+	for i := 0; i < 5; i++ {
+		evicted = lifetime.failure(`127.0.0.1`, 1, c, now)
+		now = now.Add(time.Hour)
+	}
+	if !evicted {
+		t.Error(`without a half-life MaxFails expected to count lifetime failures`)
+	}
+}
+
+func TestFailureRatio(t *testing.T) {
+	c := healthConfig{
+		maxFails:    1000,
+		maxStreak:   100,
+		ratioWindow: time.Minute,
+		maxRatio:    0.2,
+		minSamples:  20,
+		base:        time.Minute,
+	}
+	now := time.Now()
+
+	// 3 failures out of 4 queries is too few samples to judge
+	low := newHealthTable()
+	low.success(`127.0.0.1`, c, now)
+	for i := 0; i < 3; i++ {
+		if low.failure(`127.0.0.1`, 1, c, now) {
+			t.Fatal(`low-traffic server evicted by ratio`)
+		}
+	}
+
+	busy := newHealthTable()
+	for i := 0; i < 80; i++ {
+		busy.success(`127.0.0.1`, c, now)
+	}
+	evicted := 0
+	for i := 0; i < 30; i++ {
+		if busy.failure(`127.0.0.1`, 1, c, now) {
+			evicted = i + 1
+			break
+		}
+	}
+	if evicted != 21 {
+		t.Errorf(`expected eviction at the 21st failure (>20%%), got %d`, evicted)
+	}
+	if got := busy.quarantined()[0].FailureRatio; got <= 0.2 {
+		t.Errorf(`expected reported ratio above 0.2, got %f`, got)
+	}
+
+	// outcomes older than the window no longer count
+	old := newHealthTable()
+	for i := 0; i < 15; i++ {
+		old.failure(`127.0.0.1`, 1, c, now)
+		old.success(`127.0.0.1`, c, now)
+	}
+	later := now.Add(time.Minute * 2)
+	for i := 0; i < 20; i++ {
+		old.success(`127.0.0.1`, c, later)
+	}
+	if old.failure(`127.0.0.1`, 1, c, later) {
+		t.Error(`failures outside the window should not count`)
+	}
+}
+
+func TestGoodAfter(t *testing.T) {
+	c := healthConfig{maxStreak: 3, goodAfter: 1, base: time.Minute}
+	now := time.Now()
+
+	flap := func(table *healthTable) bool {
+		for i := 0; i < 5; i++ {
+			if table.failure(`127.0.0.1`, 1, c, now) {
+				return true
+			}
+			table.success(`127.0.0.1`, c, now)
+		}
+		return false
+	}
+
+	if flap(newHealthTable()) {
+		t.Error(`with GoodAfter = 1 every success should clear the streak`)
+	}
+
+	c.goodAfter = 3
+	if !flap(newHealthTable()) {
+		t.Error(`with GoodAfter = 3 single successes should not clear the streak`)
+	}
+
+	table := newHealthTable()
+	table.failure(`127.0.0.1`, 1, c, now)
+	table.success(`127.0.0.1`, c, now)
+	table.success(`127.0.0.1`, c, now)
+	if table.admit(`127.0.0.1`, c, now) == admitOK && table.admit(`127.0.0.1`, c, now) == admitOK {
+		t.Error(`recovering server expected to be deprioritized`)
+	}
+	table.success(`127.0.0.1`, c, now)
+	if table.admit(`127.0.0.1`, c, now) != admitOK {
+		t.Error(`server expected to be healthy after 3 successes in a row`)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	r := New()
+	r.RetryLimit = 1
+	r.CircuitThreshold = 2
+	r.CircuitCooldown = time.Hour
+	r.banThreshold = 10
+
+	_, err := r.LoadServersFromString("127.0.0.1\n127.0.0.2")
+	if err != nil {
+		t.Error(err)
+	}
+
+	picks := map[string]int{}
+	run := func(n int, fail string) {
+		for i := 0; i < n; i++ {
+			_ = r.lookup(`A`, `example.com`, func(res *net.Resolver) error {
+				addr := dialedServer(t, res)
+				picks[addr]++
+				if addr == fail {
+					return errTestRefused
+				}
+				return nil
+			})
+		}
+	}
+
+	run(4, `127.0.0.1:53`)
+	if got := r.CircuitState(`127.0.0.1`); got != CircuitOpen {
+		t.Fatalf(`expected open circuit, got %s`, got)
+	}
+	if len(r.QuarantinedServers()) != 0 {
+		t.Error(`an open circuit should not quarantine the server`)
+	}
+
+	picks = map[string]int{}
+	run(10, ``)
+	if picks[`127.0.0.1:53`] != 0 {
+		t.Error(`open circuit server should be skipped`)
+	}
+
+	// end the cooldown: exactly one probe goes through and closes the circuit
+	r.health.servers[`127.0.0.1`].circuitAt = time.Now().Add(-time.Hour)
+	picks = map[string]int{}
+	run(1, `127.0.0.1:53`)
+	run(1, `127.0.0.1:53`)
+	if picks[`127.0.0.1:53`] != 1 {
+		t.Errorf(`expected a single half-open probe, got %d`, picks[`127.0.0.1:53`])
+	}
+	if got := r.CircuitState(`127.0.0.1`); got != CircuitOpen {
+		t.Errorf(`failed probe should reopen the circuit, got %s`, got)
+	}
+
+	r.health.servers[`127.0.0.1`].circuitAt = time.Now().Add(-time.Hour)
+	run(2, ``)
+	if got := r.CircuitState(`127.0.0.1`); got != CircuitClosed {
+		t.Errorf(`successful probe should close the circuit, got %s`, got)
+	}
+}
+
+func TestCallerErrorsNotCounted(t *testing.T) {
+	tests := map[string]error{
+		`canceled`:     context.Canceled,
+		`deadline`:     fmt.Errorf(`query: %w`, context.DeadlineExceeded),
+		`bad address`:  &net.DNSError{Err: `unrecognized address`, Name: `300.1.1.1`},
+		`unreachable`:  &net.OpError{Op: `dial`, Net: `udp`, Err: os.NewSyscallError(`connect`, syscall.ENETUNREACH)},
+		`stdlib local`: &net.DNSError{Err: `dial udp 10.0.0.1:53: connect: ` + syscall.EACCES.Error(), Server: `10.0.0.1:53`},
+	}
+
+	for name, cause := range tests {
+		r := New()
+		r.RetryLimit = 5
+		r.RetrySleep = 0
+		r.MaxFails = 1
+		_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2")
+
+		calls := 0
+		err := r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+			calls++
+			return cause
+		})
+		if !errors.Is(err, cause) {
+			t.Errorf(`%s: unexpected error %v`, name, err)
+		}
+		if calls > 2 {
+			t.Errorf(`%s: %d attempts, expected at most one per server`, name, calls)
+		}
+
+		r.health.mu.Lock()
+		for addr, h := range r.health.servers {
+			if h.fails != 0 || h.streak != 0 || h.quarantined {
+				t.Errorf(`%s: failure counted against %s`, name, addr)
+			}
+		}
+		r.health.mu.Unlock()
+	}
+}
+
+func TestFailureWeights(t *testing.T) {
+	w := DefaultFailureWeights()
+
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{&net.DNSError{Err: `i/o timeout`, IsTimeout: true}, 3},
+		{context.DeadlineExceeded, 3},
+		{&net.OpError{Op: `read`, Net: `udp`, Err: os.NewSyscallError(`recvfrom`, syscall.ECONNREFUSED)}, 2},
+		{&net.DNSError{Err: `read udp 10.0.0.1:53: ` + syscall.ECONNREFUSED.Error()}, 2},
+		{&net.DNSError{Err: `server misbehaving`, IsTemporary: true}, 1},
+		{&ResponseError{Code: RcodeServerFailure}, 1},
+		{errors.New(`unexpected`), 1},
+	}
+
+	for _, tt := range tests {
+		if got := w.weigh(tt.err); got != tt.want {
+			t.Errorf(`%v: weight %d, want %d`, tt.err, got, tt.want)
+		}
+	}
+
+	if got := (FailureWeights{}).weigh(errors.New(`unexpected`)); got != 1 {
+		t.Errorf(`zero weights should count one, got %d`, got)
+	}
+}
+
+func TestTimeoutDemotesFaster(t *testing.T) {
+	r := New()
+	r.RetryLimit = 1
+	r.MaxFails = 6
+	r.banThreshold = 10
+	r.QuarantineDuration = time.Hour
+	_, _ = r.LoadServersFromString("10.0.0.1")
+
+	timeout := func(*net.Resolver) error { return &net.DNSError{Err: `i/o timeout`, IsTimeout: true} }
+	for i := 0; i < 2; i++ {
+		_ = r.lookup(`A`, `example.com`, timeout)
+	}
+
+	list := r.QuarantinedServers()
+	if len(list) != 1 || list[0].Fails != 6 {
+		t.Errorf(`expected quarantine after two timeouts, got %+v`, list)
+	}
+}
+
+func TestServerStats(t *testing.T) {
+	r := New()
+	r.RetryLimit = 5
+	r.RetrySleep = 0
+	r.MaxFails = 100
+	r.banThreshold = 100
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2")
+
+	calls := 0
+	_ = r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		if calls++; calls < 3 {
+			return errors.New(`connection refused`)
+		}
+		return nil
+	})
+
+	stats := r.ServerStats()
+	if len(stats) != 2 {
+		t.Fatalf(`expected both servers, got %+v`, stats)
+	}
+
+	var successes, failures uint64
+	for _, s := range stats {
+		successes += s.Successes
+		failures += s.Failures
+		if s.State != ServerHealthy {
+			t.Errorf(`%s: unexpected state %s`, s.Addr, s.State)
+		}
+		if s.Failures > 0 && s.LastError != `connection refused` {
+			t.Errorf(`%s: unexpected last error %q`, s.Addr, s.LastError)
+		}
+		if s.Successes > 0 && (s.LastSuccess.IsZero() || s.ConsecutiveFails != 0) {
+			t.Errorf(`%s: unexpected success record %+v`, s.Addr, s)
+		}
+	}
+	if successes != 1 || failures != 2 {
+		t.Errorf(`expected 1 success and 2 failures, got %d and %d`, successes, failures)
+	}
+
+	r.health.setLying(stats[0].Addr)
+	if s := r.ServerStats(); s[0].State != ServerEvicted {
+		t.Errorf(`expected an evicted server, got %s`, s[0].State)
+	}
+}
+
+func TestServerStatsGrades(t *testing.T) {
+	r := New()
+	r.RetryLimit = 0
+	r.RetrySleep = 0
+	r.CircuitThreshold = 2
+	_, _ = r.LoadServersFromString("10.0.0.1")
+
+	_ = r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		return errors.New(`connection refused`)
+	})
+
+	stat := r.ServerStats()[0]
+	if stat.Circuit != r.CircuitState(stat.Addr) || stat.Circuit == CircuitClosed {
+		t.Errorf(`expected the open circuit in the stats, got %s`, stat.Circuit)
+	}
+	if stat.State != ServerHealthy || stat.Level != 0 {
+		t.Errorf(`circuit alone should not quarantine, got %+v`, stat)
+	}
+
+	r.CircuitThreshold = 0
+	r.health = newHealthTable()
+	_ = r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		return errors.New(`connection refused`)
+	})
+
+	stat = r.ServerStats()[0]
+	if stat.State != ServerQuarantined || stat.Level != 1 {
+		t.Errorf(`expected a quarantined server, got %+v`, stat)
+	}
+	if stat.FailureRatio != 1 {
+		t.Errorf(`expected a failure ratio of 1, got %v`, stat.FailureRatio)
+	}
+
+	q := r.QuarantinedServers()
+	if len(q) != 1 || q[0].Level != stat.Level || q[0].FailureRatio != stat.FailureRatio {
+		t.Errorf(`stats %+v disagree with the quarantine %+v`, stat, q)
+	}
+}
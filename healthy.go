@@ -0,0 +1,58 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+var ErrUnhealthy = errors.New(`resolver: unhealthy`)
+
+// DefaultHealthyFreshness is how recent a successful lookup has to be for
+// Healthy to trust it.
+const DefaultHealthyFreshness = time.Second * 30
+
+// Healthy tells whether the resolver can currently resolve names, for
+// readiness checks. It needs a healthy server and a successful lookup
+// within HealthyFreshness, without one it asks a healthy server for
+// ProbeName once. The probe is not counted in the server accounting. The
+// error matching ErrUnhealthy says what is wrong.
+func (r *Resolver) Healthy(ctx context.Context) error {
+	s := r.settings()
+
+	var healthy []string
+	for _, srv := range r.Servers.All() {
+		if r.health.healthy([]string{srv.Addr}) == 1 {
+			healthy = append(healthy, srv.Addr)
+		}
+	}
+	if len(healthy) == 0 {
+		return fmt.Errorf(`%w: no healthy server out of %d`, ErrUnhealthy, r.Servers.Count())
+	}
+
+	freshness := s.HealthyFreshness
+	if freshness <= 0 {
+		freshness = DefaultHealthyFreshness
+	}
+	if last := atomic.LoadInt64(&r.stats.lastSuccess); last > 0 && time.Since(time.Unix(0, last)) <= freshness {
+		return nil
+	}
+
+	name := s.ProbeName
+	if name == `` {
+		name = DefaultProbeName
+	}
+
+	resp, err := r.exchange(ctx, healthy[0], newQuery(name, TypeA))
+	if err != nil {
+		return fmt.Errorf(`%w: no lookup succeeded for %s and probing %s failed: %v`, ErrUnhealthy, freshness, healthy[0], err)
+	}
+	if resp.Rcode != RcodeSuccess {
+		return fmt.Errorf(`%w: no lookup succeeded for %s and %s answered the probe with %s`, ErrUnhealthy, freshness, healthy[0], RcodeName(resp.Rcode))
+	}
+
+	atomic.StoreInt64(&r.stats.lastSuccess, time.Now().UnixNano())
+	return nil
+}
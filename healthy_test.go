@@ -0,0 +1,47 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestHealthy(t *testing.T) {
+	r := New()
+	if err := r.Healthy(context.Background()); !errors.Is(err, ErrUnhealthy) {
+		t.Errorf(`expected ErrUnhealthy without servers, got %v`, err)
+	}
+
+	server := newTestServer(t, answerA(map[string]string{DefaultProbeName: `192.0.2.1`}))
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	if err := r.Healthy(context.Background()); err != nil {
+		t.Errorf(`unexpected error %v`, err)
+	}
+	if err := r.Healthy(context.Background()); err != nil {
+		t.Errorf(`unexpected error %v`, err)
+	}
+	if n := len(server.Queries()); n != 1 {
+		t.Errorf(`expected the second check to trust the first probe, got %d queries`, n)
+	}
+}
+
+func TestHealthyProbeFails(t *testing.T) {
+	server := newTestServer(t, func(q Question, resp *Message) {
+		resp.Rcode = RcodeServerFailure
+	})
+
+	r := New()
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	err := r.Healthy(context.Background())
+	if !errors.Is(err, ErrUnhealthy) {
+		t.Errorf(`expected ErrUnhealthy, got %v`, err)
+	}
+
+	for _, s := range r.ServerStats() {
+		if s.Failures != 0 || s.State != ServerHealthy {
+			t.Errorf(`probe counted against %+v`, s)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package resolver
+
+import (
+	"log"
+	"time"
+)
+
+// LookupInfo describes a lookup to the hooks. Attempt is the number of the
+// attempt being made, for OnLookupDone the number of attempts made, and
+// Server the server of that attempt.
+type LookupInfo struct {
+	Host    string
+	Type    string
+	Attempt int
+	Server  string
+}
+
+// hasHooks reports whether any lookup hook is set, lookups skip all the
+// bookkeeping for them otherwise.
+func (s *Settings) hasHooks() bool {
+	return s.OnLookupStart != nil || s.OnAttempt != nil || s.OnLookupDone != nil
+}
+
+// callHook runs a hook and reports a panic in it instead of letting it
+// take the lookup down.
+func callHook(s *Settings, name string, hook func()) {
+	defer func() {
+		if v := recover(); v != nil {
+			if s.OnHookPanic != nil {
+				s.OnHookPanic(name, v)
+				return
+			}
+			log.Printf(`resolver: panic in %s hook: %v`, name, v)
+		}
+	}()
+
+	hook()
+}
+
+func (r *Resolver) hookStart(s *Settings, info *LookupInfo) {
+	if s.OnLookupStart != nil {
+		callHook(s, `OnLookupStart`, func() { s.OnLookupStart(*info) })
+	}
+}
+
+func (r *Resolver) hookAttempt(s *Settings, info *LookupInfo) {
+	if s.OnAttempt != nil {
+		callHook(s, `OnAttempt`, func() { s.OnAttempt(*info, info.Server) })
+	}
+}
+
+func (r *Resolver) hookDone(s *Settings, info *LookupInfo, err error, d time.Duration) {
+	if s.OnLookupDone != nil {
+		callHook(s, `OnLookupDone`, func() { s.OnLookupDone(*info, err, d) })
+	}
+}
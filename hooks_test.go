@@ -0,0 +1,76 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLookupHooks(t *testing.T) {
+	r := New()
+	r.RetryLimit = 5
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2\n10.0.0.3")
+
+	var events []string
+	var done LookupInfo
+	r.OnLookupStart = func(info LookupInfo) {
+		events = append(events, `start `+info.Host)
+	}
+	r.OnAttempt = func(info LookupInfo, server string) {
+		events = append(events, `attempt `+server)
+		if info.Attempt != len(events)-1 {
+			t.Errorf(`attempt %d reported as %d`, len(events)-1, info.Attempt)
+		}
+	}
+	r.OnLookupDone = func(info LookupInfo, err error, d time.Duration) {
+		events = append(events, `done`)
+		done = info
+		if err != nil {
+			t.Errorf(`unexpected error %v`, err)
+		}
+	}
+
+	calls := 0
+	err := r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		if calls++; calls < 2 {
+			return errors.New(`connection refused`)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 4 || events[0] != `start example.com` || events[3] != `done` {
+		t.Errorf(`unexpected events %v`, events)
+	}
+	if done.Attempt != 2 || done.Type != `A` || done.Server == `` {
+		t.Errorf(`unexpected done info %+v`, done)
+	}
+}
+
+func TestLookupHookPanic(t *testing.T) {
+	r := New()
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString("10.0.0.1")
+
+	var panicked []string
+	r.OnAttempt = func(LookupInfo, string) {
+		panic(`boom`)
+	}
+	r.OnHookPanic = func(hook string, v interface{}) {
+		panicked = append(panicked, hook)
+	}
+
+	err := r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		return nil
+	})
+	if err != nil {
+		t.Errorf(`unexpected error %v`, err)
+	}
+	if len(panicked) != 1 || panicked[0] != `OnAttempt` {
+		t.Errorf(`unexpected panics %v`, panicked)
+	}
+}
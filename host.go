@@ -0,0 +1,65 @@
+package resolver
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// LookupHost returns the addresses of host as strings, the way
+// net.Resolver.LookupHost does, see LookupIPAddr.
+func (r *Resolver) LookupHost(host string, opts ...LookupOption) ([]string, error) {
+	ips, err := r.LookupIPAddr(host, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = ip.String()
+	}
+
+	return addrs, nil
+}
+
+// LookupIP returns the addresses of host for network, ip, ip4 or ip6, the
+// way net.Resolver.LookupIP does. An answer, or an IP literal, without any
+// address of the family fails with a *net.AddrError.
+func (r *Resolver) LookupIP(network, host string, opts ...LookupOption) ([]net.IP, error) {
+	switch network {
+	case `ip`, `ip4`, `ip6`:
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+
+	ipAddrs, err := r.LookupIPAddr(host, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := make([]net.IP, 0, len(ipAddrs))
+	for _, ip := range ipAddrs {
+		if network == `ip` || (ip.IP.To4() != nil) == (network == `ip4`) {
+			ips = append(ips, ip.IP)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, &net.AddrError{Err: `no suitable address found`, Addr: host}
+	}
+
+	return ips, nil
+}
+
+// ipLiteral returns host as an address when it is an IP literal, bracketed
+// or not and with a zone or not.
+func ipLiteral(host string) (net.IPAddr, bool) {
+	if strings.HasPrefix(host, `[`) && strings.HasSuffix(host, `]`) {
+		host = host[1 : len(host)-1]
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return net.IPAddr{}, false
+	}
+
+	return net.IPAddr{IP: net.IP(addr.AsSlice()), Zone: addr.Zone()}, true
+}
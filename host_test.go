@@ -0,0 +1,64 @@
+package resolver
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIPLiteral(t *testing.T) {
+	r := New() // no servers, a query would fail
+
+	cases := map[string]string{
+		`192.0.2.1`:        `192.0.2.1`,
+		`2001:db8::1`:      `2001:db8::1`,
+		`[2001:db8::1]`:    `2001:db8::1`,
+		`fe80::1%eth0`:     `fe80::1%eth0`,
+		`[fe80::1%eth0]`:   `fe80::1%eth0`,
+		`::ffff:192.0.2.1`: `192.0.2.1`,
+	}
+	for host, want := range cases {
+		ips, err := r.LookupIPAddr(host)
+		if err != nil || len(ips) != 1 || ips[0].String() != want {
+			t.Errorf(`%s: expected %s, got %v, %v`, host, want, ips, err)
+		}
+	}
+	if st := r.Stats(); st.Lookups != 0 {
+		t.Errorf(`expected no lookups counted, got %d`, st.Lookups)
+	}
+
+	if ips, err := r.LookupIP(`ip6`, `2001:db8::1`); err != nil || len(ips) != 1 {
+		t.Errorf(`unexpected addresses %v, %v`, ips, err)
+	}
+	for network, host := range map[string]string{`ip4`: `2001:db8::1`, `ip6`: `192.0.2.1`} {
+		_, err := r.LookupIP(network, host)
+		if _, ok := err.(*net.AddrError); !ok {
+			t.Errorf(`%s %s: expected a *net.AddrError, got %v`, network, host, err)
+		}
+	}
+	if _, err := r.LookupIP(`tcp`, `192.0.2.1`); err == nil {
+		t.Error(`expected an unknown network to fail`)
+	}
+
+	if addrs, err := r.LookupHost(`[2001:db8::1]`); err != nil || len(addrs) != 1 || addrs[0] != `2001:db8::1` {
+		t.Errorf(`unexpected addresses %v, %v`, addrs, err)
+	}
+	if ip, err := r.NextIP(`192.0.2.1`); err != nil || ip.String() != `192.0.2.1` {
+		t.Errorf(`unexpected address %v, %v`, ip, err)
+	}
+}
+
+func TestLookupIP(t *testing.T) {
+	ts := newTestServer(t, answerA(map[string]string{`example.com`: `192.0.2.1`}))
+
+	r := New()
+	if _, err := r.LoadServersFromString(ts.Addr); err != nil {
+		t.Fatal(err)
+	}
+
+	if ips, err := r.LookupIP(`ip4`, `example.com`); err != nil || len(ips) != 1 || !ips[0].Equal(net.ParseIP(`192.0.2.1`)) {
+		t.Errorf(`unexpected addresses %v, %v`, ips, err)
+	}
+	if _, err := r.LookupIP(`ip6`, `example.com`); err == nil {
+		t.Error(`expected no IPv6 address`)
+	}
+}
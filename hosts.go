@@ -0,0 +1,176 @@
+package resolver
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostsRecheck is how often the hosts file is looked at for changes.
+var hostsRecheck = time.Second * 5
+
+// DefaultHostsPath returns where the hosts file of the platform is.
+func DefaultHostsPath() string {
+	if runtime.GOOS == `windows` {
+		root := os.Getenv(`SystemRoot`)
+		if root == `` {
+			root = `C:\Windows`
+		}
+		return filepath.Join(root, `System32`, `drivers`, `etc`, `hosts`)
+	}
+
+	return `/etc/hosts`
+}
+
+// Hosts is what a hosts file maps: names to addresses, in the order of the
+// file, and addresses to names, the first being the canonical one.
+type Hosts struct {
+	Addrs map[string][]net.IPAddr
+	Names map[string][]string
+}
+
+// ReadHosts parses the hosts file at path.
+func ReadHosts(path string) (*Hosts, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseHosts(f)
+}
+
+// ParseHosts parses a hosts file: an address and its names on every line,
+// the first name canonical and the others aliases, and # starting a
+// comment. A name may be on several lines, its addresses add up. The lines
+// without a valid address or any name are skipped. The names are kept
+// lowercase and without the trailing dot.
+func ParseHosts(r io.Reader) (*Hosts, error) {
+	h := &Hosts{Addrs: make(map[string][]net.IPAddr), Names: make(map[string][]string)}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		f := strings.Fields(line)
+		if len(f) < 2 {
+			continue
+		}
+		addr, err := netip.ParseAddr(f[0])
+		if err != nil {
+			continue
+		}
+		ip := net.IPAddr{IP: net.IP(addr.AsSlice()), Zone: addr.Zone()}
+
+		key := addr.Unmap().WithZone(``).String()
+		for _, name := range f[1:] {
+			name = nameKey(name)
+			if !containsIPAddr(h.Addrs[name], ip) {
+				h.Addrs[name] = append(h.Addrs[name], ip)
+			}
+			if !containsString(h.Names[key], name) {
+				h.Names[key] = append(h.Names[key], name)
+			}
+		}
+	}
+
+	return h, scanner.Err()
+}
+
+// hostsFile is the hosts file of a resolver, read again when it changes.
+type hostsFile struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	checked time.Time
+	hosts   *Hosts
+}
+
+// hostsTable returns the hosts of HostsPath when HostsFile is set.
+func (r *Resolver) hostsTable(opts []LookupOption) *Hosts {
+	s := r.lookupOptions(opts).settings
+	if !s.HostsFile {
+		return nil
+	}
+	path := s.HostsPath
+	if path == `` {
+		path = DefaultHostsPath()
+	}
+
+	return r.hosts.load(path, s.Logger)
+}
+
+// hostsAddrs returns the addresses of name in the hosts file.
+func (r *Resolver) hostsAddrs(name string, opts []LookupOption) []net.IPAddr {
+	if h := r.hostsTable(opts); h != nil {
+		return append([]net.IPAddr(nil), h.Addrs[name]...)
+	}
+
+	return nil
+}
+
+// hostsNames returns the names of ip in the hosts file.
+func (r *Resolver) hostsNames(ip string, opts []LookupOption) []string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil
+	}
+	if h := r.hostsTable(opts); h != nil {
+		return append([]string(nil), h.Names[addr.Unmap().WithZone(``).String()]...)
+	}
+
+	return nil
+}
+
+// load returns the hosts of path, reading the file again when its size or
+// modification time changed since the last look, hostsRecheck ago at most.
+// A file that cannot be read has no hosts.
+func (f *hostsFile) load(path string, l Logger) *Hosts {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if path == f.path && now.Sub(f.checked) < hostsRecheck {
+		return f.hosts
+	}
+	f.checked = now
+
+	info, err := os.Stat(path)
+	if err != nil {
+		f.path, f.hosts = path, nil
+		return nil
+	}
+	if path == f.path && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.hosts
+	}
+
+	h, err := ReadHosts(path)
+	if err != nil {
+		if l != nil {
+			l.Warn(`resolver: hosts file not read`, `path`, path, `err`, err)
+		}
+		h = nil
+	}
+	f.path, f.modTime, f.size, f.hosts = path, info.ModTime(), info.Size(), h
+
+	return h
+}
+
+func containsIPAddr(list []net.IPAddr, ip net.IPAddr) bool {
+	for _, v := range list {
+		if v.IP.Equal(ip.IP) && v.Zone == ip.Zone {
+			return true
+		}
+	}
+
+	return false
+}
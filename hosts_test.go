@@ -0,0 +1,80 @@
+package resolver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadHosts(t *testing.T) {
+	h, err := ReadHosts(filepath.Join(`testdata`, `hosts`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs := map[string][]string{
+		`localhost`:         {`127.0.0.1`, `::1`},
+		`ip6-localhost`:     {`::1`},
+		`db.example.com`:    {`192.0.2.10`, `2001:db8::10`, `192.0.2.11`},
+		`db`:                {`192.0.2.10`},
+		`cache.example.com`: {`192.0.2.10`},
+	}
+	for name, want := range addrs {
+		var got []string
+		for _, ip := range h.Addrs[name] {
+			got = append(got, ip.String())
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf(`%s: expected %v, got %v`, name, want, got)
+		}
+	}
+	if len(h.Addrs) != len(addrs) {
+		t.Errorf(`expected the lines without an address or a name skipped, got %v`, h.Addrs)
+	}
+
+	if names := h.Names[`192.0.2.10`]; !reflect.DeepEqual(names, []string{`db.example.com`, `db`, `cache.example.com`}) {
+		t.Errorf(`expected the canonical name first, got %v`, names)
+	}
+}
+
+func TestHostsFile(t *testing.T) {
+	defer func(saved time.Duration) { hostsRecheck = saved }(hostsRecheck)
+	hostsRecheck = 0
+
+	path := filepath.Join(t.TempDir(), `hosts`)
+	if err := os.WriteFile(path, []byte("192.0.2.1 app.example.com app\n2001:db8::1 app.example.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// no servers, every answer comes from the file
+	r := New()
+	if _, err := r.LookupIPAddr(`app.example.com`); !errors.Is(err, ErrServerListEmpty) {
+		t.Errorf(`expected the file left alone by default, got %v`, err)
+	}
+
+	r.HostsFile = true
+	r.HostsPath = path
+	if addrs, err := r.LookupHost(`App.Example.com.`); err != nil || !reflect.DeepEqual(addrs, []string{`192.0.2.1`, `2001:db8::1`}) {
+		t.Errorf(`expected both addresses of the file, got %v, %v`, addrs, err)
+	}
+	if names, err := r.LookupAddr(`2001:db8::1`); err != nil || !reflect.DeepEqual(names, []string{`app.example.com`}) {
+		t.Errorf(`expected the name of the file, got %v, %v`, names, err)
+	}
+
+	if err := os.WriteFile(path, []byte("192.0.2.2 app.example.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if ips, err := r.LookupIPAddr(`app.example.com`); err != nil || len(ips) != 1 || ips[0].IP.String() != `192.0.2.2` {
+		t.Errorf(`expected the edit picked up, got %v, %v`, ips, err)
+	}
+	if _, err := r.LookupIPAddr(`app`); !errors.Is(err, ErrServerListEmpty) {
+		t.Errorf(`expected the removed alias asked from the servers, got %v`, err)
+	}
+}
@@ -0,0 +1,51 @@
+package resolver
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var ErrResolverBusy = errors.New(`resolver: too many lookups in flight`)
+
+// enter counts a lookup in flight, waiting up to MaxInFlightWait while
+// MaxInFlight are already.
+func (r *Resolver) enter(o *lookupOptions) error {
+	max := o.settings.MaxInFlight
+	if takeSlot(&r.stats.inFlight, max) {
+		return nil
+	}
+
+	if wait := o.settings.MaxInFlightWait; wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+
+	loop:
+		for {
+			freed, done := r.gate.watch()
+			if takeSlot(&r.stats.inFlight, max) {
+				done()
+				return nil
+			}
+
+			select {
+			case <-freed:
+				done()
+			case <-o.ctx.Done():
+				done()
+				return o.ctx.Err()
+			case <-t.C:
+				done()
+				break loop
+			}
+		}
+	}
+
+	atomic.AddUint64(&r.stats.rejected, 1)
+	return ErrResolverBusy
+}
+
+func (r *Resolver) leave() {
+	atomic.AddInt64(&r.stats.inFlight, -1)
+	r.gate.notify()
+}
@@ -0,0 +1,82 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMaxInFlight(t *testing.T) {
+	r := New()
+	r.MaxInFlight = 1
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString("10.0.0.1")
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+			close(started)
+			<-unblock
+			return nil
+		})
+	}()
+	<-started
+
+	ok := func(*net.Resolver) error { return nil }
+	if err := r.lookup(`A`, `example.org`, ok); !errors.Is(err, ErrResolverBusy) {
+		t.Errorf(`expected ErrResolverBusy, got %v`, err)
+	}
+	if st := r.Stats(); st.InFlight != 1 || st.Rejected != 1 || st.Lookups != 0 {
+		t.Errorf(`unexpected stats %+v`, st)
+	}
+
+	// with a grace period the lookup waits for the running one
+	r.MaxInFlightWait = time.Second
+	waited := make(chan error, 1)
+	go func() {
+		waited <- r.lookup(`A`, `example.org`, ok)
+	}()
+	time.Sleep(time.Millisecond * 20)
+	close(unblock)
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+	if err := <-waited; err != nil {
+		t.Errorf(`waiting lookup failed: %v`, err)
+	}
+
+	if st := r.Stats(); st.InFlight != 0 || st.Rejected != 1 {
+		t.Errorf(`unexpected stats %+v`, st)
+	}
+}
+
+func TestMaxInFlightWaitExpires(t *testing.T) {
+	r := New()
+	r.MaxInFlight = 1
+	r.MaxInFlightWait = time.Millisecond * 30
+	_, _ = r.LoadServersFromString("10.0.0.1")
+
+	unblock := make(chan struct{})
+	defer close(unblock)
+	started := make(chan struct{})
+	go func() {
+		_ = r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+			close(started)
+			<-unblock
+			return nil
+		})
+	}()
+	<-started
+
+	start := time.Now()
+	err := r.lookup(`A`, `example.org`, func(*net.Resolver) error { return nil })
+	if !errors.Is(err, ErrResolverBusy) {
+		t.Errorf(`expected ErrResolverBusy, got %v`, err)
+	}
+	if d := time.Since(start); d < r.MaxInFlightWait {
+		t.Errorf(`gave up after %s`, d)
+	}
+}
@@ -0,0 +1,387 @@
+package resolver
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrReferralLimit  = errors.New(`resolver: too many referrals`)
+	ErrLameDelegation = errors.New(`resolver: lame delegation`)
+)
+
+// DefaultMaxReferrals is how many referrals ResolveIterative follows when
+// MaxReferrals is 0.
+const DefaultMaxReferrals = 16
+
+// iterativePort is the port of the nameservers ResolveIterative and
+// LookupAuthoritative find.
+var iterativePort = `53`
+
+// embeddedRootHints are the root servers, kept in a plain text file so that
+// updating them is a change of data.
+//
+//go:embed root_hints.txt
+var embeddedRootHints string
+
+// SetRootHints replaces the root servers ResolveIterative starts from, by
+// default those of the IANA root hints built into the package. Calling it
+// without servers brings those back.
+func (r *Resolver) SetRootHints(servers ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rootHints = append([]string(nil), servers...)
+}
+
+func (r *Resolver) rootServers() []string {
+	r.mu.Lock()
+	servers := r.rootHints
+	r.mu.Unlock()
+	if len(servers) > 0 {
+		return spread(servers)
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(embeddedRootHints))
+	for scanner.Scan() {
+		f := strings.Fields(scanner.Text())
+		if len(f) == 0 || strings.HasPrefix(f[0], `#`) {
+			continue
+		}
+		servers = append(servers, f[1:]...)
+	}
+
+	return spread(servers)
+}
+
+// ResolveIterative looks name up the way a recursive resolver does, without
+// one: it asks a root server, follows the referrals down to the servers of
+// the zone and returns their answer, the servers of the list are not used.
+// The glue of a referral is taken when it is within the zone of the server
+// that sent it, the nameservers without are looked up the same way. A CNAME
+// to a name outside the answer starts over from the root, the chain is in
+// the answers of the message returned.
+//
+// Every query is a try of the returned *LookupError and an attempt of
+// WithTrace, WithMeta tells the server of the answer. The lookup gives up
+// with ErrReferralLimit after MaxReferrals referrals, counting those of the
+// nameservers looked up, and with ErrLameDelegation on a referral that does
+// not lead closer to name. A name that does not exist fails with
+// ErrNoSuchHost, one without records of qtype with ErrNoData.
+func (r *Resolver) ResolveIterative(ctx context.Context, name string, qtype Type, opts ...LookupOption) (m *Message, err error) {
+	it, err := r.newIteration(ctx, name, qtype, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer it.end(&err)
+
+	return it.resolve(it.err.Name, qtype, 0)
+}
+
+// iteration is the state of one ResolveIterative or LookupAuthoritative,
+// shared by the lookups of the nameservers it makes on the way.
+type iteration struct {
+	r         *Resolver
+	ctx       context.Context
+	o         *lookupOptions
+	err       LookupError
+	start     time.Time
+	queries   int
+	referrals int
+
+	// normal has the nameservers and the CNAME targets looked up the
+	// normal way, through the servers of the list.
+	normal bool
+	hosts  map[string]string // nameserver address -> name
+	addr   string            // the server of the last response
+}
+
+// newIteration checks name the way the lookups do and starts the trace.
+func (r *Resolver) newIteration(ctx context.Context, name string, qtype Type, opts []LookupOption) (*iteration, error) {
+	name, _, err := r.hostName(qtype.String(), name, opts)
+	if err != nil {
+		return nil, err
+	}
+	it := &iteration{r: r, ctx: ctx, o: r.lookupOptions(append([]LookupOption{WithContext(ctx)}, opts...)), hosts: make(map[string]string)}
+	it.err = LookupError{Name: name, Type: qtype.String()}
+
+	if atomic.LoadInt32(&r.closed) != 0 {
+		return nil, it.err.fail(ErrResolverClosed)
+	}
+	if err := r.checkDomain(name); err != nil {
+		return nil, it.err.fail(err)
+	}
+	if !it.o.settings.RelaxedNames {
+		if err := validateName(name); err != nil {
+			return nil, it.err.fail(err)
+		}
+	}
+
+	it.start = time.Now()
+	if it.o.meta != nil {
+		*it.o.meta = LookupMeta{}
+	}
+	if t := it.o.trace; t != nil {
+		t.begin(name, qtype.String(), it.start)
+	}
+
+	return it, nil
+}
+
+// end ends the trace with the error err points at.
+func (it *iteration) end(err *error) {
+	if t := it.o.trace; t != nil {
+		t.end(*err, time.Since(it.start))
+	}
+}
+
+func (it *iteration) maxReferrals() int {
+	if n := it.o.settings.MaxReferrals; n > 0 {
+		return n
+	}
+
+	return DefaultMaxReferrals
+}
+
+// resolve walks down from the root for name, depth is how many nameserver
+// lookups it is made for.
+func (it *iteration) resolve(name string, qtype Type, depth int) (*Message, error) {
+	return it.walk(name, qtype, it.r.rootServers(), `.`, depth)
+}
+
+// walk walks down from servers, those of zone, for name.
+func (it *iteration) walk(name string, qtype Type, servers []string, zone string, depth int) (*Message, error) {
+	if depth > it.maxReferrals() {
+		return nil, it.err.fail(ErrReferralLimit)
+	}
+
+	var chain []RR
+	for cnames := 0; ; {
+		m, addr, err := it.ask(servers, name, qtype)
+		if err != nil {
+			return nil, err
+		}
+		if m.Rcode == RcodeNameError {
+			return nil, it.err.fail(&NotFoundError{Host: name, Server: addr})
+		}
+
+		target, err := cnameChain(name, m.Answers, it.o.settings.MaxCNAMEDepth)
+		if err != nil {
+			return nil, it.err.fail(err)
+		}
+		if hasType(m.Answers, qtype) {
+			m.Answers = append(chain, m.Answers...)
+			return m, nil
+		}
+		if target != name {
+			// the zone of the target is not that of name, start over
+			if cnames += countType(m.Answers, TypeCNAME); cnames > maxCNAMEDepth(&it.o.settings) {
+				return nil, it.err.fail(&CNAMELoopError{Host: name, Target: target, Depth: maxCNAMEDepth(&it.o.settings)})
+			}
+			chain = append(chain, m.Answers...)
+			if it.normal {
+				chased, err := it.r.Query(it.ctx, target, qtype)
+				if err != nil {
+					return nil, err
+				}
+				chased.Answers = append(chain, chased.Answers...)
+				return chased, nil
+			}
+			name, servers, zone = target, it.r.rootServers(), `.`
+			continue
+		}
+
+		child, ns := referral(m, zone, name)
+		if child == `` {
+			if m.Authoritative || hasType(m.Authorities, TypeSOA) {
+				return nil, it.err.fail(&NoDataError{Host: name, Type: qtype.String(), Server: addr})
+			}
+			return nil, it.err.fail(ErrLameDelegation)
+		}
+		if it.referrals++; it.referrals > it.maxReferrals() {
+			return nil, it.err.fail(ErrReferralLimit)
+		}
+		if l := it.o.settings.Logger; l != nil {
+			l.Debug(`resolver: referral`, `host`, name, `zone`, child, `server`, addr)
+		}
+
+		if servers, err = it.nameservers(m, zone, ns, depth); err != nil {
+			return nil, err
+		}
+		if len(servers) == 0 {
+			return nil, it.err.fail(ErrLameDelegation)
+		}
+		zone = child
+	}
+}
+
+// ask sends the query to servers in turn and returns the first response
+// with NOERROR or NXDOMAIN, an answer or a referral, and the server that
+// sent it.
+func (it *iteration) ask(servers []string, name string, qtype Type) (*Message, string, error) {
+	q := newQuery(name, qtype)
+	q.RecursionDesired = false
+
+	var lastErr error
+	for _, addr := range servers {
+		it.queries++
+		start := time.Now()
+		m, err := it.r.exchange(it.ctx, addr, q)
+		if err == nil && m.Rcode != RcodeSuccess && m.Rcode != RcodeNameError {
+			err = &ResponseError{Server: addr, Code: m.Rcode}
+		} else if err == nil && !m.Authoritative && len(m.Answers) == 0 && !hasType(m.Authorities, TypeNS) {
+			// neither an answer nor a referral, the server is not one of the zone
+			err = ErrLameDelegation
+		}
+		d := time.Since(start)
+		if it.o.trace != nil {
+			it.o.trace.attempt(addr, start, d, err)
+		}
+
+		if err == nil {
+			it.addr = addr
+			if it.o.meta != nil {
+				*it.o.meta = LookupMeta{Server: addr, Transport: `udp`, Attempt: it.queries, RTT: d}
+			}
+			return m, addr, nil
+		}
+		if it.ctx.Err() != nil {
+			return nil, ``, it.err.fail(it.ctx.Err())
+		}
+		it.err.add(Attempt{Server: addr, Err: err, Duration: d})
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = ErrLameDelegation
+	}
+
+	return nil, ``, it.err.fail(lastErr)
+}
+
+// referral returns the zone m delegates name to and its nameservers, when
+// that zone is below zone, the one of the server that sent m.
+func referral(m *Message, zone, name string) (child string, ns []string) {
+	name = canonicalName(name)
+	for _, rr := range m.Authorities {
+		owner := canonicalName(rr.Name)
+		if rr.Type != TypeNS || owner == zone || !inZone(owner, zone) || !inZone(name, owner) {
+			continue
+		}
+		if child != `` && owner != child {
+			continue
+		}
+		child = owner
+		ns = append(ns, canonicalName(rr.Target))
+	}
+
+	return child, ns
+}
+
+// nameservers returns the addresses of ns, in the order of spread. The glue
+// in m is taken for the nameservers within zone, without any the
+// nameservers are looked up until one has an address. Only running out of
+// referrals doing so is an error.
+func (it *iteration) nameservers(m *Message, zone string, ns []string, depth int) ([]string, error) {
+	var addrs []string
+	for _, rr := range m.Additionals {
+		if owner := canonicalName(rr.Name); (rr.Type == TypeA || rr.Type == TypeAAAA) && inZone(owner, zone) && containsString(ns, owner) {
+			addrs = append(addrs, it.nameserver(owner, rr.IP))
+		}
+	}
+
+	for _, host := range ns {
+		if len(addrs) > 0 {
+			break
+		}
+		if it.normal {
+			ips, err := it.r.LookupIPAddr(host, WithContext(it.ctx))
+			for _, ip := range ips {
+				addrs = append(addrs, it.nameserver(host, ip.IP))
+			}
+			if isCallerError(err) {
+				return nil, it.err.fail(err)
+			}
+			continue
+		}
+
+		a, err := it.resolve(nameKey(host), TypeA, depth+1)
+		if errors.Is(err, ErrReferralLimit) {
+			return nil, err
+		}
+		if err != nil {
+			continue
+		}
+		for _, rr := range a.Answers {
+			if rr.Type == TypeA {
+				addrs = append(addrs, it.nameserver(host, rr.IP))
+			}
+		}
+	}
+
+	return spread(addrs), nil
+}
+
+// nameserver returns the address of the nameserver host at ip, keeping
+// track of its name.
+func (it *iteration) nameserver(host string, ip net.IP) string {
+	addr := net.JoinHostPort(ip.String(), iterativePort)
+	it.hosts[addr] = nameKey(host)
+
+	return addr
+}
+
+// spread shuffles the server addresses, the IPv4 ones first.
+func spread(addrs []string) []string {
+	var v4, v6 []string
+	for _, addr := range addrs {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+			v6 = append(v6, addr)
+		} else {
+			v4 = append(v4, addr)
+		}
+	}
+	rand.Shuffle(len(v4), func(i, j int) { v4[i], v4[j] = v4[j], v4[i] })
+	rand.Shuffle(len(v6), func(i, j int) { v6[i], v6[j] = v6[j], v6[i] })
+
+	return append(v4, v6...)
+}
+
+func maxCNAMEDepth(s *Settings) int {
+	if s.MaxCNAMEDepth > 0 {
+		return s.MaxCNAMEDepth
+	}
+
+	return DefaultMaxCNAMEDepth
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func countType(rrs []RR, t Type) int {
+	n := 0
+	for _, rr := range rrs {
+		if rr.Type == t {
+			n++
+		}
+	}
+
+	return n
+}
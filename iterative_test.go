@@ -0,0 +1,95 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestResolveIterative(t *testing.T) {
+	ns := func(zone, host string) RR { return RR{Name: zone, Type: TypeNS, TTL: 60, Target: host} }
+	a := func(name, ip string) RR { return RR{Name: name, Type: TypeA, TTL: 60, IP: net.ParseIP(ip)} }
+
+	root := newTestServer(t, func(q Question, resp *Message) {
+		if !strings.HasSuffix(q.Name, `.com.`) {
+			resp.Authoritative, resp.Rcode = true, RcodeNameError
+			return
+		}
+		resp.Authorities = []RR{ns(`com.`, `ns.nic.com.`)}
+		resp.Additionals = []RR{a(`ns.nic.com.`, `127.0.0.2`)}
+	})
+	_, port, _ := net.SplitHostPort(root.Addr)
+	for _, ip := range []string{`127.0.0.2`, `127.0.0.3`} {
+		conn, err := net.ListenPacket(`udp`, net.JoinHostPort(ip, port))
+		if err != nil {
+			t.Skipf(`no loopback address %s: %v`, ip, err)
+		}
+		_ = conn.Close()
+	}
+	defer func(saved string) { iterativePort = saved }(iterativePort)
+	iterativePort = port
+
+	newTestServerAt(t, `127.0.0.2:`+port, func(q Question, resp *Message) {
+		switch name := q.Name; {
+		case strings.HasSuffix(name, `example.com.`):
+			resp.Authorities = []RR{ns(`example.com.`, `ns1.example.com.`)}
+			resp.Additionals = []RR{a(`ns1.example.com.`, `127.0.0.3`)}
+		case strings.HasSuffix(name, `other.com.`):
+			resp.Authorities = []RR{ns(`other.com.`, `ns.example.com.`)}
+		case strings.HasSuffix(name, `loop.com.`):
+			resp.Authorities = []RR{ns(`loop.com.`, `ns.loop.com.`)}
+		default:
+			resp.Authoritative, resp.Rcode = true, RcodeNameError
+		}
+	})
+	newTestServerAt(t, `127.0.0.3:`+port, func(q Question, resp *Message) {
+		resp.Authoritative = true
+		records := map[string]RR{
+			`www.example.com.`:   a(`www.example.com.`, `192.0.2.1`),
+			`ns.example.com.`:    a(`ns.example.com.`, `127.0.0.3`),
+			`alias.example.com.`: {Name: `alias.example.com.`, Type: TypeCNAME, TTL: 60, Target: `www.other.com.`},
+			`www.other.com.`:     a(`www.other.com.`, `192.0.2.2`),
+		}
+		rr, ok := records[q.Name]
+		switch {
+		case !ok:
+			resp.Rcode = RcodeNameError
+		case rr.Type == q.Type || rr.Type == TypeCNAME:
+			resp.Answers = []RR{rr}
+		default:
+			resp.Authorities = []RR{{Name: `example.com.`, Type: TypeSOA, TTL: 60, Target: `ns1.example.com.`, Mailbox: `hostmaster.example.com.`}}
+		}
+	})
+
+	r := New()
+	r.MaxReferrals = 6
+	r.SetRootHints(root.Addr)
+	ctx := context.Background()
+
+	var trace Trace
+	var meta LookupMeta
+	m, err := r.ResolveIterative(ctx, `www.example.com`, TypeA, WithTrace(&trace), WithMeta(&meta))
+	if err != nil || len(m.Answers) != 1 || m.Answers[0].IP.String() != `192.0.2.1` || !m.Authoritative {
+		t.Fatalf(`unexpected answer %+v, %v`, m, err)
+	}
+	if len(trace.Attempts) != 3 || meta.Server != `127.0.0.3:`+port {
+		t.Errorf(`expected the root, com and example.com servers, got %+v, %+v`, trace.Attempts, meta)
+	}
+
+	m, err = r.ResolveIterative(ctx, `alias.example.com`, TypeA)
+	if err != nil || len(m.Answers) != 2 || m.Answers[0].Type != TypeCNAME || m.Answers[1].IP.String() != `192.0.2.2` {
+		t.Errorf(`expected the CNAME chased through the glueless other.com, got %+v, %v`, m, err)
+	}
+
+	if _, err := r.ResolveIterative(ctx, `www.example.com`, TypeTXT); !errors.Is(err, ErrNoData) {
+		t.Errorf(`expected ErrNoData, got %v`, err)
+	}
+	if _, err := r.ResolveIterative(ctx, `missing.example.com`, TypeA); !errors.Is(err, ErrNoSuchHost) {
+		t.Errorf(`expected ErrNoSuchHost, got %v`, err)
+	}
+	if _, err := r.ResolveIterative(ctx, `www.loop.com`, TypeA); !errors.Is(err, ErrReferralLimit) {
+		t.Errorf(`expected ErrReferralLimit, got %v`, err)
+	}
+}
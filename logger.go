@@ -0,0 +1,11 @@
+package resolver
+
+// Logger receives the logs of a resolver as a message and key value pairs,
+// *slog.Logger implements it. Attempts are logged at debug level, server
+// state changes and list loads at info, quarantines, evictions and empty
+// lists at warn.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+}
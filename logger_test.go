@@ -0,0 +1,92 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+)
+
+type logEntry struct {
+	level string
+	msg   string
+	args  []interface{}
+}
+
+type testLogger struct {
+	entries []logEntry
+	mu      sync.Mutex
+}
+
+func (l *testLogger) add(level, msg string, args []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, args: args})
+}
+
+func (l *testLogger) Debug(msg string, args ...interface{}) { l.add(`debug`, msg, args) }
+func (l *testLogger) Info(msg string, args ...interface{})  { l.add(`info`, msg, args) }
+func (l *testLogger) Warn(msg string, args ...interface{})  { l.add(`warn`, msg, args) }
+
+func (l *testLogger) find(level, msg string) *logEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, e := range l.entries {
+		if e.level == level && e.msg == msg {
+			return &l.entries[i]
+		}
+	}
+
+	return nil
+}
+
+// field returns the value following key in the args of e.
+func (e *logEntry) field(key string) interface{} {
+	for i := 0; i+1 < len(e.args); i += 2 {
+		if e.args[i] == key {
+			return e.args[i+1]
+		}
+	}
+
+	return nil
+}
+
+func TestLogger(t *testing.T) {
+	log := &testLogger{}
+
+	r := New()
+	r.Logger = log
+	r.RetryLimit = 1
+	r.RetrySleep = 0
+	r.MaxFails = 1
+	r.NetworkDownServers = 0
+	_, _ = r.LoadServersFromString("10.0.0.1")
+
+	if e := log.find(`info`, `resolver: servers loaded`); e == nil || e.field(`added`) != 1 {
+		t.Errorf(`list load not logged: %+v`, e)
+	}
+
+	cause := errors.New(`connection refused`)
+	_ = r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		return cause
+	})
+
+	if e := log.find(`debug`, `resolver: attempt`); e == nil || e.field(`host`) != `example.com` || e.field(`server`) == nil {
+		t.Errorf(`attempt not logged: %+v`, e)
+	}
+	if e := log.find(`debug`, `resolver: attempt failed`); e == nil || e.field(`error`) != cause {
+		t.Errorf(`failed attempt not logged: %+v`, e)
+	}
+	if e := log.find(`warn`, `resolver: server quarantined`); e == nil {
+		t.Errorf(`quarantine not logged`)
+	}
+
+	_ = r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		return nil
+	})
+	if e := log.find(`warn`, `resolver: no server left`); e == nil || e.field(`quarantined`) != 1 {
+		t.Errorf(`empty list not logged: %+v`, e)
+	}
+}
@@ -0,0 +1,204 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+var ErrNopResolver = errors.New(`resolver: lookups disabled`)
+
+// Lookuper is the lookup API of Resolver, for code that should not depend
+// on the concrete type. Pool, StaticResolver and NopResolver have it too.
+type Lookuper interface {
+	LookupIPAddr(host string, opts ...LookupOption) ([]net.IPAddr, error)
+	LookupAddr(ip string, opts ...LookupOption) ([]string, error)
+	LookupNS(host string, opts ...LookupOption) ([]*net.NS, error)
+	LookupTXT(host string, opts ...LookupOption) ([]string, error)
+	LookupCNAME(host string, opts ...LookupOption) (string, error)
+	LookupMX(host string, opts ...LookupOption) ([]*net.MX, error)
+	Query(ctx context.Context, name string, qtype Type, opts ...LookupOption) (*Message, error)
+}
+
+var (
+	_ Lookuper = (*Resolver)(nil)
+	_ Lookuper = (*Pool)(nil)
+	_ Lookuper = (*StaticResolver)(nil)
+	_ Lookuper = NopResolver{}
+)
+
+// StaticRecords are the answers of a StaticResolver for one name. Names
+// are those LookupAddr returns when the key is an address.
+type StaticRecords struct {
+	IPs   []net.IPAddr
+	Names []string
+	NS    []*net.NS
+	TXT   []string
+	CNAME string
+	MX    []*net.MX
+
+	// Err fails every lookup of the name when set.
+	Err error
+}
+
+// StaticResolver answers from Records, keyed by name the way lookups take
+// it, case and a trailing dot aside, or by address for LookupAddr. Names
+// missing fail with Missing, a *NotFoundError when it is nil, names without
+// records of the type asked fail with a *NoDataError. The options are left
+// out but for WithContext, a lookup under a done context fails with its
+// error. Query answers with a message built from the records, their TTL
+// being 0. It is meant for tests.
+type StaticResolver struct {
+	Records map[string]StaticRecords
+	Missing error
+}
+
+func (s *StaticResolver) LookupIPAddr(host string, opts ...LookupOption) ([]net.IPAddr, error) {
+	rec, err := s.records(host, `IP`, opts, func(rec StaticRecords) bool { return len(rec.IPs) > 0 })
+	return rec.IPs, err
+}
+
+func (s *StaticResolver) LookupAddr(ip string, opts ...LookupOption) ([]string, error) {
+	rec, err := s.records(ip, `PTR`, opts, func(rec StaticRecords) bool { return len(rec.Names) > 0 })
+	return rec.Names, err
+}
+
+func (s *StaticResolver) LookupNS(host string, opts ...LookupOption) ([]*net.NS, error) {
+	rec, err := s.records(host, `NS`, opts, func(rec StaticRecords) bool { return len(rec.NS) > 0 })
+	return rec.NS, err
+}
+
+func (s *StaticResolver) LookupTXT(host string, opts ...LookupOption) ([]string, error) {
+	rec, err := s.records(host, `TXT`, opts, func(rec StaticRecords) bool { return len(rec.TXT) > 0 })
+	return rec.TXT, err
+}
+
+func (s *StaticResolver) LookupCNAME(host string, opts ...LookupOption) (string, error) {
+	rec, err := s.records(host, `CNAME`, opts, func(rec StaticRecords) bool { return rec.CNAME != `` })
+	return rec.CNAME, err
+}
+
+func (s *StaticResolver) LookupMX(host string, opts ...LookupOption) ([]*net.MX, error) {
+	rec, err := s.records(host, `MX`, opts, func(rec StaticRecords) bool { return len(rec.MX) > 0 })
+	return rec.MX, err
+}
+
+func (s *StaticResolver) Query(ctx context.Context, name string, qtype Type, opts ...LookupOption) (*Message, error) {
+	name = nameKey(name)
+	q := Question{Name: name, Type: qtype}
+	m := &Message{Header: Header{Response: true, RecursionAvailable: true}, Questions: []Question{q}}
+	answer := func(rr RR) {
+		if rr.Type == qtype || qtype == TypeANY {
+			rr.Name, rr.Class = name, classINET
+			m.Answers = append(m.Answers, rr)
+		}
+	}
+
+	_, err := s.records(name, qtype.String(), append([]LookupOption{WithContext(ctx)}, opts...), func(rec StaticRecords) bool {
+		for _, ip := range rec.IPs {
+			if ip4 := ip.IP.To4(); ip4 != nil {
+				answer(RR{Type: TypeA, IP: ip4})
+			} else {
+				answer(RR{Type: TypeAAAA, IP: ip.IP})
+			}
+		}
+		for _, n := range rec.Names {
+			answer(RR{Type: TypePTR, Target: n})
+		}
+		for _, ns := range rec.NS {
+			answer(RR{Type: TypeNS, Target: ns.Host})
+		}
+		if len(rec.TXT) > 0 {
+			answer(RR{Type: TypeTXT, Text: rec.TXT})
+		}
+		if rec.CNAME != `` {
+			answer(RR{Type: TypeCNAME, Target: rec.CNAME})
+		}
+		for _, mx := range rec.MX {
+			answer(RR{Type: TypeMX, Pref: mx.Pref, Target: mx.Host})
+		}
+
+		return len(m.Answers) > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// records returns the records of name when has finds those of qtype there.
+func (s *StaticResolver) records(name, qtype string, opts []LookupOption, has func(rec StaticRecords) bool) (StaticRecords, error) {
+	if err := lookupContext(opts).Err(); err != nil {
+		return StaticRecords{}, err
+	}
+
+	key := name
+	if net.ParseIP(name) == nil {
+		key = nameKey(name)
+	}
+	rec, ok := s.Records[key]
+	switch {
+	case !ok && s.Missing != nil:
+		return StaticRecords{}, s.Missing
+	case !ok:
+		return StaticRecords{}, &NotFoundError{Host: key}
+	case rec.Err != nil:
+		return StaticRecords{}, rec.Err
+	case !has(rec):
+		return StaticRecords{}, &NoDataError{Host: key, Type: qtype}
+	}
+
+	return rec, nil
+}
+
+// NopResolver fails every lookup with Err, ErrNopResolver when it is nil.
+type NopResolver struct {
+	Err error
+}
+
+func (n NopResolver) LookupIPAddr(string, ...LookupOption) ([]net.IPAddr, error) {
+	return nil, n.err()
+}
+
+func (n NopResolver) LookupAddr(string, ...LookupOption) ([]string, error) {
+	return nil, n.err()
+}
+
+func (n NopResolver) LookupNS(string, ...LookupOption) ([]*net.NS, error) {
+	return nil, n.err()
+}
+
+func (n NopResolver) LookupTXT(string, ...LookupOption) ([]string, error) {
+	return nil, n.err()
+}
+
+func (n NopResolver) LookupCNAME(string, ...LookupOption) (string, error) {
+	return ``, n.err()
+}
+
+func (n NopResolver) LookupMX(string, ...LookupOption) ([]*net.MX, error) {
+	return nil, n.err()
+}
+
+func (n NopResolver) Query(context.Context, string, Type, ...LookupOption) (*Message, error) {
+	return nil, n.err()
+}
+
+func (n NopResolver) err() error {
+	if n.Err != nil {
+		return n.Err
+	}
+
+	return ErrNopResolver
+}
+
+// lookupContext is the context WithContext gives among opts.
+func lookupContext(opts []LookupOption) context.Context {
+	o := &lookupOptions{ctx: context.Background()}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o.ctx
+}
@@ -0,0 +1,77 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestStaticResolver(t *testing.T) {
+	down := errors.New(`down`)
+	var r Lookuper = &StaticResolver{Records: map[string]StaticRecords{
+		`example.com`: {
+			IPs: []net.IPAddr{{IP: net.ParseIP(`192.0.2.1`)}, {IP: net.ParseIP(`2001:db8::1`)}},
+			TXT: []string{`v=spf1 -all`},
+			MX:  []*net.MX{{Host: `mx.example.com.`, Pref: 10}},
+		},
+		`www.example.com`: {CNAME: `example.com.`},
+		`192.0.2.1`:       {Names: []string{`example.com.`}},
+		`broken.example`:  {Err: down},
+	}}
+
+	ips, err := r.LookupIPAddr(`Example.COM.`)
+	if err != nil || len(ips) != 2 {
+		t.Errorf(`expected two addresses, got %v, %v`, ips, err)
+	}
+	if cname, err := r.LookupCNAME(`www.example.com`); err != nil || cname != `example.com.` {
+		t.Errorf(`unexpected cname %q, %v`, cname, err)
+	}
+	if names, err := r.LookupAddr(`192.0.2.1`); err != nil || len(names) != 1 {
+		t.Errorf(`unexpected names %v, %v`, names, err)
+	}
+	if _, err := r.LookupNS(`example.com`); !errors.Is(err, ErrNoData) {
+		t.Errorf(`expected ErrNoData, got %v`, err)
+	}
+	if _, err := r.LookupTXT(`missing.example`); !errors.Is(err, ErrNoSuchHost) {
+		t.Errorf(`expected ErrNoSuchHost, got %v`, err)
+	}
+	if _, err := r.LookupMX(`broken.example`); err != down {
+		t.Errorf(`expected the record error, got %v`, err)
+	}
+
+	m, err := r.Query(context.Background(), `example.com`, TypeAAAA)
+	if err != nil || len(m.Answers) != 1 || !m.Answers[0].IP.Equal(net.ParseIP(`2001:db8::1`)) {
+		t.Errorf(`unexpected answer %+v, %v`, m, err)
+	}
+	if _, err := r.Query(context.Background(), `www.example.com`, TypeA); !errors.Is(err, ErrNoData) {
+		t.Errorf(`expected ErrNoData, got %v`, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.LookupIPAddr(`example.com`, WithContext(ctx)); err != context.Canceled {
+		t.Errorf(`expected context.Canceled, got %v`, err)
+	}
+
+	missing := &StaticResolver{Missing: down}
+	if _, err := missing.LookupIPAddr(`example.com`); err != down {
+		t.Errorf(`expected the missing error, got %v`, err)
+	}
+}
+
+func TestNopResolver(t *testing.T) {
+	var r Lookuper = NopResolver{}
+	if _, err := r.LookupIPAddr(`example.com`); err != ErrNopResolver {
+		t.Errorf(`expected ErrNopResolver, got %v`, err)
+	}
+
+	down := errors.New(`down`)
+	r = NopResolver{Err: down}
+	if _, err := r.Query(context.Background(), `example.com`, TypeA); err != down {
+		t.Errorf(`expected the error given, got %v`, err)
+	}
+	if _, err := r.LookupCNAME(`example.com`); err != down {
+		t.Errorf(`expected the error given, got %v`, err)
+	}
+}
@@ -0,0 +1,29 @@
+package resolver
+
+import (
+	"time"
+)
+
+// LookupMeta tells where the answer of a successful lookup came from, see
+// WithMeta. The resolver keeps no answer cache, so FromCache is always
+// false for now. DNSSEC is the status of a Query answer, see
+// Settings.DNSSEC. Synthesized is set when LookupIPAddr made up addresses
+// with DNS64, see Settings.DNS64.
+type LookupMeta struct {
+	Server    string
+	Transport string
+	Attempt   int
+	RTT       time.Duration
+	FromCache bool
+	DNSSEC    ValidationStatus
+
+	Synthesized bool
+}
+
+// WithMeta fills in m when the lookup succeeds, m is zero after a failed
+// lookup or one answered by the system resolver.
+func WithMeta(m *LookupMeta) LookupOption {
+	return func(o *lookupOptions) {
+		o.meta = m
+	}
+}
@@ -0,0 +1,39 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestWithMeta(t *testing.T) {
+	r := New()
+	r.RetryLimit = 5
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2\n10.0.0.3")
+
+	var meta LookupMeta
+	var trace Trace
+	calls := 0
+	err := r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		if calls++; calls < 2 {
+			return errors.New(`connection refused`)
+		}
+		return nil
+	}, WithMeta(&meta), WithTrace(&trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last := trace.Attempts[len(trace.Attempts)-1]
+	if meta.Server != last.Server || meta.Attempt != 2 || meta.RTT != last.Duration || meta.Transport != `udp` || meta.FromCache {
+		t.Errorf(`unexpected meta %+v`, meta)
+	}
+
+	_ = r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		return &net.DNSError{Err: `no such host`, IsNotFound: true}
+	}, WithMeta(&meta))
+	if meta != (LookupMeta{}) {
+		t.Errorf(`expected empty meta after a failure, got %+v`, meta)
+	}
+}
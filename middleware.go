@@ -0,0 +1,63 @@
+package resolver
+
+import "context"
+
+// LookupRequest is what a Middleware sees of a lookup. Type is that of
+// LookupInfo.
+type LookupRequest struct {
+	Name string
+	Type string
+}
+
+// LookupFunc runs a lookup on the servers, all of its attempts included,
+// and returns the answer in the text form of the query log.
+type LookupFunc func(ctx context.Context, req LookupRequest) (answer string, err error)
+
+// Middleware wraps the lookups of a resolver: it is handed the next step
+// and returns the one to run in its place, which may change the context or
+// the name looked up, or the error returned.
+type Middleware func(next LookupFunc) LookupFunc
+
+// Use adds mw around every lookup made from then on, the middleware added
+// first runs outermost. It wraps the whole attempt loop of each name tried,
+// once per search candidate: it runs after the MaxInFlight gate and the
+// OnLookupStart hook, before the name checks, the routes and the servers,
+// and the fallbacks and the system resolver of NativeFirst and BypassNative
+// are not in it. The hooks, the query log and the stats see the name the
+// lookup was made for, the attempts go out for the name the middleware
+// passed on.
+func (r *Resolver) Use(mw Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.middleware = append(append([]Middleware(nil), r.middleware...), mw)
+}
+
+// chain runs the attempt loop inside the middleware.
+func (r *Resolver) chain(qtype, value string, fn func(ctx context.Context, addr, name string, s *Settings) error, o *lookupOptions, info *LookupInfo) error {
+	r.mu.Lock()
+	middleware := r.middleware
+	r.mu.Unlock()
+
+	if len(middleware) == 0 {
+		return r.run(qtype, value, fn, o, info)
+	}
+
+	next := func(ctx context.Context, req LookupRequest) (string, error) {
+		o.ctx = ctx
+		if err := r.run(qtype, req.Name, fn, o, info); err != nil {
+			return ``, err
+		}
+		if o.summary == nil {
+			return ``, nil
+		}
+		return o.summary(), nil
+	}
+	for i := len(middleware) - 1; i >= 0; i-- {
+		next = middleware[i](next)
+	}
+
+	_, err := next(o.ctx, LookupRequest{Name: value, Type: qtype})
+
+	return err
+}
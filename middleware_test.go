@@ -0,0 +1,89 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// logging is a middleware writing one line per lookup.
+func logging(lines *[]string) Middleware {
+	return func(next LookupFunc) LookupFunc {
+		return func(ctx context.Context, req LookupRequest) (string, error) {
+			answer, err := next(ctx, req)
+			*lines = append(*lines, fmt.Sprintf(`%s %s %q %v`, req.Type, req.Name, answer, err))
+			return answer, err
+		}
+	}
+}
+
+// rewrite is a middleware sending the names under from to the same names
+// under to.
+func rewrite(from, to string) Middleware {
+	return func(next LookupFunc) LookupFunc {
+		return func(ctx context.Context, req LookupRequest) (string, error) {
+			if strings.HasSuffix(req.Name, `.`+from) {
+				req.Name = strings.TrimSuffix(req.Name, from) + to
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	server := newTestServer(t, answerA(map[string]string{`api.canary.example.com`: `192.0.2.9`}))
+	r := New()
+	if _, err := r.LoadServersFromString(server.Addr); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	r.Use(logging(&lines))
+	r.Use(rewrite(`example.com`, `canary.example.com`))
+
+	ips, err := r.LookupIPAddr(`api.example.com`)
+	if err != nil || len(ips) != 1 || !ips[0].IP.Equal(net.ParseIP(`192.0.2.9`)) {
+		t.Fatalf(`expected the rewritten answer, got %v, %v`, ips, err)
+	}
+	if len(lines) != 1 || lines[0] != `IP api.example.com "192.0.2.9" <nil>` {
+		t.Errorf(`unexpected log %q`, lines)
+	}
+	for _, q := range server.Queries() {
+		if !strings.HasPrefix(q.Name, `api.canary.`) {
+			t.Errorf(`expected the rewritten name at the server, got %s`, q.Name)
+		}
+	}
+}
+
+func TestMiddlewareWrapsRetries(t *testing.T) {
+	r := New()
+	r.RetryLimit = 3
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2\n10.0.0.3\n10.0.0.4")
+
+	var order []string
+	for _, name := range []string{`outer`, `inner`} {
+		name := name
+		r.Use(func(next LookupFunc) LookupFunc {
+			return func(ctx context.Context, req LookupRequest) (string, error) {
+				order = append(order, name)
+				return next(ctx, req)
+			}
+		})
+	}
+
+	attempts := 0
+	err := r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		attempts++
+		return errors.New(`i/o timeout`)
+	})
+	if !errors.Is(err, ErrRetryLimit) || attempts != 3 {
+		t.Errorf(`expected three attempts, got %d, %v`, attempts, err)
+	}
+	if strings.Join(order, ` `) != `outer inner` {
+		t.Errorf(`expected each middleware once in order, got %v`, order)
+	}
+}
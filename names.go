@@ -0,0 +1,374 @@
+package resolver
+
+import (
+	"errors"
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidHost  = errors.New(`resolver: invalid host name`)
+	ErrInvalidAddr  = errors.New(`resolver: invalid address`)
+	ErrPublicSuffix = errors.New(`resolver: name is a public suffix`)
+)
+
+const (
+	maxNameLength  = 253
+	maxLabelLength = 63
+)
+
+// InvalidHostError is the reason of a lookup for a name that was rejected
+// before any query was sent, it matches ErrInvalidHost.
+type InvalidHostError struct {
+	Host   string
+	Reason string
+}
+
+func (e *InvalidHostError) Error() string {
+	return ErrInvalidHost.Error() + ` ` + strconv.Quote(e.Host) + `: ` + e.Reason
+}
+
+func (e *InvalidHostError) Is(target error) bool {
+	return target == ErrInvalidHost
+}
+
+func (e *InvalidHostError) Timeout() bool {
+	return false
+}
+
+func (e *InvalidHostError) Temporary() bool {
+	return false
+}
+
+// IDNAError is the reason of a lookup for a name with a label IDNA2008 has
+// no A-label for, a bidi violation or a disallowed character. It matches
+// ErrInvalidHost and unwraps to the error of the conversion.
+type IDNAError struct {
+	Host  string
+	Label string
+	Err   error
+}
+
+func (e *IDNAError) Error() string {
+	return ErrInvalidHost.Error() + ` ` + strconv.Quote(e.Host) + `: label ` + strconv.Quote(e.Label) + `: ` + e.Err.Error()
+}
+
+func (e *IDNAError) Is(target error) bool {
+	return target == ErrInvalidHost
+}
+
+func (e *IDNAError) Unwrap() error {
+	return e.Err
+}
+
+func (e *IDNAError) Timeout() bool {
+	return false
+}
+
+func (e *IDNAError) Temporary() bool {
+	return false
+}
+
+// InvalidAddrError is the reason of a reverse lookup for an address that
+// was rejected before any query was sent, it matches ErrInvalidAddr.
+type InvalidAddrError struct {
+	Addr   string
+	Reason string
+}
+
+func (e *InvalidAddrError) Error() string {
+	return ErrInvalidAddr.Error() + ` ` + strconv.Quote(e.Addr) + `: ` + e.Reason
+}
+
+func (e *InvalidAddrError) Is(target error) bool {
+	return target == ErrInvalidAddr
+}
+
+func (e *InvalidAddrError) Timeout() bool {
+	return false
+}
+
+func (e *InvalidAddrError) Temporary() bool {
+	return false
+}
+
+// validateName checks name against the limits of RFC 1035, letters, digits,
+// hyphens and underscores only, so service names like _sip._udp pass. IP
+// literals are accepted, the lookups answer them without a query.
+func validateName(name string) error {
+	invalid := func(reason string) error {
+		return &InvalidHostError{Host: name, Reason: reason}
+	}
+
+	if name == `` {
+		return invalid(`empty name`)
+	}
+	if strings.Contains(name, `://`) {
+		return invalid(`looks like a URL, pass only its host`)
+	}
+	// IPv4 literals pass as names, only IPv6 ones need parsing
+	if strings.IndexByte(name, ':') >= 0 && net.ParseIP(name) != nil {
+		return nil
+	}
+
+	n := strings.TrimSuffix(name, `.`)
+	if n == `` {
+		return invalid(`empty name`)
+	}
+	if len(n) > maxNameLength {
+		return invalid(`longer than ` + strconv.Itoa(maxNameLength) + ` characters`)
+	}
+
+	for len(n) > 0 {
+		label := n
+		if i := strings.IndexByte(n, '.'); i >= 0 {
+			label, n = n[:i], n[i+1:]
+			if n == `` {
+				return invalid(`empty label`)
+			}
+		} else {
+			n = ``
+		}
+
+		if label == `` {
+			return invalid(`empty label`)
+		}
+		if len(label) > maxLabelLength {
+			return invalid(`label longer than ` + strconv.Itoa(maxLabelLength) + ` characters`)
+		}
+
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' {
+				continue
+			}
+			if c >= 0x80 {
+				return invalid(`non-ASCII label, convert it to punycode`)
+			}
+			return invalid(`character ` + strconv.QuoteRune(rune(c)) + ` not allowed`)
+		}
+	}
+
+	return nil
+}
+
+// idnaDots are the dots UTS #46 separates labels with besides the ASCII one.
+var idnaDots = strings.NewReplacer("\u3002", `.`, "\uff0e", `.`, "\uff61", `.`)
+
+// toASCII converts the labels of name with other than ASCII characters to
+// A-labels, with the lookup profile of IDNA2008 and UTS #46. The ASCII
+// labels are left as they are, punycode or service names like _sip alike.
+func toASCII(name string) (string, error) {
+	if isASCII(name) {
+		return name, nil
+	}
+
+	labels := strings.Split(idnaDots.Replace(name), `.`)
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		a, err := idna.Lookup.ToASCII(label)
+		if err != nil {
+			return ``, &IDNAError{Host: name, Label: label, Err: err}
+		}
+		labels[i] = a
+	}
+
+	return strings.Join(labels, `.`), nil
+}
+
+// hostName is the name a lookup of qtype asks for: host with its labels
+// converted by toASCII, unless DisableIDNA is set, and normalized by
+// nameKey. A label without an A-label fails the lookup with an *IDNAError.
+// The options returned are opts, for a host ending in a dot marked so.
+func (r *Resolver) hostName(qtype, host string, opts []LookupOption) (string, []LookupOption, error) {
+	if strings.HasSuffix(host, `.`) {
+		opts = append(opts[:len(opts):len(opts)], withAbsolute())
+	}
+	if isASCII(host) || r.lookupOptions(opts).settings.DisableIDNA {
+		return nameKey(host), opts, nil
+	}
+
+	name, err := toASCII(host)
+	if err != nil {
+		return ``, nil, &LookupError{Name: nameKey(host), Type: qtype, Err: err}
+	}
+
+	return nameKey(name), opts, nil
+}
+
+// WithALabels fills in names with the names DecodeIDN converted to Unicode
+// in the results of the lookup, keyed by the decoded name, so that callers
+// wary of homographs can still see the A-labels the server sent.
+func WithALabels(names map[string]string) LookupOption {
+	return func(o *lookupOptions) {
+		o.alabels = names
+	}
+}
+
+// decodeIDN returns name with its A-labels converted back to U-labels, with
+// the registration profile of IDNA2008, when DecodeIDN is set. A label that
+// does not convert back to itself is left as it is.
+func (o *lookupOptions) decodeIDN(name string) string {
+	if !o.settings.DecodeIDN || !strings.Contains(strings.ToLower(name), `xn--`) {
+		return name
+	}
+
+	labels := strings.Split(name, `.`)
+	for i, label := range labels {
+		if len(label) < 4 || !strings.EqualFold(label[:4], `xn--`) {
+			continue
+		}
+		u, err := idna.Registration.ToUnicode(label)
+		if err != nil {
+			continue
+		}
+		if a, err := idna.Registration.ToASCII(u); err != nil || a != strings.ToLower(label) {
+			continue
+		}
+		labels[i] = u
+	}
+
+	decoded := strings.Join(labels, `.`)
+	if decoded != name && o.alabels != nil {
+		o.alabels[decoded] = name
+	}
+
+	return decoded
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
+
+// fqdn roots name so the stdlib does not try it with search domains, IP
+// literals and empty names are left alone.
+func fqdn(name string) string {
+	if name == `` || strings.HasSuffix(name, `.`) || net.ParseIP(name) != nil {
+		return name
+	}
+
+	return name + `.`
+}
+
+// reverseName returns the in-addr.arpa or ip6.arpa name of ip, or ip itself
+// when it is not an address.
+func reverseName(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+
+	return reverseIP(addr.AsSlice())
+}
+
+// reverseIP returns the in-addr.arpa or ip6.arpa name of a valid ip, an
+// IPv4-mapped one being IPv4.
+func reverseIP(ip net.IP) string {
+	var b strings.Builder
+	if v4 := ip.To4(); v4 != nil {
+		for i := len(v4) - 1; i >= 0; i-- {
+			b.WriteString(strconv.Itoa(int(v4[i])))
+			b.WriteByte('.')
+		}
+		b.WriteString(`in-addr.arpa.`)
+
+		return b.String()
+	}
+
+	const hex = `0123456789abcdef`
+	for i := len(ip) - 1; i >= 0; i-- {
+		b.WriteByte(hex[ip[i]&0xf])
+		b.WriteByte('.')
+		b.WriteByte(hex[ip[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString(`ip6.arpa.`)
+
+	return b.String()
+}
+
+// checkAddr rejects the addresses there is no reverse lookup for.
+func checkAddr(ip net.IP) error {
+	switch {
+	case len(ip) != net.IPv4len && len(ip) != net.IPv6len:
+		return &InvalidAddrError{Addr: ip.String(), Reason: `not an IPv4 or IPv6 address`}
+	case ip.IsUnspecified():
+		return &InvalidAddrError{Addr: ip.String(), Reason: `unspecified address`}
+	}
+
+	return nil
+}
+
+// nameKey is the normalized form of a name: lowercase, without the trailing
+// dot.
+func nameKey(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, `.`))
+}
+
+// PublicSuffixError is a host RegistrableDomain has no registrable domain
+// for, as it is a public suffix itself, it matches ErrPublicSuffix.
+type PublicSuffixError struct {
+	Host string
+}
+
+func (e *PublicSuffixError) Error() string {
+	return ErrPublicSuffix.Error() + `: ` + e.Host
+}
+
+func (e *PublicSuffixError) Is(target error) bool {
+	return target == ErrPublicSuffix
+}
+
+// RegistrableDomain returns the registrable domain of host, its public
+// suffix plus one label: bar.co.uk for foo.bar.co.uk. The suffixes are those
+// of the list of golang.org/x/net/publicsuffix, the private section as well,
+// so that foo.github.io is one of its own, with the wildcard and exception
+// rules of it, and a TLD not on the list is a suffix. A host that is itself
+// a public suffix, co.uk or github.io, fails with a *PublicSuffixError, a
+// malformed one or an IP address with an *InvalidHostError. The domain is
+// lowercase, without the trailing dot, in A-labels.
+func RegistrableDomain(host string) (string, error) {
+	name, err := toASCII(nameKey(host))
+	if err != nil {
+		return ``, err
+	}
+	if err := validateName(name); err != nil {
+		return ``, err
+	}
+	if net.ParseIP(name) != nil {
+		return ``, &InvalidHostError{Host: name, Reason: `an address has no registrable domain`}
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(name)
+	if err != nil {
+		return ``, &PublicSuffixError{Host: name}
+	}
+
+	return domain, nil
+}
+
+// registrableDomain is RegistrableDomain for the grouping of names by
+// domain, which takes any name: it is name itself when there is no
+// registrable domain.
+func registrableDomain(name string) string {
+	name = nameKey(name)
+	domain, err := publicsuffix.EffectiveTLDPlusOne(name)
+	if err != nil {
+		return name
+	}
+
+	return domain
+}
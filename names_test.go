@@ -0,0 +1,368 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestReverseName(t *testing.T) {
+	tests := map[string]string{
+		`192.0.2.1`:   `1.2.0.192.in-addr.arpa.`,
+		`2001:db8::1`: `1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.`,
+		`example.com`: `example.com`,
+	}
+
+	for ip, want := range tests {
+		if got := reverseName(ip); got != want {
+			t.Errorf(`%s: got %s, want %s`, ip, got, want)
+		}
+	}
+	if got, want := reverseName(`fe80::1%eth0`), reverseName(`fe80::1`); got != want {
+		t.Errorf(`expected the zone left out, got %s, want %s`, got, want)
+	}
+}
+
+func TestLookupAddrIP(t *testing.T) {
+	ts := newTestServer(t, func(q Question, resp *Message) {
+		if q.Type == TypePTR && q.Name == `1.2.0.192.in-addr.arpa.` {
+			resp.Answers = append(resp.Answers, RR{Name: q.Name, Type: TypePTR, TTL: 60, Target: `host.example.com.`})
+			return
+		}
+		resp.Rcode = RcodeNameError
+	})
+
+	r := New()
+	if _, err := r.LoadServersFromString(ts.Addr); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ip := range []net.IP{net.ParseIP(`192.0.2.1`), net.ParseIP(`::ffff:192.0.2.1`), net.IPv4(192, 0, 2, 1).To4()} {
+		names, err := r.LookupAddrIP(ip)
+		if err != nil || len(names) != 1 || names[0] != `host.example.com` {
+			t.Errorf(`%v: unexpected names %v, %v`, ip, names, err)
+		}
+	}
+
+	for _, ip := range []net.IP{nil, {1, 2, 3}, net.IPv4zero, net.IPv6unspecified} {
+		var invalid *InvalidAddrError
+		if _, err := r.LookupAddrIP(ip); !errors.As(err, &invalid) || !errors.Is(err, ErrInvalidAddr) {
+			t.Errorf(`%v: expected an *InvalidAddrError, got %v`, ip, err)
+		}
+	}
+	for _, ip := range []netip.Addr{netip.MustParseAddr(`192.0.2.1`), netip.MustParseAddr(`::ffff:192.0.2.1`)} {
+		names, err := r.LookupAddrNetIP(ip)
+		if err != nil || len(names) != 1 || names[0] != `host.example.com` {
+			t.Errorf(`%v: unexpected names %v, %v`, ip, names, err)
+		}
+	}
+	if _, err := r.LookupAddrNetIP(netip.Addr{}); !errors.Is(err, ErrInvalidAddr) {
+		t.Errorf(`expected ErrInvalidAddr for the zero address, got %v`, err)
+	}
+
+	for _, ip := range []string{`::ffff:192.0.2.1`, `192.0.2.1`} {
+		if names, err := r.LookupAddr(ip); err != nil || len(names) != 1 {
+			t.Errorf(`%s: unexpected names %v, %v`, ip, names, err)
+		}
+	}
+	if _, err := r.LookupAddr(`example.com`); !errors.Is(err, ErrInvalidAddr) {
+		t.Errorf(`expected ErrInvalidAddr for a name, got %v`, err)
+	}
+	if n := len(ts.Queries()); n != 7 {
+		t.Errorf(`expected a query per valid address, got %d`, n)
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	valid := []string{
+		`example.com`, `example.com.`, `_sip._udp.example.com`, `xn--80ak6aa92e.com`,
+		`localhost`, `192.0.2.1`, `2001:db8::1`, strings.Repeat(`a`, 63) + `.com`,
+	}
+	for _, name := range valid {
+		if err := validateName(name); err != nil {
+			t.Errorf(`%s: %v`, name, err)
+		}
+	}
+
+	invalid := []string{
+		``, `.`, `https://example.com`, `exa mple.com`, `example..com`, `.example.com`,
+		strings.Repeat(`a`, 64) + `.com`, strings.Repeat(`abcdefgh.`, 29) + `com`, `пример.рф`, `example.com/path`,
+	}
+	for _, name := range invalid {
+		err := validateName(name)
+		var invalidErr *InvalidHostError
+		if !errors.As(err, &invalidErr) || invalidErr.Host != name || !errors.Is(err, ErrInvalidHost) {
+			t.Errorf(`%q: expected InvalidHostError, got %v`, name, err)
+		}
+	}
+}
+
+func TestInvalidNameNotQueried(t *testing.T) {
+	r := New()
+	r.MaxFails = 1
+	_, _ = r.LoadServersFromString(`10.0.0.1`)
+
+	err := r.lookup(`A`, `https://example.com/`, func(*net.Resolver) error {
+		t.Error(`invalid name sent to a server`)
+		return nil
+	})
+	if !errors.Is(err, ErrInvalidHost) || !strings.Contains(err.Error(), `URL`) {
+		t.Errorf(`expected ErrInvalidHost, got %v`, err)
+	}
+	if len(r.health.servers) != 0 {
+		t.Error(`server list touched by an invalid name`)
+	}
+
+	r.RelaxedNames = true
+	calls := 0
+	_ = r.lookup(`A`, `weird name`, func(*net.Resolver) error { calls++; return nil })
+	if calls != 1 {
+		t.Error(`relaxed names should be sent`)
+	}
+}
+
+// answerMixedCase answers every type for example.com with mixed case, dotted
+// names and fails the test for queries not lowercased and rooted.
+func answerMixedCase(t *testing.T) func(q Question, resp *Message) {
+	return func(q Question, resp *Message) {
+		switch q.Name {
+		case `example.com.`, `1.2.0.192.in-addr.arpa.`:
+		case `nx.example.com.`:
+			resp.Rcode = RcodeNameError
+			return
+		default:
+			t.Errorf(`unexpected query name %q`, q.Name)
+			resp.Rcode = RcodeNameError
+			return
+		}
+
+		rr := RR{Name: q.Name, Type: q.Type, TTL: 60}
+		switch q.Type {
+		case TypeA, TypeAAAA, TypeCNAME:
+			// the stdlib reads the CNAME of its address queries too
+			resp.Answers = append(resp.Answers, RR{Name: q.Name, Type: TypeCNAME, TTL: 60, Target: `NS1.Example.COM.`})
+			if q.Type != TypeA {
+				return
+			}
+			rr.Name, rr.IP = `NS1.Example.COM.`, net.ParseIP(`192.0.2.1`)
+		case TypeMX:
+			rr.Pref, rr.Target = 10, `Mail.Example.COM.`
+		case TypeNS, TypePTR:
+			rr.Target = `NS1.Example.COM.`
+		case TypeTXT:
+			rr.Text = []string{`Hello`}
+		default:
+			return
+		}
+		resp.Answers = append(resp.Answers, rr)
+	}
+}
+
+func TestNameNormalization(t *testing.T) {
+	server := newTestServer(t, answerMixedCase(t))
+
+	r := New()
+	r.RetryLimit = 1
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	for _, host := range []string{`example.com`, `example.com.`, `ExAmple.COM.`} {
+		if ips, err := r.LookupIPAddr(host); err != nil || len(ips) != 1 {
+			t.Errorf(`%s: ip %v %v`, host, ips, err)
+		}
+		if mx, err := r.LookupMX(host); err != nil || len(mx) != 1 || mx[0].Host != `mail.example.com` {
+			t.Errorf(`%s: mx %v %v`, host, mx, err)
+		}
+		if ns, err := r.LookupNS(host); err != nil || len(ns) != 1 || ns[0].Host != `ns1.example.com` {
+			t.Errorf(`%s: ns %v %v`, host, ns, err)
+		}
+		if cname, err := r.LookupCNAME(host); err != nil || cname != `ns1.example.com` {
+			t.Errorf(`%s: cname %q %v`, host, cname, err)
+		}
+		if txt, err := r.LookupTXT(host); err != nil || len(txt) != 1 || txt[0] != `Hello` {
+			t.Errorf(`%s: txt %v %v`, host, txt, err)
+		}
+	}
+
+	if names, err := r.LookupAddr(`192.0.2.1`); err != nil || len(names) != 1 || names[0] != `ns1.example.com` {
+		t.Errorf(`ptr %v %v`, names, err)
+	}
+
+	var lookupErr *LookupError
+	if _, err := r.LookupIPAddr(`NX.Example.com.`); !errors.As(err, &lookupErr) || lookupErr.Name != `nx.example.com` {
+		t.Errorf(`unexpected error %v`, err)
+	}
+}
+
+func TestRawNames(t *testing.T) {
+	server := newTestServer(t, answerMixedCase(t))
+
+	r := New()
+	r.RetryLimit = 1
+	r.RawNames = true
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	if mx, err := r.LookupMX(`Example.com`); err != nil || len(mx) != 1 || mx[0].Host != `Mail.Example.COM.` {
+		t.Errorf(`mx %v %v`, mx, err)
+	}
+	if names, err := r.LookupAddr(`192.0.2.1`); err != nil || len(names) != 1 || names[0] != `NS1.Example.COM.` {
+		t.Errorf(`ptr %v %v`, names, err)
+	}
+}
+
+func TestToASCII(t *testing.T) {
+	tests := map[string]string{
+		`bücher.example`:           `xn--bcher-kva.example`,
+		`BÜCHER.example.`:          `xn--bcher-kva.example.`,
+		`пример.рф`:                `xn--e1afmkfd.xn--p1ai`,
+		`bücher.пример.рф`:         `xn--bcher-kva.xn--e1afmkfd.xn--p1ai`,
+		`pаypal.com`:               `xn--pypal-4ve.com`, // a Cyrillic а between Latin letters
+		`例え。テスト`:                   `xn--r8jz45g.xn--zckzah`,
+		`_sip._tcp.bücher.example`: `_sip._tcp.xn--bcher-kva.example`,
+		`xn--bcher-kva.example`:    `xn--bcher-kva.example`,
+		`Example.COM`:              `Example.COM`,
+	}
+	for name, want := range tests {
+		if got, err := toASCII(name); err != nil || got != want {
+			t.Errorf(`%s: expected %s, got %s, %v`, name, want, got, err)
+		}
+	}
+
+	// a right-to-left letter between left-to-right ones, a joiner out of
+	// place and a disallowed character
+	for _, name := range []string{"a\u05d0b.example", "x\u200dy.example", "\ufffd.example"} {
+		_, err := toASCII(name)
+		var idnaErr *IDNAError
+		if !errors.As(err, &idnaErr) || idnaErr.Host != name || !errors.Is(err, ErrInvalidHost) {
+			t.Errorf(`%q: expected an IDNAError, got %v`, name, err)
+		}
+	}
+}
+
+func TestLookupIDN(t *testing.T) {
+	ts := newTestServer(t, answerA(map[string]string{`xn--bcher-kva.example`: `192.0.2.1`}))
+
+	r := New()
+	r.RetryLimit = 1
+	if _, err := r.LoadServersFromString(ts.Addr); err != nil {
+		t.Fatal(err)
+	}
+
+	if ips, err := r.LookupIPAddr(`bücher.example`); err != nil || len(ips) != 1 {
+		t.Errorf(`expected the address of the A-label, got %v, %v`, ips, err)
+	}
+	if m, err := r.Query(context.Background(), `BÜCHER.example`, TypeA); err != nil || len(m.Answers) != 1 {
+		t.Errorf(`expected the address of the A-label, got %+v, %v`, m, err)
+	}
+
+	before := len(ts.Queries())
+	_, err := r.LookupIPAddr("a\u05d0b.example")
+	var lookupErr *LookupError
+	if !errors.As(err, &lookupErr) || lookupErr.Name != "a\u05d0b.example" || !errors.Is(err, ErrInvalidHost) {
+		t.Errorf(`expected a LookupError for the bidi violation, got %v`, err)
+	}
+	if len(ts.Queries()) != before {
+		t.Error(`a name without an A-label was sent`)
+	}
+
+	r.DisableIDNA = true
+	if _, err := r.LookupIPAddr(`bücher.example`); !errors.Is(err, ErrInvalidHost) || !strings.Contains(err.Error(), `punycode`) {
+		t.Errorf(`expected the Unicode name rejected as it is, got %v`, err)
+	}
+	for _, q := range ts.Queries() {
+		if !isASCII(q.Name) {
+			t.Errorf(`unexpected query name %q`, q.Name)
+		}
+	}
+}
+
+func TestDecodeIDN(t *testing.T) {
+	ts := newTestServer(t, func(q Question, resp *Message) {
+		rr := RR{Name: q.Name, Type: q.Type, TTL: 60}
+		switch q.Type {
+		case TypeCNAME:
+			rr.Target = `www.xn--bcher-kva.example.`
+		case TypeMX:
+			resp.Answers = append(resp.Answers, RR{Name: q.Name, Type: TypeMX, TTL: 60, Pref: 20, Target: `mx.example.com.`})
+			rr.Pref, rr.Target = 10, `mail.xn--e1afmkfd.xn--p1ai.`
+		case TypeNS:
+			// not punycode at all, kept as it is
+			rr.Target = `xn--ab.example.`
+		case TypePTR:
+			rr.Target = `host.xn--r8jz45g.xn--zckzah.`
+		default:
+			return
+		}
+		resp.Answers = append(resp.Answers, rr)
+	})
+
+	r := New()
+	r.RetryLimit = 1
+	if _, err := r.LoadServersFromString(ts.Addr); err != nil {
+		t.Fatal(err)
+	}
+
+	if cname, err := r.LookupCNAME(`alias.example`); err != nil || cname != `www.xn--bcher-kva.example` {
+		t.Errorf(`expected the A-labels without DecodeIDN, got %s, %v`, cname, err)
+	}
+
+	r.DecodeIDN = true
+	alabels := make(map[string]string)
+	if cname, err := r.LookupCNAME(`alias.example`, WithALabels(alabels)); err != nil || cname != `www.bücher.example` {
+		t.Errorf(`expected the U-labels, got %s, %v`, cname, err)
+	}
+	if alabels[`www.bücher.example`] != `www.xn--bcher-kva.example` {
+		t.Errorf(`expected the A-label form kept, got %v`, alabels)
+	}
+
+	mxList, err := r.LookupMX(`example`)
+	if err != nil || len(mxList) != 2 || mxList[0].Host != `mail.пример.рф` || mxList[1].Host != `mx.example.com` {
+		t.Errorf(`expected the IDN host decoded and the other left alone, got %+v, %v`, mxList, err)
+	}
+
+	if nsList, err := r.LookupNS(`example`); err != nil || len(nsList) != 1 || nsList[0].Host != `xn--ab.example` {
+		t.Errorf(`expected an A-label that does not round-trip left as it is, got %+v, %v`, nsList, err)
+	}
+
+	if names, err := r.LookupAddr(`192.0.2.1`); err != nil || len(names) != 1 || names[0] != `host.例え.テスト` {
+		t.Errorf(`expected the PTR name decoded, got %v, %v`, names, err)
+	}
+
+	r.DecodeIDN = false
+	cname, err := r.LookupCNAME(`alias.example`, WithSettings(func(s *Settings) { s.DecodeIDN = true }))
+	if err != nil || cname != `www.bücher.example` {
+		t.Errorf(`expected the U-labels for the lookup only, got %s, %v`, cname, err)
+	}
+}
+
+func TestRegistrableDomainRules(t *testing.T) {
+	for host, want := range map[string]string{
+		`foo.bar.co.uk`:         `bar.co.uk`,
+		`WWW.Example.COM.`:      `example.com`,
+		`a.b.foo.ck`:            `b.foo.ck`,
+		`www.ck`:                `www.ck`,
+		`a.www.ck`:              `www.ck`,
+		`x.city.kawasaki.jp`:    `city.kawasaki.jp`,
+		`x.y.other.kawasaki.jp`: `y.other.kawasaki.jp`,
+		`a.b.github.io`:         `b.github.io`,
+		`host.corp.internal`:    `corp.internal`,
+		"w.b\u00fccher.example": `xn--bcher-kva.example`,
+	} {
+		if got, err := RegistrableDomain(host); err != nil || got != want {
+			t.Errorf(`%s: expected %s, got %q, %v`, host, want, got, err)
+		}
+	}
+
+	for _, host := range []string{`co.uk`, `com`, `github.io`, `foo.ck`, `other.kawasaki.jp`} {
+		if got, err := RegistrableDomain(host); !errors.Is(err, ErrPublicSuffix) {
+			t.Errorf(`%s: expected ErrPublicSuffix, got %q, %v`, host, got, err)
+		}
+	}
+	for _, host := range []string{``, `a..example.com`, `192.0.2.1`, `2001:db8::1`} {
+		if got, err := RegistrableDomain(host); !errors.Is(err, ErrInvalidHost) {
+			t.Errorf(`%q: expected ErrInvalidHost, got %q, %v`, host, got, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AsNetResolver returns a stdlib resolver whose every connection goes to
+// the next server of r, for code taking only a *net.Resolver. A connection
+// counts as a success for its server once an answer has been read on it and
+// as a failure when the dial or a read fails, a timeout included. The dial
+// takes DialTimeout and a slot under MaxConcurrentPerServer.
+//
+// It is not as faithful as the lookups of r: the stdlib retries on the
+// connection it has, not on another server, routes and tag selectors are
+// left aside, and filtered answers and bogons are not looked at. Queries
+// for names blocked by the domain policy fail on the write.
+func (r *Resolver) AsNetResolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return r.dialServer(ctx, network)
+		},
+	}
+}
+
+func (r *Resolver) dialServer(ctx context.Context, network string) (net.Conn, error) {
+	if atomic.LoadInt32(&r.closed) != 0 {
+		return nil, ErrResolverClosed
+	}
+	if atomic.LoadInt32(&r.begun) == 0 {
+		atomic.StoreInt32(&r.begun, 1)
+	}
+
+	o := r.lookupOptions([]LookupOption{WithContext(ctx)})
+	pool := r.Servers
+	server, err := r.reserveServer(pool, ``, nil, o)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &net.Dialer{Timeout: o.settings.DialTimeout}
+	if o.settings.DisableKeepAlive {
+		d.KeepAlive = -1
+	}
+	conn, err := d.DialContext(ctx, network, serverAddress(server.Addr))
+	if err != nil {
+		r.slots.release(server.Addr)
+		if ctx.Err() == nil {
+			r.markBad(pool, server, o, err)
+		}
+		return nil, err
+	}
+
+	c := &serverConn{Conn: conn, r: r, ctx: ctx, pool: pool, server: server, o: o, start: time.Now()}
+	if pc, ok := conn.(net.PacketConn); ok {
+		// the stdlib frames its queries by whether the conn is a PacketConn
+		return &serverPacketConn{serverConn: c, pc: pc}, nil
+	}
+	c.stream = true
+
+	return c, nil
+}
+
+// serverConn reports the fate of the first answer read on it to the health
+// of its server, and gives back the server slot once closed.
+type serverConn struct {
+	net.Conn
+	r        *Resolver
+	ctx      context.Context
+	pool     ServerList
+	server   *Server
+	o        *lookupOptions
+	start    time.Time
+	stream   bool // queries have a length prefix
+	reported sync.Once
+	closed   sync.Once
+}
+
+func (c *serverConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if c.ctx.Err() == nil {
+		c.reported.Do(func() {
+			if err == nil {
+				c.r.markGood(c.pool, c.server, c.o, time.Since(c.start))
+			} else {
+				c.r.markBad(c.pool, c.server, c.o, err)
+			}
+		})
+	}
+
+	return n, err
+}
+
+// Write refuses the queries for names blocked by the domain policy.
+func (c *serverConn) Write(b []byte) (int, error) {
+	if p, _ := c.r.domainPolicy.Load().(*domainPolicy); p != nil {
+		msg := b
+		if c.stream && len(msg) > 2 {
+			msg = msg[2:]
+		}
+		var q Message
+		if q.Unpack(msg) == nil && len(q.Questions) > 0 {
+			if err := c.r.checkDomain(q.Questions[0].Name); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return c.Conn.Write(b)
+}
+
+func (c *serverConn) Close() error {
+	c.closed.Do(func() { c.r.slots.release(c.server.Addr) })
+
+	return c.Conn.Close()
+}
+
+type serverPacketConn struct {
+	*serverConn
+	pc net.PacketConn
+}
+
+func (c *serverPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	return c.pc.ReadFrom(b)
+}
+
+func (c *serverPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return c.pc.WriteTo(b, addr)
+}
@@ -0,0 +1,71 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAsNetResolver(t *testing.T) {
+	server := newTestServer(t, answerA(map[string]string{`example.com`: `192.0.2.7`}))
+
+	r := New()
+	r.DialTimeout = time.Second
+	if _, err := r.LoadServersFromString(server.Addr); err != nil {
+		t.Fatal(err)
+	}
+
+	ips, err := r.AsNetResolver().LookupIPAddr(context.Background(), `example.com`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, ip := range ips {
+		found = found || ip.IP.Equal(net.ParseIP(`192.0.2.7`))
+	}
+	if !found {
+		t.Errorf(`expected 192.0.2.7, got %v`, ips)
+	}
+	if len(server.Queries()) == 0 {
+		t.Error(`expected the queries to reach the test server`)
+	}
+
+	stats := r.ServerStats()
+	if len(stats) != 1 || stats[0].Successes == 0 || stats[0].Failures != 0 {
+		t.Errorf(`expected successes only, got %+v`, stats)
+	}
+	if n := r.slots.snapshot()[server.Addr]; n != 0 {
+		t.Errorf(`expected the slots given back, got %d`, n)
+	}
+}
+
+func TestAsNetResolverFailure(t *testing.T) {
+	conn, err := net.ListenPacket(`udp`, `127.0.0.1:0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := conn.LocalAddr().String()
+	conn.Close()
+
+	r := New()
+	if _, err := r.LoadServersFromString(dead); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	if _, err := r.AsNetResolver().LookupIPAddr(ctx, `example.com`); err == nil {
+		t.Fatal(`expected the lookup to fail`)
+	}
+
+	stats := r.ServerStats()
+	if len(stats) != 1 || stats[0].Failures == 0 {
+		t.Errorf(`expected a failure, got %+v`, stats)
+	}
+
+	r.Close()
+	if _, err := r.dialServer(context.Background(), `udp`); err != ErrResolverClosed {
+		t.Errorf(`expected ErrResolverClosed, got %v`, err)
+	}
+}
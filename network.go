@@ -0,0 +1,159 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrNetworkDown = errors.New(`resolver: network is down`)
+
+// DefaultConnectivityProbes are anycast resolvers asked to tell when the
+// network is back after an outage.
+var DefaultConnectivityProbes = []string{`1.1.1.1`, `8.8.8.8`, `9.9.9.9`}
+
+// NetworkDownError is the reason of lookups failed fast while the resolver
+// waits for connectivity, it matches ErrNetworkDown.
+type NetworkDownError struct {
+	Since time.Time
+}
+
+func (e *NetworkDownError) Error() string {
+	return ErrNetworkDown.Error() + ` since ` + e.Since.Format(time.RFC3339)
+}
+
+func (e *NetworkDownError) Is(target error) bool {
+	return target == ErrNetworkDown
+}
+
+func (e *NetworkDownError) Timeout() bool {
+	return false
+}
+
+func (e *NetworkDownError) Temporary() bool {
+	return true
+}
+
+// networkState tells a local outage from failing servers: when distinct
+// servers keep failing at transport level within a short window and none
+// answers, the network is considered down. Server failures are not counted
+// then and lookups fail fast until a connectivity probe gets an answer.
+type networkState struct {
+	failed map[string]time.Time
+	down   bool
+	since  time.Time
+	mu     sync.Mutex
+}
+
+func newNetworkState() *networkState {
+	return &networkState{failed: make(map[string]time.Time)}
+}
+
+func (n *networkState) isDown() (bool, time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.down, n.since
+}
+
+func (n *networkState) success() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if len(n.failed) > 0 {
+		n.failed = make(map[string]time.Time)
+	}
+}
+
+// failure records a transport failure of addr and reports whether it takes
+// the network down.
+func (n *networkState) failure(addr string, s *Settings, now time.Time) bool {
+	if s.NetworkDownServers <= 0 {
+		return false
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.down {
+		return false
+	}
+
+	n.failed[addr] = now
+	for a, at := range n.failed {
+		if now.Sub(at) > s.NetworkDownWindow {
+			delete(n.failed, a)
+		}
+	}
+
+	if len(n.failed) < s.NetworkDownServers {
+		return false
+	}
+
+	n.down = true
+	n.since = now
+	n.failed = make(map[string]time.Time)
+
+	return true
+}
+
+func (n *networkState) up() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.down = false
+}
+
+// networkFailure accounts a transport failure and starts waiting for the
+// network when it is the one that takes it down.
+func (r *Resolver) networkFailure(addr string, s *Settings) {
+	if !r.network.failure(addr, s, time.Now()) {
+		return
+	}
+
+	if s.Logger != nil {
+		s.Logger.Warn(`resolver: network down`, `server`, addr)
+	}
+	if s.OnNetworkChange != nil {
+		s.OnNetworkChange(true)
+	}
+
+	go r.awaitNetwork()
+}
+
+// awaitNetwork asks the connectivity probes in turn until one of them
+// answers, any response will do.
+func (r *Resolver) awaitNetwork() {
+	for i := 0; ; i++ {
+		s := r.settings()
+
+		probes := s.ConnectivityProbes
+		if len(probes) == 0 {
+			probes = DefaultConnectivityProbes
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+		_, err := r.exchange(ctx, probes[i%len(probes)], newQuery(`.`, TypeNS))
+		cancel()
+
+		if err == nil {
+			r.network.up()
+			if s.Logger != nil {
+				s.Logger.Info(`resolver: network up`, `probe`, probes[i%len(probes)])
+			}
+			if s.OnNetworkChange != nil {
+				s.OnNetworkChange(false)
+			}
+			return
+		}
+
+		t := time.NewTimer(s.ConnectivityInterval)
+		select {
+		case <-t.C:
+		case <-r.done:
+			t.Stop()
+			return
+		}
+	}
+}
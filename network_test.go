@@ -0,0 +1,104 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNetworkDown(t *testing.T) {
+	up := make(chan struct{})
+	probe := newTestServer(t, func(q Question, resp *Message) { <-up })
+
+	var mu sync.Mutex
+	var changes []bool
+
+	r := New()
+	r.RetryLimit = 10
+	r.RetrySleep = 0
+	r.DialTimeout = time.Millisecond * 50
+	r.MaxFails = 100
+	r.banThreshold = 100
+	r.NetworkDownServers = 3
+	r.ConnectivityProbes = []string{probe.Addr}
+	r.ConnectivityInterval = time.Millisecond * 10
+	r.OnNetworkChange = func(down bool) {
+		mu.Lock()
+		changes = append(changes, down)
+		mu.Unlock()
+	}
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2\n10.0.0.3\n10.0.0.4")
+
+	timeout := func(*net.Resolver) error { return &net.DNSError{Err: `i/o timeout`, IsTimeout: true} }
+	err := r.lookup(`A`, `example.com`, timeout)
+	if !errors.Is(err, ErrNetworkDown) {
+		t.Fatalf(`expected ErrNetworkDown, got %v`, err)
+	}
+
+	var lookupErr *LookupError
+	if errors.As(err, &lookupErr); lookupErr.Tries != 3 || !lookupErr.Temporary() {
+		t.Errorf(`unexpected error %+v`, lookupErr)
+	}
+
+	calls := 0
+	err = r.lookup(`A`, `example.com`, func(*net.Resolver) error { calls++; return nil })
+	if !errors.Is(err, ErrNetworkDown) || calls != 0 {
+		t.Errorf(`lookup should fail fast while down, got %v after %d attempts`, err, calls)
+	}
+
+	r.health.mu.Lock()
+	for addr, h := range r.health.servers {
+		if h.fails > 3 {
+			t.Errorf(`%s: %d failures counted`, addr, h.fails)
+		}
+	}
+	r.health.mu.Unlock()
+
+	close(up)
+
+	deadline := time.Now().Add(time.Second * 2)
+	for r.lookup(`A`, `example.com`, func(*net.Resolver) error { return nil }) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal(`network not back after the probe answered`)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(changes) != 2 || !changes[0] || changes[1] {
+		t.Errorf(`unexpected transitions %v`, changes)
+	}
+}
+
+func TestNetworkStateServerAnswers(t *testing.T) {
+	s := DefaultSettings()
+	s.NetworkDownServers = 2
+	n := newNetworkState()
+	now := time.Now()
+
+	n.failure(`10.0.0.1`, &s, now)
+	n.success()
+	if n.failure(`10.0.0.2`, &s, now) {
+		t.Error(`an answer in between should reset the detection`)
+	}
+
+	n = newNetworkState()
+	n.failure(`10.0.0.3`, &s, now)
+	if n.failure(`10.0.0.4`, &s, now.Add(time.Minute)) {
+		t.Error(`failures outside the window should not add up`)
+	}
+	if !n.failure(`10.0.0.5`, &s, now.Add(time.Minute)) {
+		t.Error(`failures within the window should take the network down`)
+	}
+
+	n = newNetworkState()
+	s.NetworkDownServers = 0
+	for _, addr := range []string{`10.0.0.5`, `10.0.0.6`, `10.0.0.7`} {
+		if n.failure(addr, &s, now) {
+			t.Error(`detection should be disabled`)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"github.com/zofan/go-slist"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultSelectMode is the order in which servers are handed out.
+	DefaultSelectMode = slist.ModeRotate
+
+	// DefaultBanThreshold is the number of consecutive failures after which
+	// a server is quarantined for QuarantineDuration.
+	DefaultBanThreshold = 3
+)
+
+var (
+	ErrBadOption     = errors.New(`resolver: bad option`)
+	ErrServersLoaded = errors.New(`resolver: server list is already populated`)
+	ErrLookupsBegun  = errors.New(`resolver: lookups have already begun`)
+	ErrNoValidServer = errors.New(`resolver: no valid server`)
+)
+
+type Option func(r *Resolver) error
+
+// LookupOption adjusts a single lookup.
+type LookupOption func(o *lookupOptions)
+
+type lookupOptions struct {
+	tags     TagSelector
+	settings Settings
+	trace    *Trace
+	meta     *LookupMeta
+	summary  func() string
+	ctx      context.Context
+	table    tablePolicy
+	servers  ServerList
+	alabels  map[string]string
+	absolute bool
+}
+
+// WithServerTags restricts the lookup to servers matching sel, overriding
+// the resolver-level RequireTags selector.
+func WithServerTags(sel TagSelector) LookupOption {
+	return func(o *lookupOptions) {
+		o.tags = sel
+	}
+}
+
+// WithServer sends the lookup to addrs only, one after another, instead of
+// the servers of the resolver or of a route. The retries, timeouts and
+// answer checks of the settings hold, but the quarantines, the server
+// filter, the tags and the fallbacks do not. Unless ServerOverrideHealth is
+// set the answers and failures are left out of the health accounting.
+func WithServer(addrs ...string) LookupOption {
+	servers := NewStaticList(addrs...)
+
+	return func(o *lookupOptions) {
+		o.servers = servers
+	}
+}
+
+// WithSettings lets fn change the settings of the lookup, the resolver
+// settings are left alone.
+func WithSettings(fn func(s *Settings)) LookupOption {
+	return func(o *lookupOptions) {
+		fn(&o.settings)
+	}
+}
+
+// WithContext bounds the lookup with ctx: the waits for a free server, for
+// the rate limiters and for a slot under MaxInFlight, and the queries sent
+// to the servers, which end with DialTimeout otherwise.
+func WithContext(ctx context.Context) LookupOption {
+	return func(o *lookupOptions) {
+		o.ctx = ctx
+	}
+}
+
+func (r *Resolver) lookupOptions(opts []LookupOption) *lookupOptions {
+	s := r.settings()
+	o := &lookupOptions{tags: s.RequireTags, settings: s, ctx: context.Background()}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// WithSelectionMode sets how servers are picked from the list and how many
+// consecutive failures quarantine a server, before any server is loaded.
+func WithSelectionMode(mode slist.SelectMode, banThreshold int) Option {
+	return func(r *Resolver) error {
+		if err := validateSelection(mode, banThreshold); err != nil {
+			return err
+		}
+
+		if r.Servers.Count() > 0 {
+			return ErrServersLoaded
+		}
+
+		r.selectMode = mode
+		r.banThreshold = banThreshold
+		r.Servers = r.newServerList()
+
+		return nil
+	}
+}
+
+// WithServerList makes l the server list, in place of the slist one, before
+// any server is loaded. The selection mode does not apply to it.
+func WithServerList(l ServerList) Option {
+	return func(r *Resolver) error {
+		if l == nil {
+			return ErrBadOption
+		}
+		if r.Servers.Count() > 0 {
+			return ErrServersLoaded
+		}
+
+		r.Servers = l
+
+		return nil
+	}
+}
+
+// WithDialTimeout sets DialTimeout, it must be positive.
+func WithDialTimeout(d time.Duration) Option {
+	return func(r *Resolver) error {
+		if d <= 0 {
+			return ErrBadOption
+		}
+
+		r.DialTimeout = d
+
+		return nil
+	}
+}
+
+// WithRetry sets RetryLimit, 0 is no limit, and RetrySleep.
+func WithRetry(limit int, sleep time.Duration) Option {
+	return func(r *Resolver) error {
+		if limit < 0 || sleep < 0 {
+			return ErrBadOption
+		}
+
+		r.RetryLimit = limit
+		r.RetrySleep = sleep
+
+		return nil
+	}
+}
+
+// WithMaxFails sets MaxFails.
+func WithMaxFails(n uint32) Option {
+	return func(r *Resolver) error {
+		r.MaxFails = n
+
+		return nil
+	}
+}
+
+// WithServers loads servers the way LoadServers does, failing with
+// ErrNoValidServer when none of them is valid. WithSelectionMode must come
+// before it.
+func WithServers(servers []string) Option {
+	return func(r *Resolver) error {
+		report, err := r.LoadServersFromString(strings.Join(servers, "\n"))
+		if err != nil {
+			return err
+		}
+		if report.Added == 0 && report.Duplicates == 0 {
+			return ErrNoValidServer
+		}
+
+		return nil
+	}
+}
+
+// NewWithOptions is New returning the error of the options. Setting up a
+// resolver with options is the way to have it checked, setting the fields
+// afterwards skips the checks. Retrying without a limit makes no sense
+// without servers and fails with ErrBadOption.
+func NewWithOptions(opts ...Option) (*Resolver, error) {
+	r := newResolver()
+	r.Servers = r.newServerList()
+
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.Settings.validate(); err != nil {
+		return nil, err
+	}
+	if r.RetryLimit == 0 && r.Servers.Count() == 0 {
+		return nil, ErrBadOption
+	}
+
+	return r, nil
+}
+
+// NewWithServers is NewWithOptions(WithServers(servers)), for the resolvers
+// that need nothing else. Servers are host, host:port or IPv6 literals,
+// with or without brackets.
+func NewWithServers(servers ...string) (*Resolver, error) {
+	return NewWithOptions(WithServers(servers))
+}
+
+// SetSelectionMode switches the selection mode of an empty server list, the
+// list keeps no way to re-order populated entries so that returns
+// ErrServersLoaded. It is for setting up the resolver, once a lookup has
+// begun it returns ErrLookupsBegun.
+func (r *Resolver) SetSelectionMode(mode slist.SelectMode, banThreshold int) error {
+	if err := validateSelection(mode, banThreshold); err != nil {
+		return err
+	}
+
+	// lookups take the settings lock after marking themselves begun, so
+	// the ones that start meanwhile see the new fields
+	r.settingsMu.Lock()
+	defer r.settingsMu.Unlock()
+
+	if atomic.LoadInt32(&r.begun) != 0 {
+		return ErrLookupsBegun
+	}
+	if r.Servers.Count() > 0 {
+		return ErrServersLoaded
+	}
+
+	r.selectMode = mode
+	r.banThreshold = banThreshold
+	r.Servers = r.newServerList()
+
+	return nil
+}
+
+// newServerList returns an empty list in the selection mode, one that
+// starts no goroutine before a server is added to it.
+func (r *Resolver) newServerList() ServerList {
+	return &slistServers{mode: r.selectMode}
+}
+
+func validateSelection(mode slist.SelectMode, banThreshold int) error {
+	switch mode {
+	case slist.ModeRandom, slist.ModeRotate, slist.ModeTime:
+	default:
+		return slist.ErrBadMode
+	}
+
+	if banThreshold < 1 {
+		return ErrBadOption
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"github.com/zofan/go-slist"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	r, err := NewWithOptions(WithSelectionMode(slist.ModeRandom, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.selectMode != slist.ModeRandom || r.banThreshold != 5 {
+		t.Error(`options were not applied`)
+	}
+
+	if _, err := NewWithOptions(WithSelectionMode(42, 3)); err != slist.ErrBadMode {
+		t.Error(err)
+	}
+	if _, err := NewWithOptions(WithSelectionMode(slist.ModeRotate, 0)); err != ErrBadOption {
+		t.Error(err)
+	}
+}
+
+func TestSetSelectionMode(t *testing.T) {
+	r := New()
+
+	if err := r.SetSelectionMode(slist.ModeRandom, 3); err != nil {
+		t.Error(err)
+	}
+
+	_, err := r.LoadServersFromString("127.0.0.1")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err := r.SetSelectionMode(slist.ModeRotate, 3); err != ErrServersLoaded {
+		t.Error(err)
+	}
+	if r.selectMode != slist.ModeRandom {
+		t.Error(`mode changed on a populated list`)
+	}
+}
+
+func TestSetSelectionModeAfterLookup(t *testing.T) {
+	r := New()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = r.lookup(`A`, `example.com`, func(*net.Resolver) error { return nil })
+	}()
+	err := r.SetSelectionMode(slist.ModeRandom, 3)
+	<-done
+
+	// either the mode was set before the lookup or the lookup came first
+	if err != nil && err != ErrLookupsBegun {
+		t.Fatal(err)
+	}
+	if err := r.SetSelectionMode(slist.ModeRandom, 3); err != ErrLookupsBegun {
+		t.Errorf(`expected ErrLookupsBegun, got %v`, err)
+	}
+}
+
+func TestWithSettings(t *testing.T) {
+	r := New()
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString("10.0.0.1")
+
+	attempts := 0
+	opt := WithSettings(func(s *Settings) {
+		s.OnAttempt = func(LookupInfo, string) {
+			attempts++
+		}
+	})
+
+	_ = r.lookup(`A`, `example.com`, func(*net.Resolver) error { return nil }, opt)
+	_ = r.lookup(`A`, `example.com`, func(*net.Resolver) error { return nil })
+
+	if attempts != 1 {
+		t.Errorf(`expected the hook on the one lookup only, got %d calls`, attempts)
+	}
+	if r.OnAttempt != nil {
+		t.Errorf(`resolver settings changed`)
+	}
+}
+
+func TestNewWithOptionsChecked(t *testing.T) {
+	r, err := NewWithOptions(
+		WithSelectionMode(slist.ModeRandom, 5),
+		WithDialTimeout(time.Second),
+		WithRetry(3, 0),
+		WithMaxFails(7),
+		WithServers([]string{`10.0.0.1`, `10.0.0.2:5353`, `10.0.0.3:99999`}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.DialTimeout != time.Second || r.RetryLimit != 3 || r.RetrySleep != 0 || r.MaxFails != 7 || r.Servers.Count() != 2 {
+		t.Errorf(`options were not applied: %+v`, r.Settings)
+	}
+
+	bad := map[string][]Option{
+		`timeout`:     {WithDialTimeout(-time.Second)},
+		`retry`:       {WithRetry(-1, 0)},
+		`sleep`:       {WithRetry(1, -time.Second)},
+		`no servers`:  {WithServers([]string{`10.0.0.3:0`})},
+		`mode after`:  {WithServers([]string{`10.0.0.1`}), WithSelectionMode(slist.ModeRandom, 3)},
+		`combination`: {func(r *Resolver) error { r.AuditFraction = 2; return nil }},
+		`no limit`:    {WithRetry(0, 0)},
+	}
+	for name, opts := range bad {
+		if _, err := NewWithOptions(opts...); err == nil {
+			t.Errorf(`%s: expected an error`, name)
+		}
+	}
+	if _, err := NewWithOptions(WithServers(nil)); err != ErrNoValidServer {
+		t.Errorf(`expected ErrNoValidServer, got %v`, err)
+	}
+	if _, err := NewWithOptions(WithRetry(0, 0), WithServers([]string{`10.0.0.1`})); err != nil {
+		t.Errorf(`expected no limit with servers allowed, got %v`, err)
+	}
+}
+
+func TestNewOptions(t *testing.T) {
+	r := New(WithDialTimeout(time.Second), WithServers([]string{`10.0.0.1`}))
+	if r.DialTimeout != time.Second || r.Servers.Count() != 1 {
+		t.Errorf(`options were not applied: %+v`, r.Settings)
+	}
+
+	defer func() {
+		if err := recover(); err != ErrBadOption {
+			t.Errorf(`expected a panic with ErrBadOption, got %v`, err)
+		}
+	}()
+	New(WithDialTimeout(-time.Second))
+}
+
+func TestNewWithServers(t *testing.T) {
+	r, err := NewWithServers(`10.0.0.1`, `10.0.0.2:5353`, `2001:db8::1`, `[2001:db8::2]:5353`, `ns.example.com`, `10.0.0.1:53`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]bool{}
+	for _, s := range r.Servers.All() {
+		got[s.Addr] = true
+	}
+	for _, want := range []string{`10.0.0.1`, `10.0.0.2:5353`, `2001:db8::1`, `[2001:db8::2]:5353`, `ns.example.com`} {
+		if !got[want] {
+			t.Errorf(`missing %s in %v`, want, got)
+		}
+	}
+	if len(got) != 5 {
+		t.Errorf(`expected 5 servers, got %v`, got)
+	}
+
+	if _, err := NewWithServers(); err != ErrNoValidServer {
+		t.Errorf(`expected ErrNoValidServer, got %v`, err)
+	}
+	if _, err := NewWithServers(`10.0.0.1:0`, `a b`); err != ErrNoValidServer {
+		t.Errorf(`expected ErrNoValidServer, got %v`, err)
+	}
+}
+
+func TestWithServer(t *testing.T) {
+	usual := newTestServer(t, answerA(map[string]string{`example.com`: `192.0.2.1`}))
+	picked := newTestServer(t, answerA(map[string]string{`example.com`: `192.0.2.2`}))
+	broken := newTestServer(t, func(q Question, resp *Message) {
+		resp.Rcode = RcodeServerFailure
+	})
+
+	r := New()
+	r.RetryLimit = 2
+	r.RetrySleep = 0
+	r.MaxFails = 1
+	r.QuarantineDuration = time.Hour
+	if _, err := r.LoadServersFromString(usual.Addr + "\n" + broken.Addr); err != nil {
+		t.Fatal(err)
+	}
+
+	ips, err := r.LookupIPAddr(`example.com`, WithServer(picked.Addr))
+	if err != nil || len(ips) != 1 || !ips[0].IP.Equal(net.ParseIP(`192.0.2.2`)) {
+		t.Errorf(`expected the address of the picked server, got %v, %v`, ips, err)
+	}
+	if n := len(usual.Queries()); n != 0 {
+		t.Errorf(`expected no queries to the usual server, got %d`, n)
+	}
+
+	// the broken server is poked without being quarantined
+	if _, err := r.LookupIPAddr(`example.com`, WithServer(broken.Addr)); !errors.Is(err, ErrRetryLimit) {
+		t.Errorf(`expected ErrRetryLimit, got %v`, err)
+	}
+	if len(broken.Queries()) == 0 {
+		t.Error(`expected the attempts on the broken server`)
+	}
+	if q := r.QuarantinedServers(); len(q) != 0 {
+		t.Errorf(`expected no quarantine, got %v`, q)
+	}
+
+	_, err = r.LookupIPAddr(`example.com`, WithServer(broken.Addr), WithSettings(func(s *Settings) {
+		s.ServerOverrideHealth = true
+	}))
+	if !errors.Is(err, ErrRetryLimit) {
+		t.Errorf(`expected ErrRetryLimit, got %v`, err)
+	}
+	if q := r.QuarantinedServers(); len(q) != 1 || q[0].Addr != broken.Addr {
+		t.Errorf(`expected the broken server quarantined, got %v`, q)
+	}
+}
+
+func TestWithContextQueries(t *testing.T) {
+	silent, err := net.ListenPacket(`udp`, `127.0.0.1:0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	r := New(WithDialTimeout(time.Second*5), WithRetry(1, 0), WithServers([]string{silent.LocalAddr().String()}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := r.LookupIPAddr(`example.com`, WithContext(ctx)); err == nil {
+		t.Fatal(`expected the lookup to fail`)
+	}
+	if d := time.Since(start); d > time.Second*2 {
+		t.Errorf(`expected the query to end with the context, took %s`, d)
+	}
+}
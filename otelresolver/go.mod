@@ -0,0 +1,22 @@
+module github.com/zofan/go-resolver/otelresolver
+
+go 1.18
+
+require (
+	github.com/zofan/go-resolver v0.0.0-00010101000000-000000000000
+	go.opentelemetry.io/otel v1.11.2
+	go.opentelemetry.io/otel/sdk v1.11.2
+	go.opentelemetry.io/otel/trace v1.11.2
+)
+
+require (
+	github.com/go-logr/logr v1.2.3 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/zofan/go-slist v0.0.0-20210406203728-48b54876780f // indirect
+	golang.org/x/net v0.21.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/zofan/go-resolver => ../
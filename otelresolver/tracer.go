@@ -0,0 +1,86 @@
+// Package otelresolver traces resolver lookups with OpenTelemetry. It is a
+// module of its own so the resolver does not depend on OpenTelemetry.
+package otelresolver
+
+import (
+	"context"
+	"github.com/zofan/go-resolver"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+const instrumentationName = `github.com/zofan/go-resolver/otelresolver`
+
+// Tracer makes the lookup options tracing lookups.
+type Tracer struct {
+	provider trace.TracerProvider
+}
+
+// New returns a tracer creating spans with provider, nil is the global
+// provider. A recording span in the context of a lookup takes precedence.
+func New(provider trace.TracerProvider) *Tracer {
+	return &Tracer{provider: provider}
+}
+
+func (t *Tracer) tracer(ctx context.Context) trace.Tracer {
+	if span := trace.SpanFromContext(ctx); span.IsRecording() {
+		return span.TracerProvider().Tracer(instrumentationName)
+	}
+	if t.provider != nil {
+		return t.provider.Tracer(instrumentationName)
+	}
+
+	return otel.GetTracerProvider().Tracer(instrumentationName)
+}
+
+// Trace returns a lookup option making a span of the lookup, child of the
+// span in ctx and named after the record type. Each attempt is an event of
+// it. Lookups without the option are not traced and pay nothing for it.
+//
+//	ips, err := r.LookupIPAddr(`example.com`, t.Trace(ctx))
+func (t *Tracer) Trace(ctx context.Context) resolver.LookupOption {
+	return resolver.WithSettings(func(s *resolver.Settings) {
+		var span trace.Span
+		start, attempt, done := s.OnLookupStart, s.OnAttempt, s.OnLookupDone
+
+		s.OnLookupStart = func(info resolver.LookupInfo) {
+			_, span = t.tracer(ctx).Start(ctx, info.Type, trace.WithAttributes(
+				attribute.String(`dns.host`, info.Host),
+				attribute.String(`dns.type`, info.Type),
+			))
+			if start != nil {
+				start(info)
+			}
+		}
+
+		s.OnAttempt = func(info resolver.LookupInfo, server string) {
+			span.AddEvent(`attempt`, trace.WithAttributes(
+				attribute.String(`dns.server`, server),
+				attribute.Int(`dns.attempt`, info.Attempt),
+			))
+			if attempt != nil {
+				attempt(info, server)
+			}
+		}
+
+		s.OnLookupDone = func(info resolver.LookupInfo, err error, d time.Duration) {
+			span.SetAttributes(
+				attribute.String(`dns.server`, info.Server),
+				attribute.Int(`dns.attempts`, info.Attempt),
+				attribute.String(`dns.outcome`, resolver.Outcome(err)),
+			)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+
+			if done != nil {
+				done(info, err, d)
+			}
+		}
+	})
+}
@@ -0,0 +1,37 @@
+package otelresolver
+
+import (
+	"context"
+	"github.com/zofan/go-resolver"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	r := resolver.New()
+	tracer := New(provider)
+
+	// without servers the lookup fails right away
+	_, _ = r.LookupMX(`example.com`, tracer.Trace(context.Background()))
+	_, _ = r.LookupMX(`example.com`)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf(`expected one span, got %d`, len(spans))
+	}
+	if spans[0].Name() != `MX` {
+		t.Errorf(`unexpected span name %s`, spans[0].Name())
+	}
+
+	attrs := make(map[string]string)
+	for _, kv := range spans[0].Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	if attrs[`dns.host`] != `example.com` || attrs[`dns.outcome`] != resolver.OutcomeEmptyList {
+		t.Errorf(`unexpected attributes %v`, attrs)
+	}
+}
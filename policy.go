@@ -0,0 +1,145 @@
+package resolver
+
+import (
+	"sync"
+	"time"
+)
+
+// HealthPolicy keeps the account of query outcomes per server and decides
+// which servers are skipped by selection. The methods are called from
+// concurrent lookups.
+type HealthPolicy interface {
+	OnSuccess(server string, latency time.Duration)
+	OnFailure(server string, err error)
+	ShouldSkip(server string) bool
+}
+
+// admitter is implemented by policies grading servers finer than skip or
+// use, probationary servers are only picked when nothing else is left.
+type admitter interface {
+	admit(server string, now time.Time) admission
+}
+
+// policy returns the health policy of the lookup, the default one lives in
+// the options so that asking for it costs nothing.
+func (o *lookupOptions) policy(r *Resolver) HealthPolicy {
+	if o.settings.HealthPolicy != nil {
+		return o.settings.HealthPolicy
+	}
+
+	o.table = tablePolicy{r: r, s: &o.settings}
+	return &o.table
+}
+
+// tablePolicy is the default policy: quarantine, probation and circuit
+// breaking in the health table of the resolver, configured by the settings
+// of the lookup.
+type tablePolicy struct {
+	r *Resolver
+	s *Settings
+}
+
+func (p *tablePolicy) OnSuccess(server string, latency time.Duration) {
+	recovered := p.r.health.success(server, p.r.healthConfig(p.s), time.Now())
+	if !recovered {
+		return
+	}
+
+	p.r.events.emit(EventServerRecovered, server, `probation passed`)
+	p.r.checkPool(p.s)
+	if p.s.Logger != nil {
+		p.s.Logger.Info(`resolver: server recovered`, `server`, server)
+	}
+}
+
+// OnFailure counts the failure weighted by FailureWeights, the server is
+// quarantined after MaxFails or after the ban threshold of consecutive ones.
+func (p *tablePolicy) OnFailure(server string, err error) {
+	quarantined := p.r.health.failure(server, p.s.FailureWeights.weigh(err), p.r.healthConfig(p.s), time.Now())
+	if !quarantined {
+		return
+	}
+
+	p.r.events.emit(EventServerQuarantined, server, err.Error())
+	p.r.checkPool(p.s)
+	if p.s.Logger != nil {
+		p.s.Logger.Warn(`resolver: server quarantined`, `server`, server, `error`, err)
+	}
+}
+
+func (p *tablePolicy) ShouldSkip(server string) bool {
+	return p.admit(server, time.Now()) == admitSkip
+}
+
+// admit starts a background re-check of a flagged server when it is due,
+// the server stays skipped until the re-check clears it.
+func (p *tablePolicy) admit(server string, now time.Time) admission {
+	a := p.r.health.admit(server, p.r.healthConfig(p.s), now)
+	if a == admitRecheck {
+		go p.r.recheckServer(server)
+		return admitSkip
+	}
+
+	return a
+}
+
+// RatioPolicy skips servers whose share of failed queries over the last
+// Window is above MaxRatio, once they have at least MinSamples queries in
+// it. A skipped server is used again when its failures age out.
+type RatioPolicy struct {
+	MaxRatio   float64
+	MinSamples int
+	Window     time.Duration
+
+	servers map[string]*ratioWindow
+	mu      sync.Mutex
+}
+
+func NewRatioPolicy(maxRatio float64, minSamples int, window time.Duration) *RatioPolicy {
+	return &RatioPolicy{
+		MaxRatio:   maxRatio,
+		MinSamples: minSamples,
+		Window:     window,
+		servers:    make(map[string]*ratioWindow),
+	}
+}
+
+func (p *RatioPolicy) OnSuccess(server string, latency time.Duration) {
+	p.add(server, false)
+}
+
+func (p *RatioPolicy) OnFailure(server string, err error) {
+	p.add(server, true)
+}
+
+func (p *RatioPolicy) ShouldSkip(server string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	w, ok := p.servers[server]
+	if !ok {
+		return false
+	}
+
+	w.advance(time.Now(), p.Window)
+	ratio, samples := w.ratio()
+
+	return samples >= p.MinSamples && ratio > p.MaxRatio
+}
+
+func (p *RatioPolicy) add(server string, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.servers == nil {
+		p.servers = make(map[string]*ratioWindow)
+	}
+
+	w, ok := p.servers[server]
+	if !ok {
+		w = &ratioWindow{}
+		p.servers[server] = w
+	}
+
+	w.add(time.Now(), p.Window, failed)
+}
@@ -0,0 +1,131 @@
+package resolver
+
+import (
+	"errors"
+	"github.com/zofan/go-slist"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingPolicy struct {
+	skip      map[string]bool
+	successes []string
+	failures  []error
+	mu        sync.Mutex
+}
+
+func (p *recordingPolicy) OnSuccess(server string, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.successes = append(p.successes, server)
+}
+
+func (p *recordingPolicy) OnFailure(server string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.failures = append(p.failures, err)
+}
+
+func (p *recordingPolicy) ShouldSkip(server string) bool {
+	return p.skip[server]
+}
+
+func TestCustomHealthPolicy(t *testing.T) {
+	policy := &recordingPolicy{skip: map[string]bool{`10.0.0.1`: true}}
+
+	r := New()
+	r.RetrySleep = 0
+	r.HealthPolicy = policy
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2")
+
+	calls := 0
+	err := r.lookup(`A`, `example.com`, func(res *net.Resolver) error {
+		if got := dialedServer(t, res); got != `10.0.0.2:53` {
+			t.Errorf(`skipped server %s selected`, got)
+		}
+		if calls++; calls == 1 {
+			return errTestRefused
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(policy.failures) != 1 || policy.failures[0] != errTestRefused {
+		t.Errorf(`unexpected failures %v`, policy.failures)
+	}
+	if len(policy.successes) != 1 || policy.successes[0] != `10.0.0.2` {
+		t.Errorf(`unexpected successes %v`, policy.successes)
+	}
+	if q := r.QuarantinedServers(); len(q) != 0 {
+		t.Errorf(`built-in accounting used with a custom policy: %+v`, q)
+	}
+
+	policy.skip[`10.0.0.2`] = true
+	err = r.lookup(`A`, `example.com`, func(*net.Resolver) error { return nil })
+	if !errors.Is(err, slist.ErrServerListEmpty) {
+		t.Errorf(`expected an empty list with every server skipped, got %v`, err)
+	}
+}
+
+func TestCustomPolicyKeepsEvictions(t *testing.T) {
+	r := New()
+	r.RetrySleep = 0
+	r.RecheckInterval = 0
+	r.HealthPolicy = NewRatioPolicy(0.5, 4, time.Minute)
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2\n10.0.0.3")
+
+	r.health.setProbe(`10.0.0.1`, &probeResult{recursive: true, hijack: &HijackedAnswer{}}, time.Now())
+	r.health.setLying(`10.0.0.2`)
+
+	for i := 0; i < 6; i++ {
+		err := r.lookup(`A`, `example.com`, func(res *net.Resolver) error {
+			if got := dialedServer(t, res); got != `10.0.0.3:53` {
+				t.Errorf(`evicted server %s selected`, got)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRatioPolicy(t *testing.T) {
+	p := NewRatioPolicy(0.5, 4, time.Minute)
+
+	p.OnFailure(`10.0.0.1`, errTestRefused)
+	p.OnFailure(`10.0.0.1`, errTestRefused)
+	p.OnFailure(`10.0.0.1`, errTestRefused)
+	if p.ShouldSkip(`10.0.0.1`) {
+		t.Error(`skipped before MinSamples`)
+	}
+
+	p.OnSuccess(`10.0.0.1`, time.Millisecond)
+	if !p.ShouldSkip(`10.0.0.1`) {
+		t.Error(`75% failures should be skipped`)
+	}
+
+	for i := 0; i < 4; i++ {
+		p.OnSuccess(`10.0.0.2`, time.Millisecond)
+	}
+	p.OnFailure(`10.0.0.2`, errTestRefused)
+	if p.ShouldSkip(`10.0.0.2`) || p.ShouldSkip(`10.0.0.3`) {
+		t.Error(`healthy or unknown server skipped`)
+	}
+
+	short := NewRatioPolicy(0.5, 1, time.Millisecond*60)
+	short.OnFailure(`10.0.0.1`, errTestRefused)
+	if !short.ShouldSkip(`10.0.0.1`) {
+		t.Error(`failing server not skipped`)
+	}
+	time.Sleep(time.Millisecond * 80)
+	if short.ShouldSkip(`10.0.0.1`) {
+		t.Error(`failures should age out of the window`)
+	}
+}
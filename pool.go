@@ -0,0 +1,45 @@
+package resolver
+
+import (
+	"sync"
+)
+
+// poolState remembers whether the pool was last seen degraded, so the
+// callbacks run once per crossing.
+type poolState struct {
+	degraded bool
+	mu       sync.Mutex
+}
+
+func poolDegraded(healthy, total int, s *Settings) bool {
+	if s.MinHealthyServers > 0 && healthy < s.MinHealthyServers {
+		return true
+	}
+
+	return s.MinHealthyFraction > 0 && float64(healthy) < s.MinHealthyFraction*float64(total)
+}
+
+// checkPool recounts the healthy servers after a server changed state and
+// runs OnPoolDegraded or OnPoolRecovered when the pool crossed the line.
+func (r *Resolver) checkPool(s *Settings) {
+	if s.OnPoolDegraded == nil && s.OnPoolRecovered == nil {
+		return
+	}
+
+	total := r.Servers.Count()
+	healthy := r.HealthyServers()
+	degraded := poolDegraded(healthy, total, s)
+
+	r.pool.mu.Lock()
+	changed := degraded != r.pool.degraded
+	r.pool.degraded = degraded
+	r.pool.mu.Unlock()
+
+	switch {
+	case !changed:
+	case degraded && s.OnPoolDegraded != nil:
+		go s.OnPoolDegraded(healthy, total)
+	case !degraded && s.OnPoolRecovered != nil:
+		go s.OnPoolRecovered(healthy, total)
+	}
+}
@@ -0,0 +1,62 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPoolCallbacks(t *testing.T) {
+	type crossing struct {
+		degraded       bool
+		healthy, total int
+	}
+	crossings := make(chan crossing, 10)
+
+	r := New()
+	r.RetryLimit = 1
+	r.RetrySleep = 0
+	r.MaxFails = 1
+	r.NetworkDownServers = 0
+	r.MinHealthyServers = 2
+	r.OnPoolDegraded = func(healthy, total int) {
+		crossings <- crossing{true, healthy, total}
+	}
+	r.OnPoolRecovered = func(healthy, total int) {
+		crossings <- crossing{false, healthy, total}
+	}
+
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2")
+
+	next := func(wait time.Duration) *crossing {
+		select {
+		case c := <-crossings:
+			return &c
+		case <-time.After(wait):
+			return nil
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		_ = r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+			return errors.New(`connection refused`)
+		})
+	}
+	if c := next(time.Second); c == nil || !c.degraded || c.healthy != 1 || c.total != 2 {
+		t.Errorf(`expected a degraded crossing, got %+v`, c)
+	}
+	if c := next(time.Millisecond * 50); c != nil {
+		t.Errorf(`unexpected crossing %+v while degraded`, c)
+	}
+
+	_, _ = r.LoadServersFromString("10.0.0.3")
+	if c := next(time.Millisecond * 50); c != nil {
+		t.Errorf(`unexpected crossing %+v with one healthy server`, c)
+	}
+
+	_, _ = r.LoadServersFromString("10.0.0.4")
+	if c := next(time.Second); c == nil || c.degraded || c.healthy != 2 || c.total != 4 {
+		t.Errorf(`expected a recovered crossing, got %+v`, c)
+	}
+}
@@ -0,0 +1,208 @@
+package resolver
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultProbeName is asked during validation, a name no server in a
+	// public list should be authoritative for.
+	DefaultProbeName = `example.com`
+
+	// DefaultNonceZone is the zone under which random, nonexistent names are
+	// asked to catch servers that rewrite NXDOMAIN answers.
+	DefaultNonceZone = `com`
+
+	probeWorkers = 32
+	probeTimeout = time.Second * 5
+)
+
+type ValidationReport struct {
+	Checked      int
+	NonRecursive int
+	Unreachable  int
+	Hijacking    []HijackedAnswer
+}
+
+// HijackedAnswer is the answer a server gave for a name that does not exist.
+type HijackedAnswer struct {
+	Addr   string
+	Name   string
+	Answer []net.IP
+}
+
+// ValidateServers probes every loaded server and flags the ones that do not
+// offer recursion or answer nonexistent names with an address instead of
+// NXDOMAIN, flagged servers are skipped by selection. The result of each
+// check is kept and re-checked in the background once it is older than
+// RecheckInterval.
+func (r *Resolver) ValidateServers(ctx context.Context) ValidationReport {
+	var report ValidationReport
+	var mu sync.Mutex
+
+	servers := r.Servers.All()
+	addrs := make(chan string)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < probeWorkers && i < len(servers); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for addr := range addrs {
+				res, err := r.probeServer(ctx, addr)
+
+				mu.Lock()
+				report.Checked++
+				if err != nil {
+					report.Unreachable++
+				} else if !res.recursive {
+					report.NonRecursive++
+				} else if res.hijack != nil {
+					report.Hijacking = append(report.Hijacking, *res.hijack)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+loop:
+	for _, s := range servers {
+		select {
+		case addrs <- s.Addr:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(addrs)
+	wg.Wait()
+
+	return report
+}
+
+// ValidatePeriodically runs ValidateServers every interval until ctx is done
+// or the resolver closed.
+func (r *Resolver) ValidatePeriodically(ctx context.Context, interval time.Duration) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				r.ValidateServers(ctx)
+			case <-ctx.Done():
+				return
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
+
+type probeResult struct {
+	recursive bool
+	hijack    *HijackedAnswer
+}
+
+// probeServer checks that the server is a recursive resolver, one that sets
+// RA and answers ProbeName without referring the query elsewhere, and that
+// it answers a random nonexistent name with NXDOMAIN. Transport errors
+// leave the previous verdict in place.
+func (r *Resolver) probeServer(ctx context.Context, addr string) (probeResult, error) {
+	var res probeResult
+	s := r.settings()
+
+	name := s.ProbeName
+	if name == `` {
+		name = DefaultProbeName
+	}
+
+	resp, err := r.exchange(ctx, addr, newQuery(name, TypeA))
+	if err != nil {
+		r.health.setProbe(addr, nil, time.Now())
+		return res, err
+	}
+
+	res.recursive = resp.RecursionAvailable && resp.Rcode != RcodeRefused &&
+		!(resp.Rcode == RcodeSuccess && len(resp.Answers) == 0 && len(resp.Authorities) > 0 && resp.Authorities[0].Type == TypeNS)
+
+	if res.recursive {
+		zone := s.NonceZone
+		if zone == `` {
+			zone = DefaultNonceZone
+		}
+
+		nonce := nonceLabel() + `.` + zone
+		resp, err := r.exchange(ctx, addr, newQuery(nonce, TypeA))
+		if err != nil {
+			r.health.setProbe(addr, nil, time.Now())
+			return res, err
+		}
+
+		if ips := answerIPs(resp); len(ips) > 0 {
+			res.hijack = &HijackedAnswer{Addr: addr, Name: nonce, Answer: ips}
+		}
+	}
+
+	r.health.setProbe(addr, &res, time.Now())
+	switch {
+	case !res.recursive:
+		r.events.emit(EventServerEvicted, addr, `not recursive`)
+	case res.hijack != nil:
+		r.events.emit(EventServerEvicted, addr, `hijacks nonexistent names: `+res.hijack.Name+` answered `+joinIPs(res.hijack.Answer))
+		if l := s.Logger; l != nil {
+			l.Warn(`resolver: server hijacks nonexistent names`, `server`, addr, `name`, res.hijack.Name, `answer`, res.hijack.Answer)
+		}
+	}
+	r.checkPool(&s)
+
+	return res, nil
+}
+
+func (r *Resolver) recheckServer(addr string) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	_, _ = r.probeServer(ctx, addr)
+}
+
+func answerIPs(m *Message) []net.IP {
+	var ips []net.IP
+	for _, rr := range m.Answers {
+		if rr.Type == TypeA || rr.Type == TypeAAAA {
+			ips = append(ips, rr.IP)
+		}
+	}
+
+	return ips
+}
+
+func joinIPs(ips []net.IP) string {
+	s := make([]string, len(ips))
+	for i, ip := range ips {
+		s[i] = ip.String()
+	}
+
+	return strings.Join(s, `,`)
+}
+
+// nonceLabel returns a random 16 character label, long and random enough
+// to never collide with a registered name.
+func nonceLabel() string {
+	const alphabet = `abcdefghijklmnopqrstuvwxyz0123456789`
+
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	for i := range b {
+		b[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	b[0] = alphabet[int(b[0])%26]
+
+	return string(b)
+}
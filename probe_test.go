@@ -0,0 +1,130 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateServersRecursion(t *testing.T) {
+	recursive := newTestServer(t, answerA(map[string]string{`example.com`: `192.0.2.1`}))
+	referral := newTestServer(t, func(q Question, resp *Message) {
+		resp.RecursionAvailable = false
+		resp.Authorities = []RR{{Name: `com.`, Type: TypeNS, TTL: 60, Target: `a.gtld-servers.net.`}}
+	})
+	refused := newTestServer(t, func(q Question, resp *Message) {
+		resp.Rcode = RcodeRefused
+	})
+
+	r := New()
+	r.DialTimeout = time.Second * 2
+
+	_, err := r.LoadServersFromString(recursive.Addr + "\n" + referral.Addr + "\n" + refused.Addr + "\n127.0.0.1:1")
+	if err != nil {
+		t.Error(err)
+	}
+
+	report := r.ValidateServers(context.Background())
+	if report.Checked != 4 || report.NonRecursive != 2 || report.Unreachable != 1 {
+		t.Errorf(`unexpected report %+v`, report)
+	}
+
+	for i := 0; i < 8; i++ {
+		_ = r.lookup(`A`, `example.com`, func(res *net.Resolver) error {
+			got := dialedServer(t, res)
+			if got == referral.Addr || got == refused.Addr {
+				t.Errorf(`non-recursive server %s selected`, got)
+			}
+			return nil
+		})
+	}
+}
+
+func TestRecursionRecheck(t *testing.T) {
+	server := newTestServer(t, answerA(map[string]string{`example.com`: `192.0.2.1`}))
+
+	r := New()
+	r.RetryLimit = 1
+	r.RecheckInterval = time.Millisecond
+
+	_, err := r.LoadServersFromString(server.Addr)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// flagged long ago, the next pick triggers a background re-check
+	r.health.setProbe(server.Addr, &probeResult{}, time.Now().Add(-time.Hour))
+
+	ok := func(*net.Resolver) error { return nil }
+	if err := r.lookup(`A`, `example.com`, ok); err == nil {
+		t.Error(`flagged server should be skipped until re-checked`)
+	}
+
+	deadline := time.Now().Add(time.Second * 2)
+	for r.lookup(`A`, `example.com`, ok) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal(`server was not re-admitted after a successful re-check`)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestValidateServersHijack(t *testing.T) {
+	honest := newTestServer(t, answerA(map[string]string{`example.com`: `192.0.2.1`}))
+	hijacking := newTestServer(t, func(q Question, resp *Message) {
+		resp.Answers = append(resp.Answers, RR{Name: q.Name, Type: TypeA, TTL: 60, IP: net.ParseIP(`198.51.100.7`)})
+	})
+
+	r := New()
+	r.DialTimeout = time.Second * 2
+	log := &testLogger{}
+	r.Logger = log
+
+	_, err := r.LoadServersFromString(honest.Addr + "\n" + hijacking.Addr)
+	if err != nil {
+		t.Error(err)
+	}
+
+	events := r.Events()
+	report := r.ValidateServers(context.Background())
+	if report.Checked != 2 || report.NonRecursive != 0 || len(report.Hijacking) != 1 {
+		t.Fatalf(`unexpected report %+v`, report)
+	}
+
+	got := report.Hijacking[0]
+	if got.Addr != hijacking.Addr || !strings.HasSuffix(got.Name, `.`+DefaultNonceZone) ||
+		len(got.Answer) != 1 || !got.Answer[0].Equal(net.ParseIP(`198.51.100.7`)) {
+		t.Errorf(`unexpected hijack record %+v`, got)
+	}
+
+	evicted := false
+	for len(events) > 0 {
+		if e := <-events; e.Type == EventServerEvicted && e.Server == hijacking.Addr {
+			evicted = strings.Contains(e.Reason, got.Name) && strings.Contains(e.Reason, `198.51.100.7`)
+		}
+	}
+	if !evicted {
+		t.Error(`expected the eviction reason to name the nonce and the forged answer`)
+	}
+	if e := log.find(`warn`, `resolver: server hijacks nonexistent names`); e == nil || e.field(`server`) != hijacking.Addr || e.field(`name`) != got.Name {
+		t.Errorf(`expected the eviction logged, got %+v`, e)
+	}
+
+	for i := 0; i < 8; i++ {
+		_ = r.lookup(`A`, `example.com`, func(res *net.Resolver) error {
+			if got := dialedServer(t, res); got == hijacking.Addr {
+				t.Errorf(`hijacking server %s selected`, got)
+			}
+			return nil
+		})
+	}
+}
+
+func TestNonceLabel(t *testing.T) {
+	a, b := nonceLabel(), nonceLabel()
+	if len(a) != 16 || a == b || a[0] < 'a' || a[0] > 'z' {
+		t.Errorf(`unexpected nonce labels %q %q`, a, b)
+	}
+}
@@ -0,0 +1,171 @@
+// Package promresolver exports the stats of a resolver to Prometheus. It
+// is a module of its own so the resolver does not depend on the client.
+package promresolver
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zofan/go-resolver"
+	"sort"
+)
+
+// DefaultMaxServers is how many servers get a label of their own in the
+// per server metrics, the others are summed up as "other".
+const DefaultMaxServers = 20
+
+// Collector is a prometheus.Collector reading Resolver.Stats on every
+// scrape, the lookups are not slowed down by it.
+type Collector struct {
+	r          *resolver.Resolver
+	maxServers int
+
+	lookups        *prometheus.Desc
+	attempts       *prometheus.Desc
+	duration       *prometheus.Desc
+	serverFailures *prometheus.Desc
+	serverLatency  *prometheus.Desc
+	healthy        *prometheus.Desc
+	inFlight       *prometheus.Desc
+	rejected       *prometheus.Desc
+}
+
+// NewCollector returns a collector of r, the maxServers servers with the
+// most failures, or the most attempts for the latency, are labelled with
+// their address, 0 is DefaultMaxServers.
+func NewCollector(r *resolver.Resolver, maxServers int) *Collector {
+	if maxServers <= 0 {
+		maxServers = DefaultMaxServers
+	}
+
+	return &Collector{
+		r:          r,
+		maxServers: maxServers,
+
+		lookups: prometheus.NewDesc(`resolver_lookups_total`,
+			`Lookups by record type and outcome.`, []string{`type`, `outcome`}, nil),
+		attempts: prometheus.NewDesc(`resolver_attempts_total`,
+			`Queries sent to servers.`, nil, nil),
+		duration: prometheus.NewDesc(`resolver_lookup_duration_seconds`,
+			`Duration of lookups including retries.`, nil, nil),
+		serverFailures: prometheus.NewDesc(`resolver_server_failures_total`,
+			`Failed attempts by server.`, []string{`server`}, nil),
+		serverLatency: prometheus.NewDesc(`resolver_server_attempt_duration_seconds`,
+			`Duration of attempts by server.`, []string{`server`}, nil),
+		healthy: prometheus.NewDesc(`resolver_healthy_servers`,
+			`Servers neither quarantined nor caught misbehaving.`, nil, nil),
+		inFlight: prometheus.NewDesc(`resolver_lookups_in_flight`,
+			`Lookups running.`, nil, nil),
+		rejected: prometheus.NewDesc(`resolver_lookups_rejected_total`,
+			`Lookups refused over MaxInFlight.`, nil, nil),
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.lookups
+	ch <- c.attempts
+	ch <- c.duration
+	ch <- c.serverFailures
+	ch <- c.serverLatency
+	ch <- c.healthy
+	ch <- c.inFlight
+	ch <- c.rejected
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	s := c.r.Stats()
+
+	for qtype, outcomes := range s.ByOutcome {
+		for outcome, n := range outcomes {
+			ch <- prometheus.MustNewConstMetric(c.lookups, prometheus.CounterValue, float64(n), qtype, outcome)
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.attempts, prometheus.CounterValue, float64(s.Attempts))
+
+	ch <- prometheus.MustNewConstHistogram(c.duration, s.Lookups, s.Latency.Seconds(), buckets(s.LatencyCounts))
+
+	for server, n := range c.topServers(s.ServerFailures) {
+		ch <- prometheus.MustNewConstMetric(c.serverFailures, prometheus.CounterValue, float64(n), server)
+	}
+	for server, h := range c.topLatency(s.ServerLatency) {
+		ch <- prometheus.MustNewConstHistogram(c.serverLatency, h.Count, h.Sum.Seconds(), buckets(h.Counts), server)
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.healthy, prometheus.GaugeValue, float64(c.r.HealthyServers()))
+	ch <- prometheus.MustNewConstMetric(c.inFlight, prometheus.GaugeValue, float64(s.InFlight))
+	ch <- prometheus.MustNewConstMetric(c.rejected, prometheus.CounterValue, float64(s.Rejected))
+}
+
+// buckets turns counts per resolver.LatencyBuckets into the cumulative
+// buckets of a Prometheus histogram.
+func buckets(counts []uint64) map[float64]uint64 {
+	b := make(map[float64]uint64, len(resolver.LatencyBuckets))
+	var cumulative uint64
+	for i, bound := range resolver.LatencyBuckets {
+		cumulative += counts[i]
+		b[bound.Seconds()] = cumulative
+	}
+
+	return b
+}
+
+// topServers keeps the maxServers servers with the most failures and sums
+// up the rest as "other", so the label set stays bounded however long the
+// server list is.
+func (c *Collector) topServers(failures map[string]uint64) map[string]uint64 {
+	if len(failures) <= c.maxServers {
+		return failures
+	}
+
+	servers := make([]string, 0, len(failures))
+	for server := range failures {
+		servers = append(servers, server)
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		if failures[servers[i]] != failures[servers[j]] {
+			return failures[servers[i]] > failures[servers[j]]
+		}
+		return servers[i] < servers[j]
+	})
+
+	top := make(map[string]uint64, c.maxServers+1)
+	for i, server := range servers {
+		if i < c.maxServers {
+			top[server] = failures[server]
+		} else {
+			top[`other`] += failures[server]
+		}
+	}
+
+	return top
+}
+
+// topLatency keeps the histograms of the maxServers servers with the most
+// attempts and merges the rest into "other".
+func (c *Collector) topLatency(latency map[string]resolver.LatencyHistogram) map[string]resolver.LatencyHistogram {
+	if len(latency) <= c.maxServers {
+		return latency
+	}
+
+	attempts := make(map[string]uint64, len(latency))
+	for server, h := range latency {
+		attempts[server] = h.Count
+	}
+
+	top := make(map[string]resolver.LatencyHistogram, c.maxServers+1)
+	other := resolver.LatencyHistogram{Counts: make([]uint64, len(resolver.LatencyBuckets)+1)}
+	kept := c.topServers(attempts)
+	for server, h := range latency {
+		if _, ok := kept[server]; ok {
+			top[server] = h
+			continue
+		}
+		for i, n := range h.Counts {
+			other.Counts[i] += n
+		}
+		other.Count += h.Count
+		other.Sum += h.Sum
+	}
+	top[`other`] = other
+
+	return top
+}
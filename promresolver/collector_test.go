@@ -0,0 +1,60 @@
+package promresolver
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/zofan/go-resolver"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollector(t *testing.T) {
+	r := resolver.New()
+
+	// without servers the lookups fail right away
+	_, _ = r.LookupIPAddr(`example.com`)
+	_, _ = r.LookupIPAddr(`example.org`)
+	_, _ = r.LookupMX(`example.com`)
+
+	expected := `
+# HELP resolver_lookups_total Lookups by record type and outcome.
+# TYPE resolver_lookups_total counter
+resolver_lookups_total{outcome="empty_list",type="IP"} 2
+resolver_lookups_total{outcome="empty_list",type="MX"} 1
+# HELP resolver_attempts_total Queries sent to servers.
+# TYPE resolver_attempts_total counter
+resolver_attempts_total 0
+# HELP resolver_healthy_servers Servers neither quarantined nor caught misbehaving.
+# TYPE resolver_healthy_servers gauge
+resolver_healthy_servers 0
+`
+	err := testutil.CollectAndCompare(NewCollector(r, 0), strings.NewReader(expected),
+		`resolver_lookups_total`, `resolver_attempts_total`, `resolver_healthy_servers`)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTopServers(t *testing.T) {
+	c := NewCollector(resolver.New(), 2)
+
+	top := c.topServers(map[string]uint64{`a`: 5, `b`: 3, `c`: 2, `d`: 1})
+	if len(top) != 3 || top[`a`] != 5 || top[`b`] != 3 || top[`other`] != 3 {
+		t.Errorf(`unexpected top servers %v`, top)
+	}
+}
+
+func TestTopLatency(t *testing.T) {
+	c := NewCollector(resolver.New(), 1)
+
+	hist := func(n uint64) resolver.LatencyHistogram {
+		counts := make([]uint64, len(resolver.LatencyBuckets)+1)
+		counts[0] = n
+		return resolver.LatencyHistogram{Counts: counts, Count: n, Sum: time.Millisecond * time.Duration(n)}
+	}
+
+	top := c.topLatency(map[string]resolver.LatencyHistogram{`a`: hist(5), `b`: hist(2), `c`: hist(1)})
+	if len(top) != 2 || top[`a`].Count != 5 || top[`other`].Count != 3 || top[`other`].Counts[0] != 3 {
+		t.Errorf(`unexpected top latency %v`, top)
+	}
+}
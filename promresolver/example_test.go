@@ -0,0 +1,19 @@
+package promresolver_test
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/zofan/go-resolver"
+	"github.com/zofan/go-resolver/promresolver"
+	"net/http"
+)
+
+func Example() {
+	r := resolver.New()
+	_, _ = r.LoadServersFromString(`8.8.8.8`)
+
+	prometheus.MustRegister(promresolver.NewCollector(r, 0))
+
+	http.Handle(`/metrics`, promhttp.Handler())
+	_ = http.ListenAndServe(`:9153`, nil)
+}
@@ -0,0 +1,130 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+)
+
+// Query sends a raw query for name to the servers the way the lookups do and
+// returns the first successful response. Responses with an error code other
+// than NXDOMAIN count as a server failure and the query moves on, their code
+// is reported by the Rcode method of the returned error. A response without
+// records of qtype fails with ErrNoData.
+//
+// With Settings.DNSSEC the query asks for the DNSSEC records and the status
+// of the response goes into the DNSSEC field of WithMeta. With
+// DNSSECValidate the AD bit of the response is set when it is Secure, and a
+// Bogus response, negative ones included, counts as a failure of the server
+// with a *BogusError.
+func (r *Resolver) Query(ctx context.Context, name string, qtype Type, opts ...LookupOption) (*Message, error) {
+	var resp *Message
+	var status ValidationStatus
+	name, opts, err := r.hostName(qtype.String(), name, opts)
+	if err != nil {
+		return nil, err
+	}
+	if m, err := r.specialQuery(name, qtype, opts); m != nil || err != nil {
+		return m, err
+	}
+
+	err = r.attempt(qtype.String(), name, func(ctx context.Context, addr, name string, s *Settings) error {
+		q := newQuery(name, qtype)
+		switch s.DNSSEC {
+		case DNSSECTrustAD:
+			q.AuthenticData = true
+			q.setDO()
+		case DNSSECValidate:
+			q.CheckingDisabled = true
+			q.setDO()
+		}
+
+		m, err := r.exchange(ctx, addr, q)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		st, err := r.validateResponse(ctx, addr, m, name, qtype, s)
+		if err != nil {
+			return err
+		}
+		if m.Rcode != RcodeSuccess {
+			return &ResponseError{Server: addr, Code: m.Rcode}
+		}
+		if qtype != TypeCNAME {
+			if _, err := cnameChain(name, m.Answers, s.MaxCNAMEDepth); err != nil {
+				return err
+			}
+		}
+		if !hasType(m.Answers, qtype) {
+			return ErrNoData
+		}
+		if qtype == TypeA || qtype == TypeAAAA {
+			if err := filteredAnswer(s, name, addr, answerIPs(m)); err != nil {
+				return err
+			}
+		}
+
+		resp, status = m, st
+		return nil
+	}, func() string { return rrSummary(resp) }, append([]LookupOption{WithContext(ctx)}, opts...)...)
+	if err == nil && status != ValidationNone {
+		if meta := r.lookupOptions(opts).meta; meta != nil {
+			meta.DNSSEC = status
+		}
+	}
+	err = r.fallback(err, func(l Lookuper) (err error) {
+		resp, err = l.Query(ctx, name, qtype, opts...)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// validateResponse returns the DNSSEC status of the response m of addr. A
+// bogus one fails with a *BogusError.
+func (r *Resolver) validateResponse(ctx context.Context, addr string, m *Message, name string, qtype Type, s *Settings) (ValidationStatus, error) {
+	switch s.DNSSEC {
+	case DNSSECTrustAD:
+		if m.AuthenticData {
+			return ValidationSecure, nil
+		}
+		return ValidationInsecure, nil
+	case DNSSECValidate:
+		if m.Rcode != RcodeSuccess && m.Rcode != RcodeNameError {
+			return ValidationNone, nil
+		}
+	default:
+		return ValidationNone, nil
+	}
+
+	v := &validator{r: r, ctx: ctx, addr: addr, trust: r.trustStore()}
+	status, err := v.validate(m, name, qtype)
+	var reason bogusError
+	if errors.As(err, &reason) {
+		if l := s.Logger; l != nil {
+			l.Warn(`resolver: bogus answer`, `host`, name, `type`, qtype.String(), `server`, addr, `reason`, string(reason))
+		}
+		return ValidationBogus, &BogusError{Server: addr, Name: name, Type: qtype, Reason: string(reason)}
+	}
+	if err != nil {
+		return ValidationNone, err
+	}
+	m.AuthenticData = status == ValidationSecure
+
+	return status, nil
+}
+
+func hasType(rrs []RR, qtype Type) bool {
+	for _, rr := range rrs {
+		if rr.Type == qtype || qtype == TypeANY {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,138 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestQuery(t *testing.T) {
+	server := newTestServer(t, answerA(map[string]string{`example.com`: `192.0.2.1`}))
+
+	r := New()
+	r.DialTimeout = time.Second * 2
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	resp, err := r.Query(context.Background(), `example.com`, TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Answers) != 1 || resp.Answers[0].IP.String() != `192.0.2.1` {
+		t.Errorf(`unexpected answers %+v`, resp.Answers)
+	}
+
+	_, err = r.Query(context.Background(), `nx.example.com`, TypeA)
+	if !errors.Is(err, ErrNoSuchHost) {
+		t.Errorf(`expected ErrNoSuchHost, got %v`, err)
+	}
+
+	var lookupErr *LookupError
+	if !errors.As(err, &lookupErr) || lookupErr.Rcode() != RcodeNameError || lookupErr.Type != `A` {
+		t.Errorf(`unexpected error %+v`, lookupErr)
+	}
+}
+
+func TestQueryRcode(t *testing.T) {
+	for _, rcode := range []int{RcodeServerFailure, RcodeRefused, RcodeFormatError} {
+		rcode := rcode
+		server := newTestServer(t, func(q Question, resp *Message) {
+			resp.Rcode = rcode
+		})
+
+		r := New()
+		r.RetryLimit = 1
+		r.DialTimeout = time.Second * 2
+		_, _ = r.LoadServersFromString(server.Addr)
+
+		_, err := r.Query(context.Background(), `example.com`, TypeA)
+		if !errors.Is(err, ErrRetryLimit) {
+			t.Errorf(`%s: expected ErrRetryLimit, got %v`, RcodeName(rcode), err)
+		}
+
+		var lookupErr *LookupError
+		if !errors.As(err, &lookupErr) || lookupErr.Rcode() != rcode {
+			t.Errorf(`%s: unexpected error %v`, RcodeName(rcode), err)
+		}
+
+		var respErr *ResponseError
+		if !errors.As(err, &respErr) || respErr.Server != server.Addr || respErr.Temporary() != (rcode == RcodeServerFailure) {
+			t.Errorf(`%s: unexpected response error %+v`, RcodeName(rcode), respErr)
+		}
+	}
+}
+
+func TestNoData(t *testing.T) {
+	server := newTestServer(t, answerA(map[string]string{`example.com`: `192.0.2.1`}))
+
+	r := New()
+	r.DialTimeout = time.Second * 2
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	_, err := r.Query(context.Background(), `example.com`, TypeAAAA)
+	if !errors.Is(err, ErrNoData) || errors.Is(err, ErrNoSuchHost) {
+		t.Errorf(`expected ErrNoData, got %v`, err)
+	}
+
+	_, err = r.LookupMX(`example.com`)
+	var noData *NoDataError
+	if !errors.As(err, &noData) || noData.Host != `example.com` || noData.Type != `MX` || noData.Server != server.Addr {
+		t.Errorf(`expected NoDataError, got %v`, err)
+	}
+
+	_, err = r.LookupMX(`nx.example.com`)
+	if !errors.Is(err, ErrNoSuchHost) || errors.Is(err, ErrNoData) {
+		t.Errorf(`expected ErrNoSuchHost, got %v`, err)
+	}
+
+	if q := r.QuarantinedServers(); len(q) != 0 {
+		t.Errorf(`server quarantined for an authoritative answer: %+v`, q)
+	}
+}
+
+func TestQueryCanceled(t *testing.T) {
+	server := newTestServer(t, answerA(map[string]string{`example.com`: `192.0.2.1`}))
+
+	r := New()
+	r.MaxFails = 1
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := r.Query(ctx, `example.com`, TypeA); !errors.Is(err, context.Canceled) {
+		t.Errorf(`expected context.Canceled, got %v`, err)
+	}
+	if _, err := r.Query(context.Background(), `example.com`, TypeA); err != nil {
+		t.Errorf(`server penalized for a cancelled query: %v`, err)
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	silent, err := net.ListenPacket(`udp`, `127.0.0.1:0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	server := newTestServer(t, answerA(map[string]string{`example.com`: `192.0.2.1`}))
+
+	r := New()
+	r.DialTimeout = time.Millisecond * 100
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString(silent.LocalAddr().String() + "\n" + server.Addr)
+
+	// each query ends with DialTimeout, well before the deadline of ctx
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if _, err := r.Query(ctx, `example.com`, TypeA); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d > time.Second*5 {
+		t.Errorf(`expected the silent server given up on after DialTimeout, took %s`, d)
+	}
+}
@@ -0,0 +1,183 @@
+package resolver
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueryLogFormat is the line format of the query log.
+type QueryLogFormat int
+
+const (
+	// QueryLogText writes dig-like lines:
+	//	2006-01-02T15:04:05.000Z example.com A @8.8.8.8:53 NOERROR success 12ms 93.184.216.34
+	QueryLogText QueryLogFormat = iota
+	// QueryLogJSON writes one JSON object per line.
+	QueryLogJSON
+)
+
+// queryLogEntry is one line of the query log.
+type queryLogEntry struct {
+	Time     time.Time `json:"time"`
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Server   string    `json:"server,omitempty"`
+	Attempt  int       `json:"attempt,omitempty"`
+	Outcome  string    `json:"outcome"`
+	Rcode    string    `json:"rcode,omitempty"`
+	Answer   string    `json:"answer,omitempty"`
+	Duration float64   `json:"duration_ms"`
+}
+
+// queryLog buffers the lines for the writer of QueryLog, they reach it when
+// the buffer fills up, on FlushQueryLog and on Close.
+type queryLog struct {
+	dst io.Writer
+	buf *bufio.Writer
+	mu  sync.Mutex
+}
+
+func (l *queryLog) write(w io.Writer, format QueryLogFormat, e *queryLogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.dst != w {
+		if l.buf != nil {
+			_ = l.buf.Flush()
+		}
+		l.dst = w
+		l.buf = bufio.NewWriter(w)
+	}
+
+	if format == QueryLogJSON {
+		b, _ := json.Marshal(e)
+		_, _ = l.buf.Write(append(b, '\n'))
+		return
+	}
+
+	server := `-`
+	if e.Server != `` {
+		server = `@` + e.Server
+	}
+	rcode := e.Rcode
+	if rcode == `` {
+		rcode = `-`
+	}
+
+	_, _ = l.buf.WriteString(e.Time.UTC().Format(`2006-01-02T15:04:05.000Z`) + ` ` + e.Name + ` ` + e.Type + ` ` +
+		server + ` ` + rcode + ` ` + e.Outcome + ` ` + strconv.FormatFloat(e.Duration, 'f', -1, 64) + `ms`)
+	if e.Answer != `` {
+		_, _ = l.buf.WriteString(` ` + e.Answer)
+	}
+	_ = l.buf.WriteByte('\n')
+}
+
+func (l *queryLog) flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.buf == nil {
+		return nil
+	}
+
+	return l.buf.Flush()
+}
+
+// FlushQueryLog writes the buffered lines of the query log out.
+func (r *Resolver) FlushQueryLog() error {
+	return r.qlog.flush()
+}
+
+// logQuery writes a lookup, or with server an attempt of it, to the query
+// log.
+func (r *Resolver) logQuery(o *lookupOptions, name, qtype, server string, attempt int, err error, d time.Duration) {
+	e := queryLogEntry{
+		Time:     time.Now().Add(-d),
+		Name:     name,
+		Type:     qtype,
+		Server:   server,
+		Attempt:  attempt,
+		Duration: float64(d.Microseconds()) / 1000,
+	}
+
+	if server == `` {
+		e.Outcome = Outcome(err)
+	} else {
+		e.Outcome = attemptOutcome(err)
+	}
+
+	switch rcode := rcodeOf(err); {
+	case err == nil || e.Outcome == OutcomeNoData:
+		e.Rcode = RcodeName(RcodeSuccess)
+	case rcode >= 0:
+		e.Rcode = RcodeName(rcode)
+	}
+
+	if err == nil && o.summary != nil {
+		e.Answer = o.summary()
+	}
+
+	r.qlog.write(o.settings.QueryLog, o.settings.QueryLogFormat, &e)
+}
+
+func ipSummary(ips []net.IPAddr) string {
+	list := make([]string, len(ips))
+	for i, ip := range ips {
+		list[i] = ip.String()
+	}
+
+	return strings.Join(list, ` `)
+}
+
+func nsSummary(nss []*net.NS) string {
+	list := make([]string, len(nss))
+	for i, ns := range nss {
+		list[i] = ns.Host
+	}
+
+	return strings.Join(list, ` `)
+}
+
+func mxSummary(mxs []*net.MX) string {
+	list := make([]string, len(mxs))
+	for i, mx := range mxs {
+		list[i] = strconv.Itoa(int(mx.Pref)) + ` ` + mx.Host
+	}
+
+	return strings.Join(list, `, `)
+}
+
+func txtSummary(txts []string) string {
+	list := make([]string, len(txts))
+	for i, txt := range txts {
+		list[i] = strconv.Quote(txt)
+	}
+
+	return strings.Join(list, ` `)
+}
+
+func rrSummary(m *Message) string {
+	if m == nil {
+		return ``
+	}
+
+	list := make([]string, 0, len(m.Answers))
+	for _, rr := range m.Answers {
+		switch {
+		case rr.IP != nil:
+			list = append(list, rr.IP.String())
+		case rr.Target != ``:
+			list = append(list, rr.Target)
+		case len(rr.Text) > 0:
+			list = append(list, txtSummary(rr.Text))
+		}
+	}
+
+	return strings.Join(list, ` `)
+}
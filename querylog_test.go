@@ -0,0 +1,68 @@
+package resolver
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestQueryLogText(t *testing.T) {
+	server := newTestServer(t, answerA(map[string]string{`example.com`: `192.0.2.1`}))
+
+	var buf bytes.Buffer
+	r := New()
+	r.RetryLimit = 1
+	r.QueryLog = &buf
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	_, _ = r.LookupIPAddr(`example.com`)
+	_, _ = r.LookupIPAddr(`nx.example.com`)
+
+	if buf.Len() != 0 {
+		t.Errorf(`lines written before the flush: %q`, buf.String())
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf(`expected 2 lines, got %q`, lines)
+	}
+
+	// lookup lines carry no server, the attempts do
+	fields := strings.Fields(lines[0])
+	if len(fields) != 8 || fields[1] != `example.com` || fields[2] != `IP` || fields[3] != `-` ||
+		fields[4] != `NOERROR` || fields[5] != OutcomeSuccess || fields[7] != `192.0.2.1` {
+		t.Errorf(`unexpected line %q`, lines[0])
+	}
+	if fields := strings.Fields(lines[1]); fields[4] != `NXDOMAIN` || fields[5] != OutcomeNotFound {
+		t.Errorf(`unexpected line %q`, lines[1])
+	}
+}
+
+func TestQueryLogJSONAttempts(t *testing.T) {
+	server := newTestServer(t, answerA(map[string]string{`example.com`: `192.0.2.1`}))
+
+	var buf bytes.Buffer
+	r := New()
+	r.QueryLog = &buf
+	r.QueryLogFormat = QueryLogJSON
+	r.QueryLogAttempts = true
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	_, _ = r.LookupMX(`example.com`)
+	if err := r.FlushQueryLog(); err != nil {
+		t.Fatal(err)
+	}
+
+	var e queryLogEntry
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &e); err != nil {
+		t.Fatalf(`%v: %q`, err, buf.String())
+	}
+	if e.Name != `example.com` || e.Type != `MX` || e.Server != server.Addr || e.Attempt != 1 ||
+		e.Outcome != OutcomeNoData || e.Rcode != `NOERROR` || e.Time.IsZero() {
+		t.Errorf(`unexpected entry %+v`, e)
+	}
+}
@@ -0,0 +1,123 @@
+package resolver
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter paces the attempts of the lookups, *rate.Limiter of
+// golang.org/x/time/rate is one. Wait blocks until an attempt may be sent
+// or ctx is done, Allow reports whether one may be sent right now.
+type RateLimiter interface {
+	Allow() bool
+	Wait(ctx context.Context) error
+}
+
+// NewRateLimiter returns a token bucket letting qps attempts through per
+// second on average and up to burst at once, burst below 1 is 1.
+func NewRateLimiter(qps float64, burst int) RateLimiter {
+	return newTokenBucket(qps, burst)
+}
+
+type tokenBucket struct {
+	qps    float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+func newTokenBucket(qps float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{qps: qps, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// reserve takes a token and returns how long to wait for it, the tokens go
+// negative for the attempts queued behind.
+func (b *tokenBucket) reserve(now time.Time, onlyNow bool) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens += now.Sub(b.last).Seconds() * b.qps
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if onlyNow && b.tokens < 1 {
+		return 0, false
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0, true
+	}
+
+	return time.Duration(-b.tokens / b.qps * float64(time.Second)), true
+}
+
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	b.tokens++
+	b.mu.Unlock()
+}
+
+func (b *tokenBucket) Allow() bool {
+	_, ok := b.reserve(time.Now(), true)
+	return ok
+}
+
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	d, _ := b.reserve(time.Now(), false)
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	}
+}
+
+// rateLimit keeps the built-in limiter of the resolver, replaced when QPS or
+// Burst change.
+type rateLimit struct {
+	bucket *tokenBucket
+	qps    float64
+	burst  int
+	mu     sync.Mutex
+}
+
+// rateLimiter returns the limiter of s, nil when the attempts are not
+// limited.
+func (r *Resolver) rateLimiter(s *Settings) RateLimiter {
+	if s.RateLimiter != nil {
+		return s.RateLimiter
+	}
+	if s.QPS <= 0 {
+		return nil
+	}
+
+	rl := r.rate
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.bucket == nil || rl.qps != s.QPS || rl.burst != s.Burst {
+		rl.bucket, rl.qps, rl.burst = newTokenBucket(s.QPS, s.Burst), s.QPS, s.Burst
+	}
+
+	return rl.bucket
+}
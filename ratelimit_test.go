@@ -0,0 +1,95 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(10, 3)
+	for i := 0; i < 3; i++ {
+		if !b.Allow() {
+			t.Fatalf(`attempt %d of the burst refused`, i+1)
+		}
+	}
+	if b.Allow() {
+		t.Error(`attempt over the burst allowed`)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if err := b.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf(`expected the wait to time out, got %v`, err)
+	}
+
+	start := time.Now()
+	if err := b.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < time.Millisecond*50 {
+		t.Errorf(`waited only %s for a token`, d)
+	}
+}
+
+func TestRateLimitRetries(t *testing.T) {
+	r := New()
+	r.RetryLimit = 4
+	r.RetrySleep = 0
+	r.QPS = 50
+	r.Burst = 1
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2")
+
+	start := time.Now()
+	_ = r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		return errors.New(`connection refused`)
+	})
+	// the first attempt uses the burst, the three retries wait 20ms each
+	if d := time.Since(start); d < time.Millisecond*55 {
+		t.Errorf(`four attempts took only %s`, d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := r.lookup(`A`, `example.com`, func(*net.Resolver) error { return nil }, WithContext(ctx))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf(`expected the canceled wait to fail the lookup, got %v`, err)
+	}
+}
+
+type countingLimiter struct {
+	waits int32
+}
+
+func (l *countingLimiter) Allow() bool { return true }
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	atomic.AddInt32(&l.waits, 1)
+	return nil
+}
+
+func TestCustomRateLimiter(t *testing.T) {
+	l := &countingLimiter{}
+	r := New()
+	r.RetrySleep = 0
+	r.QPS = 0.001 // ignored with a RateLimiter
+	r.RateLimiter = l
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2")
+
+	calls := 0
+	err := r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		if calls++; calls < 3 {
+			return errors.New(`connection refused`)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&l.waits); n != 3 {
+		t.Errorf(`expected a wait per attempt, got %d`, n)
+	}
+}
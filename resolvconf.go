@@ -0,0 +1,138 @@
+package resolver
+
+import (
+	"bufio"
+	"github.com/zofan/go-slist"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The limits of the resolv.conf options, those of glibc.
+const (
+	maxResolvNdots    = 15
+	maxResolvTimeout  = 30
+	maxResolvAttempts = 5
+)
+
+// ResolvConf is what a resolv.conf file sets. The options it does not set
+// are left zero, Ndots -1, Options takes only those it does.
+type ResolvConf struct {
+	Nameservers []string
+	Search      []string      // of the last search or domain line
+	Ndots       int           // ndots:n, 0 trying every name as it is first
+	Timeout     time.Duration // per query, timeout:n
+	Attempts    int           // per nameserver, attempts:n
+	Rotate      bool
+
+	// Unknown are the options not listed above, like edns0 or trust-ad.
+	Unknown []string
+}
+
+// ReadResolvConf parses the resolv.conf file at path.
+func ReadResolvConf(path string) (*ResolvConf, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseResolvConf(f)
+}
+
+// ParseResolvConf parses a resolv.conf file, the glibc way: a line starting
+// with # or ; is a comment, the last search or domain line wins and numbers
+// out of range are capped. Unknown lines are skipped, unknown options are
+// kept in Unknown and malformed ones are skipped too.
+func ParseResolvConf(r io.Reader) (*ResolvConf, error) {
+	conf := &ResolvConf{Ndots: -1}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == `` || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		f := strings.Fields(line)
+		switch f[0] {
+		case `nameserver`:
+			if len(f) >= 2 {
+				conf.Nameservers = append(conf.Nameservers, f[1])
+			}
+		case `search`:
+			conf.Search = append([]string(nil), f[1:]...)
+		case `domain`:
+			if len(f) >= 2 {
+				conf.Search = []string{f[1]}
+			}
+		case `options`:
+			for _, opt := range f[1:] {
+				conf.option(opt)
+			}
+		}
+	}
+
+	return conf, scanner.Err()
+}
+
+func (c *ResolvConf) option(opt string) {
+	name, value, hasValue := strings.Cut(opt, `:`)
+	n, err := strconv.Atoi(value)
+	if hasValue && (err != nil || n < 0) {
+		return
+	}
+
+	switch {
+	case name == `ndots` && hasValue:
+		c.Ndots = minInt(n, maxResolvNdots)
+	case name == `timeout` && hasValue:
+		c.Timeout = time.Duration(minInt(n, maxResolvTimeout)) * time.Second
+	case name == `attempts` && hasValue:
+		c.Attempts = minInt(n, maxResolvAttempts)
+	case name == `rotate` && !hasValue:
+		c.Rotate = true
+	default:
+		c.Unknown = append(c.Unknown, opt)
+	}
+}
+
+// Options returns the options of NewWithOptions setting up a resolver the
+// way c asks: the nameservers, timeout as DialTimeout and attempts as a
+// RetryLimit of that many tries of every nameserver, with the default
+// RetrySleep. Rotate is ModeRotate; without it the servers still rotate,
+// there is no mode trying them in order. Search and Ndots are WithSearch,
+// with DefaultNDots when there is no ndots option.
+func (c *ResolvConf) Options() []Option {
+	var opts []Option
+	if len(c.Search) > 0 {
+		ndots := c.Ndots
+		if ndots < 0 {
+			ndots = DefaultNDots
+		}
+		opts = append(opts, WithSearch(c.Search, ndots))
+	}
+	if c.Rotate {
+		opts = append(opts, WithSelectionMode(slist.ModeRotate, DefaultBanThreshold))
+	}
+	if len(c.Nameservers) > 0 {
+		opts = append(opts, WithServers(c.Nameservers))
+	}
+	if c.Timeout > 0 {
+		opts = append(opts, WithDialTimeout(c.Timeout))
+	}
+	if c.Attempts > 0 && len(c.Nameservers) > 0 {
+		opts = append(opts, WithRetry(c.Attempts*len(c.Nameservers), DefaultSettings().RetrySleep))
+	}
+
+	return opts
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,102 @@
+package resolver
+
+import (
+	"github.com/zofan/go-slist"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadResolvConf(t *testing.T) {
+	cases := map[string]ResolvConf{
+		`glibc`: {
+			Nameservers: []string{`10.0.0.1`, `10.0.0.2`, `2001:db8::53`},
+			Search:      []string{`corp.example.com`, `example.com`},
+			Ndots:       2,
+			Timeout:     time.Second * 2,
+			Attempts:    3,
+			Rotate:      true,
+			Unknown:     []string{`single-request-reopen`},
+		},
+		`musl`: {
+			Nameservers: []string{`192.0.2.53`},
+			Search:      []string{`example.org`},
+			Ndots:       1,
+			Timeout:     time.Second * 10,
+			Attempts:    2,
+		},
+		`systemd`: {
+			Nameservers: []string{`127.0.0.53`},
+			Search:      []string{`lan`},
+			Ndots:       -1,
+			Unknown:     []string{`edns0`, `trust-ad`},
+		},
+	}
+	for name, want := range cases {
+		conf, err := ReadResolvConf(filepath.Join(`testdata`, `resolv.conf.`+name))
+		if err != nil {
+			t.Errorf(`%s: %v`, name, err)
+			continue
+		}
+		if !reflect.DeepEqual(*conf, want) {
+			t.Errorf(`%s: expected %+v, got %+v`, name, want, *conf)
+		}
+	}
+}
+
+func TestParseResolvConf(t *testing.T) {
+	conf, err := ParseResolvConf(strings.NewReader("search a.example\ndomain b.example\nnameserver\noptions ndots:99 timeout:x attempts:-1 inet6\nsortlist 10.0.0.0/8\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ResolvConf{Search: []string{`b.example`}, Ndots: maxResolvNdots, Unknown: []string{`inet6`}}
+	if !reflect.DeepEqual(*conf, want) {
+		t.Errorf(`expected %+v, got %+v`, want, *conf)
+	}
+}
+
+func TestResolvConfOptions(t *testing.T) {
+	conf, err := ReadResolvConf(filepath.Join(`testdata`, `resolv.conf.glibc`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewWithOptions(conf.Options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Servers.Count() != 3 || r.DialTimeout != time.Second*2 || r.RetryLimit != 9 || r.selectMode != slist.ModeRotate {
+		t.Errorf(`unexpected setup: %s`, r)
+	}
+	if !reflect.DeepEqual(r.SearchDomains, conf.Search) || r.NDots != 2 {
+		t.Errorf(`expected the search domains and ndots, got %v, %d`, r.SearchDomains, r.NDots)
+	}
+	if r.RetrySleep != DefaultSettings().RetrySleep {
+		t.Errorf(`expected the default retry sleep, got %s`, r.RetrySleep)
+	}
+}
+
+func TestResolvConfNdotsZero(t *testing.T) {
+	conf, err := ParseResolvConf(strings.NewReader("search corp.example\noptions ndots:0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Ndots != 0 {
+		t.Fatalf(`expected ndots 0 kept, got %d`, conf.Ndots)
+	}
+
+	r, err := NewWithOptions(conf.Options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.NDots != 0 {
+		t.Errorf(`expected an NDots of 0, got %d`, r.NDots)
+	}
+
+	conf, _ = ParseResolvConf(strings.NewReader("search corp.example\n"))
+	if r, _ := NewWithOptions(conf.Options()...); r.NDots != DefaultNDots {
+		t.Errorf(`expected DefaultNDots without the option, got %d`, r.NDots)
+	}
+}
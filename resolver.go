@@ -3,9 +3,13 @@ package resolver
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/zofan/go-slist"
 	"net"
+	"net/netip"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,161 +22,871 @@ const (
 var (
 	ErrRetryLimit = errors.New(`resolver: retry limit`)
 	ErrNoSuchHost = errors.New(`resolver: host not found`)
+	ErrNoData     = errors.New(`resolver: no records of the requested type`)
+
+	ErrResolverClosed = errors.New(`resolver: closed`)
 )
 
 type Resolver struct {
-	Servers *slist.List
+	Servers ServerList
+
+	Settings
+
+	selectMode   slist.SelectMode
+	banThreshold int
+	begun        int32 // set by the first lookup, see SetSelectionMode
+	closed       int32
+	done         chan struct{} // closed by Close
+
+	health       *healthTable
+	network      *networkState
+	audits       *auditTable
+	stats        *stats
+	slots        *serverSlots
+	rate         *rateLimit
+	domains      *domainLimits
+	gate         *releases
+	flights      *flights
+	watches      *watches
+	cursors      *cursors
+	resolvers    sync.Map // string -> *serverRes
+	events       *eventBus
+	pool         *poolState
+	qlog         *queryLog
+	filter       *serverFilter
+	ring         *hashRing
+	routes       map[string]*route
+	tags         map[string]map[string]string
+	middleware   []Middleware
+	fallbacks    []Lookuper
+	rootHints    []string
+	domainPolicy atomic.Value // *domainPolicy
+	trust        atomic.Value // *trustStore
+	dns64        *dns64State
+	hosts        *hostsFile
+	mu           sync.Mutex
+	settingsMu   sync.RWMutex
+}
 
-	DialTimeout      time.Duration
-	MaxFails         uint32
-	RetryLimit       int
-	RetrySleep       time.Duration
-	BypassNative     bool
-	DisableKeepAlive bool
+// New returns a resolver with DefaultSettings and no servers, with opts
+// applied in order and checked together. It panics when they fail, which
+// NewWithOptions returns as an error instead.
+func New(opts ...Option) *Resolver {
+	r, err := NewWithOptions(opts...)
+	if err != nil {
+		panic(err)
+	}
 
-	mu sync.Mutex
+	return r
 }
 
-func New() *Resolver {
-	r := &Resolver{
-		DialTimeout:      time.Second * 2, // don't work, look at problem (net.dnsConfig.timeout - net/dnsconfig_unix.go:43)
-		RetryLimit:       5,
-		RetrySleep:       time.Millisecond * 500,
-		MaxFails:         30,
-		DisableKeepAlive: true,
+func newResolver() *Resolver {
+	return &Resolver{
+		Settings: DefaultSettings(),
+
+		health:       newHealthTable(),
+		network:      newNetworkState(),
+		audits:       newAuditTable(),
+		stats:        newStats(),
+		slots:        newServerSlots(),
+		rate:         &rateLimit{},
+		domains:      &domainLimits{},
+		gate:         newReleases(),
+		flights:      &flights{},
+		watches:      &watches{},
+		cursors:      &cursors{},
+		events:       &eventBus{},
+		done:         make(chan struct{}),
+		pool:         &poolState{},
+		qlog:         &queryLog{},
+		dns64:        &dns64State{},
+		hosts:        &hostsFile{},
+		selectMode:   DefaultSelectMode,
+		banThreshold: DefaultBanThreshold,
+	}
+}
 
-		Servers: slist.New(slist.ModeRotate, 3),
+// Close stops the background work of the resolver: the watches,
+// ValidatePeriodically and the wait for the network to come back. It ends
+// the event subscriptions, closing their channels, gives up the expvar
+// prefixes and flushes the query log. Lookups started afterwards fail with
+// ErrResolverClosed, those already running finish. Closing again does
+// nothing. The goroutine go-slist starts with the default server list, made
+// on the first server added, cannot be stopped and is left running.
+func (r *Resolver) Close() error {
+	if !atomic.CompareAndSwapInt32(&r.closed, 0, 1) {
+		return nil
 	}
 
-	return r
+	close(r.done)
+	r.events.close()
+	r.unpublishExpvar()
+
+	return r.qlog.flush()
 }
 
-func (r *Resolver) LookupIPAddr(host string) (ipList []net.IPAddr, err error) {
-	err = r.lookup(host, func(resolver *net.Resolver) (err error) {
-		ipList, err = resolver.LookupIPAddr(context.Background(), host)
+// LookupIPAddr returns the IPv4 and IPv6 addresses of host. A host that does
+// not exist fails with ErrNoSuchHost, one with neither A nor AAAA records
+// with ErrNoData. With FilterBogons set bogon addresses are left out and an
+// answer with nothing else fails with ErrOnlyBogusAddresses.
+//
+// With SplitFamilies A and AAAA are separate lookups, counted as such. When
+// one of them fails the addresses of the other come with a *FamilyError, or
+// with RequireBothFamilies none do.
+//
+// With DNS64 set a host with IPv4 addresses only gets the IPv6 addresses
+// of the NAT64 as well, see Settings.DNS64.
+//
+// An IP literal host, bracketed or with a zone as well, is returned as it
+// is, and with HostsFile set so are the addresses of a host in the hosts
+// file, or with SpecialUse set the loopback addresses of localhost. No
+// lookup is made then, nor counted.
+func (r *Resolver) LookupIPAddr(host string, opts ...LookupOption) (ipList []net.IPAddr, err error) {
+	if ip, ok := ipLiteral(host); ok {
+		return []net.IPAddr{ip}, nil
+	}
+	if host, opts, err = r.hostName(`IP`, host, opts); err != nil {
+		return nil, err
+	}
+	if ips := r.hostsAddrs(host, opts); len(ips) > 0 {
+		return ips, nil
+	}
+	if ips := r.loopbackAddrs(host, opts); ips != nil {
+		return ips, nil
+	}
+	defer func() {
+		if len(ipList) > 0 {
+			ipList = r.synthesize(host, ipList, opts)
+		}
+	}()
+	native := func(ctx context.Context) (err error) {
+		ipList, err = systemResolver.LookupIPAddr(ctx, fqdn(host))
+		if err == nil {
+			s := r.settings()
+			ipList, err = stripBogons(&s, host, ``, ipList)
+		}
 		return
-	})
+	}
 
-	if r.BypassNative && err == slist.ErrServerListEmpty {
-		ipList, err = net.DefaultResolver.LookupIPAddr(context.Background(), host)
+	if done, err := r.beforeServers(`IP`, host, native, opts); done {
+		return ipList, err
 	}
 
+	if s := r.settings(); s.SplitFamilies {
+		ipList, err = r.lookupFamilies(host, &s, opts)
+		err = r.fallback(err, func(l Lookuper) (err error) {
+			ipList, err = l.LookupIPAddr(host, opts...)
+			return
+		})
+		return ipList, r.bypass(err, native)
+	}
+
+	err = r.attempt(`IP`, host, func(ctx context.Context, addr, name string, s *Settings) (err error) {
+		ipList, err = r.serverResolver(addr, s).LookupIPAddr(ctx, fqdn(name))
+		if err == nil {
+			ips := make([]net.IP, len(ipList))
+			for i, ip := range ipList {
+				ips[i] = ip.IP
+			}
+			if err = filteredAnswer(s, name, addr, ips); err != nil {
+				ipList = nil
+				return err
+			}
+			ipList, err = stripBogons(s, name, addr, ipList)
+			return err
+		}
+		return r.noData(ctx, err, addr, name, TypeA, s)
+	}, func() string { return ipSummary(ipList) }, opts...)
+
+	err = r.fallback(err, func(l Lookuper) (err error) {
+		ipList, err = l.LookupIPAddr(host, opts...)
+		return
+	})
+	err = r.bypass(err, native)
+
 	return ipList, err
 }
 
-func (r *Resolver) LookupAddr(ip string) (names []string, err error) {
-	err = r.lookup(ip, func(resolver *net.Resolver) (err error) {
-		names, err = resolver.LookupAddr(context.Background(), ip)
+// LookupAddr returns the names pointing to ip. Without a PTR record it fails
+// with ErrNoData, or with ErrNoSuchHost when the reverse zone has no entry
+// for ip at all. With HostsFile set the names of ip in the hosts file are
+// returned without a lookup. An ip that is not an address fails with an
+// *InvalidAddrError.
+func (r *Resolver) LookupAddr(ip string, opts ...LookupOption) ([]string, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, &LookupError{Name: ip, Type: `PTR`, Err: &InvalidAddrError{Addr: ip, Reason: `not an IP address`}}
+	}
+
+	return r.lookupAddr(ip, addr.AsSlice(), opts)
+}
+
+// LookupAddrIP is LookupAddr for an address already parsed, an IPv4-mapped
+// one is looked up as IPv4. A malformed or unspecified address fails with an
+// *InvalidAddrError, no lookup is made then.
+func (r *Resolver) LookupAddrIP(ip net.IP, opts ...LookupOption) ([]string, error) {
+	if err := checkAddr(ip); err != nil {
+		return nil, &LookupError{Name: ip.String(), Type: `PTR`, Err: err}
+	}
+
+	return r.lookupAddr(ip.String(), ip, opts)
+}
+
+// LookupAddrNetIP is LookupAddrIP for a netip.Addr, its zone plays no part in
+// a reverse lookup.
+func (r *Resolver) LookupAddrNetIP(ip netip.Addr, opts ...LookupOption) ([]string, error) {
+	if !ip.IsValid() {
+		return nil, &LookupError{Name: ip.String(), Type: `PTR`, Err: &InvalidAddrError{Addr: ip.String(), Reason: `not an IPv4 or IPv6 address`}}
+	}
+
+	return r.LookupAddrIP(ip.AsSlice(), opts...)
+}
+
+// lookupAddr is the reverse lookup of ip, value being the name of it in the
+// results and the reports. The PTR query goes out for the reverse name of
+// ip, unless a middleware passed on another value.
+func (r *Resolver) lookupAddr(value string, ip net.IP, opts []LookupOption) (names []string, err error) {
+	if names := r.hostsNames(value, opts); len(names) > 0 {
+		return names, nil
+	}
+	native := func(ctx context.Context) (err error) {
+		names, err = systemResolver.LookupAddr(ctx, ip.String())
 		return
-	})
+	}
+
+	done, err := r.nativeFirst(value, native, opts)
+	if !done {
+		reverse := reverseIP(ip)
+		err = r.attempt(`PTR`, value, func(ctx context.Context, addr, name string, s *Settings) error {
+			q := reverse
+			if name != value {
+				q = reverseName(name)
+			}
+			m, err := r.exchange(ctx, addr, newQuery(q, TypePTR))
+			if err != nil {
+				return err
+			}
+			if m.Rcode != RcodeSuccess {
+				return &ResponseError{Server: addr, Code: m.Rcode}
+			}
+			if _, err := cnameChain(q, m.Answers, s.MaxCNAMEDepth); err != nil {
+				return err
+			}
+
+			names = names[:0]
+			for _, rr := range m.Answers {
+				if rr.Type == TypePTR {
+					names = append(names, rr.Target)
+				}
+			}
+			if len(names) == 0 {
+				return ErrNoData
+			}
+			return nil
+		}, func() string { return strings.Join(names, ` `) }, opts...)
+		if err != nil {
+			names = nil
+		}
 
-	if r.BypassNative && err == slist.ErrServerListEmpty {
-		names, err = net.DefaultResolver.LookupAddr(context.Background(), ip)
+		err = r.fallback(err, func(l Lookuper) (err error) {
+			names, err = l.LookupAddr(value, opts...)
+			return
+		})
+		err = r.bypass(err, native)
+	}
+
+	if !r.settings().RawNames {
+		for i := range names {
+			names[i] = nameKey(names[i])
+		}
+	}
+	o := r.lookupOptions(opts)
+	for i := range names {
+		names[i] = o.decodeIDN(names[i])
 	}
 
 	return names, err
 }
 
-func (r *Resolver) LookupNS(host string) (nsList []*net.NS, err error) {
-	err = r.lookup(host, func(resolver *net.Resolver) (err error) {
-		nsList, err = resolver.LookupNS(context.Background(), host)
+// LookupNS returns the NS records of host, failing with ErrNoData when host
+// exists but has none and with ErrNoSuchHost when it does not exist.
+func (r *Resolver) LookupNS(host string, opts ...LookupOption) (nsList []*net.NS, err error) {
+	if host, opts, err = r.hostName(`NS`, host, opts); err != nil {
+		return nil, err
+	}
+	native := func(ctx context.Context) (err error) {
+		nsList, err = systemResolver.LookupNS(ctx, fqdn(host))
 		return
-	})
+	}
 
-	if r.BypassNative && err == slist.ErrServerListEmpty {
-		nsList, err = net.DefaultResolver.LookupNS(context.Background(), host)
+	done, err := r.beforeServers(`NS`, host, native, opts)
+	if !done {
+		err = r.attempt(`NS`, host, func(ctx context.Context, addr, name string, s *Settings) (err error) {
+			nsList, err = r.serverResolver(addr, s).LookupNS(ctx, fqdn(name))
+			return r.noData(ctx, err, addr, name, TypeNS, s)
+		}, func() string { return nsSummary(nsList) }, opts...)
+
+		err = r.fallback(err, func(l Lookuper) (err error) {
+			nsList, err = l.LookupNS(host, opts...)
+			return
+		})
+		err = r.bypass(err, native)
+	}
+
+	if !r.settings().RawNames {
+		for _, ns := range nsList {
+			ns.Host = nameKey(ns.Host)
+		}
+	}
+	o := r.lookupOptions(opts)
+	for _, ns := range nsList {
+		ns.Host = o.decodeIDN(ns.Host)
 	}
 
 	return nsList, err
 }
 
-func (r *Resolver) LookupTXT(host string) (result []string, err error) {
-	err = r.lookup(host, func(resolver *net.Resolver) (err error) {
-		result, err = resolver.LookupTXT(context.Background(), host)
+// LookupTXT returns the TXT records of host, failing with ErrNoData when
+// host exists but has none and with ErrNoSuchHost when it does not exist.
+func (r *Resolver) LookupTXT(host string, opts ...LookupOption) (result []string, err error) {
+	if host, opts, err = r.hostName(`TXT`, host, opts); err != nil {
+		return nil, err
+	}
+	native := func(ctx context.Context) (err error) {
+		result, err = systemResolver.LookupTXT(ctx, fqdn(host))
 		return
-	})
+	}
 
-	if r.BypassNative && err == slist.ErrServerListEmpty {
-		result, err = net.DefaultResolver.LookupTXT(context.Background(), host)
+	if done, err := r.beforeServers(`TXT`, host, native, opts); done {
+		return result, err
 	}
 
+	err = r.attempt(`TXT`, host, func(ctx context.Context, addr, name string, s *Settings) (err error) {
+		result, err = r.serverResolver(addr, s).LookupTXT(ctx, fqdn(name))
+		return r.noData(ctx, err, addr, name, TypeTXT, s)
+	}, func() string { return txtSummary(result) }, opts...)
+
+	err = r.fallback(err, func(l Lookuper) (err error) {
+		result, err = l.LookupTXT(host, opts...)
+		return
+	})
+	err = r.bypass(err, native)
+
 	return result, err
 }
 
-func (r *Resolver) LookupCNAME(host string) (cname string, err error) {
-	err = r.lookup(host, func(resolver *net.Resolver) (err error) {
-		cname, err = resolver.LookupCNAME(context.Background(), host)
+// LookupCNAME returns the canonical name of host, which is host itself when
+// it has no CNAME. A host without any records fails with ErrNoData, one that
+// does not exist with ErrNoSuchHost.
+func (r *Resolver) LookupCNAME(host string, opts ...LookupOption) (cname string, err error) {
+	if host, opts, err = r.hostName(`CNAME`, host, opts); err != nil {
+		return ``, err
+	}
+	native := func(ctx context.Context) (err error) {
+		cname, err = systemResolver.LookupCNAME(ctx, fqdn(host))
 		return
-	})
+	}
+
+	done, err := r.beforeServers(`CNAME`, host, native, opts)
+	if !done {
+		err = r.attempt(`CNAME`, host, func(ctx context.Context, addr, name string, s *Settings) (err error) {
+			cname, err = r.serverResolver(addr, s).LookupCNAME(ctx, fqdn(name))
+			return r.noData(ctx, err, addr, name, TypeCNAME, s)
+		}, func() string { return cname }, opts...)
+
+		err = r.fallback(err, func(l Lookuper) (err error) {
+			cname, err = l.LookupCNAME(host, opts...)
+			return
+		})
+		err = r.bypass(err, native)
+	}
 
-	if r.BypassNative && err == slist.ErrServerListEmpty {
-		cname, err = net.DefaultResolver.LookupCNAME(context.Background(), host)
+	if !r.settings().RawNames {
+		cname = nameKey(cname)
 	}
+	cname = r.lookupOptions(opts).decodeIDN(cname)
 
 	return cname, err
 }
 
-func (r *Resolver) LookupMX(host string) (mxList []*net.MX, err error) {
-	err = r.lookup(host, func(resolver *net.Resolver) (err error) {
-		mxList, err = resolver.LookupMX(context.Background(), host)
+// LookupMX returns the MX records of host, failing with ErrNoData when host
+// exists but has none and with ErrNoSuchHost when it does not exist.
+func (r *Resolver) LookupMX(host string, opts ...LookupOption) (mxList []*net.MX, err error) {
+	if host, opts, err = r.hostName(`MX`, host, opts); err != nil {
+		return nil, err
+	}
+	native := func(ctx context.Context) (err error) {
+		mxList, err = systemResolver.LookupMX(ctx, fqdn(host))
 		return
-	})
+	}
 
-	if r.BypassNative && err == slist.ErrServerListEmpty {
-		mxList, err = net.DefaultResolver.LookupMX(context.Background(), host)
+	done, err := r.beforeServers(`MX`, host, native, opts)
+	if !done {
+		err = r.attempt(`MX`, host, func(ctx context.Context, addr, name string, s *Settings) (err error) {
+			mxList, err = r.serverResolver(addr, s).LookupMX(ctx, fqdn(name))
+			return r.noData(ctx, err, addr, name, TypeMX, s)
+		}, func() string { return mxSummary(mxList) }, opts...)
+
+		err = r.fallback(err, func(l Lookuper) (err error) {
+			mxList, err = l.LookupMX(host, opts...)
+			return
+		})
+		err = r.bypass(err, native)
+	}
+
+	if !r.settings().RawNames {
+		for _, mx := range mxList {
+			mx.Host = nameKey(mx.Host)
+		}
+	}
+	o := r.lookupOptions(opts)
+	for _, mx := range mxList {
+		mx.Host = o.decodeIDN(mx.Host)
 	}
 
 	return mxList, err
 }
 
-func (r *Resolver) lookup(value string, fn func(*net.Resolver) error) error {
-	var err error
-	attempts := 1
+// bypass runs the lookup on the system resolver when BypassNative is set
+// and err is one of BypassOn. A failure of it is recorded in the
+// EmptyListError, or returned in a *BypassError. It comes after the
+// fallbacks.
+func (r *Resolver) bypass(err error, native func(ctx context.Context) error) error {
+	s := r.settings()
+	if !s.BypassNative || err == nil || !s.BypassOn.takes(err) || pinned(err) {
+		return err
+	}
+
+	nativeErr := native(context.Background())
+	if nativeErr == nil {
+		r.stats.path(PathNative)
+		return nil
+	}
 
-	for {
-		server, err := r.Servers.Get()
+	var empty *EmptyListError
+	if !errors.As(err, &empty) {
+		return &BypassError{Err: err, NativeErr: nativeErr}
+	}
+	empty.BypassNative = true
+	empty.NativeErr = nativeErr
+
+	return err
+}
+
+// noData tells NODATA from NXDOMAIN for a not found error of the stdlib,
+// which reports both the same, by asking addr for the name again. Without an
+// answer err is kept.
+func (r *Resolver) noData(ctx context.Context, err error, addr, name string, qtype Type, s *Settings) error {
+	if !isNotFound(err) {
+		return err
+	}
+
+	resp, qerr := r.exchange(ctx, addr, newQuery(name, qtype))
+	if qerr != nil || resp.Rcode != RcodeSuccess {
+		return err
+	}
+	if _, cerr := cnameChain(name, resp.Answers, s.MaxCNAMEDepth); cerr != nil {
+		return cerr
+	}
+
+	return ErrNoData
+}
+
+// getServer picks the next server from the pool the health policy admits.
+// With the default policy quarantined servers are skipped and probationary
+// ones only used once in a while or when nothing else is left.
+//
+// With a tag selector only matching servers are used, when none of them is
+// left the lookup fails with ErrNoTaggedServer, or with TagFallback set goes
+// on without the selector.
+func (r *Resolver) getServer(pool ServerList, value string, tried []Attempt, o *lookupOptions) (*Server, error) {
+	if pool == o.servers {
+		return pool.Get()
+	}
+
+	server, err := r.pickServer(pool, value, tried, o.tags, o)
+	if err == ErrServerListEmpty && len(o.tags) > 0 {
+		if !o.settings.TagFallback {
+			return nil, ErrNoTaggedServer
+		}
+		return r.pickServer(pool, value, tried, nil, o)
+	}
+
+	return server, err
+}
+
+func (r *Resolver) pickServer(pool ServerList, value string, tried []Attempt, sel TagSelector, o *lookupOptions) (*Server, error) {
+	var fallback *Server
+	var busy bool
+	s := &o.settings
+	policy := o.policy(r)
+	admitter, graded := policy.(admitter)
+	now := time.Now()
+
+	for i, n := 0, pool.Count(); i < n; i++ {
+		var server *Server
+		var err error
+
+		if s.StickyByHost && pool == r.Servers {
+			server, err = r.stickyServer(pool, value, i, tried)
+		} else {
+			server, err = pool.Get()
+		}
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if !r.serverAllowed(server.Addr) || !r.serverMatches(server.Addr, sel) {
+			continue
+		}
+		if r.slots.full(server.Addr, s.MaxConcurrentPerServer) {
+			busy = true
+			continue
 		}
 
-		stdR := &net.Resolver{
-			PreferGo: true,
-			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-				d := net.Dialer{
-					Timeout:  r.DialTimeout,
-					Resolver: nil,
-				}
+		if !graded {
+			// the evictions hold whatever the policy
+			switch r.health.evicted(server.Addr, r.healthConfig(s), now) {
+			case admitRecheck:
+				go r.recheckServer(server.Addr)
+				continue
+			case admitSkip:
+				continue
+			}
+			if !policy.ShouldSkip(server.Addr) {
+				return server, nil
+			}
+			continue
+		}
 
-				if r.DisableKeepAlive {
-					d.KeepAlive = -1
-				}
+		switch admitter.admit(server.Addr, now) {
+		case admitOK:
+			return server, nil
+		case admitProbation:
+			if fallback == nil {
+				fallback = server
+			}
+		}
+	}
 
-				return d.DialContext(ctx, `udp`, server.Addr+addressSuffix)
-			},
+	if fallback != nil {
+		return fallback, nil
+	}
+	if busy {
+		return nil, errServersBusy
+	}
+
+	return nil, ErrServerListEmpty
+}
+
+func (r *Resolver) markGood(pool ServerList, server *Server, o *lookupOptions, latency time.Duration) {
+	pool.MarkGood(server)
+	if pool == o.servers && !o.settings.ServerOverrideHealth {
+		return
+	}
+	r.health.record(server.Addr, nil, latency, time.Now())
+	o.policy(r).OnSuccess(server.Addr, latency)
+}
+
+// markBad reports the failure to the list and to the health policy, which
+// quarantines the server.
+func (r *Resolver) markBad(pool ServerList, server *Server, o *lookupOptions, err error) {
+	pool.MarkBad(server)
+	r.stats.serverFailure(server.Addr)
+	if pool == o.servers && !o.settings.ServerOverrideHealth {
+		return
+	}
+	r.health.record(server.Addr, err, 0, time.Now())
+	r.events.emit(EventServerFailed, server.Addr, err.Error())
+	o.policy(r).OnFailure(server.Addr, err)
+}
+
+func (r *Resolver) healthConfig(s *Settings) healthConfig {
+	return healthConfig{
+		maxFails:  int(s.MaxFails),
+		maxStreak: r.banThreshold,
+		halfLife:  s.FailHalfLife,
+		goodAfter: s.GoodAfter,
+		probation: s.ProbationSuccesses,
+
+		circuitFails:    s.CircuitThreshold,
+		circuitCooldown: s.CircuitCooldown,
+
+		recheck:        s.RecheckInterval,
+		evictFiltering: s.EvictFiltering,
+
+		ratioWindow: s.FailureRatioWindow,
+		maxRatio:    s.MaxFailureRatio,
+		minSamples:  s.FailureRatioSamples,
+
+		base:   s.QuarantineDuration,
+		growth: s.QuarantineGrowth,
+		steps:  s.QuarantineSteps,
+		max:    s.MaxQuarantineDuration,
+		decay:  s.QuarantineDecay,
+	}
+}
+
+// lookup calls fn with resolvers bound to one server after another until an
+// attempt succeeds, the host is reported as not existing, the retry limit is
+// reached or no server is left. Failures are returned as *LookupError.
+func (r *Resolver) lookup(qtype, value string, fn func(*net.Resolver) error, opts ...LookupOption) error {
+	return r.attempt(qtype, value, func(_ context.Context, addr, _ string, s *Settings) error {
+		return fn(r.serverResolver(addr, s))
+	}, nil, opts...)
+}
+
+// attempt is lookup for callers that talk to the server themselves.
+func (r *Resolver) attempt(qtype, value string, fn func(ctx context.Context, addr, name string, s *Settings) error, summary func() string, opts ...LookupOption) (err error) {
+	if atomic.LoadInt32(&r.begun) == 0 {
+		atomic.StoreInt32(&r.begun, 1)
+	}
+	if atomic.LoadInt32(&r.closed) != 0 {
+		return &LookupError{Name: value, Type: qtype, Err: ErrResolverClosed}
+	}
+	checked := value
+	if qtype == `PTR` {
+		checked = reverseName(value)
+	}
+	if err := r.checkDomain(checked); err != nil {
+		atomic.AddUint64(&r.stats.blocked, 1)
+		return &LookupError{Name: value, Type: qtype, Err: err}
+	}
+	o := r.lookupOptions(opts)
+	o.summary = summary
+	if err := r.enter(o); err != nil {
+		return &LookupError{Name: value, Type: qtype, Err: err}
+	}
+	defer r.leave()
+	start := time.Now()
+
+	if o.settings.QueryLog != nil && !o.settings.QueryLogAttempts {
+		defer func() { r.logQuery(o, value, qtype, ``, 0, err, time.Since(start)) }()
+	}
+
+	if o.meta != nil {
+		*o.meta = LookupMeta{}
+	}
+	if o.trace != nil {
+		o.trace.begin(value, qtype, start)
+		defer func() { o.trace.end(err, time.Since(start)) }()
+	}
+
+	if !o.settings.hasHooks() {
+		err = r.search(qtype, value, fn, o, nil)
+		r.stats.lookup(qtype, err, time.Since(start))
+		return err
+	}
+
+	info := &LookupInfo{Host: value, Type: qtype}
+	r.hookStart(&o.settings, info)
+
+	err = r.search(qtype, value, fn, o, info)
+	d := time.Since(start)
+	r.stats.lookup(qtype, err, d)
+	r.hookDone(&o.settings, info, err, d)
+
+	return err
+}
+
+// run is the attempt loop of a lookup, info is kept up to date for the
+// hooks when there are any.
+func (r *Resolver) run(qtype, value string, fn func(ctx context.Context, addr, name string, s *Settings) error, o *lookupOptions, info *LookupInfo) error {
+	lookupErr := LookupError{Name: value, Type: qtype}
+
+	if qtype != `PTR` && !o.settings.RelaxedNames {
+		if err := validateName(value); err != nil {
+			return lookupErr.fail(err)
+		}
+	}
+
+	// reverse names all share in-addr.arpa, they are not limited
+	if o.settings.DomainQPS > 0 && qtype != `PTR` {
+		if err := r.limitDomain(value, o); err != nil {
+			return lookupErr.fail(err)
+		}
+	}
+
+	pool := r.Servers
+	routed := value
+	if qtype == `PTR` {
+		routed = reverseName(value)
+	}
+	var rt *route
+	if o.servers != nil {
+		pool = o.servers
+		lookupErr.pinned = true
+	} else if rt = r.matchRoute(routed); rt != nil {
+		pool = rt.servers
+		lookupErr.pinned = true
+	}
+
+	var suspects []string
+	localFails := 0
+	for attempts := 1; ; attempts++ {
+		if down, since := r.network.isDown(); down {
+			return lookupErr.fail(&NetworkDownError{Since: since})
+		}
+
+		if limiter := r.rateLimiter(&o.settings); limiter != nil {
+			if err := limiter.Wait(o.ctx); err != nil {
+				return lookupErr.fail(err)
+			}
 		}
 
-		err = fn(stdR)
-		{
-			if err, ok := err.(*net.DNSError); ok && err.IsNotFound {
-				r.Servers.MarkGood(server)
-				return ErrNoSuchHost
-			} else if err == nil {
-				r.Servers.MarkGood(server)
-				break
-			} else {
-				r.Servers.MarkBad(server)
+		server, getErr := r.reserveServer(pool, value, lookupErr.Attempts, o)
+		if getErr == ErrServerListEmpty && rt != nil {
+			return lookupErr.fail(fmt.Errorf(`%w: %s`, ErrRouteExhausted, rt.suffix))
+		} else if getErr == ErrServerListEmpty {
+			empty := r.emptyListError(pool)
+			if l := o.settings.Logger; l != nil {
+				l.Warn(`resolver: no server left`, `host`, value, `size`, empty.Size, `quarantined`, empty.Quarantined)
 			}
+			return lookupErr.fail(empty)
+		} else if getErr != nil {
+			return lookupErr.fail(getErr)
 		}
 
-		if r.RetryLimit > 0 && attempts >= r.RetryLimit {
-			return ErrRetryLimit
+		atomic.AddUint64(&r.stats.attempts, 1)
+		if l := o.settings.Logger; l != nil {
+			l.Debug(`resolver: attempt`, `host`, value, `type`, qtype, `server`, server.Addr, `attempt`, attempts)
+		}
+		if info != nil {
+			info.Attempt, info.Server = attempts, server.Addr
+			r.hookAttempt(&o.settings, info)
 		}
-		attempts++
 
-		if r.Servers.Count() < maxServersForSleep {
-			time.Sleep(r.RetrySleep)
+		start := time.Now()
+		attemptErr := r.send(o.ctx, server.Addr, value, fn, &o.settings)
+		latency := time.Since(start)
+		r.stats.attemptLatency(server.Addr, latency)
+		if o.settings.QueryLog != nil && o.settings.QueryLogAttempts {
+			r.logQuery(o, value, qtype, server.Addr, attempts, attemptErr, latency)
+		}
+		if o.trace != nil {
+			o.trace.attempt(server.Addr, start, latency, attemptErr)
+		}
+		if attemptErr != nil {
+			if l := o.settings.Logger; l != nil {
+				l.Debug(`resolver: attempt failed`, `host`, value, `type`, qtype, `server`, server.Addr, `error`, attemptErr)
+			}
+			lookupErr.add(Attempt{
+				Server:   server.Addr,
+				Err:      attemptErr,
+				Duration: latency,
+			})
+		}
+
+		if isTransportError(attemptErr) {
+			r.networkFailure(server.Addr, &o.settings)
+			if down, since := r.network.isDown(); down {
+				// the failure is the network's, not the server's
+				return lookupErr.fail(&NetworkDownError{Since: since})
+			}
+		} else if !isCallerError(attemptErr) {
+			r.network.success()
+		}
+
+		switch {
+		case attemptErr == nil:
+			if o.meta != nil {
+				*o.meta = LookupMeta{Server: server.Addr, Transport: `udp`, Attempt: attempts, RTT: latency}
+			}
+			r.markGood(pool, server, o, latency)
+			// another server answered normally, the blocking was theirs
+			for _, addr := range suspects {
+				r.health.setFiltering(addr)
+				if l := o.settings.Logger; l != nil {
+					l.Warn(`resolver: server filtering`, `server`, addr, `host`, value, `evicted`, o.settings.EvictFiltering)
+				}
+			}
+			r.maybeAudit(qtype, value, server.Addr, &o.settings)
+			return nil
+		case errors.Is(attemptErr, ErrFilteredAnswer):
+			if o.settings.FilteredAnswers == FilteredError {
+				return lookupErr.fail(attemptErr)
+			}
+			suspects = append(suspects, server.Addr)
+		case errors.Is(attemptErr, ErrOnlyBogusAddresses):
+			// the server answered, it is the name that points nowhere useful
+			r.markGood(pool, server, o, latency)
+			return lookupErr.fail(attemptErr)
+		case errors.Is(attemptErr, ErrNoData):
+			r.markGood(pool, server, o, latency)
+			return lookupErr.fail(&NoDataError{Host: value, Type: qtype, Server: server.Addr})
+		case isNotFound(attemptErr):
+			r.markGood(pool, server, o, latency)
+			return lookupErr.fail(&NotFoundError{Host: value, Server: server.Addr, Err: attemptErr})
+		case isCallerError(attemptErr), errors.Is(attemptErr, ErrCNAMELoop):
+			return lookupErr.fail(attemptErr)
+		case isLocalError(attemptErr):
+			// not the fault of the server, but give up once every server
+			// has failed this way
+			if localFails++; localFails >= pool.Count() {
+				return lookupErr.fail(attemptErr)
+			}
+		default:
+			r.markBad(pool, server, o, attemptErr)
+		}
+
+		if o.settings.RetryLimit > 0 && attempts >= o.settings.RetryLimit {
+			return lookupErr.fail(&RetryLimitError{Host: value, Err: attemptErr})
+		}
+
+		if pool.Count() < maxServersForSleep {
+			time.Sleep(o.settings.RetrySleep)
 		}
 	}
+}
 
-	return err
+// serverResolver returns a resolver sending every query to addr. It is
+// made once per server and made again when the dial settings change.
+func (r *Resolver) serverResolver(addr string, s *Settings) *net.Resolver {
+	if v, ok := r.resolvers.Load(addr); ok {
+		if sr := v.(*serverRes); sr.timeout == s.DialTimeout && sr.noKeepAlive == s.DisableKeepAlive {
+			return sr.res
+		}
+	}
+
+	sr := newServerRes(addr, s)
+	r.resolvers.Store(addr, sr)
+
+	return sr.res
+}
+
+// serverRes is the resolver of a server and the settings it was made with.
+type serverRes struct {
+	res         *net.Resolver
+	timeout     time.Duration
+	noKeepAlive bool
+}
+
+func newServerRes(addr string, s *Settings) *serverRes {
+	d := &net.Dialer{Timeout: s.DialTimeout}
+	if s.DisableKeepAlive {
+		d.KeepAlive = -1
+	}
+	address := serverAddress(addr)
+
+	return &serverRes{
+		res: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return d.DialContext(ctx, `udp`, address)
+			},
+		},
+		timeout:     s.DialTimeout,
+		noKeepAlive: s.DisableKeepAlive,
+	}
+}
+
+// serverAddress appends the default DNS port unless addr already has one.
+func serverAddress(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	if strings.IndexByte(addr, ':') >= 0 {
+		return `[` + addr + `]` + addressSuffix
+	}
+
+	return addr + addressSuffix
 }
@@ -1,10 +1,14 @@
 package resolver
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/zofan/go-slist"
+	"net"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestResolveHost(t *testing.T) {
@@ -33,7 +37,7 @@ func TestResolveNotExistsHost(t *testing.T) {
 	}
 
 	_, err = r.LookupIPAddr(`abc-123-def-456-zzzzzzz.com`)
-	if err != ErrNoSuchHost {
+	if !errors.Is(err, ErrNoSuchHost) {
 		t.Error(err)
 	}
 }
@@ -82,9 +86,14 @@ func TestRetryLimit(t *testing.T) {
 	}
 
 	_, err = r.LookupIPAddr(`google.com`)
-	if err != ErrRetryLimit {
+	if !errors.Is(err, ErrRetryLimit) {
 		t.Error(err)
 	}
+
+	var netErr net.Error
+	if !errors.As(err, &netErr) {
+		t.Errorf(`expected the cause of the last attempt in %v`, err)
+	}
 }
 
 func TestRemoveBadServer(t *testing.T) {
@@ -98,7 +107,7 @@ func TestRemoveBadServer(t *testing.T) {
 	}
 
 	_, err = r.LookupIPAddr(`google.com`)
-	if err != slist.ErrServerListEmpty {
+	if !errors.Is(err, slist.ErrServerListEmpty) {
 		t.Error(err)
 	}
 }
@@ -139,3 +148,172 @@ func TestConcurrency(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestLookupSuccessAfterFailures(t *testing.T) {
+	r := New()
+	r.RetryLimit = 5
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2\n10.0.0.3")
+
+	calls := 0
+	err := r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		if calls++; calls < 3 {
+			return errors.New(`connection refused`)
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf(`expected success on the third attempt, got %v after %d`, err, calls)
+	}
+}
+
+func TestLookupNotFound(t *testing.T) {
+	r := New()
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2\n10.0.0.3")
+
+	calls := 0
+	err := r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		calls++
+		return fmt.Errorf(`lookup: %w`, &net.DNSError{Err: `no such host`, IsNotFound: true})
+	})
+	if !errors.Is(err, ErrNoSuchHost) || calls != 1 {
+		t.Errorf(`expected ErrNoSuchHost after one attempt, got %v after %d`, err, calls)
+	}
+}
+
+func TestLookupRetryLimit(t *testing.T) {
+	r := New()
+	r.RetryLimit = 2
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2\n10.0.0.3\n10.0.0.4\n10.0.0.5")
+
+	calls := 0
+	err := r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		calls++
+		return errors.New(`i/o timeout`)
+	})
+	if !errors.Is(err, ErrRetryLimit) || calls != 2 {
+		t.Errorf(`expected ErrRetryLimit after two attempts, got %v after %d`, err, calls)
+	}
+}
+
+func TestLookupEmptyList(t *testing.T) {
+	r := New()
+
+	err := r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		t.Error(`fn called without servers`)
+		return nil
+	})
+	if !errors.Is(err, slist.ErrServerListEmpty) {
+		t.Errorf(`expected ErrServerListEmpty, got %v`, err)
+	}
+}
+
+func TestResolveNoData(t *testing.T) {
+	r := New()
+
+	err := r.Servers.LoadFromString("8.8.8.8")
+	if err != nil {
+		t.Error(err)
+	}
+
+	// github.com has A records but no AAAA
+	_, err = r.Query(context.Background(), `github.com`, TypeAAAA)
+	if !errors.Is(err, ErrNoData) {
+		t.Error(err)
+	}
+}
+
+func TestServerResolverReuse(t *testing.T) {
+	r := New()
+	s := r.settings()
+
+	a := r.serverResolver(`10.0.0.1`, &s)
+	if r.serverResolver(`10.0.0.1`, &s) != a {
+		t.Error(`resolver of the server made again`)
+	}
+	if r.serverResolver(`10.0.0.2`, &s) == a {
+		t.Error(`servers share a resolver`)
+	}
+
+	s.DialTimeout *= 2
+	b := r.serverResolver(`10.0.0.1`, &s)
+	if b == a {
+		t.Error(`resolver kept after the dial settings changed`)
+	}
+	if r.serverResolver(`10.0.0.1`, &s) != b {
+		t.Error(`new resolver of the server not kept`)
+	}
+}
+
+func BenchmarkLookupCached(b *testing.B) {
+	server := newTestServer(b, answerA(map[string]string{`example.com`: `192.0.2.1`}))
+
+	r := New()
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.LookupIPAddr(`example.com`); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	server := newTestServer(t, answerA(map[string]string{`example.com`: `192.0.2.1`}))
+
+	r := New()
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	watch, err := r.Watch(context.Background(), `example.com`, TypeA, time.Millisecond*10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-watch
+
+	started := make(chan struct{})
+	running := make(chan error, 1)
+	go func() {
+		running <- r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+			close(started)
+			time.Sleep(time.Millisecond * 20)
+			return nil
+		})
+	}()
+	<-started
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := <-running; err != nil {
+		t.Errorf(`expected the running lookup to finish, got %v`, err)
+	}
+	if _, err := r.LookupIPAddr(`example.com`); !errors.Is(err, ErrResolverClosed) {
+		t.Errorf(`expected ErrResolverClosed, got %v`, err)
+	}
+
+	select {
+	case _, ok := <-watch:
+		for ok {
+			_, ok = <-watch
+		}
+	case <-time.After(time.Second):
+		t.Fatal(`watch not closed`)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf(`closing again: %v`, err)
+	}
+}
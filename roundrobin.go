@@ -0,0 +1,154 @@
+package resolver
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultRoundRobinTTL is how long NextIP keeps an answer when
+	// RoundRobinTTL is 0.
+	DefaultRoundRobinTTL = time.Second * 30
+
+	// maxCursors is how many hosts NextIP keeps a cursor for, expired ones
+	// are dropped past it.
+	maxCursors = 4096
+)
+
+// ipCursor is where NextIP is in the addresses of a host.
+type ipCursor struct {
+	ips     []net.IPAddr
+	set     string // the sorted addresses, to tell a changed answer
+	next    int
+	expires time.Time
+}
+
+type cursors struct {
+	hosts map[string]*ipCursor
+	mu    sync.Mutex
+}
+
+// NextIP returns the addresses of host one after another across calls, so
+// that connections spread over all of them. The answer is kept for
+// RoundRobinTTL, the order starts over when a new answer has other
+// addresses. With RoundRobinFamily set to TypeA or TypeAAAA only the
+// addresses of that family are handed out while there are any.
+func (r *Resolver) NextIP(host string, opts ...LookupOption) (net.IPAddr, error) {
+	if ip, ok := ipLiteral(host); ok {
+		return ip, nil
+	}
+	key, opts, err := r.hostName(`IP`, host, opts)
+	if err != nil {
+		return net.IPAddr{}, err
+	}
+	if err := r.checkDomain(key); err != nil {
+		atomic.AddUint64(&r.stats.blocked, 1)
+		return net.IPAddr{}, &LookupError{Name: key, Type: `IP`, Err: err}
+	}
+	s := r.settings()
+	now := time.Now()
+
+	r.cursors.mu.Lock()
+	c, ok := r.cursors.hosts[key]
+	if ok && now.Before(c.expires) {
+		ip := c.take()
+		r.cursors.mu.Unlock()
+		return ip, nil
+	}
+	r.cursors.mu.Unlock()
+
+	// the addresses of a family that failed with SplitFamilies will do
+	ips, err := r.LookupIPAddr(key, opts...)
+	if len(ips) == 0 {
+		if err == nil {
+			err = &NoDataError{Host: key, Type: `IP`}
+		}
+		return net.IPAddr{}, err
+	}
+	ips = preferFamily(ips, s.RoundRobinFamily)
+	set := ipSet(ips)
+
+	ttl := s.RoundRobinTTL
+	if ttl <= 0 {
+		ttl = DefaultRoundRobinTTL
+	}
+
+	r.cursors.mu.Lock()
+	defer r.cursors.mu.Unlock()
+
+	if r.cursors.hosts == nil {
+		r.cursors.hosts = make(map[string]*ipCursor)
+	}
+	c, ok = r.cursors.hosts[key]
+	if !ok || c.set != set {
+		if !ok {
+			r.cursors.makeRoom(now)
+		}
+		c = &ipCursor{set: set}
+		r.cursors.hosts[key] = c
+	}
+	c.ips, c.expires = ips, now.Add(ttl)
+
+	return c.take(), nil
+}
+
+func (c *ipCursor) take() net.IPAddr {
+	ip := c.ips[c.next%len(c.ips)]
+	c.next = (c.next + 1) % len(c.ips)
+
+	return ip
+}
+
+// makeRoom drops the expired cursors once there are maxCursors, or any one
+// when none is.
+func (c *cursors) makeRoom(now time.Time) {
+	if len(c.hosts) < maxCursors {
+		return
+	}
+
+	for host, cur := range c.hosts {
+		if !now.Before(cur.expires) {
+			delete(c.hosts, host)
+		}
+	}
+	for host := range c.hosts {
+		if len(c.hosts) < maxCursors {
+			break
+		}
+		delete(c.hosts, host)
+	}
+}
+
+// preferFamily keeps the addresses of family, all of them when it is 0 or
+// there are none of it.
+func preferFamily(ips []net.IPAddr, family Type) []net.IPAddr {
+	if family != TypeA && family != TypeAAAA {
+		return ips
+	}
+
+	var kept []net.IPAddr
+	for _, ip := range ips {
+		if (ip.IP.To4() != nil) == (family == TypeA) {
+			kept = append(kept, ip)
+		}
+	}
+	if len(kept) == 0 {
+		return ips
+	}
+
+	return kept
+}
+
+func ipSet(ips []net.IPAddr) string {
+	list := make([]string, len(ips))
+	for i, ip := range ips {
+		list[i] = ip.String()
+	}
+	sort.Strings(list)
+
+	return strings.Join(list, ` `)
+}
@@ -0,0 +1,69 @@
+package resolver
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNextIP(t *testing.T) {
+	var mu sync.Mutex
+	ips := []string{`192.0.2.1`, `192.0.2.2`, `192.0.2.3`}
+	server := newTestServer(t, func(q Question, resp *Message) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, ip := range ips {
+			addr := net.ParseIP(ip)
+			if (addr.To4() != nil) == (q.Type == TypeA) {
+				resp.Answers = append(resp.Answers, RR{Name: q.Name, Type: q.Type, TTL: 60, IP: addr})
+			}
+		}
+	})
+
+	r := New()
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	seen := make(map[string]int)
+	var order []string
+	for i := 0; i < 6; i++ {
+		ip, err := r.NextIP(`rr.example.com`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[ip.String()]++
+		order = append(order, ip.String())
+	}
+	if len(seen) != 3 || seen[`192.0.2.1`] != 2 || seen[`192.0.2.2`] != 2 || seen[`192.0.2.3`] != 2 {
+		t.Errorf(`expected every address twice, got %v`, seen)
+	}
+	if order[0] != order[3] || order[1] != order[4] {
+		t.Errorf(`expected the same order every round, got %v`, order)
+	}
+	if st := r.Stats(); st.Lookups != 1 {
+		t.Errorf(`expected the answer to be kept, got %d lookups`, st.Lookups)
+	}
+
+	// a new answer starts over
+	mu.Lock()
+	ips = []string{`192.0.2.9`, `2001:db8::9`}
+	mu.Unlock()
+	r.cursors.hosts[`rr.example.com`].expires = time.Time{}
+	r.RoundRobinTTL = time.Nanosecond
+	r.RoundRobinFamily = TypeAAAA
+	for i := 0; i < 2; i++ {
+		if ip, err := r.NextIP(`rr.example.com`); err != nil || ip.String() != `2001:db8::9` {
+			t.Errorf(`expected the AAAA address, got %v %v`, ip, err)
+		}
+	}
+
+	r.RoundRobinFamily = TypeA
+	mu.Lock()
+	ips = []string{`2001:db8::9`}
+	mu.Unlock()
+	if ip, err := r.NextIP(`rr.example.com`); err != nil || ip.String() != `2001:db8::9` {
+		t.Errorf(`expected the other family without any A, got %v %v`, ip, err)
+	}
+}
@@ -0,0 +1,111 @@
+package resolver
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrRouteExhausted = errors.New(`resolver: routed server pool exhausted`)
+	ErrBadRoute       = errors.New(`resolver: bad route`)
+)
+
+// route sends every name under suffix to its own server list, routed lookups
+// never fall through to the default list, the fallbacks or the native resolver.
+type route struct {
+	suffix  string
+	servers ServerList
+}
+
+// AddRoute directs lookups for suffix and all of its subdomains to servers,
+// tried one after another, the longest matching suffix wins. Servers may
+// carry a port (127.0.0.1:8600). Adding an existing suffix replaces its
+// servers and resets their health, but for the servers of the default list
+// or of another route. PTR lookups are routed on their reverse name, a route
+// for 10.in-addr.arpa takes the reverse lookups of 10.0.0.0/8.
+func (r *Resolver) AddRoute(suffix string, servers []string) error {
+	suffix = routeSuffix(suffix)
+	if suffix == `` || len(servers) == 0 {
+		return ErrBadRoute
+	}
+
+	list := NewStaticList(servers...)
+	if list.Count() == 0 {
+		return ErrBadRoute
+	}
+
+	// the health of the servers the default list or another route has too
+	// is theirs as well, it is kept
+	shared := make(map[string]bool)
+	for _, s := range r.Servers.All() {
+		shared[s.Addr] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for other, rt := range r.routes {
+		if other == suffix {
+			continue
+		}
+		for _, s := range rt.servers.All() {
+			shared[s.Addr] = true
+		}
+	}
+	addrs := make([]string, 0, list.Count())
+	for _, s := range list.All() {
+		if !shared[s.Addr] {
+			addrs = append(addrs, s.Addr)
+		}
+	}
+	r.health.forget(addrs)
+
+	if r.routes == nil {
+		r.routes = make(map[string]*route)
+	}
+	r.routes[suffix] = &route{suffix: suffix, servers: list}
+
+	return nil
+}
+
+// RemoveRoute deletes the route for suffix and reports whether it existed.
+func (r *Resolver) RemoveRoute(suffix string) bool {
+	suffix = routeSuffix(suffix)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.routes[suffix]
+	delete(r.routes, suffix)
+
+	return ok
+}
+
+func (r *Resolver) matchRoute(name string) *route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.routes) == 0 {
+		return nil
+	}
+
+	name = nameKey(name)
+	for {
+		if rt, ok := r.routes[name]; ok {
+			return rt
+		}
+
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			return nil
+		}
+		name = name[i+1:]
+	}
+}
+
+func routeSuffix(suffix string) string {
+	suffix = strings.TrimPrefix(strings.TrimSpace(suffix), `*`)
+	suffix = strings.TrimPrefix(suffix, `.`)
+
+	return nameKey(suffix)
+}
@@ -0,0 +1,160 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// dialedServer reports which upstream the lookup loop handed to fn.
+func dialedServer(t *testing.T, res *net.Resolver) string {
+	conn, err := res.Dial(context.Background(), `udp`, ``)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	return conn.RemoteAddr().String()
+}
+
+func TestRouteLongestSuffix(t *testing.T) {
+	r := New()
+
+	_, err := r.LoadServersFromString("127.0.0.1")
+	if err != nil {
+		t.Error(err)
+	}
+	if err := r.AddRoute(`*.corp.example`, []string{`127.0.0.2`}); err != nil {
+		t.Error(err)
+	}
+	if err := r.AddRoute(`dev.corp.example`, []string{`127.0.0.3:8600`}); err != nil {
+		t.Error(err)
+	}
+
+	cases := map[string]string{
+		`www.corp.example`:     `127.0.0.2:53`,
+		`CORP.example.`:        `127.0.0.2:53`,
+		`a.dev.corp.example`:   `127.0.0.3:8600`,
+		`example.com`:          `127.0.0.1:53`,
+		`notcorp.example`:      `127.0.0.1:53`,
+		`corp.example.example`: `127.0.0.1:53`,
+	}
+
+	for host, want := range cases {
+		err := r.lookup(`A`, host, func(res *net.Resolver) error {
+			if got := dialedServer(t, res); got != want {
+				t.Errorf(`%s: expected %s, got %s`, host, want, got)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	if !r.RemoveRoute(`dev.corp.example`) {
+		t.Error(`expected route to be removed`)
+	}
+	_ = r.lookup(`A`, `a.dev.corp.example`, func(res *net.Resolver) error {
+		if got := dialedServer(t, res); got != `127.0.0.2:53` {
+			t.Errorf(`expected fallback to the parent route, got %s`, got)
+		}
+		return nil
+	})
+}
+
+func TestRouteNeverLeaks(t *testing.T) {
+	r := New()
+	r.RetryLimit = 2
+	r.RetrySleep = 0
+
+	_, err := r.LoadServersFromString("127.0.0.1")
+	if err != nil {
+		t.Error(err)
+	}
+	if err := r.AddRoute(`consul`, []string{`127.0.0.2`, `127.0.0.3`}); err != nil {
+		t.Error(err)
+	}
+
+	err = r.lookup(`A`, `web.service.consul`, func(res *net.Resolver) error {
+		if got := dialedServer(t, res); got == `127.0.0.1:53` {
+			t.Error(`routed lookup leaked to the default list`)
+		}
+		return &net.DNSError{Err: `connection refused`}
+	})
+	if !errors.Is(err, ErrRetryLimit) {
+		t.Error(err)
+	}
+}
+
+func TestBadRoute(t *testing.T) {
+	r := New()
+
+	if err := r.AddRoute(`*.`, []string{`127.0.0.1`}); err != ErrBadRoute {
+		t.Error(err)
+	}
+	if err := r.AddRoute(`consul`, nil); err != ErrBadRoute {
+		t.Error(err)
+	}
+}
+
+func TestRouteReplaceResetsHealth(t *testing.T) {
+	r := New()
+
+	if err := r.AddRoute(`consul`, []string{`127.0.0.2`}); err != nil {
+		t.Fatal(err)
+	}
+	addr := r.matchRoute(`consul`).servers.All()[0].Addr
+	r.health.failure(addr, 1, healthConfig{maxStreak: 1}, time.Now())
+	if st := r.health.stats([]string{addr}, 0, time.Now()); st[0].State != ServerQuarantined {
+		t.Fatalf(`expected a quarantine, got %+v`, st[0])
+	}
+
+	if err := r.AddRoute(`consul`, []string{`127.0.0.2`, `127.0.0.3`}); err != nil {
+		t.Fatal(err)
+	}
+	if st := r.health.stats([]string{addr}, 0, time.Now()); st[0].State != ServerHealthy {
+		t.Errorf(`expected the health to be reset, got %+v`, st[0])
+	}
+
+	// a server of the default list keeps the quarantine of the rotation
+	_, _ = r.LoadServersFromString(`127.0.0.4`)
+	shared := r.Servers.All()[0].Addr
+	r.health.failure(shared, 1, healthConfig{maxStreak: 1}, time.Now())
+	if err := r.AddRoute(`corp.example`, []string{shared}); err != nil {
+		t.Fatal(err)
+	}
+	if st := r.health.stats([]string{shared}, 0, time.Now()); st[0].State != ServerQuarantined {
+		t.Errorf(`expected the quarantine of the shared server kept, got %+v`, st[0])
+	}
+}
+
+func TestRoutePTR(t *testing.T) {
+	r := New()
+
+	_, err := r.LoadServersFromString("127.0.0.1")
+	if err != nil {
+		t.Error(err)
+	}
+	if err := r.AddRoute(`2.0.192.in-addr.arpa`, []string{`127.0.0.2`}); err != nil {
+		t.Error(err)
+	}
+
+	cases := map[string]string{
+		`192.0.2.1`:    `127.0.0.2:53`,
+		`198.51.100.1`: `127.0.0.1:53`,
+	}
+	for ip, want := range cases {
+		err := r.lookup(`PTR`, ip, func(res *net.Resolver) error {
+			if got := dialedServer(t, res); got != want {
+				t.Errorf(`%s: expected %s, got %s`, ip, want, got)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+)
+
+// DefaultNDots is the NDots of New, the default of resolv.conf.
+const DefaultNDots = 1
+
+// WithSearch sets SearchDomains and NDots.
+func WithSearch(domains []string, ndots int) Option {
+	return func(r *Resolver) error {
+		if ndots < 0 {
+			return ErrBadOption
+		}
+
+		r.SearchDomains = append([]string(nil), domains...)
+		r.NDots = ndots
+
+		return nil
+	}
+}
+
+// withAbsolute marks the lookup of a name ending in a dot, the search
+// domains are not tried then.
+func withAbsolute() LookupOption {
+	return func(o *lookupOptions) {
+		o.absolute = true
+	}
+}
+
+// searchNames returns the names a lookup of name tries in turn, the way the
+// stub resolvers of glibc and Go do: name with each of SearchDomains, then
+// name itself, or name first when it has at least NDots dots.
+func searchNames(name string, o *lookupOptions) []string {
+	s := &o.settings
+	if len(s.SearchDomains) == 0 || o.absolute || net.ParseIP(name) != nil {
+		return []string{name}
+	}
+
+	var names []string
+	for _, domain := range s.SearchDomains {
+		if domain = nameKey(domain); domain != `` {
+			names = append(names, name+`.`+domain)
+		}
+	}
+
+	if strings.Count(name, `.`) >= s.NDots {
+		return append([]string{name}, names...)
+	}
+
+	return append(names, name)
+}
+
+// search is chain for each of the names of searchNames until one is found.
+// A name that does not exist, has no records of qtype or is too long for a
+// search domain moves on to the next, any other failure ends the lookup.
+// The names the domain policy blocks or SpecialUse keeps from the servers
+// are skipped. The error names value and the names tried.
+func (r *Resolver) search(qtype, value string, fn func(ctx context.Context, addr, name string, s *Settings) error, o *lookupOptions, info *LookupInfo) error {
+	// checked here first to keep the common lookup free of allocations
+	if qtype == `PTR` || len(o.settings.SearchDomains) == 0 || o.absolute {
+		return r.chain(qtype, value, fn, o, info)
+	}
+	names := searchNames(value, o)
+	if len(names) == 1 {
+		return r.chain(qtype, value, fn, o, info)
+	}
+
+	var err error
+	tried := make([]string, 0, len(names))
+	for _, name := range names {
+		if name != value && r.searchBlocked(name, o) {
+			continue
+		}
+		tried = append(tried, name)
+		next := r.chain(qtype, name, fn, o, info)
+		if next == nil {
+			return nil
+		}
+		if err == nil || searchRank(next) > searchRank(err) {
+			err = next
+		}
+		if searchRank(next) == 3 {
+			// the servers failed, the other names would not fare better
+			break
+		}
+	}
+
+	var lookupErr *LookupError
+	if errors.As(err, &lookupErr) {
+		lookupErr.Name, lookupErr.Searched = value, tried
+	}
+
+	return err
+}
+
+// searchBlocked tells whether the servers are not to be asked for the
+// candidate name of a search, value itself having been checked before.
+func (r *Resolver) searchBlocked(name string, o *lookupOptions) bool {
+	if r.checkDomain(name) != nil {
+		return true
+	}
+	a, _ := specialUse(&o.settings, name)
+
+	return a != SpecialUseSend
+}
+
+// searchRank orders the failures of the names of a search: too long, no
+// such name, no records of the type, as in glibc, then any other failure.
+func searchRank(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidHost):
+		return 0
+	case errors.Is(err, ErrNoSuchHost):
+		return 1
+	case errors.Is(err, ErrNoData):
+		return 2
+	}
+
+	return 3
+}
@@ -0,0 +1,119 @@
+package resolver
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSearchNames(t *testing.T) {
+	o := &lookupOptions{settings: Settings{SearchDomains: []string{`myns.svc.cluster.local`, `svc.cluster.local.`}, NDots: DefaultNDots}}
+	tests := map[string][]string{
+		`backend`:     {`backend.myns.svc.cluster.local`, `backend.svc.cluster.local`, `backend`},
+		`www.example`: {`www.example`, `www.example.myns.svc.cluster.local`, `www.example.svc.cluster.local`},
+	}
+	for name, want := range tests {
+		if got := searchNames(name, o); !reflect.DeepEqual(got, want) {
+			t.Errorf(`%s: expected %v, got %v`, name, want, got)
+		}
+	}
+
+	o.settings.NDots = 5
+	if got := searchNames(`www.example`, o); got[len(got)-1] != `www.example` {
+		t.Errorf(`expected the name itself last below ndots, got %v`, got)
+	}
+
+	o.settings.NDots = 0
+	if got := searchNames(`backend`, o); got[0] != `backend` {
+		t.Errorf(`expected the name itself first with ndots 0, got %v`, got)
+	}
+
+	o.absolute = true
+	if got := searchNames(`backend`, o); !reflect.DeepEqual(got, []string{`backend`}) {
+		t.Errorf(`expected a name ending in a dot as it is, got %v`, got)
+	}
+}
+
+func TestSearchDomains(t *testing.T) {
+	ts := newTestServer(t, func(q Question, resp *Message) {
+		switch q.Name {
+		case `broken.other.example.`:
+			resp.Rcode = RcodeServerFailure
+		case `db.other.example.`:
+			if q.Type == TypeA {
+				resp.Answers = []RR{{Name: q.Name, Type: TypeA, TTL: 60, IP: []byte{192, 0, 2, 2}}}
+			}
+		default:
+			answerA(map[string]string{`backend.myns.svc.cluster.local`: `192.0.2.1`})(q, resp)
+		}
+	})
+
+	r, err := NewWithOptions(WithServers([]string{ts.Addr}), WithRetry(1, 0), WithSearch([]string{`other.example`, `myns.svc.cluster.local`}, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		// the names not found on the way leave the next lookup alone
+		ips, err := r.LookupIPAddr(`backend`)
+		if err != nil || len(ips) != 1 || ips[0].IP.String() != `192.0.2.1` {
+			t.Fatalf(`expected the address of the second search domain, got %v, %v`, ips, err)
+		}
+	}
+	if q := ts.Queries(); q[0].Name != `backend.other.example.` {
+		t.Errorf(`expected the first search domain asked first, got %+v`, q)
+	}
+
+	_, err = r.LookupIPAddr(`missing`)
+	var lookupErr *LookupError
+	if !errors.As(err, &lookupErr) || !errors.Is(err, ErrNoSuchHost) || lookupErr.Name != `missing` ||
+		!reflect.DeepEqual(lookupErr.Searched, []string{`missing.other.example`, `missing.myns.svc.cluster.local`, `missing`}) {
+		t.Errorf(`expected ErrNoSuchHost after every name, got %v`, err)
+	}
+	if !strings.Contains(err.Error(), `tried missing.other.example, missing.myns.svc.cluster.local, missing`) {
+		t.Errorf(`expected the names tried in the error, got %v`, err)
+	}
+
+	if _, err := r.LookupTXT(`db`); !errors.Is(err, ErrNoData) {
+		t.Errorf(`expected the name with other records to win over those not found, got %v`, err)
+	}
+
+	if _, err := r.LookupIPAddr(`backend.`); !errors.Is(err, ErrNoSuchHost) {
+		t.Errorf(`expected a name ending in a dot not searched, got %v`, err)
+	}
+
+	_, err = r.LookupIPAddr(`broken`)
+	if !errors.As(err, &lookupErr) || errors.Is(err, ErrNoSuchHost) || len(lookupErr.Searched) != 1 {
+		t.Errorf(`expected the failure of the servers to end the search, got %v`, err)
+	}
+}
+
+func TestSearchCandidatesChecked(t *testing.T) {
+	ts := newTestServer(t, answerA(map[string]string{`data.exfil.example`: `192.0.2.66`, `printer.local`: `192.0.2.9`}))
+
+	r, err := NewWithOptions(WithServers([]string{ts.Addr}), WithRetry(1, 0), WithSearch([]string{`exfil.example`, `local`}, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetDomainPolicy(nil, []string{`exfil.example`}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.LookupIPAddr(`data`)
+	var lookupErr *LookupError
+	if !errors.Is(err, ErrNoSuchHost) || !errors.As(err, &lookupErr) || !reflect.DeepEqual(lookupErr.Searched, []string{`data.local`, `data`}) {
+		t.Errorf(`expected the denied candidate skipped, got %v`, err)
+	}
+
+	r.SpecialUse = true
+	if _, err := r.LookupIPAddr(`printer`); !errors.Is(err, ErrNoSuchHost) {
+		t.Errorf(`expected the special-use candidate skipped, got %v`, err)
+	}
+
+	for _, q := range ts.Queries() {
+		if q.Name == `data.exfil.example.` || q.Name == `printer.exfil.example.` || q.Name == `printer.local.` {
+			t.Errorf(`blocked candidate %s sent`, q.Name)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package resolver
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testServer is an in-process DNS server on a loopback UDP port, handler
+// fills in the response for every query it receives.
+type testServer struct {
+	Addr string
+
+	conn    net.PacketConn
+	handler func(q Question, resp *Message)
+
+	mu      sync.Mutex
+	queries []Question
+}
+
+func newTestServer(t testing.TB, handler func(q Question, resp *Message)) *testServer {
+	return newTestServerAt(t, `127.0.0.1:0`, handler)
+}
+
+// newTestServerAt is newTestServer listening on addr.
+func newTestServerAt(t testing.TB, addr string, handler func(q Question, resp *Message)) *testServer {
+	conn, err := net.ListenPacket(`udp`, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testServer{Addr: conn.LocalAddr().String(), conn: conn, handler: handler}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go s.serve()
+
+	return s
+}
+
+func (s *testServer) serve() {
+	buf := make([]byte, 4096)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		var query Message
+		if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) != 1 {
+			continue
+		}
+
+		q := query.Questions[0]
+		s.mu.Lock()
+		s.queries = append(s.queries, q)
+		s.mu.Unlock()
+
+		resp := &Message{
+			Header: Header{
+				ID:                 query.ID,
+				Response:           true,
+				RecursionDesired:   query.RecursionDesired,
+				RecursionAvailable: true,
+			},
+			Questions: query.Questions,
+		}
+		s.handler(q, resp)
+
+		if b, err := resp.Pack(); err == nil {
+			_, _ = s.conn.WriteTo(b, addr)
+		}
+	}
+}
+
+func (s *testServer) Queries() []Question {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Question(nil), s.queries...)
+}
+
+// answerA answers A queries for the names in zone and NXDOMAIN otherwise,
+// other record types of existing names get an empty NOERROR answer.
+func answerA(zone map[string]string) func(q Question, resp *Message) {
+	return func(q Question, resp *Message) {
+		ip, ok := zone[strings.ToLower(strings.TrimSuffix(q.Name, `.`))]
+		if !ok {
+			resp.Rcode = RcodeNameError
+			return
+		}
+		if q.Type == TypeA {
+			resp.Answers = append(resp.Answers, RR{Name: q.Name, Type: TypeA, TTL: 60, IP: net.ParseIP(ip)})
+		}
+	}
+}
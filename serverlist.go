@@ -0,0 +1,243 @@
+package resolver
+
+import (
+	"bufio"
+	"github.com/zofan/go-slist"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is an entry of a ServerList.
+type Server = slist.Server
+
+// ErrServerListEmpty is what ServerList.Get returns when it has no server
+// to hand out, the one of slist.
+var ErrServerListEmpty = slist.ErrServerListEmpty
+
+// ServerList is the set of servers the lookups pick from, the list of
+// go-slist unless Servers is set to another. Add is called by the loaders,
+// LoadFromString and LoadFromURL load lines of addresses the way slist does,
+// Get is called by every attempt, followed by MarkGood once the server
+// answered or MarkBad when it failed. The quarantines are kept by the
+// resolver, a list need not take a failing server out of rotation itself.
+// All must return the servers handed out, the same *Server every time for
+// one address, it may be called while lookups are running.
+type ServerList interface {
+	Add(addr string)
+	LoadFromString(servers string) error
+	LoadFromURL(url string) error
+	All() []*Server
+	Count() int
+	Get() (*Server, error)
+	MarkGood(s *Server)
+	MarkBad(s *Server)
+}
+
+var (
+	_ ServerList = (*slist.List)(nil)
+	_ ServerList = (*slistServers)(nil)
+	_ ServerList = (*StaticList)(nil)
+
+	_ changeCounter = (*slistServers)(nil)
+	_ changeCounter = (*StaticList)(nil)
+)
+
+// slistServers is the default ServerList, a *slist.List in the selection
+// mode made when the first server is added: slist starts a goroutine with
+// every list which nothing stops, Close included, so a resolver without
+// servers has none and one with servers has one.
+type slistServers struct {
+	mode  slist.SelectMode
+	list  *slist.List
+	count uint64 // of the changes
+	mu    sync.Mutex
+}
+
+// get returns the list, making it when create is set.
+func (l *slistServers) get(create bool) *slist.List {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.list == nil && create {
+		// the resolver quarantines the failing servers, the list is not to
+		// ban them: its bans drop servers for good
+		l.list = slist.New(l.mode, math.MaxInt32)
+	}
+
+	return l.list
+}
+
+func (l *slistServers) changed() {
+	l.mu.Lock()
+	l.count++
+	l.mu.Unlock()
+}
+
+func (l *slistServers) changes() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.count
+}
+
+func (l *slistServers) Add(addr string) {
+	defer l.changed()
+	l.get(true).Add(addr)
+}
+
+func (l *slistServers) LoadFromString(servers string) error {
+	defer l.changed()
+	return l.get(true).LoadFromString(servers)
+}
+
+func (l *slistServers) LoadFromURL(url string) error {
+	defer l.changed()
+	return l.get(true).LoadFromURL(url)
+}
+
+func (l *slistServers) All() []*Server {
+	if list := l.get(false); list != nil {
+		return list.All()
+	}
+
+	return nil
+}
+
+func (l *slistServers) Count() int {
+	if list := l.get(false); list != nil {
+		return list.Count()
+	}
+
+	return 0
+}
+
+func (l *slistServers) Get() (*Server, error) {
+	if list := l.get(false); list != nil {
+		return list.Get()
+	}
+
+	return nil, ErrServerListEmpty
+}
+
+func (l *slistServers) MarkGood(s *Server) {
+	l.get(true).MarkGood(s)
+}
+
+func (l *slistServers) MarkBad(s *Server) {
+	l.get(true).MarkBad(s)
+}
+
+// StaticList is a ServerList handing out its servers one after another.
+type StaticList struct {
+	servers []*Server
+	next    int
+	count   uint64 // of the changes
+	mu      sync.Mutex
+}
+
+// NewStaticList returns a list of addrs, in that order.
+func NewStaticList(addrs ...string) *StaticList {
+	l := &StaticList{}
+	for _, addr := range addrs {
+		l.Add(addr)
+	}
+
+	return l
+}
+
+// Add appends addr unless the list already has it.
+func (l *StaticList) Add(addr string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, s := range l.servers {
+		if s.Addr == addr {
+			return
+		}
+	}
+	l.servers = append(l.servers, &Server{Addr: addr})
+	l.count++
+}
+
+func (l *StaticList) changes() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.count
+}
+
+// LoadFromString adds the servers of the lines of servers, the empty lines
+// and those starting with # left out.
+func (l *StaticList) LoadFromString(servers string) error {
+	return l.load(strings.NewReader(servers))
+}
+
+// LoadFromURL adds the servers of the lines of the document at url, the way
+// LoadFromString does.
+func (l *StaticList) LoadFromURL(url string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return l.load(resp.Body)
+}
+
+func (l *StaticList) load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != `` && line[0] != '#' {
+			l.Add(line)
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (l *StaticList) All() []*Server {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]*Server(nil), l.servers...)
+}
+
+func (l *StaticList) Count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.servers)
+}
+
+func (l *StaticList) Get() (*Server, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.servers) == 0 {
+		return nil, ErrServerListEmpty
+	}
+
+	s := l.servers[l.next%len(l.servers)]
+	l.next = (l.next + 1) % len(l.servers)
+	s.LastUsage = time.Now()
+
+	return s, nil
+}
+
+func (l *StaticList) MarkGood(s *Server) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s.GoodCnt++
+}
+
+func (l *StaticList) MarkBad(s *Server) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s.BadCnt++
+}
@@ -0,0 +1,113 @@
+package resolver
+
+import (
+	"errors"
+	"github.com/zofan/go-slist"
+	"net"
+	"runtime"
+	"testing"
+)
+
+func TestStaticList(t *testing.T) {
+	l := NewStaticList(`10.0.0.1`, `10.0.0.2`, `10.0.0.1`)
+	if l.Count() != 2 {
+		t.Fatalf(`expected 2 servers, got %d`, l.Count())
+	}
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		s, err := l.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, s.Addr)
+	}
+	if got[0] != `10.0.0.1` || got[1] != `10.0.0.2` || got[2] != `10.0.0.1` || got[3] != `10.0.0.2` {
+		t.Errorf(`expected the servers in turn, got %v`, got)
+	}
+
+	if err := l.LoadFromString("# more\n10.0.0.3\n\n 10.0.0.2 \n"); err != nil || l.Count() != 3 {
+		t.Errorf(`expected one more server, got %d, %v`, l.Count(), err)
+	}
+
+	if _, err := NewStaticList().Get(); err != ErrServerListEmpty {
+		t.Errorf(`expected ErrServerListEmpty, got %v`, err)
+	}
+}
+
+func TestResolverStaticList(t *testing.T) {
+	server := newTestServer(t, answerA(map[string]string{`example.com`: `192.0.2.1`}))
+	dead, err := net.ListenPacket(`udp`, `127.0.0.1:0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadAddr := dead.LocalAddr().String()
+	dead.Close()
+
+	l := NewStaticList()
+	r, err := NewWithOptions(WithServerList(l))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.RetrySleep = 0
+	if _, err := r.LoadServersFromString(deadAddr + "\n" + server.Addr); err != nil {
+		t.Fatal(err)
+	}
+	if l.Count() != 2 {
+		t.Fatalf(`expected the servers loaded into the list, got %d`, l.Count())
+	}
+
+	ips, err := r.LookupIPAddr(`example.com`)
+	if err != nil || len(ips) == 0 || !ips[0].IP.Equal(net.ParseIP(`192.0.2.1`)) {
+		t.Errorf(`unexpected answer %v, %v`, ips, err)
+	}
+	for _, s := range l.All() {
+		if s.Addr == server.Addr && s.GoodCnt == 0 {
+			t.Error(`expected the answering server marked good`)
+		}
+		if s.Addr == deadAddr && s.BadCnt == 0 {
+			t.Error(`expected the dead server marked bad`)
+		}
+	}
+
+	def := New()
+	if err := def.Servers.LoadFromString(server.Addr); err != nil || def.Servers.Count() != 1 {
+		t.Errorf(`expected the loaders of the list reachable, got %d, %v`, def.Servers.Count(), err)
+	}
+
+	empty, _ := NewWithOptions(WithServerList(NewStaticList()))
+	if _, err := empty.LookupIPAddr(`example.com`); !errors.Is(err, ErrServerListEmpty) {
+		t.Errorf(`expected ErrServerListEmpty, got %v`, err)
+	}
+	if _, err := NewWithOptions(WithServers([]string{`10.0.0.1`}), WithServerList(l)); err != ErrServersLoaded {
+		t.Errorf(`expected ErrServersLoaded, got %v`, err)
+	}
+}
+
+func TestServerListLazy(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 50; i++ {
+		r := New()
+		if err := r.SetSelectionMode(slist.ModeRandom, 2); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.AddRoute(`corp.example`, []string{`10.0.0.53`}); err != nil {
+			t.Fatal(err)
+		}
+		if r.Servers.Count() != 0 || r.Servers.All() != nil {
+			t.Fatal(`expected an empty list`)
+		}
+	}
+	if after := runtime.NumGoroutine(); after-before >= 50 {
+		t.Errorf(`expected no goroutine per resolver without servers, went from %d to %d`, before, after)
+	}
+
+	r := New()
+	if _, err := r.Servers.Get(); err != ErrServerListEmpty {
+		t.Errorf(`expected ErrServerListEmpty, got %v`, err)
+	}
+	r.Servers.Add(`10.0.0.1`)
+	if s, err := r.Servers.Get(); err != nil || s.Addr != `10.0.0.1` {
+		t.Errorf(`expected the server added, got %v, %v`, s, err)
+	}
+}
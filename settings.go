@@ -0,0 +1,357 @@
+package resolver
+
+import (
+	"io"
+	"net/netip"
+	"time"
+)
+
+// Settings are the tunables of a Resolver. The fields may be set directly
+// until the resolver is shared between goroutines, after that they must be
+// changed through Configure. Every lookup works on a copy taken when it
+// starts, so it sees either all or none of the changes of one Configure.
+type Settings struct {
+	DialTimeout      time.Duration
+	MaxFails         uint32
+	RetryLimit       int
+	RetrySleep       time.Duration
+	BypassNative     bool
+	DisableKeepAlive bool
+	StickyByHost     bool
+	RequireTags      TagSelector
+	TagFallback      bool
+
+	// RelaxedNames sends names failing the RFC 1035 checks anyway.
+	RelaxedNames bool
+
+	// DisableIDNA sends names with Unicode labels as they are, by default
+	// those are converted to A-labels first, punycode. For callers that
+	// convert the names themselves.
+	DisableIDNA bool
+
+	// DecodeIDN converts the A-labels in the names of the results back to
+	// Unicode: the targets of LookupCNAME, the hosts of LookupMX and
+	// LookupNS and the names of LookupAddr. See WithALabels.
+	DecodeIDN bool
+
+	// SearchDomains are tried in turn for the names with fewer than NDots
+	// dots before the name itself, and after it for the others, the way
+	// resolv.conf has it, an NDots of 0 trying every name as it is first. A
+	// name ending in a dot is looked up as it is. Every name is a lookup of the servers of its own, the
+	// first found is the answer.
+	SearchDomains []string
+	NDots         int
+
+	// HostsFile answers LookupIPAddr, LookupHost and LookupAddr from the
+	// hosts file at HostsPath first, "" is DefaultHostsPath. The file is
+	// read again once it changed, seen within five seconds.
+	HostsFile bool
+	HostsPath string
+
+	// SpecialUse handles the special-use names of SpecialUseNames before any
+	// server is asked, nil is DefaultSpecialUseNames: the name under the
+	// longest suffix of the list gets the action of it. Off by default, as
+	// some networks serve .local or .test names from their servers.
+	SpecialUse      bool
+	SpecialUseNames map[string]SpecialUseAction
+
+	// RawNames returns the names in answers as the server sent them, by
+	// default they are lowercased and without the trailing dot.
+	RawNames bool
+
+	// BypassOn are the failures of the servers BypassNative tries the system
+	// resolver on, 0 is FallbackEmptyList.
+	BypassOn FallbackPolicy
+
+	// ServerOverrideHealth counts the lookups of WithServer in the health
+	// accounting of their servers, by default they are not.
+	ServerOverrideHealth bool
+
+	// NativeFirst runs the lookups on the system resolver first, the servers
+	// are asked when it fails or takes longer than NativeTimeout, 0 is
+	// DefaultNativeTimeout. A name it does not find is not found.
+	NativeFirst   bool
+	NativeTimeout time.Duration
+
+	// FallbackOnNotFound has the fallbacks of SetFallbacks move on to the
+	// next layer when one does not find the name, instead of returning, and
+	// NativeFirst ask the servers.
+	FallbackOnNotFound bool
+
+	// DNSSEC is how Query treats the DNSSEC records of its answers, off by
+	// default. The status is in the DNSSEC field of WithMeta.
+	DNSSEC DNSSECMode
+
+	// DNS64 has LookupIPAddr make up the IPv6 addresses of the hosts with
+	// IPv4 addresses only, for IPv6-only networks behind a NAT64: the IPv4
+	// addresses embedded in DNS64Prefix, RFC 6052. A zero DNS64Prefix is the
+	// one DiscoverDNS64Prefix finds. Synthesized in WithMeta tells.
+	DNS64       bool
+	DNS64Prefix netip.Prefix
+
+	// EmbeddedFallback loads the servers of LoadEmbeddedServers when
+	// LoadServersFromURL fails or yields none.
+	EmbeddedFallback bool
+
+	// MaxConcurrentPerServer is how many queries may be in flight to one
+	// server, servers at the limit are skipped and lookups wait when all of
+	// them are. 0 is no limit.
+	MaxConcurrentPerServer int
+
+	// QPS is how many attempts per second the lookups may send on average,
+	// up to Burst at once, 0 is no limit. Retries count. RateLimiter replaces
+	// the built-in limiter when set.
+	QPS         float64
+	Burst       int
+	RateLimiter RateLimiter
+
+	// DomainQPS is how many lookups per second may go to the names of one
+	// registrable domain, up to DomainBurst at once, 0 is no limit. Lookups
+	// over it wait, or with DomainFailFast fail with ErrDomainRateLimited.
+	// DomainLimiters is how many domains are kept track of, 0 is
+	// DefaultDomainLimiters.
+	DomainQPS      float64
+	DomainBurst    int
+	DomainFailFast bool
+	DomainLimiters int
+
+	// MaxInFlight is how many lookups may run at once, retries and sleeps
+	// included, 0 is no limit. Lookups over it wait up to MaxInFlightWait
+	// and then fail with ErrResolverBusy.
+	MaxInFlight     int
+	MaxInFlightWait time.Duration
+
+	// SplitFamilies has LookupIPAddr send A and AAAA as raw queries at the
+	// same time, each with attempts and servers of its own. The addresses of
+	// one family are returned when the other fails, unless
+	// RequireBothFamilies is set.
+	SplitFamilies       bool
+	RequireBothFamilies bool
+
+	// RoundRobinTTL is how long NextIP keeps the addresses of a host, 0 is
+	// DefaultRoundRobinTTL. RoundRobinFamily TypeA or TypeAAAA has it hand
+	// out only the addresses of that family while there are any.
+	RoundRobinTTL    time.Duration
+	RoundRobinFamily Type
+
+	// SweepMinBits is the shortest IPv4 prefix SweepPTR sweeps, 0 is
+	// DefaultSweepMinBits.
+	SweepMinBits int
+
+	// MaxCNAMEDepth is the longest CNAME chain followed, 0 is
+	// DefaultMaxCNAMEDepth.
+	MaxCNAMEDepth int
+
+	// MaxReferrals is how many referrals ResolveIterative follows, 0 is
+	// DefaultMaxReferrals.
+	MaxReferrals int
+
+	GoodAfter             int
+	CircuitThreshold      int
+	CircuitCooldown       time.Duration
+	ProbeName             string
+	NonceZone             string
+	RecheckInterval       time.Duration
+	FailHalfLife          time.Duration
+	MaxFailureRatio       float64
+	FailureRatioWindow    time.Duration
+	FailureRatioSamples   int
+	QuarantineDuration    time.Duration
+	QuarantineGrowth      float64
+	MaxQuarantineDuration time.Duration
+	QuarantineDecay       time.Duration
+
+	// QuarantineSteps are the first quarantines of a server in multiples of
+	// QuarantineDuration, 1, 5 and 30 minutes by default, those past the
+	// steps grow by QuarantineGrowth from the last, all up to
+	// MaxQuarantineDuration. Without steps every one grows from the one before.
+	QuarantineSteps []float64
+
+	ProbationSuccesses int
+	FailureWeights     FailureWeights
+
+	// FilteredAnswers is what to do with address answers made only of
+	// FilteredPrefixes, nil prefixes are DefaultFilteredPrefixes. With
+	// EvictFiltering servers caught filtering are no longer used.
+	FilteredAnswers  FilteredAnswerPolicy
+	FilteredPrefixes []netip.Prefix
+	EvictFiltering   bool
+
+	// FilterBogons leaves the addresses in BogonPrefixes out of address
+	// lookups, nil prefixes are DefaultBogonPrefixes. Off by default, private
+	// names resolve to private addresses.
+	FilterBogons  bool
+	BogonPrefixes []netip.Prefix
+
+	// AuditFraction of the successful address lookups are asked again from
+	// the same and a random other server, 0 disables the audit. A server is
+	// flagged once it disagrees in more than AuditThreshold of at least
+	// AuditMinSamples audits, with EvictLying it is no longer used then.
+	// AuditComparator nil is DefaultComparator.
+	AuditFraction   float64
+	AuditThreshold  float64
+	AuditMinSamples int
+	AuditComparator AnswerComparator
+	EvictLying      bool
+
+	// NetworkDownServers distinct servers failing to answer within
+	// NetworkDownWindow mean the local network is down, 0 disables the
+	// detection. ConnectivityProbes are then asked every ConnectivityInterval
+	// and OnNetworkChange learns about both transitions.
+	NetworkDownServers   int
+	NetworkDownWindow    time.Duration
+	ConnectivityProbes   []string
+	ConnectivityInterval time.Duration
+	OnNetworkChange      func(down bool)
+
+	// OnLookupStart, OnAttempt and OnLookupDone are called synchronously on
+	// the goroutine of every lookup: start once, then each attempt in turn
+	// with the server it goes to, then done with the outcome and how long
+	// the lookup took. Concurrent lookups call them concurrently and in no
+	// particular order between each other. A panic in one of them is passed
+	// to OnHookPanic, or logged when that is nil, and the lookup goes on.
+	OnLookupStart func(info LookupInfo)
+	OnAttempt     func(info LookupInfo, server string)
+	OnLookupDone  func(info LookupInfo, err error, d time.Duration)
+	OnHookPanic   func(hook string, v interface{})
+
+	// OnPoolDegraded runs on a goroutine of its own when the healthy servers
+	// drop below MinHealthyServers or below MinHealthyFraction of the list,
+	// OnPoolRecovered when they are back above. Each runs once per crossing.
+	MinHealthyServers  int
+	MinHealthyFraction float64
+	OnPoolDegraded     func(healthy, total int)
+	OnPoolRecovered    func(healthy, total int)
+
+	// HealthyFreshness is how recent a successful lookup makes Healthy
+	// report the resolver healthy without a probe, 0 is
+	// DefaultHealthyFreshness.
+	HealthyFreshness time.Duration
+
+	// QueryLog gets a line in QueryLogFormat for every lookup, or with
+	// QueryLogAttempts for every attempt. Lines are buffered, see
+	// FlushQueryLog and Close.
+	QueryLog         io.Writer
+	QueryLogFormat   QueryLogFormat
+	QueryLogAttempts bool
+
+	// EventBuffer is the buffer of the Events channel, 0 is
+	// DefaultEventBuffer.
+	EventBuffer int
+
+	// Logger is told about attempts and server state changes, nil logs
+	// nothing.
+	Logger Logger
+
+	// HealthPolicy decides which servers are used, nil is the built-in
+	// accounting configured by the settings above.
+	HealthPolicy HealthPolicy
+}
+
+// DefaultQuarantineSteps are the QuarantineSteps of DefaultSettings.
+var DefaultQuarantineSteps = []float64{1, 5, 30}
+
+func DefaultSettings() Settings {
+	return Settings{
+		DialTimeout:      time.Second * 2, // don't work, look at problem (net.dnsConfig.timeout - net/dnsconfig_unix.go:43)
+		RetryLimit:       5,
+		RetrySleep:       time.Millisecond * 500,
+		MaxFails:         30,
+		DisableKeepAlive: true,
+		MaxCNAMEDepth:    DefaultMaxCNAMEDepth,
+		NDots:            DefaultNDots,
+
+		GoodAfter:             1,
+		CircuitCooldown:       time.Second * 30,
+		ProbeName:             DefaultProbeName,
+		NonceZone:             DefaultNonceZone,
+		RecheckInterval:       time.Hour,
+		FailureRatioWindow:    time.Minute * 10,
+		FailureRatioSamples:   50,
+		QuarantineDuration:    time.Minute,
+		QuarantineGrowth:      5,
+		MaxQuarantineDuration: time.Minute * 30,
+		QuarantineDecay:       time.Hour,
+		QuarantineSteps:       DefaultQuarantineSteps,
+		ProbationSuccesses:    3,
+		FailureWeights:        DefaultFailureWeights(),
+
+		AuditThreshold:  0.5,
+		AuditMinSamples: 20,
+
+		NetworkDownServers:   5,
+		NetworkDownWindow:    time.Second * 5,
+		ConnectivityInterval: time.Second,
+
+		MinHealthyServers: 1,
+	}
+}
+
+// validate reports settings that make no sense with ErrBadOption: negative
+// durations, limits and fractions out of range.
+func (s *Settings) validate() error {
+	for _, d := range []time.Duration{s.DialTimeout, s.RetrySleep, s.MaxInFlightWait, s.CircuitCooldown, s.RecheckInterval,
+		s.FailHalfLife, s.FailureRatioWindow, s.QuarantineDuration, s.MaxQuarantineDuration, s.QuarantineDecay,
+		s.NetworkDownWindow, s.ConnectivityInterval, s.HealthyFreshness, s.RoundRobinTTL, s.NativeTimeout} {
+		if d < 0 {
+			return ErrBadOption
+		}
+	}
+	for _, n := range []int{s.RetryLimit, s.MaxConcurrentPerServer, s.Burst, s.DomainBurst, s.DomainLimiters,
+		s.MaxInFlight, s.MaxCNAMEDepth, s.MaxReferrals, s.NDots, s.GoodAfter, s.CircuitThreshold, s.FailureRatioSamples, s.ProbationSuccesses,
+		s.AuditMinSamples, s.NetworkDownServers, s.MinHealthyServers, s.EventBuffer} {
+		if n < 0 {
+			return ErrBadOption
+		}
+	}
+	for _, f := range []float64{s.MaxFailureRatio, s.AuditFraction, s.AuditThreshold, s.MinHealthyFraction} {
+		if f < 0 || f > 1 {
+			return ErrBadOption
+		}
+	}
+	for _, step := range s.QuarantineSteps {
+		if step <= 0 {
+			return ErrBadOption
+		}
+	}
+	if s.QPS < 0 || s.DomainQPS < 0 || s.QuarantineGrowth < 0 || s.DNSSEC < DNSSECOff || s.DNSSEC > DNSSECValidate {
+		return ErrBadOption
+	}
+
+	return validDNS64Prefix(s.DNS64Prefix)
+}
+
+// Configure changes the settings while lookups may be running. RequireTags
+// must be replaced, not modified in place.
+func (r *Resolver) Configure(fn func(s *Settings)) {
+	r.settingsMu.Lock()
+	defer r.settingsMu.Unlock()
+
+	fn(&r.Settings)
+}
+
+// UpdateSettings is Configure with the changes checked the way
+// NewWithOptions checks options. fn works on a copy which replaces the
+// settings only when it is valid, otherwise the error is returned and the
+// settings are left as they were. Lookups already running keep the copy
+// they started with.
+func (r *Resolver) UpdateSettings(fn func(s *Settings)) error {
+	r.settingsMu.Lock()
+	defer r.settingsMu.Unlock()
+
+	s := r.Settings
+	fn(&s)
+	if err := s.validate(); err != nil {
+		return err
+	}
+	r.Settings = s
+
+	return nil
+}
+
+func (r *Resolver) settings() Settings {
+	r.settingsMu.RLock()
+	defer r.settingsMu.RUnlock()
+
+	return r.Settings
+}
@@ -0,0 +1,125 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConfigureWhileResolving(t *testing.T) {
+	r := New()
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2\n10.0.0.3\n10.0.0.4")
+
+	done := make(chan struct{})
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for n := 0; n < 200; n++ {
+				_ = r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+					if n%3 == 0 {
+						return errors.New(`i/o timeout`)
+					}
+					return nil
+				})
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for n := 0; ; n++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			r.Configure(func(s *Settings) {
+				s.RetryLimit = n%4 + 1
+				s.DialTimeout = time.Duration(n%5+1) * time.Second
+				s.MaxFails = uint32(n%10 + 1)
+				s.StickyByHost = n%2 == 0
+				s.QuarantineDuration = time.Millisecond
+			})
+		}
+	}()
+
+	time.Sleep(time.Millisecond * 200)
+	close(done)
+	wg.Wait()
+}
+
+func TestLookupSettingsSnapshot(t *testing.T) {
+	r := New()
+	r.RetryLimit = 3
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2\n10.0.0.3\n10.0.0.4\n10.0.0.5")
+
+	calls := 0
+	err := r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		calls++
+		// the running lookup keeps the limit it started with
+		r.Configure(func(s *Settings) { s.RetryLimit = 1 })
+		return errors.New(`i/o timeout`)
+	})
+	if !errors.Is(err, ErrRetryLimit) || calls != 3 {
+		t.Errorf(`expected ErrRetryLimit after three attempts, got %v after %d`, err, calls)
+	}
+}
+
+func TestUpdateSettings(t *testing.T) {
+	r := New()
+
+	err := r.UpdateSettings(func(s *Settings) {
+		s.RetryLimit = 2
+		s.AuditFraction = 2
+	})
+	if err != ErrBadOption {
+		t.Errorf(`expected ErrBadOption, got %v`, err)
+	}
+	if s := r.settings(); s.RetryLimit != 5 || s.AuditFraction != 0 {
+		t.Errorf(`expected the settings left alone, got %+v`, s)
+	}
+
+	_ = r.UpdateSettings(func(s *Settings) { s.RetryLimit, s.RetrySleep = 0, 0 })
+
+	done := make(chan struct{})
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			// the two change together or not at all
+			if s := r.settings(); s.RetrySleep != time.Duration(s.RetryLimit)*time.Millisecond {
+				t.Errorf(`saw a partial update: %d, %s`, s.RetryLimit, s.RetrySleep)
+				return
+			}
+		}
+	}()
+
+	for i := 1; i <= 500; i++ {
+		if err := r.UpdateSettings(func(s *Settings) {
+			s.RetryLimit = i
+			s.RetrySleep = time.Duration(i) * time.Millisecond
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
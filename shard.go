@@ -0,0 +1,199 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Pool spreads lookups over resolvers of its own by the hash of the name,
+// a name always goes to the same one. Lookups of different names then do
+// not contend on the locks of one resolver, its server list above all.
+type Pool struct {
+	shards []*Resolver
+}
+
+// NewPool returns a pool of n resolvers, at least one, configure is called
+// on each of them before it is used. The server lists are loaded through
+// the pool, which gives every resolver a list of its own.
+func NewPool(n int, configure func(r *Resolver)) *Pool {
+	if n < 1 {
+		n = 1
+	}
+
+	p := &Pool{shards: make([]*Resolver, n)}
+	for i := range p.shards {
+		r := New()
+		if configure != nil {
+			configure(r)
+		}
+		p.shards[i] = r
+	}
+
+	return p
+}
+
+// Shards returns the resolvers of the pool.
+func (p *Pool) Shards() []*Resolver {
+	return append([]*Resolver(nil), p.shards...)
+}
+
+// shard returns the resolver of name.
+func (p *Pool) shard(name string) *Resolver {
+	if len(p.shards) == 1 {
+		return p.shards[0]
+	}
+
+	// FNV-1a inline over the name key, this runs on every lookup
+	h := uint32(2166136261)
+	name = strings.TrimSuffix(name, `.`)
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		h ^= uint32(c)
+		h *= 16777619
+	}
+
+	return p.shards[h%uint32(len(p.shards))]
+}
+
+// LoadServers loads the servers read from reader into every resolver of
+// the pool, the report is that of the first.
+func (p *Pool) LoadServers(reader io.Reader) (LoadReport, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return LoadReport{}, err
+	}
+
+	var report LoadReport
+	for i, r := range p.shards {
+		rep, err := r.LoadServers(bytes.NewReader(data))
+		if err != nil {
+			return rep, err
+		}
+		if i == 0 {
+			report = rep
+		}
+	}
+
+	return report, nil
+}
+
+func (p *Pool) LoadServersFromString(servers string) (LoadReport, error) {
+	return p.LoadServers(strings.NewReader(servers))
+}
+
+func (p *Pool) LoadServersFromURL(url string) (LoadReport, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return LoadReport{}, err
+	}
+
+	defer resp.Body.Close()
+
+	return p.LoadServers(resp.Body)
+}
+
+func (p *Pool) LookupIPAddr(host string, opts ...LookupOption) ([]net.IPAddr, error) {
+	return p.shard(host).LookupIPAddr(host, opts...)
+}
+
+func (p *Pool) LookupAddr(ip string, opts ...LookupOption) ([]string, error) {
+	return p.shard(ip).LookupAddr(ip, opts...)
+}
+
+func (p *Pool) LookupNS(host string, opts ...LookupOption) ([]*net.NS, error) {
+	return p.shard(host).LookupNS(host, opts...)
+}
+
+func (p *Pool) LookupTXT(host string, opts ...LookupOption) ([]string, error) {
+	return p.shard(host).LookupTXT(host, opts...)
+}
+
+func (p *Pool) LookupCNAME(host string, opts ...LookupOption) (string, error) {
+	return p.shard(host).LookupCNAME(host, opts...)
+}
+
+func (p *Pool) LookupMX(host string, opts ...LookupOption) ([]*net.MX, error) {
+	return p.shard(host).LookupMX(host, opts...)
+}
+
+func (p *Pool) Query(ctx context.Context, name string, qtype Type, opts ...LookupOption) (*Message, error) {
+	return p.shard(name).Query(ctx, name, qtype, opts...)
+}
+
+// Stats adds up the counters of the resolvers of the pool.
+func (p *Pool) Stats() Stats {
+	var s Stats
+	for i, r := range p.shards {
+		st := r.Stats()
+		if i == 0 {
+			s = st
+			continue
+		}
+
+		s.Lookups += st.Lookups
+		s.Successes += st.Successes
+		s.Failures += st.Failures
+		s.NotFound += st.NotFound
+		s.RetryLimit += st.RetryLimit
+		s.EmptyList += st.EmptyList
+		s.Attempts += st.Attempts
+		s.InFlight += st.InFlight
+		s.Rejected += st.Rejected
+		s.Blocked += st.Blocked
+		s.Latency += st.Latency
+
+		for j, n := range st.LatencyCounts {
+			s.LatencyCounts[j] += n
+		}
+		for qtype, n := range st.ByType {
+			s.ByType[qtype] += n
+		}
+		for qtype, outcomes := range st.ByOutcome {
+			if s.ByOutcome[qtype] == nil {
+				s.ByOutcome[qtype] = make(map[string]uint64)
+			}
+			for outcome, n := range outcomes {
+				s.ByOutcome[qtype][outcome] += n
+			}
+		}
+		for addr, n := range st.ServerFailures {
+			s.ServerFailures[addr] += n
+		}
+		for addr, n := range st.ServerInFlight {
+			s.ServerInFlight[addr] += n
+		}
+		for addr, h := range st.ServerLatency {
+			s.ServerLatency[addr] = s.ServerLatency[addr].add(h)
+		}
+		for path, n := range st.ByPath {
+			s.ByPath[path] += n
+		}
+	}
+
+	s.MeanLatency = 0
+	if s.Lookups > 0 {
+		s.MeanLatency = s.Latency / time.Duration(s.Lookups)
+	}
+
+	return s
+}
+
+// Close closes every resolver of the pool and returns the first error.
+func (p *Pool) Close() error {
+	var first error
+	for _, r := range p.shards {
+		if err := r.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
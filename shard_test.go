@@ -0,0 +1,98 @@
+package resolver
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPool(t *testing.T) {
+	zone := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		zone[fmt.Sprintf(`h%d.example.com`, i)] = fmt.Sprintf(`192.0.2.%d`, i)
+	}
+	server := newTestServer(t, answerA(zone))
+
+	var configured int
+	p := NewPool(4, func(r *Resolver) {
+		configured++
+		r.RetrySleep = 0
+	})
+	if configured != 4 {
+		t.Fatalf(`expected 4 resolvers configured, got %d`, configured)
+	}
+
+	report, err := p.LoadServersFromString(server.Addr)
+	if err != nil || report.Added != 1 {
+		t.Fatalf(`unexpected load %+v %v`, report, err)
+	}
+	for _, r := range p.Shards() {
+		if r.Servers.Count() != 1 {
+			t.Errorf(`expected every shard to get the server, got %d`, r.Servers.Count())
+		}
+	}
+
+	if p.shard(`H1.example.com.`) != p.shard(`h1.example.com`) {
+		t.Error(`expected spellings of a name to share a shard`)
+	}
+
+	used := make(map[*Resolver]bool)
+	for host, ip := range zone {
+		ips, err := p.LookupIPAddr(host)
+		if err != nil || len(ips) != 1 || ips[0].IP.String() != ip {
+			t.Errorf(`%s: unexpected result %v %v`, host, ips, err)
+		}
+		used[p.shard(host)] = true
+	}
+	if len(used) < 2 {
+		t.Errorf(`expected the names spread over the shards, used %d`, len(used))
+	}
+
+	st := p.Stats()
+	if st.Lookups != uint64(len(zone)) || st.Successes != uint64(len(zone)) || st.ByType[`IP`] != uint64(len(zone)) {
+		t.Errorf(`unexpected stats %+v`, st)
+	}
+	if h := st.ServerLatency[server.Addr]; h.Count != uint64(len(zone)) {
+		t.Errorf(`expected %d attempts in the latency of %s, got %+v`, len(zone), server.Addr, h)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+// BenchmarkContention runs lookups of many names from many goroutines on a
+// single resolver and on a pool, the pool should scale better.
+func BenchmarkContention(b *testing.B) {
+	names := make([]string, 1024)
+	for i := range names {
+		names[i] = fmt.Sprintf(`h%d.example.com`, i)
+	}
+	const servers = "10.0.0.1\n10.0.0.2\n10.0.0.3"
+
+	run := func(b *testing.B, shard func(name string) *Resolver) {
+		var next uint32
+		b.ReportAllocs()
+		b.SetParallelism(16)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				name := names[atomic.AddUint32(&next, 1)%uint32(len(names))]
+				if err := shard(name).attempt(`A`, name, benchOK, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+
+	b.Run(`single`, func(b *testing.B) {
+		r := benchResolver(b, servers)
+		run(b, func(string) *Resolver { return r })
+	})
+	b.Run(`pool`, func(b *testing.B) {
+		p := NewPool(8, func(r *Resolver) { r.RetrySleep = 0 })
+		if _, err := p.LoadServersFromString(servers); err != nil {
+			b.Fatal(err)
+		}
+		run(b, p.shard)
+	})
+}
@@ -0,0 +1,175 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var ErrSpecialUse = errors.New(`resolver: special-use name`)
+
+// SpecialUseAction is what SpecialUse does with the names under a suffix.
+type SpecialUseAction int
+
+const (
+	// SpecialUseSend asks the servers, as for any other name.
+	SpecialUseSend SpecialUseAction = iota
+	// SpecialUseLoopback answers the addresses with 127.0.0.1 and ::1, and
+	// the other types with no data, without a lookup.
+	SpecialUseLoopback
+	// SpecialUseFail fails the lookup with a *SpecialUseError.
+	SpecialUseFail
+	// SpecialUseNative asks the system resolver only, which may speak mDNS,
+	// Query fails as with SpecialUseFail.
+	SpecialUseNative
+)
+
+func (a SpecialUseAction) String() string {
+	switch a {
+	case SpecialUseSend:
+		return `send`
+	case SpecialUseLoopback:
+		return `loopback`
+	case SpecialUseFail:
+		return `fail`
+	case SpecialUseNative:
+		return `native`
+	}
+
+	return `SpecialUseAction(` + strconv.Itoa(int(a)) + `)`
+}
+
+// DefaultSpecialUseNames are the actions of SpecialUse for the names of
+// RFC 6761, 6762 and 7686 no public server should be asked about.
+var DefaultSpecialUseNames = map[string]SpecialUseAction{
+	`localhost`: SpecialUseLoopback,
+	`local`:     SpecialUseFail,
+	`test`:      SpecialUseFail,
+	`invalid`:   SpecialUseFail,
+	`onion`:     SpecialUseFail,
+}
+
+// SpecialUseError is a lookup of a special-use name SpecialUse refused, it
+// matches ErrSpecialUse and ErrNoSuchHost. Suffix is the one of the name.
+type SpecialUseError struct {
+	Name   string
+	Suffix string
+}
+
+func (e *SpecialUseError) Error() string {
+	return ErrSpecialUse.Error() + `: ` + e.Name + ` is under ` + e.Suffix
+}
+
+func (e *SpecialUseError) Is(target error) bool {
+	return target == ErrSpecialUse || target == ErrNoSuchHost
+}
+
+func (e *SpecialUseError) Timeout() bool {
+	return false
+}
+
+func (e *SpecialUseError) Temporary() bool {
+	return false
+}
+
+// specialUse returns the action of SpecialUse for name and the suffix it is
+// under, the longest of the list, SpecialUseSend when there is none.
+func specialUse(s *Settings, name string) (SpecialUseAction, string) {
+	if !s.SpecialUse {
+		return SpecialUseSend, ``
+	}
+	names := s.SpecialUseNames
+	if names == nil {
+		names = DefaultSpecialUseNames
+	}
+
+	name = nameKey(name)
+	for suffix := name; suffix != ``; {
+		if a, ok := names[suffix]; ok {
+			return a, suffix
+		}
+		i := strings.IndexByte(suffix, '.')
+		if i < 0 {
+			break
+		}
+		suffix = suffix[i+1:]
+	}
+
+	return SpecialUseSend, ``
+}
+
+// loopbackAddrs returns the addresses of a name SpecialUse answers with the
+// loopback, nil for the others.
+func (r *Resolver) loopbackAddrs(host string, opts []LookupOption) []net.IPAddr {
+	o := r.lookupOptions(opts)
+	if a, _ := specialUse(&o.settings, host); a != SpecialUseLoopback {
+		return nil
+	}
+
+	return []net.IPAddr{{IP: net.IPv4(127, 0, 0, 1).To4()}, {IP: net.IPv6loopback}}
+}
+
+// beforeServers answers a lookup of qtype for host without the servers when
+// it can: a special-use name is handled by SpecialUse, then NativeFirst may
+// answer. It is done when the servers are not to be asked.
+func (r *Resolver) beforeServers(qtype, host string, native func(ctx context.Context) error, opts []LookupOption) (done bool, err error) {
+	o := r.lookupOptions(opts)
+	a, suffix := SpecialUseSend, ``
+	if qtype != `PTR` {
+		a, suffix = specialUse(&o.settings, host)
+	}
+
+	switch a {
+	case SpecialUseLoopback:
+		return true, &LookupError{Name: host, Type: qtype, Err: &NoDataError{Host: host, Type: qtype}}
+	case SpecialUseFail:
+		return true, &LookupError{Name: host, Type: qtype, Err: &SpecialUseError{Name: host, Suffix: suffix}}
+	case SpecialUseNative:
+		timeout := o.settings.NativeTimeout
+		if timeout == 0 {
+			timeout = DefaultNativeTimeout
+		}
+		ctx, cancel := context.WithTimeout(o.ctx, timeout)
+		defer cancel()
+		if err := native(ctx); err != nil {
+			if isNotFound(err) {
+				err = &NotFoundError{Host: host, Err: err}
+			}
+			return true, &LookupError{Name: host, Type: qtype, Err: err}
+		}
+		r.stats.path(PathNative)
+		return true, nil
+	}
+
+	return r.nativeFirst(host, native, opts)
+}
+
+// specialQuery answers Query for a special-use name without the servers:
+// the loopback records of localhost, or a failure. Both are nil for the
+// names the servers are asked about.
+func (r *Resolver) specialQuery(name string, qtype Type, opts []LookupOption) (*Message, error) {
+	o := r.lookupOptions(opts)
+	a, suffix := specialUse(&o.settings, name)
+	switch a {
+	case SpecialUseSend:
+		return nil, nil
+	case SpecialUseLoopback:
+		m := newQuery(name, qtype)
+		m.Response, m.Authoritative, m.RecursionAvailable = true, true, true
+		ip := net.IPv4(127, 0, 0, 1).To4()
+		switch qtype {
+		case TypeAAAA:
+			ip = net.IPv6loopback
+		case TypeA:
+		default:
+			return nil, &LookupError{Name: name, Type: qtype.String(), Err: &NoDataError{Host: name, Type: qtype.String()}}
+		}
+		m.Answers = []RR{{Name: m.Questions[0].Name, Type: qtype, Class: classINET, IP: ip}}
+		return m, nil
+	}
+
+	// the system resolver of SpecialUseNative answers no messages
+	return nil, &LookupError{Name: name, Type: qtype.String(), Err: &SpecialUseError{Name: name, Suffix: suffix}}
+}
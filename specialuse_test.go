@@ -0,0 +1,96 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSpecialUseMatch(t *testing.T) {
+	s := Settings{SpecialUse: true}
+	for name, want := range map[string]SpecialUseAction{
+		`localhost`:          SpecialUseLoopback,
+		`MyHost.LocalHost.`:  SpecialUseLoopback,
+		`printer.local`:      SpecialUseFail,
+		`x.onion`:            SpecialUseFail,
+		`example.com`:        SpecialUseSend,
+		`localhost.example.`: SpecialUseSend,
+	} {
+		if got, _ := specialUse(&s, name); got != want {
+			t.Errorf(`%s: expected %s, got %s`, name, want, got)
+		}
+	}
+
+	s.SpecialUseNames = map[string]SpecialUseAction{`local`: SpecialUseNative, `corp.local`: SpecialUseSend}
+	if got, suffix := specialUse(&s, `dc.corp.local`); got != SpecialUseSend || suffix != `corp.local` {
+		t.Errorf(`expected the longest suffix to win, got %s under %q`, got, suffix)
+	}
+	if got, _ := specialUse(&s, `localhost`); got != SpecialUseSend {
+		t.Errorf(`expected a list of its own to replace the defaults, got %s`, got)
+	}
+	if got, _ := specialUse(&Settings{}, `x.invalid`); got != SpecialUseSend {
+		t.Errorf(`expected nothing special with SpecialUse off, got %s`, got)
+	}
+}
+
+func TestSpecialUseLookups(t *testing.T) {
+	ts := newTestServer(t, answerA(map[string]string{`printer.test`: `192.0.2.9`}))
+
+	r := New()
+	r.SpecialUse = true
+	r.RetryLimit = 1
+	if _, err := r.LoadServersFromString(ts.Addr); err != nil {
+		t.Fatal(err)
+	}
+
+	ips, err := r.LookupIPAddr(`myhost.localhost`)
+	if err != nil || len(ips) != 2 || !ips[0].IP.IsLoopback() || !ips[1].IP.IsLoopback() {
+		t.Errorf(`expected the loopback addresses, got %v, %v`, ips, err)
+	}
+	if _, err := r.LookupMX(`localhost`); !errors.Is(err, ErrNoData) {
+		t.Errorf(`expected ErrNoData for the MX of localhost, got %v`, err)
+	}
+
+	var special *SpecialUseError
+	_, err = r.LookupIPAddr(`printer.local`)
+	if !errors.As(err, &special) || special.Suffix != `local` || !errors.Is(err, ErrNoSuchHost) {
+		t.Errorf(`expected a *SpecialUseError, got %v`, err)
+	}
+	if _, err := r.LookupTXT(`hidden.onion`); !errors.Is(err, ErrSpecialUse) {
+		t.Errorf(`expected ErrSpecialUse, got %v`, err)
+	}
+
+	m, err := r.Query(context.Background(), `localhost`, TypeAAAA)
+	if err != nil || len(m.Answers) != 1 || !m.Answers[0].IP.IsLoopback() {
+		t.Errorf(`expected the loopback AAAA, got %v, %v`, m, err)
+	}
+	if _, err := r.Query(context.Background(), `a.invalid`, TypeA); !errors.Is(err, ErrSpecialUse) {
+		t.Errorf(`expected ErrSpecialUse from Query, got %v`, err)
+	}
+	if n := len(ts.Queries()); n != 0 {
+		t.Errorf(`expected no queries to the server, got %d`, n)
+	}
+
+	r.SpecialUseNames = map[string]SpecialUseAction{`test`: SpecialUseSend}
+	if ips, err := r.LookupIPAddr(`printer.test`); err != nil || len(ips) != 1 {
+		t.Errorf(`expected the server to answer once .test is sent, got %v, %v`, ips, err)
+	}
+}
+
+func TestSpecialUseConfig(t *testing.T) {
+	c := DefaultConfig()
+	c.SpecialUse = true
+	c.SpecialUseNames = map[string]string{`Local.`: `native`, `localhost`: `loopback`}
+	s, _, err := c.settings()
+	if err != nil || !s.SpecialUse || s.SpecialUseNames[`local`] != SpecialUseNative {
+		t.Fatalf(`expected the actions of the config, got %v, %v`, s.SpecialUseNames, err)
+	}
+	if back := configFrom(s, 0, 0); back.SpecialUseNames[`local`] != `native` {
+		t.Errorf(`expected the actions back, got %v`, back.SpecialUseNames)
+	}
+
+	c.SpecialUseNames = map[string]string{`local`: `mdns`}
+	if _, _, err := c.settings(); !errors.Is(err, ErrBadOption) {
+		t.Errorf(`expected ErrBadOption, got %v`, err)
+	}
+}
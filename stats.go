@@ -0,0 +1,385 @@
+package resolver
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Lookup outcomes counted by Stats.ByOutcome.
+const (
+	OutcomeSuccess    = `success`
+	OutcomeNotFound   = `not_found`
+	OutcomeNoData     = `no_data`
+	OutcomeRetryLimit = `retry_limit`
+	OutcomeEmptyList  = `empty_list`
+	OutcomeError      = `error`
+)
+
+// outcomes are the outcomes in the order of the counters of typeStats.
+var outcomes = [...]string{OutcomeSuccess, OutcomeNotFound, OutcomeNoData, OutcomeRetryLimit, OutcomeEmptyList, OutcomeError}
+
+// LatencyBuckets are the upper bounds of the lookup latency histogram, the
+// last count of Stats.LatencyCounts is for the slower lookups.
+var LatencyBuckets = []time.Duration{
+	time.Millisecond,
+	time.Millisecond * 5,
+	time.Millisecond * 10,
+	time.Millisecond * 25,
+	time.Millisecond * 50,
+	time.Millisecond * 100,
+	time.Millisecond * 250,
+	time.Millisecond * 500,
+	time.Second,
+}
+
+// Stats is a snapshot of what a resolver has done since it was created or
+// its stats were last reset.
+type Stats struct {
+	Lookups     uint64
+	ByType      map[string]uint64
+	ByOutcome   map[string]map[string]uint64 // type -> outcome -> lookups
+	Successes   uint64
+	Failures    uint64
+	NotFound    uint64
+	RetryLimit  uint64
+	EmptyList   uint64
+	Attempts    uint64
+	InFlight    int64
+	Rejected    uint64
+	Blocked     uint64 // by the domain policy
+	Latency     time.Duration
+	MeanLatency time.Duration
+
+	// LatencyCounts are the lookups per LatencyBuckets, not cumulative.
+	LatencyCounts []uint64
+
+	// ServerFailures are the failed attempts per server.
+	ServerFailures map[string]uint64
+
+	// ServerLatency are the latencies of the attempts per server.
+	ServerLatency map[string]LatencyHistogram
+
+	// ServerInFlight are the queries in flight per server, servers without
+	// any are left out.
+	ServerInFlight map[string]int64
+
+	// ByPath are the lookups answered per path: PathServers, one of the
+	// fallbacks, or PathNative for the system resolver of NativeFirst and
+	// BypassNative.
+	ByPath map[string]uint64
+}
+
+// LatencyHistogram counts durations per LatencyBuckets, the last count is
+// for the longer ones. Counts are not cumulative.
+type LatencyHistogram struct {
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+}
+
+// latencyHistogram is the live form of LatencyHistogram, small enough to
+// keep one for each of thousands of servers.
+type latencyHistogram struct {
+	counts []uint64
+	sum    int64
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{counts: make([]uint64, len(LatencyBuckets)+1)}
+}
+
+func (h *latencyHistogram) add(d time.Duration) {
+	atomic.AddUint64(&h.counts[latencyBucket(d)], 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+func (h *latencyHistogram) snapshot() LatencyHistogram {
+	s := LatencyHistogram{Counts: make([]uint64, len(h.counts)), Sum: time.Duration(atomic.LoadInt64(&h.sum))}
+	for i := range h.counts {
+		s.Counts[i] = atomic.LoadUint64(&h.counts[i])
+		s.Count += s.Counts[i]
+	}
+
+	return s
+}
+
+// add returns the sum of h and o, either may be empty.
+func (h LatencyHistogram) add(o LatencyHistogram) LatencyHistogram {
+	sum := LatencyHistogram{Counts: make([]uint64, len(LatencyBuckets)+1), Count: h.Count + o.Count, Sum: h.Sum + o.Sum}
+	for i := range h.Counts {
+		sum.Counts[i] += h.Counts[i]
+	}
+	for i := range o.Counts {
+		sum.Counts[i] += o.Counts[i]
+	}
+
+	return sum
+}
+
+func (h *latencyHistogram) reset() {
+	for i := range h.counts {
+		atomic.StoreUint64(&h.counts[i], 0)
+	}
+	atomic.StoreInt64(&h.sum, 0)
+}
+
+type stats struct {
+	lookups        uint64
+	successes      uint64
+	failures       uint64
+	notFound       uint64
+	retryLimit     uint64
+	emptyList      uint64
+	attempts       uint64
+	inFlight       int64
+	rejected       uint64
+	blocked        uint64
+	latency        int64
+	lastSuccess    int64 // unix nanoseconds, not reset
+	latencyCounts  []uint64
+	types          atomic.Value // map[string]*typeStats, replaced on a new type
+	typesMu        sync.Mutex
+	serverFailures sync.Map // string -> *uint64
+	serverLatency  sync.Map // string -> *latencyHistogram
+	paths          sync.Map // string -> *uint64
+}
+
+// typeStats are the lookups of one type, in total and per outcome.
+type typeStats struct {
+	lookups  uint64
+	outcomes [len(outcomes)]uint64
+}
+
+// typeStats returns the counters of qtype, copying the map to add them when
+// missing. The types are few, the copies stop soon.
+func (st *stats) typeStats(qtype string) *typeStats {
+	m, _ := st.types.Load().(map[string]*typeStats)
+	if ts := m[qtype]; ts != nil {
+		return ts
+	}
+
+	st.typesMu.Lock()
+	defer st.typesMu.Unlock()
+
+	m, _ = st.types.Load().(map[string]*typeStats)
+	if ts := m[qtype]; ts != nil {
+		return ts
+	}
+
+	next := make(map[string]*typeStats, len(m)+1)
+	for k, v := range m {
+		next[k] = v
+	}
+	ts := &typeStats{}
+	next[qtype] = ts
+	st.types.Store(next)
+
+	return ts
+}
+
+func newStats() *stats {
+	return &stats{latencyCounts: make([]uint64, len(LatencyBuckets)+1)}
+}
+
+// counter returns the counter of key in m, adding it when missing.
+func counter(m *sync.Map, key interface{}) *uint64 {
+	n, ok := m.Load(key)
+	if !ok {
+		n, _ = m.LoadOrStore(key, new(uint64))
+	}
+
+	return n.(*uint64)
+}
+
+// Outcome classifies the result of a lookup the way Stats counts it.
+func Outcome(err error) string {
+	return outcomes[outcomeIndex(err)]
+}
+
+func outcomeIndex(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var empty *EmptyListError
+	switch {
+	case errors.Is(err, ErrNoSuchHost):
+		return 1
+	case errors.Is(err, ErrNoData):
+		return 2
+	case errors.Is(err, ErrRetryLimit):
+		return 3
+	case errors.As(err, &empty):
+		return 4
+	}
+
+	return 5
+}
+
+func (st *stats) lookup(qtype string, err error, d time.Duration) {
+	atomic.AddUint64(&st.lookups, 1)
+	atomic.AddInt64(&st.latency, int64(d))
+	atomic.AddUint64(&st.latencyCounts[latencyBucket(d)], 1)
+	ts := st.typeStats(qtype)
+	atomic.AddUint64(&ts.lookups, 1)
+
+	i := outcomeIndex(err)
+	atomic.AddUint64(&ts.outcomes[i], 1)
+
+	switch outcomes[i] {
+	case OutcomeSuccess:
+		atomic.AddUint64(&st.successes, 1)
+		atomic.StoreInt64(&st.lastSuccess, time.Now().UnixNano())
+		return
+	case OutcomeNotFound:
+		atomic.AddUint64(&st.notFound, 1)
+	case OutcomeRetryLimit:
+		atomic.AddUint64(&st.retryLimit, 1)
+	case OutcomeEmptyList:
+		atomic.AddUint64(&st.emptyList, 1)
+	}
+	atomic.AddUint64(&st.failures, 1)
+}
+
+func (st *stats) path(path string) {
+	atomic.AddUint64(counter(&st.paths, path), 1)
+}
+
+func (st *stats) serverFailure(addr string) {
+	atomic.AddUint64(counter(&st.serverFailures, addr), 1)
+}
+
+func (st *stats) attemptLatency(addr string, d time.Duration) {
+	h, ok := st.serverLatency.Load(addr)
+	if !ok {
+		h, _ = st.serverLatency.LoadOrStore(addr, newLatencyHistogram())
+	}
+	h.(*latencyHistogram).add(d)
+}
+
+func latencyBucket(d time.Duration) int {
+	for i, b := range LatencyBuckets {
+		if d <= b {
+			return i
+		}
+	}
+
+	return len(LatencyBuckets)
+}
+
+// Stats returns the counters of the lookups made so far.
+func (r *Resolver) Stats() Stats {
+	st := r.stats
+	s := Stats{
+		Lookups:        atomic.LoadUint64(&st.lookups),
+		ByType:         make(map[string]uint64),
+		ByOutcome:      make(map[string]map[string]uint64),
+		Successes:      atomic.LoadUint64(&st.successes),
+		Failures:       atomic.LoadUint64(&st.failures),
+		NotFound:       atomic.LoadUint64(&st.notFound),
+		RetryLimit:     atomic.LoadUint64(&st.retryLimit),
+		EmptyList:      atomic.LoadUint64(&st.emptyList),
+		Attempts:       atomic.LoadUint64(&st.attempts),
+		InFlight:       atomic.LoadInt64(&st.inFlight),
+		Rejected:       atomic.LoadUint64(&st.rejected),
+		Blocked:        atomic.LoadUint64(&st.blocked),
+		Latency:        time.Duration(atomic.LoadInt64(&st.latency)),
+		LatencyCounts:  make([]uint64, len(st.latencyCounts)),
+		ServerFailures: make(map[string]uint64),
+		ServerLatency:  make(map[string]LatencyHistogram),
+		ServerInFlight: r.slots.snapshot(),
+		ByPath:         make(map[string]uint64),
+	}
+
+	for i := range st.latencyCounts {
+		s.LatencyCounts[i] = atomic.LoadUint64(&st.latencyCounts[i])
+	}
+
+	types, _ := st.types.Load().(map[string]*typeStats)
+	for qtype, ts := range types {
+		s.ByType[qtype] = atomic.LoadUint64(&ts.lookups)
+		for i := range ts.outcomes {
+			if n := atomic.LoadUint64(&ts.outcomes[i]); n > 0 {
+				if s.ByOutcome[qtype] == nil {
+					s.ByOutcome[qtype] = make(map[string]uint64)
+				}
+				s.ByOutcome[qtype][outcomes[i]] = n
+			}
+		}
+	}
+	st.serverFailures.Range(func(k, v interface{}) bool {
+		s.ServerFailures[k.(string)] = atomic.LoadUint64(v.(*uint64))
+		return true
+	})
+	st.paths.Range(func(k, v interface{}) bool {
+		s.ByPath[k.(string)] = atomic.LoadUint64(v.(*uint64))
+		return true
+	})
+	st.serverLatency.Range(func(k, v interface{}) bool {
+		s.ServerLatency[k.(string)] = v.(*latencyHistogram).snapshot()
+		return true
+	})
+
+	if s.Lookups > 0 {
+		s.MeanLatency = s.Latency / time.Duration(s.Lookups)
+	}
+
+	return s
+}
+
+// ServerLatency returns the latency histogram of the attempts sent to addr,
+// false when none was.
+func (r *Resolver) ServerLatency(addr string) (LatencyHistogram, bool) {
+	h, ok := r.stats.serverLatency.Load(addr)
+	if !ok {
+		return LatencyHistogram{}, false
+	}
+
+	return h.(*latencyHistogram).snapshot(), true
+}
+
+// HealthyServers counts the servers of the list neither quarantined nor
+// caught misbehaving.
+func (r *Resolver) HealthyServers() int {
+	servers := r.Servers.All()
+	addrs := make([]string, len(servers))
+	for i, srv := range servers {
+		addrs[i] = srv.Addr
+	}
+
+	return r.health.healthy(addrs)
+}
+
+// ResetStats sets the counters back to zero, InFlight is left alone.
+// Lookups running meanwhile may be counted partly before and partly after
+// the reset.
+func (r *Resolver) ResetStats() {
+	st := r.stats
+	for _, n := range []*uint64{&st.lookups, &st.successes, &st.failures, &st.notFound, &st.retryLimit, &st.emptyList, &st.attempts, &st.rejected, &st.blocked} {
+		atomic.StoreUint64(n, 0)
+	}
+	atomic.StoreInt64(&st.latency, 0)
+
+	for i := range st.latencyCounts {
+		atomic.StoreUint64(&st.latencyCounts[i], 0)
+	}
+	types, _ := st.types.Load().(map[string]*typeStats)
+	for _, ts := range types {
+		atomic.StoreUint64(&ts.lookups, 0)
+		for i := range ts.outcomes {
+			atomic.StoreUint64(&ts.outcomes[i], 0)
+		}
+	}
+	for _, m := range []*sync.Map{&st.serverFailures, &st.paths} {
+		m.Range(func(k, v interface{}) bool {
+			atomic.StoreUint64(v.(*uint64), 0)
+			return true
+		})
+	}
+	st.serverLatency.Range(func(k, v interface{}) bool {
+		v.(*latencyHistogram).reset()
+		return true
+	})
+}
@@ -0,0 +1,101 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	r := New()
+	r.RetryLimit = 2
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2\n10.0.0.3")
+
+	_ = r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		return nil
+	})
+	_ = r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		return &net.DNSError{Err: `no such host`, IsNotFound: true}
+	})
+	_ = r.lookup(`MX`, `example.com`, func(*net.Resolver) error {
+		return errors.New(`i/o timeout`)
+	})
+
+	s := r.Stats()
+	if s.Lookups != 3 || s.ByType[`A`] != 2 || s.ByType[`MX`] != 1 {
+		t.Errorf(`unexpected lookup counts %+v`, s)
+	}
+	if s.Successes != 1 || s.Failures != 2 || s.NotFound != 1 || s.RetryLimit != 1 || s.EmptyList != 0 {
+		t.Errorf(`unexpected outcomes %+v`, s)
+	}
+	if s.ByOutcome[`A`][OutcomeSuccess] != 1 || s.ByOutcome[`A`][OutcomeNotFound] != 1 || s.ByOutcome[`MX`][OutcomeRetryLimit] != 1 {
+		t.Errorf(`unexpected outcomes by type %v`, s.ByOutcome)
+	}
+	var failures uint64
+	for _, n := range s.ServerFailures {
+		failures += n
+	}
+	if failures != 2 {
+		t.Errorf(`expected 2 server failures, got %v`, s.ServerFailures)
+	}
+	var counted uint64
+	for _, n := range s.LatencyCounts {
+		counted += n
+	}
+	if len(s.LatencyCounts) != len(LatencyBuckets)+1 || counted != 3 {
+		t.Errorf(`unexpected latency histogram %v`, s.LatencyCounts)
+	}
+	if s.Attempts != 4 {
+		t.Errorf(`expected 4 attempts, got %d`, s.Attempts)
+	}
+	if s.MeanLatency != s.Latency/3 {
+		t.Errorf(`unexpected mean latency %v of %v`, s.MeanLatency, s.Latency)
+	}
+
+	r.ResetStats()
+	if s := r.Stats(); s.Lookups != 0 || s.Attempts != 0 || s.ByType[`A`] != 0 {
+		t.Errorf(`stats not reset %+v`, s)
+	}
+
+	empty := New()
+	_ = empty.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		return nil
+	})
+	if s := empty.Stats(); s.EmptyList != 1 || s.Attempts != 0 {
+		t.Errorf(`unexpected empty list stats %+v`, s)
+	}
+}
+
+func TestServerLatency(t *testing.T) {
+	r := New()
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString("10.0.0.1")
+	addr := r.Servers.All()[0].Addr
+
+	if _, ok := r.ServerLatency(addr); ok {
+		t.Errorf(`latency of a server never asked`)
+	}
+
+	for i := 0; i < 3; i++ {
+		_ = r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+			return nil
+		})
+	}
+
+	h, ok := r.ServerLatency(addr)
+	if !ok || h.Count != 3 || h.Counts[0] != 3 || len(h.Counts) != len(LatencyBuckets)+1 {
+		t.Errorf(`unexpected histogram %+v`, h)
+	}
+	if s := r.Stats(); s.ServerLatency[addr].Count != 3 {
+		t.Errorf(`histogram missing from stats %+v`, s.ServerLatency)
+	}
+
+	r.ResetStats()
+	if h, _ := r.ServerLatency(addr); h.Count != 0 || h.Sum != 0 {
+		t.Errorf(`histogram not reset %+v`, h)
+	}
+	if latencyBucket(LatencyBuckets[len(LatencyBuckets)-1]+1) != len(LatencyBuckets) {
+		t.Errorf(`slow attempts not in the last bucket`)
+	}
+}
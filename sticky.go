@@ -0,0 +1,158 @@
+package resolver
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// ringReplicas is the number of virtual nodes per server on the hash ring,
+// more replicas spread names more evenly at the cost of ring size.
+const ringReplicas = 64
+
+type ringPoint struct {
+	hash   uint32
+	server *Server
+}
+
+// hashRing maps query names onto servers with consistent hashing, so a change
+// in the server set only moves the names owned by the joined or left server.
+type hashRing struct {
+	size    int
+	members uint64
+	points  []ringPoint
+
+	// the list the ring is of and its count of changes then, see
+	// changeCounter, both guarded by the mutex of the resolver
+	list    ServerList
+	changes uint64
+}
+
+// changeCounter is a ServerList counting the changes of its servers, the
+// ring of one is kept as long as the count stays.
+type changeCounter interface {
+	changes() uint64
+}
+
+func newHashRing(servers []*Server) *hashRing {
+	h := &hashRing{
+		size:    len(servers),
+		members: ringMembers(servers),
+		points:  make([]ringPoint, 0, len(servers)*ringReplicas),
+	}
+
+	for _, s := range servers {
+		for i := 0; i < ringReplicas; i++ {
+			h.points = append(h.points, ringPoint{
+				hash:   ringHash(s.Addr + `#` + strconv.Itoa(i)),
+				server: s,
+			})
+		}
+	}
+
+	sort.Slice(h.points, func(i, j int) bool {
+		return h.points[i].hash < h.points[j].hash
+	})
+
+	return h
+}
+
+// get returns the n-th distinct server clockwise from the name's position
+// that is not among the tried ones, n = 0 is the preferred server, larger n
+// are the fallback candidates. Once all were tried they come round again.
+func (h *hashRing) get(name string, n int, tried []Attempt) *Server {
+	if len(h.points) == 0 {
+		return nil
+	}
+
+	key := ringHash(nameKey(name))
+	idx := sort.Search(len(h.points), func(i int) bool {
+		return h.points[i].hash >= key
+	})
+
+	order := make([]*Server, 0, h.size)
+	seen := make(map[*Server]struct{}, h.size)
+	for i := 0; i < len(h.points) && len(order) < h.size; i++ {
+		p := h.points[(idx+i)%len(h.points)]
+		if _, ok := seen[p.server]; ok {
+			continue
+		}
+		seen[p.server] = struct{}{}
+		order = append(order, p.server)
+	}
+
+	fresh := 0
+	for _, s := range order {
+		if triedServer(tried, s.Addr) {
+			continue
+		}
+		if fresh == n {
+			return s
+		}
+		fresh++
+	}
+
+	return order[(n-fresh)%len(order)]
+}
+
+func triedServer(tried []Attempt, addr string) bool {
+	for _, a := range tried {
+		if a.Server == addr {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ringMembers sums hashes of the addresses of servers, in whatever order
+// the list hands them out, so that replacing a server changes it.
+func ringMembers(servers []*Server) uint64 {
+	var sum uint64
+	for _, s := range servers {
+		// FNV-1a inline, this runs on every sticky selection from a list
+		// that does not count its changes
+		h := uint64(14695981039346656037)
+		for i := 0; i < len(s.Addr); i++ {
+			h ^= uint64(s.Addr[i])
+			h *= 1099511628211
+		}
+		sum += h
+	}
+
+	return sum
+}
+
+func ringHash(s string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+	return h.Sum32()
+}
+
+// stickyServer picks the n-th server for a lookup of name out of those of
+// pool not tried yet. The ring is rebuilt whenever the servers of the list
+// change, known from the count of changes of the lists of this package and
+// from the servers themselves for the others.
+func (r *Resolver) stickyServer(pool ServerList, name string, n int, tried []Attempt) (*Server, error) {
+	r.mu.Lock()
+	changes, counted := uint64(0), false
+	if c, ok := pool.(changeCounter); ok {
+		// counted before All, a change in between is seen the next time
+		changes, counted = c.changes(), true
+	}
+	if r.ring == nil || r.ring.list != pool || r.ring.changes != changes || !counted {
+		servers := pool.All()
+		if len(servers) == 0 {
+			r.mu.Unlock()
+			return nil, ErrServerListEmpty
+		}
+		if r.ring == nil || r.ring.list != pool || r.ring.size != len(servers) || r.ring.members != ringMembers(servers) {
+			r.ring = newHashRing(servers)
+		}
+		r.ring.list, r.ring.changes = pool, changes
+	}
+	ring := r.ring
+	r.mu.Unlock()
+
+	return ring.get(name, n, tried), nil
+}
@@ -0,0 +1,120 @@
+package resolver
+
+import (
+	"fmt"
+	"github.com/zofan/go-slist"
+	"testing"
+)
+
+func testServers(n int) []*slist.Server {
+	servers := make([]*slist.Server, n)
+	for i := range servers {
+		servers[i] = &slist.Server{Addr: fmt.Sprintf(`10.0.0.%d`, i+1)}
+	}
+	return servers
+}
+
+func TestHashRingSticky(t *testing.T) {
+	ring := newHashRing(testServers(10))
+
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf(`host-%d.example.com`, i)
+		if ring.get(name, 0, nil) != ring.get(name, 0, nil) {
+			t.Fatal(`same name expected the same server`)
+		}
+		if ring.get(name, 0, nil) != ring.get(`HOST-`+name[5:]+`.`, 0, nil) {
+			t.Fatal(`name case and trailing dot should not change the server`)
+		}
+	}
+}
+
+func TestHashRingFallback(t *testing.T) {
+	ring := newHashRing(testServers(5))
+
+	seen := map[*slist.Server]struct{}{}
+	for n := 0; n < 5; n++ {
+		seen[ring.get(`example.com`, n, nil)] = struct{}{}
+	}
+	if len(seen) != 5 {
+		t.Errorf(`expected 5 distinct fallback candidates, got %d`, len(seen))
+	}
+	if ring.get(`example.com`, 5, nil) != ring.get(`example.com`, 0, nil) {
+		t.Error(`candidates expected to wrap around`)
+	}
+}
+
+func TestHashRingMinimalMovement(t *testing.T) {
+	servers := testServers(10)
+	before := newHashRing(servers)
+	after := newHashRing(servers[:9])
+
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf(`host-%d.example.com`, i)
+		a, b := before.get(name, 0, nil), after.get(name, 0, nil)
+		if a != b {
+			if a != servers[9] {
+				t.Fatalf(`%s moved from %s, which is still in the ring`, name, a.Addr)
+			}
+			moved++
+		}
+	}
+	if moved > 200 {
+		t.Errorf(`too many names moved: %d`, moved)
+	}
+}
+
+func TestStickyServerReplaced(t *testing.T) {
+	r := New()
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2")
+	for i := 0; i < 20; i++ {
+		_, _ = r.stickyServer(r.Servers, fmt.Sprintf(`host-%d.example.com`, i), 0, nil)
+	}
+
+	// same size, one server swapped for another
+	r.Servers = r.newServerList()
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.3")
+
+	for i := 0; i < 20; i++ {
+		srv, err := r.stickyServer(r.Servers, fmt.Sprintf(`host-%d.example.com`, i), 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if srv.Addr == `10.0.0.2` {
+			t.Fatal(`ring still hashes to the removed server`)
+		}
+	}
+}
+
+func TestHashRingSkipsTried(t *testing.T) {
+	ring := newHashRing(testServers(3))
+
+	first, second := ring.get(`example.com`, 0, nil), ring.get(`example.com`, 1, nil)
+	tried := []Attempt{{Server: first.Addr}}
+	if got := ring.get(`example.com`, 0, tried); got != second {
+		t.Errorf(`expected the next candidate after the tried one, got %s`, got.Addr)
+	}
+
+	tried = []Attempt{{Server: `10.0.0.1`}, {Server: `10.0.0.2`}, {Server: `10.0.0.3`}}
+	if got := ring.get(`example.com`, 0, tried); got != first {
+		t.Errorf(`expected the candidates to come round once all were tried, got %s`, got.Addr)
+	}
+}
+
+func TestStickyRingKept(t *testing.T) {
+	r := New()
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2")
+
+	_, _ = r.stickyServer(r.Servers, `example.com`, 0, nil)
+	ring := r.ring
+	_, _ = r.stickyServer(r.Servers, `example.org`, 0, nil)
+	if r.ring != ring {
+		t.Error(`expected the ring kept while the list is unchanged`)
+	}
+
+	_, _ = r.LoadServersFromString(`10.0.0.3`)
+	_, _ = r.stickyServer(r.Servers, `example.com`, 0, nil)
+	if r.ring == ring || r.ring.size != 3 {
+		t.Error(`expected the ring rebuilt once a server joined`)
+	}
+}
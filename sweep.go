@@ -0,0 +1,73 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+)
+
+const (
+	// DefaultSweepMinBits is the shortest IPv4 prefix SweepPTR takes when
+	// SweepMinBits is 0, a /16 is 65536 lookups.
+	DefaultSweepMinBits = 16
+
+	// sweepMinBits6 is the shortest IPv6 prefix SweepPTR takes, anything
+	// wider cannot be swept address by address.
+	sweepMinBits6 = 120
+)
+
+var ErrSweepTooLarge = errors.New(`resolver: prefix too large to sweep`)
+
+// SweepResult is the outcome of one address of SweepPTR, the way
+// ReverseResult is of LookupAddrBatch.
+type SweepResult struct {
+	Addr     netip.Addr
+	Names    []string
+	NotFound bool
+	Err      error
+}
+
+// SweepPTR looks up the names of every address of prefix with up to
+// concurrency lookups at once, the results are in address order. IPv4
+// prefixes shorter than SweepMinBits and IPv6 ones shorter than /120 fail
+// with ErrSweepTooLarge. Once ctx is done the addresses left out get
+// ctx.Err(), which is then returned as well.
+func (r *Resolver) SweepPTR(ctx context.Context, prefix netip.Prefix, concurrency int, opts ...BatchOption) ([]SweepResult, error) {
+	if !prefix.IsValid() {
+		return nil, ErrBadOption
+	}
+
+	minBits := sweepMinBits6
+	if prefix.Addr().Is4() {
+		if minBits = r.settings().SweepMinBits; minBits <= 0 {
+			minBits = DefaultSweepMinBits
+		}
+	}
+	if prefix.Bits() < minBits {
+		return nil, ErrSweepTooLarge
+	}
+
+	prefix = prefix.Masked()
+	var addrs []netip.Addr
+	var ips []string
+	for a := prefix.Addr(); a.IsValid() && prefix.Contains(a); a = a.Next() {
+		addrs = append(addrs, a)
+		ips = append(ips, a.String())
+	}
+
+	reverse := r.LookupAddrBatch(ctx, ips, concurrency, nil, opts...)
+	results := make([]SweepResult, len(addrs))
+	for i, res := range reverse {
+		results[i] = SweepResult{Addr: addrs[i], Names: res.Names, NotFound: res.NotFound, Err: res.Err}
+	}
+
+	if err := ctx.Err(); err != nil {
+		for _, res := range results {
+			if errors.Is(res.Err, err) {
+				return results, err
+			}
+		}
+	}
+
+	return results, nil
+}
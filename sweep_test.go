@@ -0,0 +1,77 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestSweepPTR(t *testing.T) {
+	server := newTestServer(t, func(q Question, resp *Message) {
+		// 192.0.2.0/28, the even hosts have names
+		var last int
+		if _, err := fmt.Sscanf(q.Name, `%d.2.0.192.in-addr.arpa.`, &last); err != nil || last%2 == 1 {
+			resp.Rcode = RcodeNameError
+			return
+		}
+		resp.Answers = append(resp.Answers, RR{Name: q.Name, Type: TypePTR, TTL: 60, Target: fmt.Sprintf(`h%d.example.com.`, last)})
+	})
+
+	r := New()
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	var total int
+	res, err := r.SweepPTR(context.Background(), netip.MustParsePrefix(`192.0.2.5/28`), 4, WithProgress(func(done, n int) { total = n }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 16 || total != 16 {
+		t.Fatalf(`expected 16 addresses, got %d and a total of %d`, len(res), total)
+	}
+	for i, sr := range res {
+		if sr.Addr != netip.AddrFrom4([4]byte{192, 0, 2, byte(i)}) || sr.Err != nil {
+			t.Errorf(`unexpected result %+v`, sr)
+			continue
+		}
+		if i%2 == 1 {
+			if !sr.NotFound {
+				t.Errorf(`%s: expected NotFound, got %+v`, sr.Addr, sr)
+			}
+		} else if len(sr.Names) != 1 || !strings.HasPrefix(sr.Names[0], fmt.Sprintf(`h%d.`, i)) {
+			t.Errorf(`%s: unexpected names %v`, sr.Addr, sr.Names)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if res, err := r.SweepPTR(ctx, netip.MustParsePrefix(`192.0.2.0/30`), 1); !errors.Is(err, context.Canceled) || len(res) != 4 {
+		t.Errorf(`expected a canceled sweep, got %d results and %v`, len(res), err)
+	}
+}
+
+func TestSweepPTRTooLarge(t *testing.T) {
+	r := New()
+
+	for prefix, want := range map[string]error{
+		`10.0.0.0/8`:       ErrSweepTooLarge,
+		`2001:db8::/64`:    ErrSweepTooLarge,
+		`2001:db8::/119`:   ErrSweepTooLarge,
+		`198.51.100.0/32`:  nil,
+		`2001:db8::ff/128`: nil,
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := r.SweepPTR(ctx, netip.MustParsePrefix(prefix), 1); want != nil && err != want || want == nil && err == ErrSweepTooLarge {
+			t.Errorf(`%s: expected %v, got %v`, prefix, want, err)
+		}
+	}
+
+	r.SweepMinBits = 24
+	if _, err := r.SweepPTR(context.Background(), netip.MustParsePrefix(`10.0.0.0/23`), 1); err != ErrSweepTooLarge {
+		t.Errorf(`expected SweepMinBits to refuse a /23, got %v`, err)
+	}
+}
@@ -0,0 +1,135 @@
+package resolver
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+var ErrNoTaggedServer = errors.New(`resolver: no healthy server matches the tags`)
+
+// TagSelector matches servers having every one of its tags with the same value.
+type TagSelector map[string]string
+
+// ParseTagSelector reads a selector in the form `region=eu,tier=primary`.
+func ParseTagSelector(expr string) (TagSelector, error) {
+	sel := TagSelector{}
+
+	for _, pair := range strings.Split(expr, `,`) {
+		if pair = strings.TrimSpace(pair); pair == `` {
+			continue
+		}
+
+		k, v, ok := parseTag(pair)
+		if !ok {
+			return nil, ErrBadOption
+		}
+		sel[k] = v
+	}
+
+	return sel, nil
+}
+
+func (s TagSelector) Match(tags map[string]string) bool {
+	for k, v := range s {
+		if tags[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s TagSelector) String() string {
+	pairs := make([]string, 0, len(s))
+	for k, v := range s {
+		pairs = append(pairs, k+`=`+v)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, `,`)
+}
+
+// TagServer replaces the tags of the server, nil tags remove them.
+func (r *Resolver) TagServer(addr string, tags map[string]string) {
+	if norm, ok := normalizeServer(addr); ok {
+		addr = norm
+	}
+
+	copied := make(map[string]string, len(tags))
+	for k, v := range tags {
+		copied[k] = v
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(copied) == 0 {
+		delete(r.tags, addr)
+		return
+	}
+
+	if r.tags == nil {
+		r.tags = make(map[string]map[string]string)
+	}
+	r.tags[addr] = copied
+}
+
+// ServerTags returns a copy of the tags of the server.
+func (r *Resolver) ServerTags(addr string) map[string]string {
+	if norm, ok := normalizeServer(addr); ok {
+		addr = norm
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tags := make(map[string]string, len(r.tags[addr]))
+	for k, v := range r.tags[addr] {
+		tags[k] = v
+	}
+
+	return tags
+}
+
+func (r *Resolver) serverMatches(addr string, sel TagSelector) bool {
+	if len(sel) == 0 {
+		return true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return sel.Match(r.tags[addr])
+}
+
+// parseServerLine splits a server list line of the form
+// `1.1.1.1 region=eu provider=cloudflare` into address and tags.
+func parseServerLine(line string) (addr string, tags map[string]string, ok bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ``, nil, false
+	}
+
+	for _, f := range fields[1:] {
+		k, v, ok := parseTag(f)
+		if !ok {
+			return ``, nil, false
+		}
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		tags[k] = v
+	}
+
+	return fields[0], tags, true
+}
+
+func parseTag(pair string) (k, v string, ok bool) {
+	i := strings.IndexByte(pair, '=')
+	if i <= 0 {
+		return ``, ``, false
+	}
+
+	return strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+1:]), true
+}
@@ -0,0 +1,77 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestServerTags(t *testing.T) {
+	r := New()
+	r.RetrySleep = 0
+
+	report, err := r.LoadServersFromString("127.0.0.1 region=eu provider=quad9\n127.0.0.2 region=us\n127.0.0.3 region=eu=x y")
+	if err != nil {
+		t.Error(err)
+	}
+	if report.Added != 2 || report.Invalid != 1 {
+		t.Errorf(`unexpected load report %+v`, report)
+	}
+
+	eu, err := ParseTagSelector(`region=eu`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		err := r.lookup(`A`, `example.com`, func(res *net.Resolver) error {
+			if got := dialedServer(t, res); got != `127.0.0.1:53` {
+				t.Errorf(`expected region=eu server, got %s`, got)
+			}
+			return nil
+		}, WithServerTags(eu))
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	r.TagServer(`127.0.0.2:53`, map[string]string{`region`: `eu`, `tier`: `primary`})
+	if got := r.ServerTags(`127.0.0.2`)[`tier`]; got != `primary` {
+		t.Errorf(`expected tier=primary, got %q`, got)
+	}
+
+	r.RequireTags = TagSelector{`tier`: `primary`}
+	_ = r.lookup(`A`, `example.com`, func(res *net.Resolver) error {
+		if got := dialedServer(t, res); got != `127.0.0.2:53` {
+			t.Errorf(`expected the resolver-level selector to apply, got %s`, got)
+		}
+		return nil
+	})
+}
+
+func TestServerTagsFallback(t *testing.T) {
+	r := New()
+	r.RequireTags = TagSelector{`region`: `ap`}
+
+	_, err := r.LoadServersFromString("127.0.0.1 region=eu")
+	if err != nil {
+		t.Error(err)
+	}
+
+	ok := func(*net.Resolver) error { return nil }
+	if err := r.lookup(`A`, `example.com`, ok); !errors.Is(err, ErrNoTaggedServer) {
+		t.Error(err)
+	}
+
+	r.TagFallback = true
+	if err := r.lookup(`A`, `example.com`, ok); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := ParseTagSelector(`region`); err != ErrBadOption {
+		t.Error(err)
+	}
+	if sel, _ := ParseTagSelector(` tier=primary, region=eu `); sel.String() != `region=eu,tier=primary` {
+		t.Errorf(`unexpected selector %s`, sel)
+	}
+}
@@ -0,0 +1,69 @@
+package resolver
+
+import (
+	"errors"
+	"time"
+)
+
+// Trace is the record of one lookup, filled in by WithTrace.
+type Trace struct {
+	Host     string
+	Type     string
+	Start    time.Time
+	Duration time.Duration
+	Attempts []TraceAttempt
+	Err      error
+}
+
+// TraceAttempt is one query of a traced lookup. Transport is the one the
+// attempt started on, a truncated answer is asked again over TCP. Outcome
+// is the class of Err: success, not_found, no_data or error.
+type TraceAttempt struct {
+	Server    string
+	Transport string
+	Start     time.Time
+	Duration  time.Duration
+	Outcome   string
+	Err       error
+}
+
+// WithTrace records the attempts and timing of the lookup in t, which is
+// reset first. Lookups without it keep no record.
+func WithTrace(t *Trace) LookupOption {
+	return func(o *lookupOptions) {
+		o.trace = t
+	}
+}
+
+func (t *Trace) begin(host, qtype string, now time.Time) {
+	*t = Trace{Host: host, Type: qtype, Start: now}
+}
+
+func (t *Trace) attempt(server string, start time.Time, d time.Duration, err error) {
+	t.Attempts = append(t.Attempts, TraceAttempt{
+		Server:    server,
+		Transport: `udp`,
+		Start:     start,
+		Duration:  d,
+		Outcome:   attemptOutcome(err),
+		Err:       err,
+	})
+}
+
+func (t *Trace) end(err error, d time.Duration) {
+	t.Duration = d
+	t.Err = err
+}
+
+func attemptOutcome(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case errors.Is(err, ErrNoData):
+		return OutcomeNoData
+	case isNotFound(err):
+		return OutcomeNotFound
+	}
+
+	return OutcomeError
+}
@@ -0,0 +1,51 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestWithTrace(t *testing.T) {
+	r := New()
+	r.RetryLimit = 5
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString("10.0.0.1\n10.0.0.2\n10.0.0.3")
+
+	var trace Trace
+	calls := 0
+	err := r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		if calls++; calls < 3 {
+			return errors.New(`connection refused`)
+		}
+		return nil
+	}, WithTrace(&trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if trace.Host != `example.com` || trace.Type != `A` || trace.Err != nil || trace.Duration <= 0 {
+		t.Errorf(`unexpected trace %+v`, trace)
+	}
+	if len(trace.Attempts) != 3 {
+		t.Fatalf(`expected 3 attempts, got %+v`, trace.Attempts)
+	}
+	for i, a := range trace.Attempts {
+		if a.Server == `` || a.Transport != `udp` || a.Start.Before(trace.Start) {
+			t.Errorf(`attempt %d: unexpected %+v`, i, a)
+		}
+		if i > 0 && a.Start.Before(trace.Attempts[i-1].Start) {
+			t.Errorf(`attempt %d out of order`, i)
+		}
+	}
+	if trace.Attempts[0].Outcome != OutcomeError || trace.Attempts[2].Outcome != OutcomeSuccess {
+		t.Errorf(`unexpected outcomes %+v`, trace.Attempts)
+	}
+
+	err = r.lookup(`A`, `example.com`, func(*net.Resolver) error {
+		return &net.DNSError{Err: `no such host`, IsNotFound: true}
+	}, WithTrace(&trace))
+	if trace.Err != err || len(trace.Attempts) != 1 || trace.Attempts[0].Outcome != OutcomeNotFound {
+		t.Errorf(`unexpected trace of a failed lookup %+v`, trace)
+	}
+}
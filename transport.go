@@ -0,0 +1,23 @@
+package resolver
+
+import "net/http"
+
+// HTTPTransport returns a clone of base, http.DefaultTransport when it is
+// nil, that dials through DialContext, so that the hosts of its requests
+// are looked up by r and not by the system resolver. The TLS config, proxy
+// and pool settings of base are kept. TLS is still set up by the transport
+// over the dialed connection, the SNI and the certificate check go by the
+// host name of the request and not by the address dialed. A DialTLSContext
+// or DialTLS of base is dropped, it would bypass r. Requests through a
+// proxy look up the proxy host only.
+func (r *Resolver) HTTPTransport(base *http.Transport) *http.Transport {
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+
+	t := base.Clone()
+	t.DialContext = r.DialContext
+	t.DialTLSContext, t.DialTLS = nil, nil
+
+	return t
+}
@@ -0,0 +1,72 @@
+package resolver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPTransport(t *testing.T) {
+	web := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = io.WriteString(w, req.TLS.ServerName)
+	}))
+	defer web.Close()
+	_, port, _ := net.SplitHostPort(web.Listener.Addr().String())
+
+	// the test certificate is for example.com, which only the test server
+	// resolves to the local web server
+	dns := newTestServer(t, answerA(map[string]string{`example.com`: `127.0.0.1`}))
+	r := New()
+	if _, err := r.LoadServersFromString(dns.Addr); err != nil {
+		t.Fatal(err)
+	}
+
+	base := web.Client().Transport.(*http.Transport)
+	base.MaxIdleConnsPerHost = 7
+	tr := r.HTTPTransport(base)
+	if tr == base || tr.MaxIdleConnsPerHost != 7 || tr.TLSClientConfig == nil || tr.TLSClientConfig.RootCAs != base.TLSClientConfig.RootCAs {
+		t.Fatal(`expected a clone keeping the settings of base`)
+	}
+
+	resp, err := (&http.Client{Transport: tr}).Get(`https://example.com:` + port + `/`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	sni, _ := io.ReadAll(resp.Body)
+	if string(sni) != `example.com` {
+		t.Errorf(`expected the SNI example.com, got %q`, sni)
+	}
+	asked := false
+	for _, q := range dns.Queries() {
+		asked = asked || q.Name == `example.com.`
+	}
+	if !asked {
+		t.Errorf(`expected the lookup at the test server, got %v`, dns.Queries())
+	}
+}
+
+func ExampleResolver_HTTPTransport() {
+	r, err := NewWithServers(`1.1.1.1`, `8.8.8.8`)
+	if err != nil {
+		panic(err)
+	}
+
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	client := &http.Client{Transport: r.HTTPTransport(base)}
+
+	resp, err := client.Get(`https://example.com/`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer resp.Body.Close()
+
+	fmt.Println(resp.Status)
+}
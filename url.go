@@ -0,0 +1,80 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+)
+
+var ErrBadURL = errors.New(`resolver: bad URL`)
+
+// schemePorts are the ports of the URL schemes ResolveURL knows.
+var schemePorts = map[string]string{
+	`http`:  `80`,
+	`https`: `443`,
+	`ws`:    `80`,
+	`wss`:   `443`,
+	`ftp`:   `21`,
+	`ssh`:   `22`,
+	`smtp`:  `25`,
+	`imap`:  `143`,
+	`imaps`: `993`,
+	`ldap`:  `389`,
+	`ldaps`: `636`,
+}
+
+// URLTarget is where a URL points: its host as written, without brackets
+// or userinfo, the port and the addresses of the host.
+type URLTarget struct {
+	Host string
+	Port string
+	IPs  []net.IPAddr
+}
+
+// Addrs returns the addresses joined with the port, in order, ready for
+// dialing.
+func (t *URLTarget) Addrs() []string {
+	addrs := make([]string, len(t.IPs))
+	for i, ip := range t.IPs {
+		addrs[i] = net.JoinHostPort(ip.String(), t.Port)
+	}
+
+	return addrs
+}
+
+// ResolveURL looks up the host of rawurl, an absolute URL. The port is the
+// one of the URL or that of its scheme, an unknown scheme needs one. An IP
+// literal host is returned as it is, see LookupIPAddr. A URL that does not
+// parse, has no host or no port fails with a *url.Error wrapping ErrBadURL
+// or the parse error, before any lookup.
+func (r *Resolver) ResolveURL(ctx context.Context, rawurl string) (*URLTarget, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	host := u.Hostname()
+	if host == `` {
+		return nil, &url.Error{Op: `parse`, URL: rawurl, Err: fmt.Errorf(`%w: no host`, ErrBadURL)}
+	}
+	port := u.Port()
+	if port == `` {
+		port = schemePorts[u.Scheme]
+	}
+	if port == `` {
+		return nil, &url.Error{Op: `parse`, URL: rawurl, Err: fmt.Errorf(`%w: no port`, ErrBadURL)}
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 0xffff {
+		return nil, &url.Error{Op: `parse`, URL: rawurl, Err: fmt.Errorf(`%w: port %s`, ErrBadURL, port)}
+	}
+
+	t := &URLTarget{Host: host, Port: port}
+	if t.IPs, err = r.LookupIPAddr(host, WithContext(ctx)); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
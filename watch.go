@@ -0,0 +1,286 @@
+package resolver
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WatchUpdate is a change of the records watched, or a failure to look
+// them up. Records are the whole current set in text form, the address of
+// A and AAAA records, `pref host` for MX, `priority weight port target` for
+// SRV. After a failure Err is set and Records are the last ones known.
+type WatchUpdate struct {
+	Host    string
+	Type    Type
+	Records []string
+	Added   []string
+	Removed []string
+	Err     error
+	Time    time.Time
+}
+
+// watchKey is what watches share their queries by.
+type watchKey struct {
+	name  string
+	qtype Type
+}
+
+// watcher polls one name and type for all of its watches.
+type watcher struct {
+	key       watchKey
+	intervals map[*int]time.Duration // of the watches, by a pointer of each
+	records   []string
+	err       error
+	gen       uint64        // bumped on every change and failure
+	changed   chan struct{} // closed and replaced with gen
+	wake      chan struct{}
+	stop      context.CancelFunc
+	mu        sync.Mutex
+}
+
+type watches struct {
+	watchers map[watchKey]*watcher
+	mu       sync.Mutex
+}
+
+// Watch looks up the records of type qtype of host every interval, or
+// every TTL of the records when that is longer, and sends an update when
+// they change, starting with the first answer. A failed lookup is sent as
+// an update with Err and the watch goes on, the next answer is sent
+// whether it changed or not. A name without records of qtype has an empty
+// set. Watches of one name and type share their queries, made at the
+// shortest of their intervals. The channel is closed once ctx is done or
+// the resolver closed. A receiver falling behind gets one update for all
+// the changes it missed.
+func (r *Resolver) Watch(ctx context.Context, host string, qtype Type, interval time.Duration) (<-chan WatchUpdate, error) {
+	if interval <= 0 {
+		return nil, ErrBadOption
+	}
+
+	key := watchKey{name: nameKey(host), qtype: qtype}
+	token := new(int)
+	w := r.watcher(key, token, interval)
+	ch := make(chan WatchUpdate, 1)
+
+	go func() {
+		defer close(ch)
+		defer r.unwatch(w, token)
+
+		var seen uint64
+		var last []string
+		failed := false
+		for {
+			w.mu.Lock()
+			gen, records, err, changed := w.gen, w.records, w.err, w.changed
+			w.mu.Unlock()
+
+			if gen != seen {
+				seen = gen
+				u := WatchUpdate{Host: host, Type: qtype, Records: last, Err: err, Time: time.Now()}
+				if err == nil {
+					u.Records = records
+					u.Added, u.Removed = diffRecords(last, records)
+				}
+				if err != nil || failed || len(u.Added) > 0 || len(u.Removed) > 0 || last == nil {
+					select {
+					case ch <- u:
+					case <-ctx.Done():
+						return
+					case <-r.done:
+						return
+					}
+				}
+				if err == nil {
+					last = records
+				}
+				failed = err != nil
+			}
+
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			case <-r.done:
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// watcher returns the watcher of key with the watch of token added,
+// starting it when there is none yet.
+func (r *Resolver) watcher(key watchKey, token *int, interval time.Duration) *watcher {
+	r.watches.mu.Lock()
+	defer r.watches.mu.Unlock()
+
+	if w, ok := r.watches.watchers[key]; ok {
+		w.mu.Lock()
+		w.intervals[token] = interval
+		w.mu.Unlock()
+
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+		return w
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	w := &watcher{
+		key:       key,
+		intervals: map[*int]time.Duration{token: interval},
+		changed:   make(chan struct{}),
+		wake:      make(chan struct{}, 1),
+		stop:      stop,
+	}
+	if r.watches.watchers == nil {
+		r.watches.watchers = make(map[watchKey]*watcher)
+	}
+	r.watches.watchers[key] = w
+
+	go r.poll(ctx, w)
+
+	return w
+}
+
+// unwatch drops the watch of token, the last one stops the watcher.
+func (r *Resolver) unwatch(w *watcher, token *int) {
+	r.watches.mu.Lock()
+	defer r.watches.mu.Unlock()
+
+	w.mu.Lock()
+	delete(w.intervals, token)
+	last := len(w.intervals) == 0
+	w.mu.Unlock()
+
+	if last {
+		w.stop()
+		delete(r.watches.watchers, w.key)
+	}
+}
+
+func (r *Resolver) poll(ctx context.Context, w *watcher) {
+	for {
+		records, ttl, err := r.watchRecords(ctx, w.key)
+		if ctx.Err() != nil {
+			return
+		}
+
+		w.mu.Lock()
+		if err != nil || w.err != nil || w.gen == 0 || !sameRecords(w.records, records) {
+			if err == nil {
+				w.records = records
+			}
+			w.err = err
+			w.gen++
+			close(w.changed)
+			w.changed = make(chan struct{})
+		}
+		wait := time.Duration(0)
+		for _, d := range w.intervals {
+			if wait == 0 || d < wait {
+				wait = d
+			}
+		}
+		w.mu.Unlock()
+
+		if ttl > wait {
+			wait = ttl
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-w.wake:
+			t.Stop()
+		case <-ctx.Done():
+			t.Stop()
+			return
+		}
+	}
+}
+
+// watchRecords looks up the records of key, sorted, along with the lowest
+// TTL among them.
+func (r *Resolver) watchRecords(ctx context.Context, key watchKey) ([]string, time.Duration, error) {
+	m, err := r.Query(ctx, key.name, key.qtype)
+	if errors.Is(err, ErrNoData) {
+		return []string{}, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	records := []string{}
+	var ttl uint32
+	for _, rr := range m.Answers {
+		if rr.Type != key.qtype && key.qtype != TypeANY {
+			continue
+		}
+		if records = append(records, rrValue(rr)); len(records) == 1 || rr.TTL < ttl {
+			ttl = rr.TTL
+		}
+	}
+	sort.Strings(records)
+
+	return records, time.Duration(ttl) * time.Second, nil
+}
+
+func rrValue(rr RR) string {
+	switch rr.Type {
+	case TypeA, TypeAAAA:
+		return rr.IP.String()
+	case TypeMX:
+		return strconv.Itoa(int(rr.Pref)) + ` ` + rr.Target
+	case TypeSRV:
+		return strconv.Itoa(int(rr.Pref)) + ` ` + strconv.Itoa(int(rr.Weight)) + ` ` + strconv.Itoa(int(rr.Port)) + ` ` + rr.Target
+	case TypeTXT:
+		return strings.Join(rr.Text, ``)
+	case TypeCNAME, TypeNS, TypePTR:
+		return rr.Target
+	}
+
+	return hex.EncodeToString(rr.Data)
+}
+
+func sameRecords(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// diffRecords returns what b has that a has not and the other way round,
+// both sorted.
+func diffRecords(a, b []string) (added, removed []string) {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || i < len(a) && a[i] < b[j]:
+			removed = append(removed, a[i])
+			i++
+		case i == len(a) || b[j] < a[i]:
+			added = append(added, b[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+
+	return added, removed
+}
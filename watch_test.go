@@ -0,0 +1,107 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	var mu sync.Mutex
+	ips := []string{`192.0.2.1`, `192.0.2.2`}
+	gone := false
+	server := newTestServer(t, func(q Question, resp *Message) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if gone {
+			resp.Rcode = RcodeNameError
+			return
+		}
+		for _, ip := range ips {
+			resp.Answers = append(resp.Answers, RR{Name: q.Name, Type: TypeA, IP: net.ParseIP(ip)})
+		}
+	})
+	set := func(list []string, nx bool) {
+		mu.Lock()
+		ips, gone = list, nx
+		mu.Unlock()
+	}
+
+	r := New()
+	r.RetrySleep = 0
+	_, _ = r.LoadServersFromString(server.Addr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a, err := r.Watch(ctx, `svc.example.com`, TypeA, time.Millisecond*10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := r.Watch(ctx, `SVC.example.com.`, TypeA, time.Hour)
+
+	next := func(ch <-chan WatchUpdate) WatchUpdate {
+		select {
+		case u := <-ch:
+			return u
+		case <-time.After(time.Second):
+			t.Fatal(`no update`)
+		}
+		return WatchUpdate{}
+	}
+
+	for _, ch := range []<-chan WatchUpdate{a, b} {
+		if u := next(ch); u.Err != nil || len(u.Records) != 2 || len(u.Added) != 2 || len(u.Removed) != 0 {
+			t.Errorf(`unexpected first update %+v`, u)
+		}
+	}
+	r.watches.mu.Lock()
+	if n := len(r.watches.watchers); n != 1 {
+		t.Errorf(`expected the watches to share a watcher, got %d`, n)
+	}
+	r.watches.mu.Unlock()
+
+	set([]string{`192.0.2.2`, `192.0.2.3`}, false)
+	for _, ch := range []<-chan WatchUpdate{a, b} {
+		u := next(ch)
+		if u.Err != nil || len(u.Added) != 1 || u.Added[0] != `192.0.2.3` || len(u.Removed) != 1 || u.Removed[0] != `192.0.2.1` {
+			t.Errorf(`unexpected change %+v`, u)
+		}
+	}
+
+	// a failure is an update, the watch goes on and tells of the recovery
+	set([]string{`192.0.2.2`, `192.0.2.3`}, true)
+	if u := next(a); !errors.Is(u.Err, ErrNoSuchHost) || len(u.Records) != 2 {
+		t.Errorf(`expected a failure with the last records, got %+v`, u)
+	}
+	set([]string{`192.0.2.2`, `192.0.2.3`}, false)
+	for {
+		u := next(a)
+		if u.Err == nil {
+			if len(u.Records) != 2 || len(u.Added) != 0 || len(u.Removed) != 0 {
+				t.Errorf(`unexpected recovery %+v`, u)
+			}
+			break
+		}
+	}
+
+	cancel()
+	for _, ch := range []<-chan WatchUpdate{a, b} {
+		for range ch {
+		}
+	}
+	r.watches.mu.Lock()
+	if n := len(r.watches.watchers); n != 0 {
+		t.Errorf(`expected the watcher gone, got %d`, n)
+	}
+	r.watches.mu.Unlock()
+}
+
+func TestDiffRecords(t *testing.T) {
+	added, removed := diffRecords([]string{`a`, `b`, `d`}, []string{`b`, `c`, `d`, `e`})
+	if len(added) != 2 || added[0] != `c` || added[1] != `e` || len(removed) != 1 || removed[0] != `a` {
+		t.Errorf(`unexpected diff %v %v`, added, removed)
+	}
+}
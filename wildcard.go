@@ -0,0 +1,232 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// wildcardProbes is how many nonexistent names DetectWildcard asks for.
+	wildcardProbes = 4
+
+	// wildcardServers is how many distinct servers it spreads them over.
+	wildcardServers = 3
+)
+
+// WildcardInfo is the verdict of DetectWildcard on a domain. Wildcard is
+// set when most of the answered probes resolved, Addrs, Types and CNAMEs
+// are then what they resolved to, as sets in order. Probes are the names
+// asked, one server each.
+type WildcardInfo struct {
+	Domain   string
+	Wildcard bool
+	Addrs    []net.IP
+	Types    []Type
+	CNAMEs   []string
+	Probes   []WildcardProbe
+}
+
+// WildcardProbe is the answer of Server for the A and AAAA records of Name,
+// a random label under the domain. Err is set when the server did not
+// answer either or failed with another code than NXDOMAIN.
+type WildcardProbe struct {
+	Name     string
+	Server   string
+	Resolved bool
+	Addrs    []net.IP
+	Err      error
+}
+
+// Matches reports whether the addresses are all wildcard addresses, so that
+// an enumeration can leave out the names resolving to nothing else.
+func (w *WildcardInfo) Matches(ips []net.IP) bool {
+	if !w.Wildcard || len(ips) == 0 {
+		return false
+	}
+	for _, ip := range ips {
+		if !containsIP(w.Addrs, ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// DetectWildcard tells whether domain has a wildcard record: it asks for
+// the addresses of random names under it, 16 random characters long so
+// that no real name is hit, from up to three distinct servers of the list
+// so that a server making up answers is outvoted. The servers are those of
+// the route of domain when there is one. Every probe is a lookup of its own,
+// under the domain policy, the rate limiters and MaxInFlight, a special-use
+// domain is not probed. It fails when no probe is answered, with the error
+// of the last one.
+func (r *Resolver) DetectWildcard(ctx context.Context, domain string) (*WildcardInfo, error) {
+	domain, _, err := r.hostName(`A`, domain, nil)
+	if err != nil {
+		return nil, err
+	}
+	if atomic.LoadInt32(&r.closed) != 0 {
+		return nil, &LookupError{Name: domain, Type: `A`, Err: ErrResolverClosed}
+	}
+	s := r.settings()
+	if !s.RelaxedNames {
+		if err := validateName(domain); err != nil {
+			return nil, &LookupError{Name: domain, Type: `A`, Err: err}
+		}
+	}
+	if err := r.checkDomain(domain); err != nil {
+		atomic.AddUint64(&r.stats.blocked, 1)
+		return nil, &LookupError{Name: domain, Type: `A`, Err: err}
+	}
+	if a, suffix := specialUse(&s, domain); a != SpecialUseSend {
+		return nil, &LookupError{Name: domain, Type: `A`, Err: &SpecialUseError{Name: domain, Suffix: suffix}}
+	}
+
+	pool := r.Servers
+	if rt := r.matchRoute(domain); rt != nil {
+		pool = rt.servers
+	}
+	var servers []string
+	for _, srv := range pool.All() {
+		if r.serverAllowed(srv.Addr) && r.health.healthy([]string{srv.Addr}) == 1 {
+			servers = append(servers, srv.Addr)
+		}
+	}
+	if len(servers) == 0 {
+		return nil, &LookupError{Name: domain, Type: `A`, Err: ErrServerListEmpty}
+	}
+	rand.Shuffle(len(servers), func(i, j int) { servers[i], servers[j] = servers[j], servers[i] })
+	if len(servers) > wildcardServers {
+		servers = servers[:wildcardServers]
+	}
+
+	info := &WildcardInfo{Domain: domain, Probes: make([]WildcardProbe, wildcardProbes)}
+	cnames := make([][]string, wildcardProbes)
+	types := make([][]Type, wildcardProbes)
+	var wg sync.WaitGroup
+	for i := range info.Probes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			info.Probes[i], cnames[i], types[i] = r.wildcardProbe(ctx, servers[i%len(servers)], nonceLabel()+`.`+domain)
+		}(i)
+	}
+	wg.Wait()
+
+	answered, resolved := 0, 0
+	var lastErr error
+	for _, p := range info.Probes {
+		switch {
+		case p.Err != nil:
+			lastErr = p.Err
+		case p.Resolved:
+			resolved++
+			fallthrough
+		default:
+			answered++
+		}
+	}
+	if answered == 0 {
+		return nil, &LookupError{Name: domain, Type: `A`, Tries: wildcardProbes, Err: lastErr}
+	}
+	if info.Wildcard = resolved*2 > answered; !info.Wildcard {
+		return info, nil
+	}
+
+	for i, p := range info.Probes {
+		if !p.Resolved {
+			continue
+		}
+		for _, ip := range p.Addrs {
+			if !containsIP(info.Addrs, ip) {
+				info.Addrs = append(info.Addrs, ip)
+			}
+		}
+		for _, target := range cnames[i] {
+			if !containsString(info.CNAMEs, target) {
+				info.CNAMEs = append(info.CNAMEs, target)
+			}
+		}
+		for _, t := range types[i] {
+			if !containsType(info.Types, t) {
+				info.Types = append(info.Types, t)
+			}
+		}
+	}
+	sort.Slice(info.Addrs, func(i, j int) bool { return bytes.Compare(info.Addrs[i].To16(), info.Addrs[j].To16()) < 0 })
+	sort.Strings(info.CNAMEs)
+	sort.Slice(info.Types, func(i, j int) bool { return info.Types[i] < info.Types[j] })
+
+	return info, nil
+}
+
+// wildcardProbe asks addr for the A and AAAA records of name, returning the
+// CNAME targets and the types of the records of the answers as well.
+func (r *Resolver) wildcardProbe(ctx context.Context, addr, name string) (p WildcardProbe, cnames []string, types []Type) {
+	p = WildcardProbe{Name: name, Server: addr}
+	err := r.attempt(`A`, name, func(ctx context.Context, addr, name string, _ *Settings) error {
+		answered := false
+		for _, qtype := range []Type{TypeA, TypeAAAA} {
+			m, err := r.exchange(ctx, addr, newQuery(name, qtype))
+			if err == nil && m.Rcode != RcodeSuccess && m.Rcode != RcodeNameError {
+				err = &ResponseError{Server: addr, Code: m.Rcode}
+			}
+			if err != nil {
+				p.Err = err
+				continue
+			}
+			answered = true
+			for _, rr := range m.Answers {
+				switch rr.Type {
+				case TypeA, TypeAAAA:
+					p.Addrs = append(p.Addrs, rr.IP)
+				case TypeCNAME:
+					cnames = append(cnames, nameKey(rr.Target))
+				}
+				if !containsType(types, rr.Type) {
+					types = append(types, rr.Type)
+				}
+			}
+		}
+		if answered {
+			p.Err = nil
+		}
+
+		return p.Err
+	}, nil, WithContext(ctx), WithServer(addr), withAbsolute(), WithSettings(func(s *Settings) { s.RetryLimit = 1 }))
+
+	var lookupErr *LookupError
+	if err != nil && p.Err == nil && errors.As(err, &lookupErr) {
+		// refused before the server was asked
+		p.Err = lookupErr.Err
+	}
+	p.Resolved = len(p.Addrs) > 0 || len(cnames) > 0
+
+	return p, cnames, types
+}
+
+func containsIP(list []net.IP, ip net.IP) bool {
+	for _, v := range list {
+		if v.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsType(list []Type, t Type) bool {
+	for _, v := range list {
+		if v == t {
+			return true
+		}
+	}
+
+	return false
+}
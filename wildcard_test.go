@@ -0,0 +1,147 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDetectWildcard(t *testing.T) {
+	honest := func(q Question, resp *Message) {
+		switch {
+		case strings.HasSuffix(q.Name, `.wild.example.`):
+			resp.Answers = []RR{{Name: q.Name, Type: TypeCNAME, TTL: 60, Target: `LB.wild.example.`}}
+			if q.Type == TypeA {
+				resp.Answers = append(resp.Answers, RR{Name: `lb.wild.example.`, Type: TypeA, TTL: 60, IP: net.ParseIP(`192.0.2.80`)})
+			}
+		default:
+			resp.Rcode = RcodeNameError
+		}
+	}
+	liar := func(q Question, resp *Message) {
+		if q.Type == TypeA {
+			resp.Answers = []RR{{Name: q.Name, Type: TypeA, TTL: 60, IP: net.ParseIP(`198.51.100.1`)}}
+		}
+	}
+
+	a, b := newTestServer(t, honest), newTestServer(t, honest)
+	r := New()
+	if _, err := r.LoadServersFromString(a.Addr + "\n" + b.Addr); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := r.DetectWildcard(context.Background(), `Wild.Example.`)
+	if err != nil || !info.Wildcard || len(info.Probes) != wildcardProbes {
+		t.Fatalf(`expected a wildcard, got %+v, %v`, info, err)
+	}
+	if !reflect.DeepEqual(info.Types, []Type{TypeA, TypeCNAME}) || !reflect.DeepEqual(info.CNAMEs, []string{`lb.wild.example`}) ||
+		len(info.Addrs) != 1 || !info.Addrs[0].Equal(net.ParseIP(`192.0.2.80`)) {
+		t.Errorf(`unexpected wildcard answer %+v`, info)
+	}
+	names := map[string]bool{}
+	for _, p := range info.Probes {
+		if names[p.Name] || !strings.HasSuffix(p.Name, `.wild.example`) || len(p.Name) != 16+len(`.wild.example`) {
+			t.Errorf(`unexpected probe name %s`, p.Name)
+		}
+		names[p.Name] = true
+	}
+	if !info.Matches([]net.IP{net.ParseIP(`192.0.2.80`)}) || info.Matches([]net.IP{net.ParseIP(`192.0.2.80`), net.ParseIP(`192.0.2.81`)}) {
+		t.Error(`expected only the wildcard addresses to match`)
+	}
+
+	// the server making up answers is outvoted
+	c := newTestServer(t, liar)
+	r.AddServer(c.Addr)
+	info, err = r.DetectWildcard(context.Background(), `plain.example`)
+	if err != nil || info.Wildcard || info.Matches([]net.IP{net.ParseIP(`198.51.100.1`)}) {
+		t.Errorf(`expected no wildcard, got %+v, %v`, info, err)
+	}
+	servers := map[string]bool{}
+	for _, p := range info.Probes {
+		servers[p.Server] = true
+	}
+	if len(servers) != 3 {
+		t.Errorf(`expected the probes spread over the three servers, got %v`, servers)
+	}
+
+	down := New()
+	down.DialTimeout = time.Millisecond * 100
+	_, _ = down.LoadServersFromString(`127.0.0.1:1`)
+	if _, err := down.DetectWildcard(context.Background(), `wild.example`); err == nil {
+		t.Error(`expected an error without any answer`)
+	}
+	if _, err := New().DetectWildcard(context.Background(), `wild.example`); !errors.Is(err, ErrServerListEmpty) {
+		t.Errorf(`expected ErrServerListEmpty, got %v`, err)
+	}
+}
+
+func TestDetectWildcardChecked(t *testing.T) {
+	wild := func(q Question, resp *Message) {
+		resp.Answers = []RR{{Name: q.Name, Type: TypeA, TTL: 60, IP: net.ParseIP(`192.0.2.80`)}}
+	}
+	a, b := newTestServer(t, wild), newTestServer(t, wild)
+	r := New()
+	if _, err := r.LoadServersFromString(a.Addr); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.SetDomainPolicy(nil, []string{`wild.example`}); err != nil {
+		t.Fatal(err)
+	}
+	var blocked *DomainBlockedError
+	if _, err := r.DetectWildcard(context.Background(), `wild.example`); !errors.As(err, &blocked) {
+		t.Errorf(`expected a *DomainBlockedError, got %v`, err)
+	}
+	_ = r.SetDomainPolicy(nil, nil)
+
+	r.SpecialUse = true
+	if _, err := r.DetectWildcard(context.Background(), `printer.local`); !errors.Is(err, ErrSpecialUse) {
+		t.Errorf(`expected ErrSpecialUse, got %v`, err)
+	}
+	if n := len(a.Queries()); n != 0 {
+		t.Errorf(`expected nothing sent, got %d queries`, n)
+	}
+
+	if err := r.AddRoute(`corp.example`, []string{b.Addr}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := r.DetectWildcard(context.Background(), `corp.example`)
+	if err != nil || !info.Wildcard {
+		t.Fatalf(`expected a wildcard, got %+v, %v`, info, err)
+	}
+	for _, p := range info.Probes {
+		if p.Server != b.Addr {
+			t.Errorf(`expected the probes sent on the route, got %s`, p.Server)
+		}
+	}
+
+	r.DomainQPS, r.DomainBurst, r.DomainFailFast = 0.001, 1, true
+	info, err = r.DetectWildcard(context.Background(), `other.example`)
+	limited := 0
+	for _, p := range info.Probes {
+		if errors.Is(p.Err, ErrDomainRateLimited) {
+			limited++
+		}
+	}
+	if err != nil || limited != wildcardProbes-1 {
+		t.Errorf(`expected all probes but one limited, got %d, %v`, limited, err)
+	}
+	r.DomainQPS = 0
+
+	r.MaxInFlight = 1
+	atomic.AddInt64(&r.stats.inFlight, 1)
+	if _, err := r.DetectWildcard(context.Background(), `wild.example`); !errors.Is(err, ErrResolverBusy) {
+		t.Errorf(`expected ErrResolverBusy, got %v`, err)
+	}
+	atomic.AddInt64(&r.stats.inFlight, -1)
+
+	r.Close()
+	if _, err := r.DetectWildcard(context.Background(), `wild.example`); !errors.Is(err, ErrResolverClosed) {
+		t.Errorf(`expected ErrResolverClosed, got %v`, err)
+	}
+}